@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v1"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	benchID     = "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	benchSecret = "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+)
+
+type benchResult struct {
+	ops     int
+	elapsed time.Duration
+}
+
+// Measures the throughput of signing and verifying requests with each digest, for a range of body sizes.
+func bench(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	digestList := fs.String("digests", strings.Join(signers.DigestNames(), ","), "comma separated digests to measure")
+	sizeList := fs.String("sizes", "0,1024,65536,1048576", "comma separated body sizes in bytes")
+	version := fs.Int("version", 2, "signature version")
+	duration := fs.Duration("duration", time.Second, "time spent measuring each digest and size")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	sizes := []int{}
+	for _, s := range strings.Split(*sizeList, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid body size %q", s)
+		}
+		sizes = append(sizes, n)
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "digest\tbody bytes\tops/s\tMB/s\t")
+	for _, name := range strings.Split(*digestList, ",") {
+		name = strings.TrimSpace(name)
+		digest, ok := signers.DigestByName(name)
+		if !ok {
+			return fmt.Errorf("unknown digest %s; known digests are %s", name, strings.Join(signers.DigestNames(), ", "))
+		}
+		for _, size := range sizes {
+			res, err := benchDigest(*version, digest, size, *duration)
+			if err != nil {
+				fmt.Fprintf(w, "%s\t%d\t%s\t\t\n", name, size, err)
+				continue
+			}
+			perSecond := float64(res.ops) / res.elapsed.Seconds()
+			fmt.Fprintf(w, "%s\t%d\t%.0f\t%.2f\t\n", name, size, perSecond, perSecond*float64(size)/1e6)
+		}
+	}
+	return w.Flush()
+}
+
+// Signs and verifies a request with a body of the given size for about the given duration.
+func benchDigest(version int, digest func() hash.Hash, size int, duration time.Duration) (benchResult, error) {
+	var signer signers.Signer
+	var err *signers.AuthenticationError
+	switch version {
+	case 1:
+		signer, err = v1.NewV1Signer(digest)
+	case 2:
+		signer, err = v2.NewV2Signer(digest)
+	default:
+		return benchResult{}, fmt.Errorf("unsupported version %d", version)
+	}
+	if err != nil {
+		return benchResult{}, err.ToError()
+	}
+	body := bytes.Repeat([]byte("a"), size)
+	authHeaders := map[string]string{
+		"id":    benchID,
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Benchmark",
+	}
+	res := benchResult{}
+	start := time.Now()
+	for res.elapsed < duration {
+		req, _ := http.NewRequest("POST", "http://example.com/resource?key=value", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		if err := signer.SignDirect(req, authHeaders, benchSecret); err != nil {
+			return res, err.ToError()
+		}
+		if err := signer.Check(req, benchSecret); err != nil {
+			return res, err.ToError()
+		}
+		res.ops++
+		res.elapsed = time.Since(start)
+	}
+	return res, nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBench(t *testing.T) {
+	var out bytes.Buffer
+	if err := bench([]string{"-digests", "sha1,sha256", "-sizes", "0,1024", "-duration", "1ms"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[4], "sha256") || !strings.Contains(lines[4], "1024") {
+		t.Errorf("Expected a row for each digest and size, got:\n%s", out.String())
+	}
+	if err := bench([]string{"-digests", "md4"}, &out); err == nil {
+		t.Error("Expected an unknown digest to be refused")
+	}
+}
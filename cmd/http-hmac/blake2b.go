@@ -0,0 +1,7 @@
+//go:build blake2b
+// +build blake2b
+
+package main
+
+// Makes BLAKE2b available to the bench command.
+import _ "github.com/acquia/http-hmac-go/contrib/blake2b"
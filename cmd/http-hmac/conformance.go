@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/nonce"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v1"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// A request sent by the conformance suite, and whether the target must accept it.
+type conformanceCase struct {
+	name   string
+	req    *http.Request
+	accept bool
+}
+
+type conformanceResult struct {
+	passed, failed, skipped int
+}
+
+// Runs the fixtures of the library as live requests against a server, reporting which it accepts.
+func conformance(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("conformance", flag.ContinueOnError)
+	target := fs.String("target", "", "base URL of the server under test")
+	version := fs.Int("version", 2, "signature version to test")
+	keystore := fs.String("keystore", "", "write the credentials of the vectors to this JSON keystore, for the server under test to load")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *target == "" && *keystore == "" {
+		return errors.New("a target or a keystore is required")
+	}
+	vectors, err := conformanceVectors(*version)
+	if err != nil {
+		return err
+	}
+	if *keystore != "" {
+		ks, err := conformanceKeys(vectors)
+		if err != nil {
+			return err
+		}
+		if err := ks.WriteFile(*keystore); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Wrote %d keys to %s\n", len(ks.Keys), *keystore)
+	}
+	if *target == "" {
+		return nil
+	}
+	u, err := url.Parse(*target)
+	if err != nil {
+		return err
+	}
+	res := runConformance(http.DefaultClient, u, vectors, stdout)
+	fmt.Fprintf(stdout, "%d passed, %d failed, %d skipped\n", res.passed, res.failed, res.skipped)
+	if res.failed > 0 {
+		return fmt.Errorf("%d requests were not handled as expected", res.failed)
+	}
+	return nil
+}
+
+// Returns the signature vectors of a version.
+func conformanceVectors(version int) ([]*signers.SignatureVector, error) {
+	all, err := signers.NewVectors(signers.Fixtures, signers.CompatFixtures)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*signers.SignatureVector{}
+	for _, v := range all.Signatures {
+		if v.Version == "v"+strconv.Itoa(version) {
+			ret = append(ret, v)
+		}
+	}
+	return ret, nil
+}
+
+// Collects the credentials of the vectors a server must accept.
+func conformanceKeys(vectors []*signers.SignatureVector) (*keys.KeyFile, error) {
+	ks := &keys.KeyFile{}
+	seen := map[string]string{}
+	for _, v := range vectors {
+		id := v.AuthParams["id"]
+		if v.Expectations.Error != "" || id == "" {
+			continue
+		}
+		if secret, ok := seen[id]; ok {
+			if secret != v.Secret {
+				return nil, fmt.Errorf("key %s has several secrets in the vectors", id)
+			}
+			continue
+		}
+		seen[id] = v.Secret
+		ks.Keys = append(ks.Keys, keys.Key{ID: id, Secret: v.Secret})
+	}
+	return ks, nil
+}
+
+func runConformance(client *http.Client, target *url.URL, vectors []*signers.SignatureVector, stdout io.Writer) conformanceResult {
+	res := conformanceResult{}
+	for _, v := range vectors {
+		cases, err := conformanceCases(target, v)
+		if err != nil {
+			fmt.Fprintf(stdout, "SKIP %s (%s): %s\n", v.Name, v.Version, err)
+			res.skipped++
+			continue
+		}
+		for _, c := range cases {
+			resp, err := client.Do(c.req)
+			if err != nil {
+				fmt.Fprintf(stdout, "FAIL %s: %s\n", c.name, err)
+				res.failed++
+				continue
+			}
+			resp.Body.Close()
+			// Only an authentication failure is a rejection, including malformed credentials answered with 400
+			// (see middleware.StandardStatuses): the target need not serve the paths of the vectors.
+			accepted := resp.StatusCode != http.StatusBadRequest && resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden
+			if accepted == c.accept {
+				fmt.Fprintf(stdout, "ok   %s (%d)\n", c.name, resp.StatusCode)
+				res.passed++
+				continue
+			}
+			expected := "rejected"
+			if c.accept {
+				expected = "accepted"
+			}
+			fmt.Fprintf(stdout, "FAIL %s: expected the request to be %s, got status %d\n", c.name, expected, resp.StatusCode)
+			res.failed++
+		}
+	}
+	return res
+}
+
+// Builds the requests of a vector: the vector itself, signed now for the target, and for vectors that must be
+// accepted, copies with a tampered signature and an expired timestamp that must be rejected.
+func conformanceCases(target *url.URL, v *signers.SignatureVector) ([]*conformanceCase, error) {
+	name := fmt.Sprintf("%s (%s)", v.Name, v.Version)
+	accept := v.Expectations.Error == ""
+	req, err := conformanceRequest(target, v, 0, false)
+	if err != nil {
+		// Vectors of invalid requests often cannot be produced by a conforming signer.
+		return nil, err
+	}
+	cases := []*conformanceCase{{name, req, accept}}
+	if !accept {
+		return cases, nil
+	}
+	if req, err = conformanceRequest(target, v, 0, true); err != nil {
+		return nil, err
+	}
+	cases = append(cases, &conformanceCase{name + " with a tampered signature", req, false})
+	if v.Version == "v2" {
+		if req, err = conformanceRequest(target, v, -time.Hour, false); err != nil {
+			return nil, err
+		}
+		cases = append(cases, &conformanceCase{name + " with an expired timestamp", req, false})
+	}
+	return cases, nil
+}
+
+// Builds and signs the request of a vector for the target. The timestamp keeps its offset from the system
+// time of the vector, shifted by skew, and v2 requests get a fresh nonce so that servers detecting replays
+// do not reject them.
+func conformanceRequest(target *url.URL, v *signers.SignatureVector, skew time.Duration, tampered bool) (*http.Request, error) {
+	vu, err := url.Parse(v.Request.URL)
+	if err != nil {
+		return nil, err
+	}
+	u := *target
+	u.Path = singleJoiningSlash(target.Path, vu.Path)
+	u.RawQuery = vu.RawQuery
+	req, err := http.NewRequest(v.Request.Method, u.String(), bytes.NewReader([]byte(v.Request.Body)))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range v.Request.Headers {
+		req.Header[k] = append([]string{}, vs...)
+	}
+	if ts := req.Header.Get("X-Authorization-Timestamp"); ts != "" {
+		t, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now().Add(skew).Unix()
+		req.Header.Set("X-Authorization-Timestamp", strconv.FormatInt(t-v.SystemTime+now, 10))
+	}
+
+	digest, ok := signers.DigestByName(v.Digest)
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest %s", v.Digest)
+	}
+	var signer signers.Signer
+	var serr *signers.AuthenticationError
+	params := signers.CopyAuthHeaders(v.AuthParams)
+	switch v.Version {
+	case "v1":
+		signer, serr = v1.NewV1Signer(digest)
+	case "v2":
+		signer, serr = v2.NewV2Signer(digest)
+		if _, ok := params["nonce"]; ok {
+			if params["nonce"], err = nonce.New(); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported version %s", v.Version)
+	}
+	if serr != nil {
+		return nil, serr.ToError()
+	}
+	sig, serr := signer.Sign(req, params, v.Secret)
+	if serr != nil {
+		return nil, serr.ToError()
+	}
+	if tampered {
+		sig = tamperSignature(sig)
+	}
+	auth, serr := signer.GenerateAuthorization(req, params, sig)
+	if serr != nil {
+		return nil, serr.ToError()
+	}
+	req.Header.Set("Authorization", auth)
+	return req, nil
+}
+
+// Changes the first character of a base64 signature.
+func tamperSignature(sig string) string {
+	if sig == "" {
+		return "AAAA"
+	}
+	c := byte('A')
+	if sig[0] == 'A' {
+		c = 'B'
+	}
+	return string(c) + sig[1:]
+}
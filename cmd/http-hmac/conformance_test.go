@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"github.com/acquia/http-hmac-go/middleware"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	vectors, err := conformanceVectors(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := conformanceKeys(vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := httptest.NewServer(middleware.New(ks).Handler(http.NotFoundHandler()))
+	defer api.Close()
+	target, _ := url.Parse(api.URL + "/base")
+	var out bytes.Buffer
+	res := runConformance(api.Client(), target, vectors, &out)
+	if res.failed != 0 || res.passed == 0 {
+		t.Errorf("Expected the middleware to conform, got %+v:\n%s", res, out.String())
+	}
+
+	// A server accepting anything fails the negative cases.
+	lax := httptest.NewServer(http.NotFoundHandler())
+	defer lax.Close()
+	target, _ = url.Parse(lax.URL)
+	out.Reset()
+	res = runConformance(lax.Client(), target, vectors, &out)
+	if res.failed == 0 || !strings.Contains(out.String(), "tampered signature: expected the request to be rejected") {
+		t.Errorf("Expected a server accepting every request to fail, got %+v:\n%s", res, out.String())
+	}
+}
+
+func TestConformanceKeystore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys.json")
+	var out bytes.Buffer
+	if err := conformance([]string{"-keystore", file}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "Wrote ") {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/acquia/http-hmac-go/keys"
+	"io"
+	"os"
+)
+
+// Generates a key ID and secret, printing them or adding them to a keystore.
+func keygen(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	length := fs.Int("length", 32, "secret length in bytes")
+	file := fs.String("keystore", "", "add the key to this JSON keystore, creating it if needed")
+	realm := fs.String("realm", "", "restrict the key to a realm in the keystore")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := keys.GenerateKeyID()
+	if err != nil {
+		return err
+	}
+	secret, err := keys.GenerateSecret(*length)
+	if err != nil {
+		return err
+	}
+	if *file != "" {
+		ks, err := keys.ReadKeyFile(*file)
+		if os.IsNotExist(err) {
+			ks, err = &keys.KeyFile{}, nil
+		}
+		if err != nil {
+			return err
+		}
+		ks.Keys = append(ks.Keys, keys.Key{ID: id, Secret: secret, Realm: *realm})
+		if err := ks.WriteFile(*file); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(stdout, "id: %s\nsecret: %s\n", id, secret)
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/acquia/http-hmac-go/keys"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeygen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keygen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys.json")
+	for i := 0; i < 2; i++ {
+		var out bytes.Buffer
+		if err := keygen([]string{"-length", "48", "-keystore", path, "-realm", "Plexus"}, &out); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), "secret: ") {
+			t.Error("Unexpected output: ", out.String())
+		}
+	}
+	ks, err := keys.ReadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.Keys) != 2 || ks.Keys[0].ID == ks.Keys[1].ID {
+		t.Fatalf("Expected two distinct keys in the keystore, got %v.", ks.Keys)
+	}
+	if b, _ := base64.StdEncoding.DecodeString(ks.Keys[0].Secret); len(b) != 48 {
+		t.Errorf("Expected a 48 byte secret, got %d bytes.", len(b))
+	}
+	if _, err := ks.GetSecret("Plexus", ks.Keys[1].ID); err != nil {
+		t.Error("Generated key not found in its realm: ", err.Message)
+	}
+	if _, err := ks.GetSecret("Pipet service", ks.Keys[1].ID); err == nil {
+		t.Error("Generated key found outside its realm.")
+	}
+	if err := keygen([]string{"-length", "8"}, ioutil.Discard); err == nil {
+		t.Error("Expected short secrets to be refused.")
+	}
+}
@@ -0,0 +1,58 @@
+// Command http-hmac provisions credentials for, and signs and verifies, HTTP HMAC requests.
+//
+// Usage:
+//
+//	http-hmac <command> [flags]
+//
+// Run a command with -h for its flags.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+type command struct {
+	summary string
+	run     func(args []string, stdout io.Writer) error
+}
+
+var commands = map[string]command{
+	"bench":        {"measure signing and verification throughput by digest", bench},
+	"conformance":  {"run the test vectors against a server", conformance},
+	"keygen":       {"generate a key ID and secret", keygen},
+	"proxy":        {"run a local proxy signing the requests it forwards", proxy},
+	"verify-proxy": {"run a reverse proxy verifying requests for a backend", verifyProxy},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: http-hmac <command> [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-14s %s\n", name, commands[name].summary)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "http-hmac: unknown command %q\n", os.Args[1])
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "http-hmac %s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
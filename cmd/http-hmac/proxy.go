@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/acquia/http-hmac-go/hmacclient"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+)
+
+// The environment variable the secret is read from if not given as a flag, keeping it out of process
+// listings.
+const secretEnv = "HTTP_HMAC_SECRET"
+
+type proxyConfig struct {
+	upstream *url.URL
+	id       string
+	secret   string
+	realm    string
+	version  int
+	headers  []string
+}
+
+// Runs a local proxy signing every request it forwards.
+func proxy(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("proxy", flag.ContinueOnError)
+	listen := fs.String("listen", "127.0.0.1:8080", "address to listen on")
+	upstream := fs.String("upstream", "", "URL of the API to forward to; without it, the proxy forwards plain HTTP requests to the host they are addressed to")
+	id := fs.String("id", "", "key ID")
+	secret := fs.String("secret", "", "secret; defaults to $"+secretEnv)
+	realm := fs.String("realm", "", "realm sent with v2 signatures")
+	version := fs.Int("version", 2, "signature version")
+	var headers stringList
+	fs.Var(&headers, "sign-header", "sign request headers matching this pattern, e.g. X-Custom-*; may be repeated")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg := proxyConfig{
+		id:      *id,
+		secret:  *secret,
+		realm:   *realm,
+		version: *version,
+		headers: headers,
+	}
+	if cfg.secret == "" {
+		cfg.secret = os.Getenv(secretEnv)
+	}
+	if cfg.id == "" || cfg.secret == "" {
+		return errors.New("a key ID and secret are required")
+	}
+	if *upstream != "" {
+		u, err := url.Parse(*upstream)
+		if err != nil {
+			return err
+		}
+		cfg.upstream = u
+	}
+	fmt.Fprintf(stdout, "Signing proxy listening on %s\n", *listen)
+	return http.ListenAndServe(*listen, newSigningProxy(cfg))
+}
+
+func newSigningProxy(cfg proxyConfig) http.Handler {
+	client := hmacclient.New(cfg.id, cfg.secret, cfg.version,
+		hmacclient.WithRealm(cfg.realm),
+		hmacclient.WithSignHeaders(cfg.headers...),
+		hmacclient.WithoutResponseVerification(),
+	)
+	rp := &httputil.ReverseProxy{
+		Transport: client.Transport,
+		Director: func(req *http.Request) {
+			if cfg.upstream != nil {
+				req.URL.Scheme = cfg.upstream.Scheme
+				req.URL.Host = cfg.upstream.Host
+				req.URL.Path = singleJoiningSlash(cfg.upstream.Path, req.URL.Path)
+				req.Host = cfg.upstream.Host
+			}
+			req.Header.Del("Proxy-Authorization")
+			req.Header.Del("Proxy-Connection")
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Tunnelled TLS cannot be signed.
+		if req.Method == http.MethodConnect || (cfg.upstream == nil && !req.URL.IsAbs()) {
+			http.Error(w, "http-hmac proxy: only plain HTTP requests can be signed; use -upstream for HTTPS APIs", http.StatusBadGateway)
+			return
+		}
+		rp.ServeHTTP(w, req)
+	})
+}
+
+func singleJoiningSlash(a string, b string) string {
+	switch {
+	case a == "" || a == "/":
+		return b
+	case b == "" || b == "/":
+		return a
+	case a[len(a)-1] == '/' && b[0] == '/':
+		return a + b[1:]
+	case a[len(a)-1] != '/' && b[0] != '/':
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// A flag that may be repeated.
+type stringList []string
+
+func (s *stringList) String() string {
+	return fmt.Sprint(*s)
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
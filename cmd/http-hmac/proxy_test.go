@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/middleware"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const (
+	testID     = "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	testSecret = "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+)
+
+func TestSigningProxy(t *testing.T) {
+	api := httptest.NewServer(middleware.New(keys.Static{testID: testSecret}).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.URL.Path + " " + string(body)))
+	})))
+	defer api.Close()
+	upstream, _ := url.Parse(api.URL + "/v1")
+
+	p := httptest.NewServer(newSigningProxy(proxyConfig{upstream: upstream, id: testID, secret: testSecret, realm: "Pipet service", version: 2}))
+	defer p.Close()
+	resp, err := http.Post(p.URL+"/tasks", "application/json", strings.NewReader(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != `/v1/tasks {"a":1}` {
+		t.Errorf("Expected the proxied request to be signed and accepted, got status %d: %s", resp.StatusCode, body)
+	}
+
+	// As a forward proxy.
+	forward := httptest.NewServer(newSigningProxy(proxyConfig{id: testID, secret: testSecret, version: 2}))
+	defer forward.Close()
+	proxyURL, _ := url.Parse(forward.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err = client.Get(api.URL + "/resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected the forwarded request to be signed and accepted, got status %d.", resp.StatusCode)
+	}
+}
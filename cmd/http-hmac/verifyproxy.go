@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/middleware"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type verifyProxyConfig struct {
+	upstream    *url.URL
+	keys        keys.Provider
+	idHeader    string
+	realmHeader string
+}
+
+// Runs a reverse proxy verifying requests before forwarding them to an upstream.
+func verifyProxy(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("verify-proxy", flag.ContinueOnError)
+	listen := fs.String("listen", "127.0.0.1:8080", "address to listen on")
+	upstream := fs.String("upstream", "", "URL of the backend to forward verified requests to")
+	keystore := fs.String("keystore", "", "JSON keystore with the accepted keys")
+	idHeader := fs.String("id-header", "X-Hmac-Key-Id", "header passing the verified key ID upstream")
+	realmHeader := fs.String("realm-header", "X-Hmac-Realm", "header passing the verified realm upstream")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *upstream == "" || *keystore == "" {
+		return errors.New("an upstream and a keystore are required")
+	}
+	u, err := url.Parse(*upstream)
+	if err != nil {
+		return err
+	}
+	ks, err := keys.ReadKeyFile(*keystore)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Verifying proxy listening on %s, forwarding to %s\n", *listen, u)
+	return http.ListenAndServe(*listen, newVerifyingProxy(verifyProxyConfig{
+		upstream:    u,
+		keys:        ks,
+		idHeader:    *idHeader,
+		realmHeader: *realmHeader,
+	}))
+}
+
+func newVerifyingProxy(cfg verifyProxyConfig) http.Handler {
+	rp := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = cfg.upstream.Scheme
+			req.URL.Host = cfg.upstream.Host
+			req.URL.Path = singleJoiningSlash(cfg.upstream.Path, req.URL.Path)
+			for name := range req.Header {
+				if strings.HasPrefix(strings.ToLower(name), "x-authorization-") {
+					req.Header.Del(name)
+				}
+			}
+			req.Header.Del("Authorization")
+			if identity, ok := middleware.FromContext(req.Context()); ok {
+				req.Header.Set(cfg.idHeader, identity.KeyID)
+				req.Header.Set(cfg.realmHeader, identity.Realm)
+				req.Header.Set("X-Hmac-Version", strconv.Itoa(identity.Version))
+			}
+		},
+	}
+	verified := middleware.New(cfg.keys).Handler(rp)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Identity headers only ever come from the proxy.
+		req.Header.Del(cfg.idHeader)
+		req.Header.Del(cfg.realmHeader)
+		req.Header.Del("X-Hmac-Version")
+		verified.ServeHTTP(w, req)
+	})
+}
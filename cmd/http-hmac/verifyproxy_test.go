@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/acquia/http-hmac-go/hmacclient"
+	"github.com/acquia/http-hmac-go/keys"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestVerifyingProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Hmac-Key-Id") + "|" + r.Header.Get("X-Hmac-Realm") + "|" + r.Header.Get("Authorization")))
+	}))
+	defer backend.Close()
+	upstream, _ := url.Parse(backend.URL)
+	ks := &keys.KeyFile{Keys: []keys.Key{{ID: testID, Secret: testSecret}}}
+	p := httptest.NewServer(newVerifyingProxy(verifyProxyConfig{upstream: upstream, keys: ks, idHeader: "X-Hmac-Key-Id", realmHeader: "X-Hmac-Realm"}))
+	defer p.Close()
+
+	client := hmacclient.New(testID, testSecret, 2, hmacclient.WithRealm("Pipet service"), hmacclient.WithoutResponseVerification())
+	req, _ := http.NewRequest("GET", p.URL+"/resource", nil)
+	req.Header.Set("X-Hmac-Realm", "spoofed")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != testID+"|Pipet service|" {
+		t.Errorf("Expected the backend to receive the verified identity only, got status %d: %s", resp.StatusCode, body)
+	}
+
+	req, _ = http.NewRequest("GET", p.URL+"/resource", nil)
+	req.Header.Set("X-Hmac-Key-Id", testID)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 403 {
+		t.Errorf("Expected unsigned request to be rejected, got status %d.", resp.StatusCode)
+	}
+}
@@ -0,0 +1,107 @@
+//go:build awskms
+// +build awskms
+
+package awskms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"net/http"
+	"testing"
+)
+
+const testSecret = "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+
+// Holds HMAC keys by key ID and answers like KMS does.
+type fakeKMS struct {
+	keys map[string][]byte
+}
+
+func (f *fakeKMS) mac(keyID *string, algorithm types.MacAlgorithmSpec, message []byte) ([]byte, error) {
+	key, ok := f.keys[aws.ToString(keyID)]
+	if !ok {
+		return nil, &types.NotFoundException{Message: aws.String("no such key")}
+	}
+	if algorithm != types.MacAlgorithmSpecHmacSha256 {
+		return nil, &types.InvalidKeyUsageException{Message: aws.String("unsupported algorithm")}
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(message)
+	return h.Sum(nil), nil
+}
+
+func (f *fakeKMS) GenerateMac(ctx context.Context, params *kms.GenerateMacInput, optFns ...func(*kms.Options)) (*kms.GenerateMacOutput, error) {
+	mac, err := f.mac(params.KeyId, params.MacAlgorithm, params.Message)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateMacOutput{Mac: mac, KeyId: params.KeyId, MacAlgorithm: params.MacAlgorithm}, nil
+}
+
+func (f *fakeKMS) VerifyMac(ctx context.Context, params *kms.VerifyMacInput, optFns ...func(*kms.Options)) (*kms.VerifyMacOutput, error) {
+	mac, err := f.mac(params.KeyId, params.MacAlgorithm, params.Message)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, params.Mac) {
+		return nil, &types.KMSInvalidMacException{Message: aws.String("invalid MAC")}
+	}
+	return &kms.VerifyMacOutput{MacValid: true, KeyId: params.KeyId, MacAlgorithm: params.MacAlgorithm}, nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	key, _ := signers.Base64Secret(testSecret)
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+
+	remote, _ := v2.NewV2Signer(sha256.New)
+	remote.Backend = New(&fakeKMS{keys: map[string][]byte{"alias/hmac": key.Bytes()}})
+	local, _ := v2.NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	if err := remote.SignDirect(req, authHeaders, "alias/hmac"); err != nil {
+		t.Fatal("Failed to sign through KMS: ", err.Message)
+	}
+	if err := local.Check(req, testSecret); err != nil {
+		t.Error("Signature computed by KMS does not verify locally: ", err.Message)
+	}
+	if err := remote.Check(req, "alias/hmac"); err != nil {
+		t.Error("KMS fails to verify its own signature: ", err.Message)
+	}
+	req.Header.Set("X-Authorization-Timestamp", "1432075983")
+	if err := remote.Check(req, "alias/hmac"); err == nil || err.ErrorType != signers.ErrorTypeSignatureMismatch {
+		t.Error("Expected an invalid MAC to be reported as a signature mismatch.")
+	}
+	if err := remote.Check(req, "alias/missing"); err == nil || err.ErrorType != signers.ErrorTypeInternalError {
+		t.Error("Expected KMS failures to be reported as internal errors.")
+	}
+}
+
+func TestVerifyMACErrors(t *testing.T) {
+	b := New(&fakeKMS{keys: map[string][]byte{"alias/hmac": []byte("key")}})
+	mac, err := b.GenerateMAC(context.Background(), "alias/hmac", []byte("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid, err := b.VerifyMAC(context.Background(), "alias/hmac", []byte("message"), mac); !valid || err != nil {
+		t.Error("Expected the MAC to verify, got ", valid, err)
+	}
+	if valid, err := b.VerifyMAC(context.Background(), "alias/hmac", []byte("other"), mac); valid || err != nil {
+		t.Error("Expected a mismatching MAC to be invalid without an error, got ", valid, err)
+	}
+	var notFound *types.NotFoundException
+	if _, err := b.VerifyMAC(context.Background(), "alias/missing", []byte("message"), mac); !errors.As(err, &notFound) {
+		t.Error("Expected other KMS errors to be returned, got ", err)
+	}
+}
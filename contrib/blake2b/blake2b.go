@@ -0,0 +1,31 @@
+//go:build blake2b
+// +build blake2b
+
+// Package blake2b registers the BLAKE2b hash functions, as blake2b-256 and blake2b-512, for tools selecting
+// digests by name, such as http-hmac bench. Import it for its side effect; build with the blake2b tag. It
+// requires golang.org/x/crypto/blake2b. BLAKE2b is not part of the specification and is never approved in
+// FIPS mode: only use it between parties that agreed on it.
+package blake2b
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"golang.org/x/crypto/blake2b"
+	"hash"
+)
+
+func init() {
+	signers.RegisterDigest("blake2b-256", New256)
+	signers.RegisterDigest("blake2b-512", New512)
+}
+
+// New256 returns an unkeyed BLAKE2b-256 hash, for use with HMAC.
+func New256() hash.Hash {
+	h, _ := blake2b.New256(nil)
+	return h
+}
+
+// New512 returns an unkeyed BLAKE2b-512 hash, for use with HMAC.
+func New512() hash.Hash {
+	h, _ := blake2b.New512(nil)
+	return h
+}
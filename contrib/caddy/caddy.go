@@ -0,0 +1,165 @@
+//go:build caddy
+// +build caddy
+
+// Package caddy provides a Caddy v2 HTTP handler module, http.handlers.http_hmac, enforcing HTTP HMAC
+// signatures at the edge with the verification middleware. Build Caddy with the caddy tag, e.g.
+// xcaddy build --with github.com/acquia/http-hmac-go/contrib/caddy; it requires
+// github.com/caddyserver/caddy/v2. In a Caddyfile:
+//
+//	http_hmac {
+//		keystore /etc/hmac/keys.json
+//		realm Plexus /etc/hmac/plexus.json
+//		tolerance 5m
+//		require_headers Plexus X-Tenant
+//	}
+//
+// Keystores use the keys.KeyFile format. Realms with a keystore of their own are isolated from the
+// default one.
+package caddy
+
+import (
+	"fmt"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/middleware"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/compat"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"net/http"
+	"time"
+)
+
+func init() {
+	caddy.RegisterModule(Handler{})
+	httpcaddyfile.RegisterHandlerDirective("http_hmac", parseCaddyfile)
+}
+
+// Handler verifies requests before passing them on to the next handler.
+type Handler struct {
+	// Keystore of the keys accepted in every realm without a keystore of its own.
+	Keystore string `json:"keystore,omitempty"`
+	// Keystores by realm.
+	Realms map[string]string `json:"realms,omitempty"`
+	// Maximum distance of v2 timestamps from the current time. Defaults to 15 minutes.
+	Tolerance caddy.Duration `json:"tolerance,omitempty"`
+	// Headers that must be signed, by realm. The empty realm applies to realms not listed.
+	RequiredHeaders map[string][]string `json:"required_headers,omitempty"`
+
+	m *middleware.Middleware
+}
+
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.http_hmac",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+func (h *Handler) Provision(ctx caddy.Context) error {
+	providers := keys.Realms{}
+	if h.Keystore != "" {
+		ks, err := keys.ReadKeyFile(h.Keystore)
+		if err != nil {
+			return fmt.Errorf("loading keystore: %w", err)
+		}
+		providers[""] = ks
+	}
+	for realm, path := range h.Realms {
+		ks, err := keys.ReadKeyFile(path)
+		if err != nil {
+			return fmt.Errorf("loading keystore of realm %s: %w", realm, err)
+		}
+		providers[realm] = ks
+	}
+	options := []middleware.Option{}
+	for realm, headers := range h.RequiredHeaders {
+		options = append(options, middleware.WithRequiredHeaders(realm, headers...))
+	}
+	h.m = middleware.New(providers, options...)
+	if h.Tolerance != 0 {
+		identifier := compat.NewSupportedSignatureIdentifier()
+		if signer, ok := identifier.GetSigner(2).(*v2.V2Signer); ok {
+			signer.Timestamps = &signers.TimestampValidator{Tolerance: time.Duration(h.Tolerance)}
+		}
+		h.m.Identifier = identifier
+	}
+	return nil
+}
+
+func (h *Handler) Validate() error {
+	if h.Keystore == "" && len(h.Realms) == 0 {
+		return fmt.Errorf("http_hmac: a keystore is required")
+	}
+	if h.Tolerance < 0 {
+		return fmt.Errorf("http_hmac: tolerance must not be negative")
+	}
+	return nil
+}
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	var err error
+	h.m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err = next.ServeHTTP(w, r)
+	})).ServeHTTP(w, r)
+	return err
+}
+
+func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "keystore":
+				if !d.Args(&h.Keystore) {
+					return d.ArgErr()
+				}
+			case "realm":
+				var realm, path string
+				if !d.Args(&realm, &path) {
+					return d.ArgErr()
+				}
+				if h.Realms == nil {
+					h.Realms = map[string]string{}
+				}
+				h.Realms[realm] = path
+			case "tolerance":
+				var value string
+				if !d.Args(&value) {
+					return d.ArgErr()
+				}
+				tolerance, err := caddy.ParseDuration(value)
+				if err != nil {
+					return d.Errf("invalid tolerance: %v", err)
+				}
+				h.Tolerance = caddy.Duration(tolerance)
+			case "require_headers":
+				args := d.RemainingArgs()
+				if len(args) < 2 {
+					return d.ArgErr()
+				}
+				if h.RequiredHeaders == nil {
+					h.RequiredHeaders = map[string][]string{}
+				}
+				h.RequiredHeaders[args[0]] = append(h.RequiredHeaders[args[0]], args[1:]...)
+			default:
+				return d.Errf("unknown subdirective %s", d.Val())
+			}
+		}
+	}
+	return nil
+}
+
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var handler Handler
+	err := handler.UnmarshalCaddyfile(h.Dispenser)
+	return handler, err
+}
+
+var (
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddy.Validator             = (*Handler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+	_ caddyfile.Unmarshaler       = (*Handler)(nil)
+)
@@ -0,0 +1,89 @@
+//go:build caddy
+// +build caddy
+
+package caddy
+
+import (
+	"crypto/sha256"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testID     = "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	testSecret = "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+)
+
+func signedRequest(t *testing.T) *http.Request {
+	req := httptest.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	signer, _ := v2.NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":    testID,
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	if err := signer.SignDirect(req, authHeaders, testSecret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	return req
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keystore := filepath.Join(dir, "keys.json")
+	if err := (&keys.KeyFile{Keys: []keys.Key{{ID: testID, Secret: testSecret}}}).WriteFile(keystore); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &Handler{}
+	d := caddyfile.NewTestDispenser("http_hmac {\n\tkeystore " + keystore + "\n\ttolerance 1m\n}")
+	if err := h.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+	if h.Keystore != keystore || time.Duration(h.Tolerance) != time.Minute {
+		t.Fatalf("Unexpected configuration %+v", h)
+	}
+	if err := h.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	late := signedRequest(t)
+	called := false
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		called = true
+		return nil
+	})
+	rec := httptest.NewRecorder()
+	if err := h.ServeHTTP(rec, signedRequest(t), next); err != nil || !called || rec.Code != 200 {
+		t.Errorf("Expected the signed request to reach the next handler, got status %d, error %v", rec.Code, err)
+	}
+
+	called = false
+	signers.OverrideClock(1432075982 + 120)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, late, next)
+	if called || rec.Code != 403 || !strings.Contains(rec.Body.String(), "timestamp") {
+		t.Errorf("Expected a request beyond the tolerance to be rejected, got status %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,136 @@
+//go:build fasthttp || fiber
+// +build fasthttp fiber
+
+// Package fasthttp signs and verifies fasthttp requests and responses, for high-throughput proxies built
+// on github.com/valyala/fasthttp. Build with the fasthttp (or fiber) tag.
+//
+// The signers operate on net/http types, so each call builds a lightweight *http.Request view of the
+// fasthttp request: headers are copied, but the body is read in place rather than copied, and no
+// connection, context or server state is converted.
+package fasthttp
+
+import (
+	"bytes"
+	"github.com/acquia/http-hmac-go/middleware"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/valyala/fasthttp"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// Sign signs req with signer like SignDirect does, setting the headers the signer adds, such as
+// Authorization and X-Authorization-Timestamp, on req.
+func Sign(signer signers.Signer, req *fasthttp.Request, authHeaders map[string]string, secret string) *signers.AuthenticationError {
+	view, err := Request(req)
+	if err != nil {
+		return err
+	}
+	before := view.Header.Clone()
+	if err := signer.SignDirect(view, authHeaders, secret); err != nil {
+		return err
+	}
+	for name, values := range view.Header {
+		if len(values) > 0 && (len(before[name]) == 0 || before[name][0] != values[0]) {
+			req.Header.Set(name, values[0])
+		}
+	}
+	return nil
+}
+
+// Verify verifies req like Middleware.Verify, with the middleware's identifier, key provider, nonce store,
+// body limits and required headers, and returns the identity it was signed with.
+func Verify(m *middleware.Middleware, req *fasthttp.Request) (*middleware.Identity, *signers.AuthenticationError) {
+	view, err := Request(req)
+	if err != nil {
+		return nil, err
+	}
+	return m.Verify(view)
+}
+
+// SignResponse signs resp as the response to req with the response signer of signer. Fails for signers
+// without one, such as v1.
+func SignResponse(signer signers.Signer, req *fasthttp.Request, resp *fasthttp.Response, secret string) *signers.AuthenticationError {
+	rs := signer.GetResponseSigner()
+	if rs == nil {
+		return signers.Errorf(500, signers.ErrorTypeInternalError, "Signer does not support response signatures.")
+	}
+	view, err := Request(req)
+	if err != nil {
+		return err
+	}
+	// The status code and headers are covered by extended v2 signatures.
+	rw := signers.NewDummySignableResponseWriter(resp.Body())
+	resp.Header.VisitAll(func(k, v []byte) {
+		rw.Header().Add(string(k), string(v))
+	})
+	rw.WriteHeader(resp.StatusCode())
+	if err := rs.SignResponseDirect(view, rw, secret); err != nil {
+		return err
+	}
+	// Only the signature and the headers added by the signer are copied back, leaving repeated headers of
+	// resp intact.
+	for name, values := range rw.Header() {
+		if len(values) > 0 && (name == "X-Server-Authorization-Hmac-Sha256" || len(resp.Header.Peek(name)) == 0) {
+			resp.Header.Set(name, values[0])
+		}
+	}
+	return nil
+}
+
+// CheckResponse checks the signature of resp, received in response to req.
+func CheckResponse(signer signers.Signer, req *fasthttp.Request, resp *fasthttp.Response, secret string) *signers.AuthenticationError {
+	rs := signer.GetResponseSigner()
+	if rs == nil {
+		return signers.Errorf(500, signers.ErrorTypeInternalError, "Signer does not support response signatures.")
+	}
+	view, err := Request(req)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	resp.Header.VisitAll(func(k, v []byte) {
+		header.Add(string(k), string(v))
+	})
+	return rs.Check(view, &http.Response{
+		StatusCode:    resp.StatusCode(),
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(resp.Body())),
+		ContentLength: int64(len(resp.Body())),
+		Request:       view,
+	}, secret)
+}
+
+// Request returns the *http.Request view of req the signers work on. The view reads the body of req; it
+// must not be used after req is released.
+func Request(req *fasthttp.Request) (*http.Request, *signers.AuthenticationError) {
+	u, err := url.Parse(string(req.URI().FullURI()))
+	if err != nil {
+		return nil, signers.Errorf(400, signers.ErrorTypeInvalidRequiredHeader, "Invalid request URI: %w", err)
+	}
+	header := http.Header{}
+	req.Header.VisitAll(func(k, v []byte) {
+		if name := http.CanonicalHeaderKey(string(k)); name != "Host" {
+			header.Add(name, string(v))
+		}
+	})
+	body := req.Body()
+	getBody := func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	rc, _ := getBody()
+	return &http.Request{
+		Method:        string(req.Header.Method()),
+		URL:           u,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          rc,
+		GetBody:       getBody,
+		ContentLength: int64(len(body)),
+		Host:          string(req.Host()),
+		RequestURI:    string(req.RequestURI()),
+	}, nil
+}
@@ -0,0 +1,90 @@
+//go:build fasthttp || fiber
+// +build fasthttp fiber
+
+package fasthttp
+
+import (
+	"crypto/sha256"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/middleware"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v1"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"github.com/valyala/fasthttp"
+	"testing"
+)
+
+const (
+	testID     = "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	testSecret = "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+)
+
+func signedRequest(t *testing.T, signer signers.Signer) *fasthttp.Request {
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI("http://example.acquiapipet.net/v1.0/task")
+	req.Header.SetMethod("POST")
+	req.Header.SetContentType("application/json")
+	req.SetBodyString(`{"method":"hi.bob","params":["5","4","8"]}`)
+	authHeaders := map[string]string{
+		"id":    testID,
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	if err := Sign(signer, req, authHeaders, testSecret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	return req
+}
+
+func TestRoundTrip(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, _ := v2.NewV2Signer(sha256.New)
+	req := signedRequest(t, signer)
+	defer fasthttp.ReleaseRequest(req)
+	if len(req.Header.Peek("Authorization")) == 0 || len(req.Header.Peek("X-Authorization-Content-SHA256")) == 0 {
+		t.Fatal("Expected the signature headers to be set on the request, got ", req.Header.String())
+	}
+
+	m := middleware.New(keys.Static{testID: testSecret})
+	identity, err := Verify(m, req)
+	if err != nil {
+		t.Fatal("Signed request does not verify: ", err.Message)
+	}
+	if identity.KeyID != testID {
+		t.Error("Unexpected key ID ", identity.KeyID)
+	}
+	if _, err := Verify(m, req); err == nil || err.ErrorType != signers.ErrorTypeReplayedRequest {
+		t.Error("Expected a replayed request to be rejected.")
+	}
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	resp.SetStatusCode(201)
+	resp.SetBodyString(`{"id":133}`)
+	if err := SignResponse(signer, req, resp, testSecret); err != nil {
+		t.Fatal("Failed to sign response: ", err.Message)
+	}
+	if err := CheckResponse(signer, req, resp, testSecret); err != nil {
+		t.Error("Signed response does not verify: ", err.Message)
+	}
+	resp.SetBodyString(`{"id":134}`)
+	if err := CheckResponse(signer, req, resp, testSecret); err == nil || err.ErrorType != signers.ErrorTypeSignatureMismatch {
+		t.Error("Expected a tampered response to be rejected.")
+	}
+}
+
+func TestNoResponseSigner(t *testing.T) {
+	signer, _ := v1.NewV1Signer(sha256.New)
+	req := signedRequest(t, signer)
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	resp.SetBodyString("ok")
+	if err := SignResponse(signer, req, resp, testSecret); err == nil || err.ErrorType != signers.ErrorTypeInternalError {
+		t.Error("Expected signing a response with a signer without a response signer to fail.")
+	}
+	if err := CheckResponse(signer, req, resp, testSecret); err == nil || err.ErrorType != signers.ErrorTypeInternalError {
+		t.Error("Expected checking a response with a signer without a response signer to fail.")
+	}
+}
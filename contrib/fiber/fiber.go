@@ -0,0 +1,110 @@
+//go:build fiber
+// +build fiber
+
+// Package fiber provides a Fiber middleware verifying HTTP HMAC signatures, built on the fasthttp adapter.
+// Build with the fiber tag; it requires github.com/gofiber/fiber/v2 and github.com/valyala/fasthttp.
+//
+//	app.Use(fiber.New(provider, middleware.WithRequiredHeaders("", "Content-Type")))
+//	app.Get("/", func(c *gofiber.Ctx) error {
+//		identity, _ := fiber.Identity(c)
+//		...
+//	})
+package fiber
+
+import (
+	"bytes"
+	"github.com/acquia/http-hmac-go/contrib/fasthttp"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/middleware"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+)
+
+// IdentityKey is the key of the verified identity in the Locals of a request.
+const IdentityKey = "http-hmac-identity"
+
+// New returns a Fiber handler verifying requests like middleware.New(provider, options...) does. All
+// middleware options apply, including sessions, rate limits, authorizers, error responders and response
+// signing; the identity is stored in the request's Locals under IdentityKey.
+func New(provider keys.Provider, options ...middleware.Option) fiber.Handler {
+	return Wrap(middleware.New(provider, options...))
+}
+
+// Wrap returns a Fiber handler verifying requests with m.
+func Wrap(m *middleware.Middleware) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req, aerr := fasthttp.Request(c.Request())
+		if aerr != nil {
+			return fiber.NewError(aerr.HttpStatus, aerr.Message)
+		}
+		w := &responseWriter{header: http.Header{}}
+		var err error
+		passed := false
+		m.Handler(http.HandlerFunc(func(hw http.ResponseWriter, r *http.Request) {
+			identity, _ := middleware.FromContext(r.Context())
+			c.Locals(IdentityKey, identity)
+			if err = c.Next(); err != nil {
+				// Fiber's error handler writes the response; it is neither signed nor checked.
+				passed = true
+				return
+			}
+			// Hand the response to the middleware, which may sign it or replace it with an error. The headers
+			// come first, for extended signatures to cover them and Content-Type not to be sniffed.
+			resp := c.Response()
+			resp.Header.VisitAll(func(k, v []byte) {
+				if name := http.CanonicalHeaderKey(string(k)); name != "Content-Length" {
+					hw.Header().Add(name, string(v))
+				}
+			})
+			hw.WriteHeader(resp.StatusCode())
+			hw.Write(resp.Body())
+		})).ServeHTTP(w, req)
+		w.apply(c, passed)
+		return err
+	}
+}
+
+// Identity returns the identity of the verified request c belongs to.
+func Identity(c *fiber.Ctx) (*middleware.Identity, bool) {
+	identity, ok := c.Locals(IdentityKey).(*middleware.Identity)
+	return identity, ok && identity != nil
+}
+
+// Collects what the middleware writes, to be copied into the Fiber response.
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// Copies headers, e.g. session cookies and response signatures, into the Fiber response, followed by the
+// status and body unless the handler's error is left to Fiber.
+func (w *responseWriter) apply(c *fiber.Ctx, headersOnly bool) {
+	resp := c.Response()
+	for name, values := range w.header {
+		resp.Header.Del(name)
+		for _, value := range values {
+			resp.Header.Add(name, value)
+		}
+	}
+	if headersOnly || w.status == 0 {
+		return
+	}
+	resp.SetStatusCode(w.status)
+	resp.SetBody(w.body.Bytes())
+}
@@ -0,0 +1,109 @@
+//go:build fiber
+// +build fiber
+
+package fiber
+
+import (
+	"crypto/sha256"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/middleware"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"github.com/gofiber/fiber/v2"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testID     = "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	testSecret = "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+)
+
+func TestRoundTrip(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	app := fiber.New()
+	app.Use(New(keys.Static{testID: testSecret}, middleware.WithResponseSigning()))
+	app.Post("/v1.0/task", func(c *fiber.Ctx) error {
+		identity, ok := Identity(c)
+		if !ok {
+			return c.Status(500).SendString("no identity")
+		}
+		return c.Status(201).SendString(identity.KeyID)
+	})
+
+	req := httptest.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(`{"method":"hi.bob"}`))
+	req.Header.Set("Content-Type", "application/json")
+	signer, _ := v2.NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":    testID,
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	if err := signer.SignDirect(req, authHeaders, testSecret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 201 || string(body) != testID {
+		t.Fatalf("Expected the handler to get the identity, got status %d: %s", resp.StatusCode, body)
+	}
+	resp.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+	if err := v2.VerifyResponse(req, resp, testSecret); err != nil {
+		t.Error("Response signature does not verify: ", err.Message)
+	}
+
+	unsigned := httptest.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(`{}`))
+	resp, err = app.Test(unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Error("Expected an unsigned request to be rejected, got status ", resp.StatusCode)
+	}
+}
+
+func TestExtendedResponseSigning(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	app := fiber.New()
+	app.Use(New(keys.Static{testID: testSecret}, middleware.WithExtendedResponseSigning("Location", "Content-Type")))
+	app.Post("/v1.0/task", func(c *fiber.Ctx) error {
+		c.Set("Location", "/v1.0/task/134")
+		c.Set("Content-Type", "application/json")
+		return c.Status(201).SendString(`{"id":134}`)
+	})
+
+	req := httptest.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(`{"method":"hi.bob"}`))
+	req.Header.Set("Content-Type", "application/json")
+	signer, _ := v2.NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":    testID,
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	if err := signer.SignDirect(req, authHeaders, testSecret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 201 || resp.Header.Get("Content-Type") != "application/json" || resp.Header.Get("Location") != "/v1.0/task/134" {
+		t.Fatalf("Expected the handler's response, got status %d and headers %v: %s", resp.StatusCode, resp.Header, body)
+	}
+	resp.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+	rs := v2.NewV2ResponseSigner(sha256.New)
+	rs.Extended = true
+	rs.Headers = []string{"Location", "Content-Type"}
+	if err := rs.Check(req, resp, testSecret); err != nil {
+		t.Error("Extended response signature does not verify: ", err.Message)
+	}
+}
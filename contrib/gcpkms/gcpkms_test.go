@@ -0,0 +1,108 @@
+//go:build gcpkms
+// +build gcpkms
+
+package gcpkms
+
+import (
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"github.com/googleapis/gax-go/v2"
+	"net/http"
+	"testing"
+)
+
+const (
+	testSecret = "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	testKey    = "projects/p/locations/global/keyRings/r/cryptoKeys/hmac/cryptoKeyVersions/1"
+)
+
+// Holds HMAC keys by resource name and answers like Cloud KMS does, checksums included. If corrupt is set,
+// MACs are altered after their checksum is computed.
+type fakeKMS struct {
+	keys    map[string][]byte
+	corrupt bool
+}
+
+func (f *fakeKMS) mac(name string, data []byte) ([]byte, error) {
+	key, ok := f.keys[name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+func (f *fakeKMS) MacSign(ctx context.Context, req *kmspb.MacSignRequest, opts ...gax.CallOption) (*kmspb.MacSignResponse, error) {
+	mac, err := f.mac(req.Name, req.Data)
+	if err != nil {
+		return nil, err
+	}
+	resp := &kmspb.MacSignResponse{
+		Name:               req.Name,
+		Mac:                mac,
+		MacCrc32C:          checksum(mac),
+		VerifiedDataCrc32C: req.DataCrc32C.GetValue() == checksum(req.Data).GetValue(),
+	}
+	if f.corrupt {
+		resp.Mac = append([]byte{}, mac...)
+		resp.Mac[0] ^= 1
+	}
+	return resp, nil
+}
+
+func (f *fakeKMS) MacVerify(ctx context.Context, req *kmspb.MacVerifyRequest, opts ...gax.CallOption) (*kmspb.MacVerifyResponse, error) {
+	mac, err := f.mac(req.Name, req.Data)
+	if err != nil {
+		return nil, err
+	}
+	success := hmac.Equal(mac, req.Mac)
+	return &kmspb.MacVerifyResponse{
+		Name:                     req.Name,
+		Success:                  success,
+		VerifiedDataCrc32C:       req.DataCrc32C.GetValue() == checksum(req.Data).GetValue(),
+		VerifiedMacCrc32C:        req.MacCrc32C.GetValue() == checksum(req.Mac).GetValue(),
+		VerifiedSuccessIntegrity: success,
+	}, nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	key, _ := signers.Base64Secret(testSecret)
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+
+	remote, _ := v2.NewV2Signer(sha256.New)
+	remote.Backend = New(&fakeKMS{keys: map[string][]byte{testKey: key.Bytes()}})
+	local, _ := v2.NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	if err := remote.SignDirect(req, authHeaders, testKey); err != nil {
+		t.Fatal("Failed to sign through KMS: ", err.Message)
+	}
+	if err := local.Check(req, testSecret); err != nil {
+		t.Error("Signature computed by KMS does not verify locally: ", err.Message)
+	}
+	if err := remote.Check(req, testKey); err != nil {
+		t.Error("KMS fails to verify its own signature: ", err.Message)
+	}
+	req.Header.Set("X-Authorization-Timestamp", "1432075983")
+	if err := remote.Check(req, testKey); err == nil || err.ErrorType != signers.ErrorTypeSignatureMismatch {
+		t.Error("Expected an invalid MAC to be reported as a signature mismatch.")
+	}
+}
+
+func TestCorruption(t *testing.T) {
+	b := New(&fakeKMS{keys: map[string][]byte{testKey: []byte("key")}, corrupt: true})
+	if _, err := b.GenerateMAC(context.Background(), testKey, []byte("message")); err != errCorrupted {
+		t.Error("Expected a MAC not matching its checksum to be rejected, got ", err)
+	}
+}
@@ -0,0 +1,77 @@
+//go:build memguard
+// +build memguard
+
+// Package memguard provides a key provider keeping secrets in memguard enclaves: encrypted in memory, and
+// only decrypted into guarded, locked buffers for the duration of a verification. Build with the memguard
+// tag; it requires github.com/awnumar/memguard.
+package memguard
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/awnumar/memguard"
+	"sync"
+)
+
+// Provider implements keys.Provider and keys.SecretProvider. The verification middleware uses
+// GetSecretKey where the signer supports it; GetSecret copies the secret into a string and is only there
+// for signers and response signing that need one.
+type Provider struct {
+	mu       sync.RWMutex
+	enclaves map[string]*memguard.Enclave
+}
+
+func New() *Provider {
+	return &Provider{
+		enclaves: map[string]*memguard.Enclave{},
+	}
+}
+
+// Add seals key material for a key ID. The given slice is wiped.
+func (p *Provider) Add(id string, key []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.enclaves[id] = memguard.NewEnclave(key)
+}
+
+// AddEncoded decodes a secret, e.g. with signers.DecodeBase64, and seals it for a key ID.
+func (p *Provider) AddEncoded(id string, encoded string, decoder signers.SecretDecoder) *signers.AuthenticationError {
+	secret, err := signers.DecodeSecret(encoded, decoder)
+	if err != nil {
+		return err
+	}
+	p.Add(id, secret.Bytes())
+	return nil
+}
+
+func (p *Provider) open(id string) (*memguard.LockedBuffer, *signers.AuthenticationError) {
+	p.mu.RLock()
+	enclave, ok := p.enclaves[id]
+	p.mu.RUnlock()
+	if !ok {
+		return nil, signers.Errorf(403, signers.ErrorTypeUnknownKey, "Unknown key ID %s.", id)
+	}
+	buf, err := enclave.Open()
+	if err != nil {
+		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not open key enclave: %w", err)
+	}
+	return buf, nil
+}
+
+// GetSecretKey decrypts the secret into a locked buffer, which the returned function destroys.
+func (p *Provider) GetSecretKey(realm string, id string) (signers.Secret, func(), *signers.AuthenticationError) {
+	buf, err := p.open(id)
+	if err != nil {
+		return signers.Secret{}, nil, err
+	}
+	return signers.RawSecret(buf.Bytes()), buf.Destroy, nil
+}
+
+// GetSecret returns the secret base64 encoded, as v2 signers expect.
+func (p *Provider) GetSecret(realm string, id string) (string, *signers.AuthenticationError) {
+	buf, err := p.open(id)
+	if err != nil {
+		return "", err
+	}
+	defer buf.Destroy()
+	return signers.RawSecret(buf.Bytes()).Base64(), nil
+}
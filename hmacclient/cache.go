@@ -0,0 +1,126 @@
+package hmacclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/acquia/http-hmac-go/signers"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SignatureCache remembers the Authorization headers of signed requests, so that identical requests signed
+// within the same second, e.g. by tight polling loops, reuse them instead of computing the HMAC again.
+// Requests are identical if their method, URL, headers, body and credential are. The cache is emptied
+// whenever the clock ticks to the next second, as the timestamps signed change.
+//
+// Only signatures without a nonce, i.e. v1, are cached: a v2 signature covers a nonce unique to each
+// request, which servers reject when replayed. Requests with a body that has no GetBody are not cached.
+type SignatureCache struct {
+	// Maximum number of entries. Defaults to 1024; further requests are signed without being cached.
+	Size int
+
+	mu      sync.Mutex
+	second  int64
+	entries map[string]string
+}
+
+func (c *SignatureCache) size() int {
+	if c.Size <= 0 {
+		return 1024
+	}
+	return c.Size
+}
+
+func (c *SignatureCache) get(second int64, key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if second != c.second {
+		return "", false
+	}
+	auth, ok := c.entries[key]
+	return auth, ok
+}
+
+func (c *SignatureCache) put(second int64, key string, auth string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if second != c.second || c.entries == nil {
+		c.second = second
+		c.entries = map[string]string{}
+	}
+	if len(c.entries) < c.size() {
+		c.entries[key] = auth
+	}
+}
+
+// Reports whether the signatures of signer can be reused for identical requests.
+func cacheable(signer signers.RequestSigner) bool {
+	v, ok := signer.(interface{ Version() int })
+	return ok && v.Version() == 1
+}
+
+// Returns the cache key of a request about to be signed, or false if its body cannot be hashed without
+// consuming it.
+func cacheKey(req *http.Request, authHeaders map[string]string) (string, bool) {
+	h := sha256.New()
+	io.WriteString(h, req.Method+"\n"+req.Host+"\n"+req.URL.String()+"\n")
+	names := []string{}
+	for name := range req.Header {
+		if name != "Authorization" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		io.WriteString(h, name+": "+strings.Join(req.Header[name], ", ")+"\n")
+	}
+	for _, k := range []string{"id", "realm", "headers"} {
+		io.WriteString(h, k+"="+strconv.Quote(authHeaders[k])+"\n")
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return "", false
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return "", false
+		}
+		_, err = io.Copy(h, body)
+		body.Close()
+		if err != nil {
+			return "", false
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// Signs the request with Signer, through SignatureCache if set.
+func (t *Transport) sign(req *http.Request, authHeaders map[string]string) *signers.AuthenticationError {
+	if t.SignatureCache == nil || !cacheable(t.Signer) {
+		return t.Signer.SignDirect(req, authHeaders, t.Secret)
+	}
+	key, ok := cacheKey(req, authHeaders)
+	if !ok {
+		return t.Signer.SignDirect(req, authHeaders, t.Secret)
+	}
+	second := t.now().Unix()
+	if auth, ok := t.SignatureCache.get(second, key); ok {
+		req.Header.Set("Authorization", auth)
+		// A reused v1 signature is a use all the same, for deprecation hooks (see WithDeprecationHook).
+		if r, ok := t.Signer.(interface {
+			ReportSigned(req *http.Request, id string)
+		}); ok {
+			r.ReportSigned(req, authHeaders["id"])
+		}
+		return nil
+	}
+	if err := t.Signer.SignDirect(req, authHeaders, t.Secret); err != nil {
+		return err
+	}
+	t.SignatureCache.put(second, key, req.Header.Get("Authorization"))
+	return nil
+}
@@ -0,0 +1,199 @@
+package hmacclient
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"github.com/acquia/http-hmac-go/nonce"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v1"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"net/http"
+)
+
+// Option configures the Transport of a client created with New.
+type Option func(*Transport)
+
+// WithRealm sets the realm sent with v2 signatures.
+func WithRealm(realm string) Option {
+	return func(t *Transport) {
+		t.Realm = realm
+	}
+}
+
+// WithBase sets the RoundTripper the signed requests are sent through.
+func WithBase(base http.RoundTripper) Option {
+	return func(t *Transport) {
+		t.Base = base
+	}
+}
+
+// WithSignHeaders adds the request headers matching the patterns to the signed headers.
+func WithSignHeaders(patterns ...string) Option {
+	return func(t *Transport) {
+		t.SignHeaders = append(t.SignHeaders, patterns...)
+	}
+}
+
+// WithNonceSource sets the generator of the nonces sent with v2 signatures.
+func WithNonceSource(source nonce.Source) Option {
+	return func(t *Transport) {
+		t.NonceSource = source
+	}
+}
+
+// WithClock sets the source of the current time.
+func WithClock(clock signers.Clock) Option {
+	return func(t *Transport) {
+		t.Clock = clock
+	}
+}
+
+// WithoutClockCorrection disables retrying requests rejected because of clock skew.
+func WithoutClockCorrection() Option {
+	return func(t *Transport) {
+		t.CorrectClock = false
+	}
+}
+
+// WithoutResponseVerification accepts responses that are not signed.
+func WithoutResponseVerification() Option {
+	return func(t *Transport) {
+		t.VerifyResponses = false
+	}
+}
+
+// WithAuthorizationHeader sends v2 signatures in another header than Authorization, e.g.
+// X-Acquia-Authorization where intermediaries consume or strip the Authorization header.
+func WithAuthorizationHeader(name string) Option {
+	return func(t *Transport) {
+		if signer, ok := t.Signer.(*v2.V2Signer); ok {
+			signer.AuthorizationHeader = name
+		}
+	}
+}
+
+// WithOptionalRealm leaves the realm parameter out of v2 signatures when no realm is set, for servers
+// without realms (see middleware.WithOptionalRealm), instead of sending an empty one.
+func WithOptionalRealm() Option {
+	return func(t *Transport) {
+		if signer, ok := t.Signer.(*v2.V2Signer); ok {
+			signer.OptionalRealm = true
+		}
+	}
+}
+
+// WithProfile signs v2 requests as servers verifying with the profile expect (see middleware.WithProfile):
+// with v2.Strict, bodyless POST, PUT and PATCH requests carry the hash of the empty body.
+func WithProfile(p v2.Profile) Option {
+	return func(t *Transport) {
+		if signer, ok := t.Signer.(*v2.V2Signer); ok {
+			signer.Profile = p
+		}
+	}
+}
+
+// WithExtendedResponseSigning checks v2 response signatures covering the status code and the given headers
+// as well as the body, from servers using middleware.WithExtendedResponseSigning with the same headers.
+func WithExtendedResponseSigning(headers ...string) Option {
+	return func(t *Transport) {
+		if signer, ok := t.Signer.(*v2.V2Signer); ok {
+			rs := signer.GetResponseSigner().(*v2.V2ResponseSigner)
+			rs.Extended = true
+			rs.Headers = headers
+		}
+	}
+}
+
+// WithParamHeaders sends the parameters of v2 signatures in individual X-Authorization-* headers instead of
+// the Authorization header, for CDNs and WAFs that mangle it.
+func WithParamHeaders() Option {
+	return func(t *Transport) {
+		t.ParamHeaders = true
+	}
+}
+
+// WithDualSigning signs v2 requests with v1 as well, sending the v1 signature in header (see
+// Transport.DualHeader), while servers are upgraded. If v1 is unavailable, e.g. in FIPS mode, requests
+// fail with the reason.
+func WithDualSigning(header string) Option {
+	return func(t *Transport) {
+		signer, err := v1.NewV1Signer(sha1.New)
+		if err != nil {
+			t.Signer = failingSigner{err}
+			return
+		}
+		t.DualSigner = signer
+		t.DualHeader = header
+	}
+}
+
+// WithDeprecationHook calls hook whenever a request is signed with v1, including dual signatures, to
+// track the clients left to migrate.
+func WithDeprecationHook(hook signers.DeprecationHook) Option {
+	return func(t *Transport) {
+		for _, s := range []signers.RequestSigner{t.Signer, t.DualSigner} {
+			if signer, ok := s.(*v1.V1Signer); ok {
+				signer.OnUse = hook
+			}
+		}
+	}
+}
+
+// WithSignatureCache reuses the signatures of identical requests signed within the same second, for
+// polling loops. It only applies to v1 (see SignatureCache).
+func WithSignatureCache() Option {
+	return func(t *Transport) {
+		t.SignatureCache = &SignatureCache{}
+	}
+}
+
+type failingSigner struct {
+	err *signers.AuthenticationError
+}
+
+func (f failingSigner) SignDirect(req *http.Request, authHeaders map[string]string, secret string) *signers.AuthenticationError {
+	return f.err
+}
+
+// New returns a client signing its requests with the given key and signature version (1 or 2). Clock skew
+// is corrected, and with v2 responses must be signed, unless disabled by the options. If the signer cannot
+// be created, e.g. v1 in FIPS mode, every request made with the client fails with the reason.
+func New(id string, secret string, version int, options ...Option) *http.Client {
+	signer, err := newSigner(version)
+	if err != nil {
+		return &http.Client{Transport: failingTransport{err.ToError()}}
+	}
+	t := &Transport{
+		Signer:          signer,
+		ID:              id,
+		Secret:          secret,
+		CorrectClock:    true,
+		VerifyResponses: version == 2,
+	}
+	for _, option := range options {
+		option(t)
+	}
+	return &http.Client{Transport: t}
+}
+
+func newSigner(version int) (signers.RequestSigner, *signers.AuthenticationError) {
+	switch version {
+	case 1:
+		return v1.NewV1Signer(sha1.New)
+	case 2:
+		return v2.NewV2Signer(sha256.New)
+	}
+	return nil, signers.Errorf(500, signers.ErrorTypeUnknownSignatureType, "Unsupported signature version %d.", version)
+}
+
+type failingTransport struct {
+	err error
+}
+
+func (f failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, fmt.Errorf("hmacclient: %w", f.err)
+}
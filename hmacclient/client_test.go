@@ -0,0 +1,111 @@
+package hmacclient
+
+import (
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/middleware"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	hello := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	signing := middleware.New(keys.Static{testID: testSecret}, middleware.WithResponseSigning())
+	srv := httptest.NewServer(signing.Handler(hello))
+	defer srv.Close()
+
+	client := New(testID, testSecret, 2, WithRealm("Pipet service"))
+	resp, err := client.Get(srv.URL + "/resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != "hello" {
+		t.Errorf("Expected signed response to be accepted, got status %d and %q.", resp.StatusCode, body)
+	}
+
+	unsigned := httptest.NewServer(middleware.New(keys.Static{testID: testSecret}).Handler(hello))
+	defer unsigned.Close()
+	if _, err := client.Get(unsigned.URL + "/resource"); err == nil {
+		t.Error("Expected unsigned response to be rejected.")
+	}
+	client = New(testID, testSecret, 2, WithoutResponseVerification())
+	resp, err = client.Get(unsigned.URL + "/resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected request to be accepted without response verification, got status %d.", resp.StatusCode)
+	}
+
+	if _, err := New(testID, testSecret, 3).Get(srv.URL); err == nil {
+		t.Error("Expected client with an unsupported version to fail.")
+	}
+}
+
+func TestOptionalRealm(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(middleware.New(keys.Static{testID: testSecret}, middleware.WithOptionalRealm(), middleware.WithResponseSigning()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	})))
+	defer srv.Close()
+
+	resp, err := New(testID, testSecret, 2, WithOptionalRealm()).Get(srv.URL + "/resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || auth == "" || strings.Contains(auth, "realm") {
+		t.Errorf("Expected a signature without realm to be accepted, got status %d and %q.", resp.StatusCode, auth)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	srv := httptest.NewServer(middleware.New(keys.Static{testID: testSecret}, middleware.WithProfile(v2.Strict), middleware.WithResponseSigning()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer srv.Close()
+
+	resp, err := New(testID, testSecret, 2).Post(srv.URL+"/resource", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 403 {
+		t.Errorf("Expected a bodyless POST without content hash to be rejected by a strict server, got status %d.", resp.StatusCode)
+	}
+	resp, err = New(testID, testSecret, 2, WithProfile(v2.Strict)).Post(srv.URL+"/resource", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected a bodyless POST signed with the strict profile to be accepted, got status %d.", resp.StatusCode)
+	}
+}
+
+func TestExtendedResponseSigning(t *testing.T) {
+	srv := httptest.NewServer(middleware.New(keys.Static{testID: testSecret}, middleware.WithExtendedResponseSigning("Location")).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/resource/1")
+		w.WriteHeader(201)
+		w.Write([]byte("created"))
+	})))
+	defer srv.Close()
+
+	resp, err := New(testID, testSecret, 2, WithExtendedResponseSigning("Location")).Post(srv.URL+"/resource", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 201 {
+		t.Errorf("Expected the extended response signature to verify, got status %d.", resp.StatusCode)
+	}
+	if _, err := New(testID, testSecret, 2).Post(srv.URL+"/resource", "text/plain", strings.NewReader("hello")); err == nil {
+		t.Error("Expected an extended response signature to fail a client checking the body only.")
+	}
+}
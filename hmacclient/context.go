@@ -0,0 +1,53 @@
+package hmacclient
+
+import (
+	"context"
+)
+
+type contextKey int
+
+const (
+	realmKey contextKey = iota
+	signHeadersKey
+	nonceKey
+)
+
+// WithRequestRealm returns a copy of ctx overriding the realm of Transport for the requests made with it.
+// (WithRealm is the Option setting the realm of every request.)
+func WithRequestRealm(ctx context.Context, realm string) context.Context {
+	return context.WithValue(ctx, realmKey, realm)
+}
+
+// WithExtraSignedHeaders returns a copy of ctx adding header patterns, as in Transport.SignHeaders, to the
+// signed headers of the requests made with it. Patterns already in ctx are kept.
+func WithExtraSignedHeaders(ctx context.Context, patterns ...string) context.Context {
+	extra, _ := ctx.Value(signHeadersKey).([]string)
+	return context.WithValue(ctx, signHeadersKey, append(append([]string{}, extra...), patterns...))
+}
+
+// WithRequestNonce returns a copy of ctx making the requests made with it signed with the given nonce
+// instead of a generated one, e.g. nonce.Derive of an idempotency key, for the server to recognize
+// redeliveries (see middleware.Identity.Nonce). Only one request may be made with ctx within the replay window
+// of the server, as it rejects nonces it has seen, unless it deduplicates the request instead.
+func WithRequestNonce(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, nonceKey, nonce)
+}
+
+func nonceFromContext(ctx context.Context) (string, bool) {
+	n, ok := ctx.Value(nonceKey).(string)
+	return n, ok && n != ""
+}
+
+func realmFromContext(ctx context.Context, realm string) string {
+	if r, ok := ctx.Value(realmKey).(string); ok {
+		return r
+	}
+	return realm
+}
+
+func signHeadersFromContext(ctx context.Context, patterns []string) []string {
+	if extra, ok := ctx.Value(signHeadersKey).([]string); ok {
+		return append(append([]string{}, patterns...), extra...)
+	}
+	return patterns
+}
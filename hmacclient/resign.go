@@ -0,0 +1,53 @@
+package hmacclient
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Resigner is an http.RoundTripper for authenticated proxies and gateways: it strips the signature a
+// request was verified with and has Transport sign it again, e.g. with the credential of the next trust
+// domain. Use it as the Transport of an httputil.ReverseProxy behind the middleware.
+type Resigner struct {
+	Transport *Transport
+	// Headers carrying inbound signatures besides Authorization, X-Authorization-*, Signature and
+	// Signature-Input, e.g. X-Acquia-Authorization. They are stripped as well.
+	StripHeaders []string
+	// If set, adjusts the outgoing request, e.g. its host and headers, after the inbound signature was
+	// stripped and before it is signed. To sign for another host, set both URL.Host and Host. A body it
+	// replaces is buffered in memory to be hashed.
+	Rewrite func(req *http.Request)
+}
+
+// RoundTrip re-signs a copy of the request. The content hash and timestamp are recomputed, rather than
+// taken over from the inbound signature.
+func (r *Resigner) RoundTrip(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.RequestURI = ""
+	StripSignature(out.Header)
+	for _, name := range r.StripHeaders {
+		out.Header.Del(name)
+	}
+	if r.Rewrite != nil {
+		r.Rewrite(out)
+		if out.Body != req.Body {
+			// The content hash must be computed from the new body.
+			out.GetBody = nil
+		}
+	}
+	return r.Transport.RoundTrip(out)
+}
+
+// StripSignature removes the headers of the signature schemes of this module from h: Authorization,
+// X-Authorization-* (including the timestamp and content hash of v2), Signature, Signature-Input and the
+// body digests they cover, Content-Digest and Digest.
+func StripSignature(h http.Header) {
+	for name := range h {
+		if strings.HasPrefix(strings.ToLower(name), "x-authorization-") {
+			h.Del(name)
+		}
+	}
+	for _, name := range []string{"Authorization", "Signature", "Signature-Input", "Content-Digest", "Digest"} {
+		h.Del(name)
+	}
+}
@@ -0,0 +1,327 @@
+package hmacclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/acquia/http-hmac-go/nonce"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Differences between the server and the local clock below this are not corrected.
+const skewThreshold = time.Minute
+
+// Transport is an http.RoundTripper that signs every outgoing request before passing it on to Base.
+type Transport struct {
+	Signer signers.RequestSigner
+	ID     string
+	Realm  string
+	Secret string
+	// The underlying RoundTripper. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+	// If set, a request rejected with 401 or 403 as a timestamp range error (code timestamp_range_error in
+	// the JSON error body, see middleware.JSONErrorResponder) by a server whose Date header is off from the
+	// local clock is re-signed with a timestamp corrected by that offset and retried once. The offset is kept for
+	// subsequent requests. Requests with a body can only be retried if they have GetBody set, as
+	// http.NewRequest does for in-memory bodies.
+	CorrectClock bool
+	// Request headers whose names match one of these patterns (see path.Match, e.g. "X-Custom-*") are
+	// added to the signed headers. Matching is case-insensitive. Authorization headers are never included.
+	SignHeaders []string
+	// If set, requests with a body are sent with "Expect: 100-continue", so that the body is only sent once
+	// the server has accepted the signed headers (see http.Transport.ExpectContinueTimeout). The content
+	// hash is computed from a copy obtained through GetBody, leaving the body to be read once, by Base.
+	// Bodies without GetBody are buffered in memory for hashing.
+	ExpectContinue bool
+	// If set, successful responses must bear a valid response signature (v2), or RoundTrip fails. Error
+	// responses are returned as they are, since servers do not sign their rejections. The signature is
+	// checked against the nonce and timestamp each request was signed with, so a response replayed from
+	// another request is rejected.
+	VerifyResponses bool
+	// Generates the nonces of v2 signatures. Defaults to nonce.UUIDv4.
+	NonceSource nonce.Source
+	// Source of the current time, before clock correction. Defaults to the package clock.
+	Clock signers.Clock
+	// If set, the parameters of v2 signatures are sent in individual X-Authorization-* headers instead of
+	// the Authorization header, for CDNs and WAFs that mangle it (see middleware.WithParamHeaders).
+	ParamHeaders bool
+	// If set, the signatures of identical requests signed within the same second are reused (v1 only).
+	SignatureCache *SignatureCache
+	// If set, requests are signed with this signer too, e.g. v1 alongside v2 while servers are upgraded,
+	// with its Authorization header sent in DualHeader. Headers it adds, such as a Date header, are kept.
+	DualSigner signers.RequestSigner
+	// Header carrying the signature of DualSigner. Defaults to X-Authorization-V1. Pass Authorization for
+	// servers not yet upgraded, with Signer writing to another header (see V2Signer.AuthorizationHeader).
+	DualHeader string
+
+	mu     sync.Mutex
+	offset time.Duration
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+func (t *Transport) nonces() nonce.Source {
+	if t.NonceSource == nil {
+		return nonce.UUIDv4
+	}
+	return t.NonceSource
+}
+
+// ClockOffset returns the correction currently applied to the local clock when signing.
+func (t *Transport) ClockOffset() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.offset
+}
+
+func (t *Transport) now() time.Time {
+	return signers.OffsetClock{Clock: t.Clock, Offset: t.ClockOffset()}.Now()
+}
+
+// RoundTrip signs a copy of the request, so the caller's headers are left untouched. The realm and signed
+// headers can be overridden for a request through its context (see WithRequestRealm).
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.send(req, req.Body)
+	if err != nil || !t.CorrectClock || !t.correctSkew(resp) {
+		return resp, err
+	}
+	var body io.ReadCloser
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		body, err = req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+	}
+	resp.Body.Close()
+	return t.send(req, body)
+}
+
+// Signs a copy of req with body and sends it. body is closed even if signing fails, as RoundTrip requires.
+func (t *Transport) send(req *http.Request, body io.ReadCloser) (*http.Response, error) {
+	sent := false
+	defer func() {
+		if !sent && body != nil && body != http.NoBody {
+			body.Close()
+		}
+	}()
+	n, ok := nonceFromContext(req.Context())
+	if !ok {
+		var err error
+		if n, err = t.nonces().Nonce(); err != nil {
+			return nil, err
+		}
+	}
+	signed := req.Clone(req.Context())
+	signed.Body = body
+	if body != nil && body != http.NoBody {
+		if signed.GetBody == nil {
+			if err := bufferBody(signed); err != nil {
+				return nil, err
+			}
+		}
+		if t.ExpectContinue {
+			signed.Header.Set("Expect", "100-continue")
+		}
+	}
+	tsHeader := t.timestampHeader()
+	if signed.Header.Get(tsHeader) == "" {
+		signed.Header.Set(tsHeader, strconv.FormatInt(t.now().Unix(), 10))
+	}
+	authHeaders := map[string]string{
+		"id":    t.ID,
+		"realm": realmFromContext(req.Context(), t.Realm),
+		"nonce": n,
+	}
+	if headers := signedHeaders(signed.Header, signHeadersFromContext(req.Context(), t.SignHeaders)); len(headers) > 0 {
+		authHeaders["headers"] = strings.Join(headers, ";")
+	}
+	if t.DualSigner != nil {
+		if serr := t.dualSign(signed, authHeaders); serr != nil {
+			return nil, serr.ToError()
+		}
+	}
+	if serr := t.sign(signed, authHeaders); serr != nil {
+		return nil, serr.ToError()
+	}
+	timestamp := signed.Header.Get(tsHeader)
+	if t.ParamHeaders {
+		if serr := t.moveToParamHeaders(signed); serr != nil {
+			return nil, serr.ToError()
+		}
+	}
+	sent = true
+	resp, err := t.base().RoundTrip(signed)
+	if err != nil || !t.VerifyResponses || resp.StatusCode >= 400 {
+		return resp, err
+	}
+	if verr := t.verifyResponse(signed, resp, n, timestamp); verr != nil {
+		resp.Body.Close()
+		return nil, verr.ToError()
+	}
+	return resp, nil
+}
+
+// Returns the header carrying the timestamp of signatures, as configured on the timestamp validator of
+// Signer.
+func (t *Transport) timestampHeader() string {
+	if s, ok := t.Signer.(signers.TimestampedSigner); ok {
+		return s.TimestampValidator().HeaderName()
+	}
+	return "X-Authorization-Timestamp"
+}
+
+// Moves the parameters of the v2 signature of a request from its authorization header to the individual
+// parameter headers.
+func (t *Transport) moveToParamHeaders(req *http.Request) *signers.AuthenticationError {
+	name := "Authorization"
+	if signer, ok := t.Signer.(*v2.V2Signer); ok && signer.AuthorizationHeader != "" {
+		name = signer.AuthorizationHeader
+	}
+	a, err := v2.ParseAuthorization(req.Header.Get(name))
+	if err != nil {
+		return err
+	}
+	a.SetParamHeaders(req.Header)
+	req.Header.Del(name)
+	return nil
+}
+
+func (t *Transport) dualHeader() string {
+	if t.DualHeader == "" {
+		return "X-Authorization-V1"
+	}
+	return t.DualHeader
+}
+
+// Signs a copy of the request with DualSigner, moving its signature to DualHeader of the request.
+func (t *Transport) dualSign(signed *http.Request, authHeaders map[string]string) *signers.AuthenticationError {
+	dual := signed.Clone(signed.Context())
+	if signed.GetBody != nil {
+		body, err := signed.GetBody()
+		if err != nil {
+			return signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
+		}
+		dual.Body = body
+	}
+	ah := map[string]string{}
+	for k, v := range authHeaders {
+		ah[k] = v
+	}
+	if err := t.DualSigner.SignDirect(dual, ah, t.Secret); err != nil {
+		return err
+	}
+	for name, values := range dual.Header {
+		if _, ok := signed.Header[name]; !ok && name != "Authorization" {
+			signed.Header[name] = values
+		}
+	}
+	signed.Header.Set(t.dualHeader(), dual.Header.Get("Authorization"))
+	return nil
+}
+
+// Checks the response signature against the nonce and timestamp the request was signed with, so that a
+// response cannot be passed off as the answer to another request.
+func (t *Transport) verifyResponse(req *http.Request, resp *http.Response, nonce string, timestamp string) *signers.AuthenticationError {
+	var rs signers.ResponseSigner
+	if s, ok := t.Signer.(interface{ GetResponseSigner() signers.ResponseSigner }); ok {
+		rs = s.GetResponseSigner()
+	}
+	if rs == nil {
+		return signers.Errorf(500, signers.ErrorTypeInternalError, "Signer does not support response signatures.")
+	}
+	if bc, ok := rs.(signers.BoundResponseChecker); ok {
+		return bc.CheckBound(nonce, timestamp, resp, t.Secret)
+	}
+	return rs.Check(req, resp, t.Secret)
+}
+
+// Returns the lowercase names of the headers matching the patterns, sorted.
+func signedHeaders(h http.Header, patterns []string) []string {
+	ret := []string{}
+	for name := range h {
+		lower := strings.ToLower(name)
+		if lower == "authorization" || strings.HasPrefix(lower, "x-authorization-") {
+			continue
+		}
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(strings.ToLower(pattern), lower); ok {
+				ret = append(ret, lower)
+				break
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Adjusts the clock offset if a rejection looks caused by clock skew: the server reports a timestamp range
+// error and its Date differs from the local clock. Returns true if the request should be retried.
+func (t *Transport) correctSkew(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return false
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil || !timestampRejected(resp) {
+		return false
+	}
+	offset := date.Sub(signers.NowFrom(t.Clock))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	diff := offset - t.offset
+	if diff < skewThreshold && diff > -skewThreshold {
+		return false
+	}
+	t.offset = offset
+	return true
+}
+
+// Reports whether the body of a rejection has the code of timestamp range errors, as the error responses
+// of the middleware do. The body is left readable for the caller.
+func timestampRejected(resp *http.Response) bool {
+	if resp.Body == nil {
+		return false
+	}
+	head, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	if err != nil {
+		return false
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	return json.Unmarshal(head, &body) == nil && body.Code == "timestamp_range_error"
+}
+
+// Replaces the body with an in-memory copy and sets GetBody, so that it can be hashed without consuming it.
+func bufferBody(req *http.Request) error {
+	data, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil
+}
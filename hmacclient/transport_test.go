@@ -0,0 +1,547 @@
+package hmacclient
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/middleware"
+	"github.com/acquia/http-hmac-go/nonce"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/mock"
+	"github.com/acquia/http-hmac-go/signers/v1"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testID     = "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	testSecret = "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+)
+
+// Starts a server whose clock runs an hour ahead of the local one.
+func skewedServer(t *testing.T, rejections *int32) *httptest.Server {
+	skew := time.Hour
+	verifier, err := v2.NewV2Signer(sha256.New)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	verifier.Timestamps = &signers.TimestampValidator{
+		Clock: signers.NewTestClock(time.Now().Add(skew).Unix()),
+	}
+	m := middleware.New(keys.Static{testID: testSecret})
+	m.Identifier = &mock.Identifier{Signer: verifier}
+	protected := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(skew).UTC().Format(http.TimeFormat))
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, r)
+		if rec.Code == http.StatusForbidden {
+			atomic.AddInt32(rejections, 1)
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+}
+
+func newTransport(t *testing.T, correct bool) *Transport {
+	signer, err := v2.NewV2Signer(sha256.New)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	return &Transport{
+		Signer:       signer,
+		ID:           testID,
+		Realm:        "Pipet service",
+		Secret:       testSecret,
+		CorrectClock: correct,
+	}
+}
+
+func TestClockCorrection(t *testing.T) {
+	var rejections int32
+	srv := skewedServer(t, &rejections)
+	defer srv.Close()
+
+	client := &http.Client{Transport: newTransport(t, false)}
+	resp, err := client.Get(srv.URL + "/resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected skewed request to be rejected without clock correction, got status %d.", resp.StatusCode)
+	}
+
+	atomic.StoreInt32(&rejections, 0)
+	transport := newTransport(t, true)
+	client = &http.Client{Transport: transport}
+	req, _ := http.NewRequest("POST", srv.URL+"/resource", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected retried request to succeed, got status %d.", resp.StatusCode)
+	}
+	if string(body) != `{"a":1}` {
+		t.Errorf("Expected body to be replayed on retry, got %q.", body)
+	}
+	if n := atomic.LoadInt32(&rejections); n != 1 {
+		t.Errorf("Expected exactly one rejection before the retry, got %d.", n)
+	}
+	if offset := transport.ClockOffset(); offset < 59*time.Minute || offset > 61*time.Minute {
+		t.Errorf("Expected a clock offset of about an hour, got %s.", offset)
+	}
+
+	// The offset is remembered, so the next request goes through the first time.
+	atomic.StoreInt32(&rejections, 0)
+	resp, err = client.Get(srv.URL + "/resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := atomic.LoadInt32(&rejections); resp.StatusCode != http.StatusOK || n != 0 {
+		t.Errorf("Expected corrected request to succeed without retry, got status %d after %d rejections.", resp.StatusCode, n)
+	}
+}
+
+func TestClockCorrectionUnreplayableBody(t *testing.T) {
+	var rejections int32
+	srv := skewedServer(t, &rejections)
+	defer srv.Close()
+
+	client := &http.Client{Transport: newTransport(t, true)}
+	req, _ := http.NewRequest("POST", srv.URL+"/resource", ioutil.NopCloser(strings.NewReader("data")))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := atomic.LoadInt32(&rejections); resp.StatusCode != http.StatusForbidden || n != 1 {
+		t.Errorf("Expected request without GetBody not to be retried, got status %d after %d rejections.", resp.StatusCode, n)
+	}
+}
+
+// Fails to generate nonces.
+type failingNonces struct{}
+
+func (failingNonces) Nonce() (string, error) {
+	return "", io.ErrUnexpectedEOF
+}
+
+// Records whether the body was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestBodyClosedOnSigningError(t *testing.T) {
+	transport := newTransport(t, false)
+	transport.NonceSource = failingNonces{}
+	body := &closeRecorder{Reader: strings.NewReader("data")}
+	req, _ := http.NewRequest("POST", "http://example.com/resource", body)
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Fatal("Expected the request to fail without a nonce.")
+	}
+	if !body.closed {
+		t.Error("Expected the request body to be closed when signing fails.")
+	}
+}
+
+func TestClockCorrectionOtherRejection(t *testing.T) {
+	var rejections int32
+	m := middleware.New(keys.Static{testID: "c2VjcmV0LW9mLWFub3RoZXIta2V5"})
+	protected := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The clock of the server is skewed, but the rejection is a signature mismatch.
+		w.Header().Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		atomic.AddInt32(&rejections, 1)
+		protected.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	transport := newTransport(t, true)
+	resp, err := (&http.Client{Transport: transport}).Get(srv.URL + "/resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if n := atomic.LoadInt32(&rejections); resp.StatusCode != http.StatusForbidden || n != 1 {
+		t.Errorf("Expected a signature mismatch not to be retried, got status %d after %d requests.", resp.StatusCode, n)
+	}
+	if !strings.Contains(string(body), "signature_mismatch") {
+		t.Errorf("Expected the error body to be left readable, got %q.", body)
+	}
+	if offset := transport.ClockOffset(); offset != 0 {
+		t.Errorf("Expected the clock offset to be left alone, got %s.", offset)
+	}
+}
+
+func TestSignHeaders(t *testing.T) {
+	received := make(chan string, 1)
+	m := middleware.New(keys.Static{testID: testSecret}, middleware.WithRequiredHeaders("", "X-Custom-Tenant"))
+	srv := httptest.NewServer(m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("Authorization")
+	})))
+	defer srv.Close()
+
+	transport := newTransport(t, false)
+	transport.SignHeaders = []string{"x-custom-*"}
+	transport.NonceSource = &nonce.Counter{Prefix: "sign-headers-"}
+	req, _ := http.NewRequest("GET", srv.URL+"/resource", nil)
+	req.Header.Set("X-Custom-Tenant", "acme")
+	req.Header.Set("X-Custom-Trace", "1")
+	req.Header.Set("Accept", "application/json")
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected request to be accepted, got status %d.", resp.StatusCode)
+	}
+	auth := <-received
+	if !strings.Contains(auth, `headers="x-custom-tenant%3Bx-custom-trace"`) {
+		t.Error("Unexpected signed headers in ", auth)
+	}
+	if !strings.Contains(auth, `nonce="sign-headers-1"`) {
+		t.Error("Nonce source was not used in ", auth)
+	}
+}
+
+// Counts the copies of a body handed out through GetBody.
+type countingBody struct {
+	data   string
+	copies int32
+}
+
+func (c *countingBody) GetBody() (io.ReadCloser, error) {
+	atomic.AddInt32(&c.copies, 1)
+	return ioutil.NopCloser(strings.NewReader(c.data)), nil
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestExpectContinue(t *testing.T) {
+	body := &countingBody{data: `{"upload":"large"}`}
+	var sent *http.Request
+	transport := newTransport(t, false)
+	transport.ExpectContinue = true
+	transport.Base = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		return &http.Response{StatusCode: 200, Body: http.NoBody, Request: req}, nil
+	})
+	req, _ := http.NewRequest("PUT", "http://example.acquiapipet.net/upload", strings.NewReader(body.data))
+	req.GetBody = body.GetBody
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if sent.Header.Get("Expect") != "100-continue" {
+		t.Error("Expected the signed request to ask for 100-continue.")
+	}
+	if n := atomic.LoadInt32(&body.copies); n != 1 {
+		t.Errorf("Expected the body to be hashed from exactly one copy, got %d.", n)
+	}
+	if data, _ := ioutil.ReadAll(sent.Body); string(data) != body.data {
+		t.Errorf("Expected the body to be left unread for sending, got %q.", data)
+	}
+
+	verifier, _ := v2.NewV2Signer(sha256.New)
+	sent.Body = ioutil.NopCloser(strings.NewReader(body.data))
+	if serr := verifier.Check(sent, testSecret); serr != nil {
+		t.Error("Signed upload does not verify: ", serr.Message)
+	}
+}
+
+func TestDualSigning(t *testing.T) {
+	var sent *http.Request
+	client := New(testID, testSecret, 2, WithDualSigning(""), WithoutResponseVerification(), WithoutClockCorrection(),
+		WithBase(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			sent = req
+			return &http.Response{StatusCode: 200, Body: http.NoBody, Request: req}, nil
+		})))
+	req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/resource", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	upgraded := middleware.New(keys.Static{testID: testSecret})
+	if _, err := upgraded.Verify(sent.Clone(sent.Context())); err != nil {
+		t.Error("Expected the v2 signature to be accepted: ", err.Message)
+	}
+	legacy := sent.Clone(sent.Context())
+	legacy.Header.Set("Authorization", sent.Header.Get("X-Authorization-V1"))
+	legacy.Body, _ = sent.GetBody()
+	signer, _ := v1.NewV1Signer(sha1.New)
+	if err := signer.Check(legacy, testSecret); err != nil {
+		t.Error("Expected the v1 signature to be accepted: ", err.Message)
+	}
+}
+
+func TestResponseBinding(t *testing.T) {
+	signing := middleware.New(keys.Static{testID: testSecret}, middleware.WithResponseSigning())
+	srv := httptest.NewServer(signing.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("balance: 100"))
+	})))
+	defer srv.Close()
+
+	var recorded http.Header
+	var replay bool
+	transport := newTransport(t, false)
+	transport.VerifyResponses = true
+	transport.Base = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if replay {
+			return &http.Response{StatusCode: 200, Header: recorded, Body: ioutil.NopCloser(strings.NewReader("balance: 100")), Request: req}, nil
+		}
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err == nil {
+			recorded = resp.Header.Clone()
+		}
+		return resp, err
+	})
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal("Expected the signed response to be accepted: ", err)
+	}
+	resp.Body.Close()
+
+	replay = true
+	if _, err := client.Get(srv.URL); err == nil || !strings.Contains(err.Error(), "signature mismatch") {
+		t.Error("Expected a response signed for another request to be rejected, got ", err)
+	}
+}
+
+func TestContextOverrides(t *testing.T) {
+	var sent *http.Request
+	transport := newTransport(t, false)
+	transport.Base = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		return &http.Response{StatusCode: 200, Body: http.NoBody, Request: req}, nil
+	})
+	client := &http.Client{Transport: transport}
+	ctx := WithExtraSignedHeaders(WithRequestRealm(context.Background(), "Admin"), "X-Tenant")
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/resource", nil)
+	req.Header.Set("X-Tenant", "acme")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	auth := v2.ParseAuthHeaders(sent)
+	if auth["realm"] != "Admin" || auth["headers"] != "x-tenant" {
+		t.Error("Expected the context to override the realm and signed headers, got ", sent.Header.Get("Authorization"))
+	}
+
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if auth := v2.ParseAuthHeaders(sent); auth["realm"] != "Pipet service" || auth["headers"] != "" {
+		t.Error("Expected requests without overrides to use the transport settings, got ", sent.Header.Get("Authorization"))
+	}
+}
+
+func TestRequestNonce(t *testing.T) {
+	var seen []string
+	m := middleware.New(keys.Static{testID: testSecret})
+	srv := httptest.NewServer(m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := middleware.FromContext(r.Context())
+		seen = append(seen, id.Nonce)
+	})))
+	defer srv.Close()
+	client := &http.Client{Transport: newTransport(t, false)}
+	n := nonce.Derive("order-1234")
+	req, _ := http.NewRequest("GET", srv.URL+"/resource", nil)
+	for _, r := range []*http.Request{req.WithContext(WithRequestNonce(context.Background(), n)), req} {
+		resp, err := client.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if len(seen) != 2 || seen[0] != n || seen[1] == n || seen[1] == "" {
+		t.Errorf("Expected the server to see the nonce %s, then a generated one, got %v.", n, seen)
+	}
+}
+
+func TestResigner(t *testing.T) {
+	const backendID = "backend-gateway"
+	const backendSecret = "c2VjcmV0LW9mLXRoZS1iYWNrZW5k"
+	backend := middleware.New(keys.Static{backendID: backendSecret})
+	var received string
+	var receivedHost string
+	srv := httptest.NewServer(backend.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := middleware.FromContext(r.Context())
+		body, _ := ioutil.ReadAll(r.Body)
+		received = identity.KeyID + " " + string(body)
+		receivedHost = r.Host
+	})))
+	defer srv.Close()
+
+	resigner := &Resigner{
+		Transport: newTransport(t, false),
+		Rewrite: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = strings.TrimPrefix(srv.URL, "http://")
+			req.Host = "backend.internal"
+			req.Body = ioutil.NopCloser(strings.NewReader(`{"task":1,"via":"gateway"}`))
+			req.ContentLength = -1
+		},
+	}
+	resigner.Transport.ID = backendID
+	resigner.Transport.Secret = backendSecret
+	gateway := middleware.New(keys.Static{testID: testSecret}).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := resigner.RoundTrip(r)
+		if err != nil {
+			t.Error("Failed to forward the request: ", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}))
+
+	req, _ := http.NewRequest("POST", "http://gateway.example.com/task", strings.NewReader(`{"task":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	signing := newTransport(t, false)
+	signing.Base = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		gateway.ServeHTTP(rec, req)
+		return &http.Response{StatusCode: rec.Code, Body: http.NoBody, Request: req}, nil
+	})
+	resp, err := (&http.Client{Transport: signing}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("Expected the re-signed request to be accepted by the backend, got status ", resp.StatusCode)
+	}
+	if received != backendID+` {"task":1,"via":"gateway"}` || receivedHost != "backend.internal" {
+		t.Error("Unexpected request at the backend: ", received, " for host ", receivedHost)
+	}
+}
+
+// Counts the signatures computed by a v1 signer.
+type countingSigner struct {
+	*v1.V1Signer
+	signed int
+}
+
+func (c *countingSigner) SignDirect(req *http.Request, authHeaders map[string]string, secret string) *signers.AuthenticationError {
+	c.signed++
+	return c.V1Signer.SignDirect(req, authHeaders, secret)
+}
+
+func TestSignatureCache(t *testing.T) {
+	v1signer, _ := v1.NewV1Signer(sha1.New)
+	uses := 0
+	v1signer.OnUse = func(e *signers.DeprecationEvent) {
+		uses++
+	}
+	signer := &countingSigner{V1Signer: v1signer}
+	var sent []string
+	transport := &Transport{
+		Signer:         signer,
+		ID:             testID,
+		Secret:         testSecret,
+		Clock:          signers.NewTestClock(1432075982),
+		SignatureCache: &SignatureCache{},
+		Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			sent = append(sent, req.Header.Get("Authorization"))
+			return &http.Response{StatusCode: 200, Body: http.NoBody, Request: req}, nil
+		}),
+	}
+	client := &http.Client{Transport: transport}
+	get := func(url string) {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	get("http://example.acquiapipet.net/status")
+	get("http://example.acquiapipet.net/status")
+	if signer.signed != 1 || sent[0] != sent[1] {
+		t.Error("Expected identical requests to reuse the signature, signed ", signer.signed, " times")
+	}
+	if uses != 2 {
+		t.Error("Expected the deprecation hook to be called for reused signatures too, called ", uses, " times")
+	}
+	get("http://example.acquiapipet.net/status?page=2")
+	if signer.signed != 2 {
+		t.Error("Expected a different request to be signed, signed ", signer.signed, " times")
+	}
+	transport.Clock = signers.NewTestClock(1432075983)
+	get("http://example.acquiapipet.net/status")
+	if signer.signed != 3 {
+		t.Error("Expected the cache to be emptied when the clock ticks, signed ", signer.signed, " times")
+	}
+
+	v2transport := newTransport(t, false)
+	v2transport.SignatureCache = &SignatureCache{}
+	v2transport.Base = transport.Base
+	client = &http.Client{Transport: v2transport}
+	sent = nil
+	get("http://example.acquiapipet.net/status")
+	get("http://example.acquiapipet.net/status")
+	if sent[0] == sent[1] {
+		t.Error("Expected v2 signatures, which cover a nonce, not to be cached.")
+	}
+}
+
+func TestParamHeaders(t *testing.T) {
+	var sent *http.Request
+	client := New(testID, testSecret, 2, WithRealm("Pipet service"), WithParamHeaders(), WithoutResponseVerification(),
+		WithBase(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			sent = req
+			return &http.Response{StatusCode: 200, Body: http.NoBody, Request: req}, nil
+		})))
+	resp, err := client.Get("http://example.acquiapipet.net/resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if sent.Header.Get("Authorization") != "" || sent.Header.Get("X-Authorization-Signature") == "" || sent.Header.Get("X-Authorization-Realm") != "Pipet service" {
+		t.Fatal("Expected the signature in parameter headers, got ", sent.Header)
+	}
+	m := middleware.New(keys.Static{testID: testSecret}, middleware.WithParamHeaders())
+	if _, err := m.Verify(sent); err != nil {
+		t.Error("Expected the signature in parameter headers to be accepted: ", err.Message)
+	}
+}
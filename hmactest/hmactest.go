@@ -0,0 +1,118 @@
+// Package hmactest provides utilities for integration testing handlers that are protected by HTTP HMAC
+// authentication, in the spirit of net/http/httptest.
+package hmactest
+
+import (
+	"crypto/sha256"
+	"github.com/acquia/http-hmac-go/hmacclient"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/middleware"
+	"github.com/acquia/http-hmac-go/nonce"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Pre-provisioned credentials known to every Server.
+const (
+	KeyID  = "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	Secret = "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	Realm  = "hmactest"
+
+	SecondaryKeyID  = "615d6517-1cea-4aa3-b48e-96d83c16c4dd"
+	SecondarySecret = "TXkgU2VjcmV0IEtleSBUaGF0IGlzIFZlcnkgU2VjdXJl"
+)
+
+// Keys returns a fresh copy of the pre-provisioned credentials.
+func Keys() keys.Static {
+	return keys.Static{
+		KeyID:          Secret,
+		SecondaryKeyID: SecondarySecret,
+	}
+}
+
+// Server is an httptest.Server whose handler is wrapped in the verification middleware.
+type Server struct {
+	*httptest.Server
+	Keys       keys.Static
+	Middleware *middleware.Middleware
+}
+
+// NewServer starts a server verifying requests against the pre-provisioned credentials. Additional
+// keys may be added to Server.Keys before requests are sent.
+func NewServer(handler http.Handler, options ...middleware.Option) *Server {
+	s := &Server{
+		Keys: Keys(),
+	}
+	s.Middleware = middleware.New(s.Keys, options...)
+	s.Server = httptest.NewServer(s.Middleware.Handler(handler))
+	return s
+}
+
+// Client returns an http.Client that signs requests with the primary key.
+func (s *Server) Client() *http.Client {
+	return s.ClientFor(KeyID)
+}
+
+// ClientFor returns an http.Client that signs requests with the given key, which must exist in Server.Keys.
+func (s *Server) ClientFor(id string) *http.Client {
+	return &http.Client{
+		Transport: NewTransport(id, s.Keys[id], s.Server.Client().Transport),
+	}
+}
+
+// NewTransport returns a v2 signing transport for the given credentials, in the test realm.
+func NewTransport(id string, secret string, base http.RoundTripper) *hmacclient.Transport {
+	signer, err := v2.NewV2Signer(sha256.New)
+	if err != nil {
+		panic(err.Message)
+	}
+	return &hmacclient.Transport{
+		Signer: signer,
+		ID:     id,
+		Realm:  Realm,
+		Secret: secret,
+		Base:   base,
+	}
+}
+
+// SignRequest signs a request in place with the primary key, for tests calling a handler directly.
+func SignRequest(t testing.TB, req *http.Request) {
+	t.Helper()
+	signer, err := v2.NewV2Signer(sha256.New)
+	if err != nil {
+		t.Fatal("Failed to create signer: ", err.Message)
+	}
+	n, nerr := nonce.New()
+	if nerr != nil {
+		t.Fatal("Failed to generate nonce: ", nerr.Error())
+	}
+	authHeaders := map[string]string{
+		"id":    KeyID,
+		"realm": Realm,
+		"nonce": n,
+	}
+	if err := signer.SignDirect(req, authHeaders, Secret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+}
+
+// AssertAuthenticated fails the test if the response was rejected by the verification middleware, with any
+// client error status, as AssertRejected tells.
+func AssertAuthenticated(t testing.TB, resp *http.Response) {
+	t.Helper()
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		t.Errorf("Expected request to be authenticated, got status %d.", resp.StatusCode)
+	}
+}
+
+// AssertRejected fails the test unless the response was rejected by the verification middleware, with any
+// client error status, as the middleware may respond with 400, 413 or 429 as well (see
+// middleware.WithStatusTable).
+func AssertRejected(t testing.TB, resp *http.Response) {
+	t.Helper()
+	if resp.StatusCode < 400 || resp.StatusCode >= 500 {
+		t.Errorf("Expected request to be rejected, got status %d.", resp.StatusCode)
+	}
+}
@@ -0,0 +1,77 @@
+package hmactest
+
+import (
+	"github.com/acquia/http-hmac-go/middleware"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	for _, id := range []string{KeyID, SecondaryKeyID} {
+		req, _ := http.NewRequest("POST", srv.URL+"/resource/1?key=value", strings.NewReader(`{"a":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := srv.ClientFor(id).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		AssertAuthenticated(t, resp)
+	}
+
+	resp, err := http.Get(srv.URL + "/resource/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	AssertRejected(t, resp)
+}
+
+// Returns the response to a malformed request, rejected with 400 under StandardStatuses.
+func malformedResponse(t *testing.T) *http.Response {
+	srv := NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), middleware.WithStatusTable(middleware.StandardStatuses))
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL+"/resource/1", nil)
+	auth := &v2.AuthorizationHeader{ID: KeyID, Nonce: "n", Realm: Realm, Version: "2.0", Signature: "%%%"}
+	req.Header.Set("Authorization", auth.String())
+	req.Header.Set("X-Authorization-Timestamp", "yesterday")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Fatal("Expected the malformed header to be rejected with 400, got ", resp.StatusCode)
+	}
+	return resp
+}
+
+func TestAssertRejectedStatusTable(t *testing.T) {
+	AssertRejected(t, malformedResponse(t))
+}
+
+// Records whether an assertion failed, rather than failing the test.
+type failureRecorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *failureRecorder) Helper() {}
+
+func (r *failureRecorder) Errorf(format string, args ...interface{}) {
+	r.failed = true
+}
+
+func TestAssertAuthenticatedStatusTable(t *testing.T) {
+	r := &failureRecorder{TB: t}
+	AssertAuthenticated(r, malformedResponse(t))
+	if !r.failed {
+		t.Error("Expected a request rejected with 400 not to count as authenticated.")
+	}
+}
@@ -0,0 +1,316 @@
+// Command genfixtures recomputes the expected signatures and authorization headers of the test fixtures
+// in signers/test_fixtures.go from their secrets and requests, so new cases need not be computed by hand.
+//
+// Usage, from the root of the repository:
+//
+//	go run ./internal/genfixtures [-file signers/test_fixtures.go] [-n]
+//	go run ./internal/genfixtures -vectors signers/testdata/vectors.json
+//
+// Only the versions already listed are recomputed: to add a case, give it placeholders such as
+// Expected: map[string]string{"v2": ""} and ExpectedHeader: map[string]string{"v2": ""}. The
+// Expected signature of CompatFixtures is recomputed unless empty, which marks an unidentifiable
+// request. With -n the result is written to stdout instead of the file.
+//
+// With -vectors, the fixtures are exported as JSON test vectors for other implementations instead; see
+// signers/testdata/vectors.md.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/compat"
+	"github.com/acquia/http-hmac-go/signers/v1"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	file := flag.String("file", "signers/test_fixtures.go", "the fixtures source file to update")
+	dryRun := flag.Bool("n", false, "write the updated source to stdout instead of the file")
+	vectors := flag.String("vectors", "", "export the fixtures as JSON test vectors to this file instead")
+	flag.Parse()
+
+	if *vectors != "" {
+		b, err := signers.MarshalVectors(signers.Fixtures, signers.CompatFixtures)
+		if err == nil {
+			err = ioutil.WriteFile(*vectors, b, 0644)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "genfixtures:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	src, err := ioutil.ReadFile(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "genfixtures:", err)
+		os.Exit(1)
+	}
+	out, err := regenerate(src, signers.Fixtures, signers.CompatFixtures)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "genfixtures:", err)
+		os.Exit(1)
+	}
+	if *dryRun {
+		os.Stdout.Write(out)
+		return
+	}
+	if bytes.Equal(out, src) {
+		return
+	}
+	if err := ioutil.WriteFile(*file, out, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "genfixtures:", err)
+		os.Exit(1)
+	}
+}
+
+// A replacement of the source between two offsets.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// regenerate rewrites the Expected values of the Fixtures and CompatFixtures literals in src, which must
+// declare the given fixtures in the same order.
+func regenerate(src []byte, fixtures []*signers.TestFixture, compatFixtures []*signers.CompatibilityTestFixture) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	edits := []edit{}
+	offset := func(p token.Pos) int {
+		return fset.Position(p).Offset
+	}
+	replace := func(e ast.Expr, text string) {
+		edits = append(edits, edit{offset(e.Pos()), offset(e.End()), text})
+	}
+
+	elts, err := fixtureLiterals(f, "Fixtures", len(fixtures))
+	if err != nil {
+		return nil, err
+	}
+	for i, lit := range elts {
+		fx := fixtures[i]
+		computed, err := compute(fx)
+		if err != nil {
+			return nil, fmt.Errorf("fixture %d (%s): %w", i, fx.TestName, err)
+		}
+		if e := field(lit, "Expected"); e != nil {
+			replace(e, mapLiteral(computed.signatures))
+		}
+		if e := field(lit, "ExpectedHeader"); e != nil {
+			replace(e, mapLiteral(computed.headers))
+		}
+		if resp, ok := field(lit, "Response").(*ast.UnaryExpr); ok {
+			if rl, ok := resp.X.(*ast.CompositeLit); ok {
+				if e := field(rl, "Expected"); e != nil {
+					replace(e, mapLiteral(computed.responses))
+				}
+			}
+		}
+	}
+
+	elts, err = fixtureLiterals(f, "CompatFixtures", len(compatFixtures))
+	if err != nil {
+		return nil, err
+	}
+	for i, lit := range elts {
+		fx := compatFixtures[i]
+		if fx.Expected == "" {
+			continue
+		}
+		sig, err := computeCompat(fx)
+		if err != nil {
+			return nil, fmt.Errorf("compatibility fixture %d (%s): %w", i, fx.TestName, err)
+		}
+		if e, ok := field(lit, "Expected").(*ast.BasicLit); ok {
+			replace(e, strconv.Quote(sig))
+		}
+	}
+
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	out := append([]byte{}, src...)
+	for _, e := range edits {
+		out = append(out[:e.start], append([]byte(e.text), out[e.end:]...)...)
+	}
+	return format.Source(out)
+}
+
+// Returns the elements of the slice literal assigned to the package variable name.
+func fixtureLiterals(f *ast.File, name string, n int) ([]*ast.CompositeLit, error) {
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			if len(vs.Names) != 1 || vs.Names[0].Name != name || len(vs.Values) != 1 {
+				continue
+			}
+			slice, ok := vs.Values[0].(*ast.CompositeLit)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a slice literal", name)
+			}
+			ret := []*ast.CompositeLit{}
+			for _, elt := range slice.Elts {
+				if u, ok := elt.(*ast.UnaryExpr); ok {
+					elt = u.X
+				}
+				lit, ok := elt.(*ast.CompositeLit)
+				if !ok {
+					return nil, fmt.Errorf("unexpected element in %s", name)
+				}
+				ret = append(ret, lit)
+			}
+			if len(ret) != n {
+				return nil, fmt.Errorf("%s declares %d fixtures in the source but %d were compiled; rebuild the tool", name, len(ret), n)
+			}
+			return ret, nil
+		}
+	}
+	return nil, fmt.Errorf("no declaration of %s", name)
+}
+
+// Returns the value of the named field in a keyed struct literal, or nil.
+func field(lit *ast.CompositeLit, name string) ast.Expr {
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if id, ok := kv.Key.(*ast.Ident); ok && id.Name == name {
+			return kv.Value
+		}
+	}
+	return nil
+}
+
+func mapLiteral(m map[string]string) string {
+	if len(m) == 0 {
+		return "map[string]string{}"
+	}
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString("map[string]string{\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s: %s,\n", strconv.Quote(k), quote(m[k]))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// Quotes a string, preferring a raw string literal for values with double quotes, as headers are written.
+func quote(s string) string {
+	if strings.Contains(s, `"`) && !strings.ContainsAny(s, "`\n") {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+type computed struct {
+	signatures map[string]string
+	headers    map[string]string
+	responses  map[string]string
+}
+
+func newSigner(version string, fx *signers.TestFixture) (signers.Signer, *signers.AuthenticationError) {
+	switch version {
+	case "v1":
+		return v1.NewV1Signer(fx.Digest)
+	case "v2":
+		return v2.NewV2Signer(fx.Digest)
+	}
+	return nil, signers.Errorf(500, signers.ErrorTypeUnknownSignatureType, "Unknown version %s.", version)
+}
+
+// Computes the values of every version listed in the Expected fields of the fixture.
+func compute(fx *signers.TestFixture) (*computed, error) {
+	ret := &computed{map[string]string{}, map[string]string{}, map[string]string{}}
+	versions := map[string]bool{}
+	for k := range fx.Expected {
+		versions[k] = true
+	}
+	for k := range fx.ExpectedHeader {
+		versions[k] = true
+	}
+	if fx.Response != nil {
+		for k := range fx.Response.Expected {
+			versions[k] = true
+		}
+	}
+	signers.OverrideClock(fx.SystemTime)
+	defer signers.RestoreClock()
+	for version := range versions {
+		signer, err := newSigner(version, fx)
+		if err != nil {
+			return nil, err.ToError()
+		}
+		sig, err := signer.Sign(fx.Request, fx.AuthHeaders, fx.SecretKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot sign as %s: %w", version, err.ToError())
+		}
+		if _, ok := fx.Expected[version]; ok {
+			ret.signatures[version] = sig
+		}
+		auth, err := signer.GenerateAuthorization(fx.Request, fx.AuthHeaders, sig)
+		if err != nil {
+			return nil, fmt.Errorf("cannot generate the authorization header as %s: %w", version, err.ToError())
+		}
+		if _, ok := fx.ExpectedHeader[version]; ok {
+			ret.headers[version] = auth
+		}
+		if fx.Response == nil {
+			continue
+		}
+		if _, ok := fx.Response.Expected[version]; !ok {
+			continue
+		}
+		saved, had := fx.Request.Header["Authorization"]
+		fx.Request.Header.Set("Authorization", auth)
+		rsig, err := signer.GetResponseSigner().SignResponse(fx.Request, fx.Response.Response, fx.SecretKey)
+		if had {
+			fx.Request.Header["Authorization"] = saved
+		} else {
+			fx.Request.Header.Del("Authorization")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot sign the response as %s: %w", version, err.ToError())
+		}
+		ret.responses[version] = rsig
+	}
+	return ret, nil
+}
+
+// Computes the signature of the Authorization header of a compatibility fixture.
+func computeCompat(fx *signers.CompatibilityTestFixture) (string, error) {
+	signers.OverrideClock(fx.SystemTime)
+	defer signers.RestoreClock()
+	signer := compat.NewAllSignaturesIdentifier(fx.Digest).IdentifySignature(fx.Request.Header.Get("Authorization"))
+	if signer == nil {
+		return "", fmt.Errorf("no signer matches %q", fx.Request.Header.Get("Authorization"))
+	}
+	sig, err := signer.Sign(fx.Request, signer.ParseAuthHeaders(fx.Request), fx.SecretKey)
+	if err != nil {
+		return "", err.ToError()
+	}
+	return sig, nil
+}
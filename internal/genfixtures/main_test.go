@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/acquia/http-hmac-go/signers"
+	"io/ioutil"
+	"testing"
+)
+
+func TestRegenerate(t *testing.T) {
+	src, err := ioutil.ReadFile("../../signers/test_fixtures.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := regenerate(src, signers.Fixtures, signers.CompatFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, src) {
+		t.Error("Expected the fixtures to be up to date; run go run ./internal/genfixtures")
+	}
+
+	// Placeholders are filled in.
+	sig := []byte(`"MRlPr/Z1WQY2sMthcaEqETRMw4gPYXlPcTpaLWS2gcc="`)
+	if !bytes.Contains(src, sig) {
+		t.Fatal("Fixture signature not found")
+	}
+	blank := bytes.Replace(src, sig, []byte(`""`), 1)
+	if out, err = regenerate(blank, signers.Fixtures, signers.CompatFixtures); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, src) {
+		t.Error("Expected the placeholders to be replaced by the computed signatures")
+	}
+}
+
+func TestVectors(t *testing.T) {
+	want, err := signers.MarshalVectors(signers.Fixtures, signers.CompatFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile("../../signers/testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("Expected the vectors to be up to date; run make vectors")
+	}
+	v := &signers.Vectors{}
+	if err := json.Unmarshal(got, v); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Compatibility) != len(signers.CompatFixtures) || len(v.Signatures) < len(signers.Fixtures) {
+		t.Error("Expected a vector for every fixture, got ", len(v.Signatures), " and ", len(v.Compatibility))
+	}
+	for _, s := range v.Signatures {
+		if s.Expectations.Signature == "" && s.Expectations.Error == "" {
+			t.Error("Expected a signature or an error for vector ", s.Name, " ", s.Version)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package keys
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/acquia/http-hmac-go/signers"
+	"strings"
+)
+
+// The length of derived secrets, in bytes.
+const derivedSecretLength = 32
+
+var errNulLabel = errors.New("keys: realms and key IDs of derived secrets must not contain NUL")
+
+// DeriveKey derives n bytes of key material from a master secret with HKDF (RFC 5869) over HMAC-SHA256.
+// Different info labels give independent keys. n may be at most 8160.
+func DeriveKey(master []byte, salt []byte, info []byte, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, errors.New("keys: cannot derive a negative number of bytes")
+	}
+	if n > 255*sha256.Size {
+		return nil, errors.New("keys: cannot derive more than 8160 bytes with HKDF-SHA256")
+	}
+	if len(salt) == 0 {
+		salt = make([]byte, sha256.Size)
+	}
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(master)
+	prk := extract.Sum(nil)
+
+	ret := make([]byte, 0, n+sha256.Size)
+	block := []byte{}
+	for i := byte(1); len(ret) < n; i++ {
+		expand := hmac.New(sha256.New, prk)
+		expand.Write(block)
+		expand.Write(info)
+		expand.Write([]byte{i})
+		block = expand.Sum(nil)
+		ret = append(ret, block...)
+	}
+	return ret[:n], nil
+}
+
+// DeriveSecret derives the secret of a key ID in a realm from a base64 encoded master secret, so that each
+// service only receives the secrets of its own keys. The secret is 32 bytes of HKDF-SHA256 output, base64
+// encoded, with the master secret as input key material, no salt and "http-hmac-go\x00" + realm + "\x00" + id
+// as info. The master secret must be at least MinSecretLength bytes long. Realms and key IDs containing NUL
+// are rejected, as they would make the info ambiguous: realm "a\x00b" and key ID "c" would get the secret of
+// realm "a" and key ID "b\x00c".
+func DeriveSecret(master string, realm string, id string) (string, error) {
+	if strings.IndexByte(realm, 0) >= 0 || strings.IndexByte(id, 0) >= 0 {
+		return "", errNulLabel
+	}
+	m, err := base64.StdEncoding.DecodeString(master)
+	if err != nil {
+		return "", err
+	}
+	if len(m) < MinSecretLength {
+		return "", fmt.Errorf("keys: master secrets must be at least %d bytes long", MinSecretLength)
+	}
+	key, err := DeriveKey(m, nil, []byte("http-hmac-go\x00"+realm+"\x00"+id), derivedSecretLength)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Derived is a Provider deriving the secrets of key IDs from a master secret on the fly, with DeriveSecret,
+// instead of storing them. The realm is part of the label: signature versions without a realm get secrets
+// derived for the empty realm.
+type Derived struct {
+	// Base64 encoded master secret, at least MinSecretLength bytes long.
+	Master string
+	// If set, only key IDs it reports as known get a secret. Otherwise every key ID does, and requests are only
+	// authenticated by the signature made with the derived secret.
+	Known func(realm string, id string) bool
+}
+
+func (d *Derived) GetSecret(realm string, id string) (string, *signers.AuthenticationError) {
+	if d.Known != nil && !d.Known(realm, id) {
+		return "", signers.Errorf(403, signers.ErrorTypeUnknownKey, "Unknown key ID %s.", id)
+	}
+	secret, err := DeriveSecret(d.Master, realm, id)
+	if err == errNulLabel {
+		return "", signers.Errorf(403, signers.ErrorTypeUnknownKey, "Unknown key ID %s.", id)
+	}
+	if err != nil {
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Cannot derive secret: %w", err)
+	}
+	return secret, nil
+}
@@ -0,0 +1,79 @@
+package keys
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/acquia/http-hmac-go/nonce"
+	"github.com/acquia/http-hmac-go/signers"
+	"io/ioutil"
+	"os"
+)
+
+// Key is a credential in a KeyFile.
+type Key struct {
+	ID string `json:"id"`
+	// Base64 encoded, as v2 secrets are.
+	Secret string `json:"secret"`
+	// If set, the key is only valid in this realm.
+	Realm string `json:"realm,omitempty"`
+}
+
+// KeyFile is the JSON keystore format, {"keys": [{"id": ..., "secret": ..., "realm": ...}]}. It is a
+// Provider of the keys it lists.
+type KeyFile struct {
+	Keys []Key `json:"keys"`
+}
+
+// ReadKeyFile reads a keystore from a file.
+func ReadKeyFile(path string) (*KeyFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &KeyFile{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// WriteFile writes the keystore to a file readable by its owner only.
+func (f *KeyFile) WriteFile(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), os.FileMode(0600))
+}
+
+func (f *KeyFile) GetSecret(realm string, id string) (string, *signers.AuthenticationError) {
+	for _, k := range f.Keys {
+		if k.ID == id && (k.Realm == "" || k.Realm == realm) {
+			return k.Secret, nil
+		}
+	}
+	return "", signers.Errorf(403, signers.ErrorTypeUnknownKey, "Unknown key ID %s.", id)
+}
+
+// The shortest secret GenerateSecret produces, in bytes.
+const MinSecretLength = 16
+
+// GenerateSecret returns a base64 encoded secret of n cryptographically random bytes, as v2 secrets are
+// encoded. n must be at least MinSecretLength; 32 matches the output of HMAC-SHA256.
+func GenerateSecret(n int) (string, error) {
+	if n < MinSecretLength {
+		return "", fmt.Errorf("keys: secrets must be at least %d bytes long", MinSecretLength)
+	}
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// GenerateKeyID returns a random (version 4) UUID, the form of key IDs in the specification.
+func GenerateKeyID() (string, error) {
+	return nonce.New()
+}
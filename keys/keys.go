@@ -0,0 +1,47 @@
+package keys
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+)
+
+type Provider interface {
+	// Returns the secret belonging to a key ID. The realm is passed along for providers that keep
+	// separate key namespaces; it is empty for signature versions that do not carry one.
+	// Fails with ErrorTypeUnknownKey if the key ID does not exist.
+	GetSecret(realm string, id string) (string, *signers.AuthenticationError)
+}
+
+// SecretProvider is implemented by providers that hold decoded key material, such as memory enclaves, so
+// that secrets need not pass through strings. The returned function must be called once the secret is no
+// longer needed; it may wipe the key material.
+type SecretProvider interface {
+	GetSecretKey(realm string, id string) (signers.Secret, func(), *signers.AuthenticationError)
+}
+
+// Static is a Provider backed by a fixed map of key IDs to secrets. Realms are ignored.
+type Static map[string]string
+
+func (s Static) GetSecret(realm string, id string) (string, *signers.AuthenticationError) {
+	secret, ok := s[id]
+	if !ok {
+		return "", signers.Errorf(403, signers.ErrorTypeUnknownKey, "Unknown key ID %s.", id)
+	}
+	return secret, nil
+}
+
+// Realms routes lookups to a separate provider per realm, so that one verifier can serve several services or
+// tenants with isolated key namespaces, e.g. Realms{"Pipet service": pipet, "Plexus": plexus}. The provider
+// for the empty realm, if any, serves realms without a provider of their own as well as signature
+// versions without a realm. Other realms are rejected with ErrorTypeUnknownKey.
+type Realms map[string]Provider
+
+func (r Realms) GetSecret(realm string, id string) (string, *signers.AuthenticationError) {
+	p, ok := r[realm]
+	if !ok {
+		p, ok = r[""]
+	}
+	if !ok {
+		return "", signers.Errorf(403, signers.ErrorTypeUnknownKey, "Unknown realm %s.", realm)
+	}
+	return p.GetSecret(realm, id)
+}
@@ -0,0 +1,113 @@
+package keys
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/acquia/http-hmac-go/signers"
+	"regexp"
+	"testing"
+)
+
+func TestRealms(t *testing.T) {
+	r := Realms{
+		"Pipet service": Static{"a": "pipet"},
+		"Plexus":        Static{"a": "plexus"},
+	}
+	if s, err := r.GetSecret("Plexus", "a"); err != nil || s != "plexus" {
+		t.Error("Lookup was not routed to the realm's provider.")
+	}
+	if s, err := r.GetSecret("Pipet service", "a"); err != nil || s != "pipet" {
+		t.Error("Lookup was not routed to the realm's provider.")
+	}
+	if _, err := r.GetSecret("Other", "a"); err == nil || err.ErrorType != signers.ErrorTypeUnknownKey {
+		t.Error("Expected lookup in an unknown realm to fail.")
+	}
+	r[""] = Static{"b": "fallback"}
+	if s, err := r.GetSecret("Other", "b"); err != nil || s != "fallback" {
+		t.Error("Lookup in an unknown realm did not fall back.")
+	}
+	if _, err := r.GetSecret("Plexus", "b"); err == nil {
+		t.Error("Keys of the fallback provider leaked into a routed realm.")
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	// RFC 5869, test case 1.
+	ikm, _ := hex.DecodeString("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	okm, err := DeriveKey(ikm, salt, info, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(okm) != "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865" {
+		t.Errorf("Unexpected key material %x", okm)
+	}
+	if _, err := DeriveKey(ikm, salt, info, 8161); err == nil {
+		t.Error("Expected derivation of more than 255 blocks to fail.")
+	}
+	if _, err := DeriveKey(ikm, salt, info, -1); err == nil {
+		t.Error("Expected derivation of a negative length to fail.")
+	}
+}
+
+func TestDerived(t *testing.T) {
+	master := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	d := &Derived{Master: master}
+	a, err := d.GetSecret("Pipet service", "a")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if s, _ := DeriveSecret(master, "Pipet service", "a"); s != a {
+		t.Error("Expected the provider to return the derived secret.")
+	}
+	if b, _ := d.GetSecret("Plexus", "a"); b == a {
+		t.Error("Expected secrets derived for different realms to differ.")
+	}
+	if b, _ := d.GetSecret("Pipet service", "b"); b == a {
+		t.Error("Expected secrets derived for different key IDs to differ.")
+	}
+	if _, err := DeriveSecret(master, "a\x00b", "c"); err == nil {
+		t.Error("Expected a realm containing NUL to be rejected.")
+	}
+	if _, err := d.GetSecret("a", "b\x00c"); err == nil || err.ErrorType != signers.ErrorTypeUnknownKey {
+		t.Error("Expected a key ID containing NUL to be rejected.")
+	}
+	d.Known = func(realm string, id string) bool { return id == "a" }
+	if _, err := d.GetSecret("Pipet service", "b"); err == nil || err.ErrorType != signers.ErrorTypeUnknownKey {
+		t.Error("Expected an unknown key ID to be rejected.")
+	}
+	for _, short := range []string{"", "c2hvcnQ="} {
+		d.Master = short
+		if _, err := d.GetSecret("Pipet service", "a"); err == nil || err.ErrorType != signers.ErrorTypeInternalError {
+			t.Errorf("Expected the master secret %q to be rejected.", short)
+		}
+	}
+	d.Master = "not base64!"
+	if _, err := d.GetSecret("Pipet service", "a"); err == nil || err.Cause == nil {
+		t.Error("Expected an invalid master secret to fail with its cause.")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	secret, err := GenerateSecret(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := base64.StdEncoding.DecodeString(secret); err != nil || len(b) != 32 {
+		t.Errorf("Expected a base64 encoded 32 byte secret, got %s.", secret)
+	}
+	if other, _ := GenerateSecret(32); other == secret {
+		t.Error("Expected distinct secrets.")
+	}
+	if _, err := GenerateSecret(MinSecretLength - 1); err == nil {
+		t.Error("Expected a short secret to be refused.")
+	}
+	id, err := GenerateKeyID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+		t.Errorf("Expected a version 4 UUID, got %s.", id)
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+	"time"
+)
+
+// RequestAgeHook receives the age of a signed request: the current time of the server minus the time the
+// request claims to have been signed at (see Identity.Timestamp), negative for clocks running ahead of the
+// server. err is nil if the request was verified, and otherwise its failure, e.g. a timestamp out of range.
+type RequestAgeHook func(req *http.Request, keyID string, age time.Duration, err *signers.AuthenticationError)
+
+// WithRequestAgeHook reports the age of every signed request bearing a timestamp to hook once it is
+// verified or rejected, e.g. to track the clock drift of clients in a histogram before changing the
+// tolerance of TimestampValidator. The age is measured with the package clock (see signers.Now). Rejected
+// requests are reported with their unverified key ID.
+func WithRequestAgeHook(hook RequestAgeHook) Option {
+	return func(m *Middleware) {
+		m.onRequestAge = hook
+	}
+}
+
+func (m *Middleware) reportAge(req *http.Request, signer signers.Signer, authHeaders map[string]string, err *signers.AuthenticationError) {
+	if t, ok := requestTime(req, signer); ok {
+		m.onRequestAge(req, authHeaders["id"], signers.Now().Sub(t), err)
+	}
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/acquia/http-hmac-go/signers"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditDecision is the outcome of the verification of a request.
+type AuditDecision string
+
+const (
+	// The request was verified and handed to the handler.
+	AuditAllow AuditDecision = "allow"
+	// The request was rejected.
+	AuditDeny AuditDecision = "deny"
+)
+
+// AuditRecord describes the verification of a request.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// The key ID and realm the request was signed with, unverified for denied requests. Empty for requests
+	// without a credential.
+	KeyID    string        `json:"key_id,omitempty"`
+	Realm    string        `json:"realm,omitempty"`
+	Method   string        `json:"method"`
+	Path     string        `json:"path"`
+	Decision AuditDecision `json:"decision"`
+	// Code of the error of a denied request, as in the error responses, e.g. "signature_mismatch".
+	ErrorType  string `json:"error_type,omitempty"`
+	RemoteAddr string `json:"remote_addr"`
+}
+
+// AuditSink receives a record of every verification of the middleware, e.g. to keep the audit trail
+// compliance requires.
+type AuditSink interface {
+	Record(record *AuditRecord) error
+}
+
+// WithAuditSink records the verification of every request, except those skipped and anonymous ones, to sink.
+// Requests failing deferred body verification once the handler runs are recorded again, as denied.
+func WithAuditSink(sink AuditSink) Option {
+	return func(m *Middleware) {
+		m.audit = sink
+	}
+}
+
+func (m *Middleware) recordDecision(req *http.Request, identity *Identity, err *signers.AuthenticationError) {
+	if m.audit == nil {
+		return
+	}
+	r := &AuditRecord{
+		Time:       signers.Now(),
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		Decision:   AuditAllow,
+		RemoteAddr: req.RemoteAddr,
+	}
+	if identity == nil {
+		identity = m.credential(req)
+	}
+	r.KeyID, r.Realm = identity.KeyID, identity.Realm
+	if err != nil {
+		r.Decision = AuditDeny
+		r.ErrorType = ErrorCode(err.ErrorType)
+	}
+	if err := m.audit.Record(r); err != nil {
+		signers.Logf("Could not record audit record: %s", err.Error())
+	}
+}
+
+// Returns the identity of a request, unverified if it failed verification. Empty for requests without a
+// credential.
+func (m *Middleware) credential(req *http.Request) *Identity {
+	if identity, ok := FromContext(req.Context()); ok {
+		return identity
+	}
+	if signer := m.Identifier.IdentifySignature(req.Header.Get(m.authorizationHeader())); signer != nil {
+		return newIdentity(signer, signer.ParseAuthHeaders(req), req)
+	}
+	return &Identity{}
+}
+
+// JSONAuditSink writes audit records as JSON lines.
+type JSONAuditSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONAuditSink(w io.Writer) *JSONAuditSink {
+	return &JSONAuditSink{enc: json.NewEncoder(w)}
+}
+
+// NewStdoutAuditSink writes audit records as JSON lines to the standard output, e.g. for the log collector
+// of a container platform.
+func NewStdoutAuditSink() *JSONAuditSink {
+	return NewJSONAuditSink(os.Stdout)
+}
+
+func (s *JSONAuditSink) Record(record *AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(record)
+}
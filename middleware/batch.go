@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+	"runtime"
+	"sync"
+)
+
+// SignedMessage is a captured request to verify in a batch, e.g. recorded API traffic re-validated by an
+// audit pipeline or a queue consumer. VerifyBatch sets Identity or Err.
+type SignedMessage struct {
+	Request  *http.Request
+	Identity *Identity
+	Err      *signers.AuthenticationError
+}
+
+// VerifyBatch verifies messages concurrently and returns the number of messages that failed. Secrets are
+// looked up once per key ID and realm for the whole batch, unless the key provider hands out decoded key
+// material, which is released after each message as usual. Bodies are hashed with pooled hashers, as for
+// every request. Nonces are not recorded, since batches re-validate
+// traffic that has been accepted before, and failures are not counted by the lockout policy nor reported to
+// security hooks, the audit sink or the request age hook; timestamps are validated as configured on the
+// signers. Messages not verified before ctx is done fail with ErrorTypeInternalError.
+func (m *Middleware) VerifyBatch(ctx context.Context, msgs []*SignedMessage) int {
+	batch := *m
+	batch.Nonces = nil
+	// Failures of re-validated traffic must not lock out keys, trigger security hooks, or reach the audit
+	// trail and age metrics of live requests.
+	batch.lockout = nil
+	batch.events = nil
+	batch.audit = nil
+	batch.onRequestAge = nil
+	batch.idempotency = nil
+	if _, ok := m.Keys.(keys.SecretProvider); !ok {
+		batch.Keys = &batchKeys{
+			provider: m.Keys,
+			secrets:  map[batchKey]*batchSecret{},
+		}
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(msgs) {
+		workers = len(msgs)
+	}
+	work := make(chan *SignedMessage)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range work {
+				if ctx.Err() != nil {
+					msg.Err = signers.Errorf(500, signers.ErrorTypeInternalError, "Batch verification cancelled: %w", ctx.Err())
+				} else {
+					msg.Identity, msg.Err = batch.Verify(msg.Request)
+				}
+				if msg.Err != nil {
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, msg := range msgs {
+		work <- msg
+	}
+	close(work)
+	wg.Wait()
+	return failed
+}
+
+type batchKey struct {
+	realm string
+	id    string
+}
+
+type batchSecret struct {
+	once   sync.Once
+	secret string
+	err    *signers.AuthenticationError
+}
+
+// Caches the outcome of secret lookups for the duration of a batch. Each key is looked up once, concurrent
+// lookups of the same key waiting for the first; lookups of different keys run concurrently.
+type batchKeys struct {
+	provider keys.Provider
+	mu       sync.Mutex
+	secrets  map[batchKey]*batchSecret
+}
+
+func (b *batchKeys) GetSecret(realm string, id string) (string, *signers.AuthenticationError) {
+	k := batchKey{realm, id}
+	b.mu.Lock()
+	s, ok := b.secrets[k]
+	if !ok {
+		s = &batchSecret{}
+		b.secrets[k] = s
+	}
+	b.mu.Unlock()
+	s.once.Do(func() {
+		s.secret, s.err = b.provider.GetSecret(realm, id)
+	})
+	return s.secret, s.err
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"bytes"
+	"github.com/acquia/http-hmac-go/signers"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// WithMaxBodySize limits the size of request bodies buffered for verification. Larger requests are rejected
+// with 413 before the signature is checked.
+func WithMaxBodySize(n int64) Option {
+	return func(m *Middleware) {
+		m.maxBodySize = n
+	}
+}
+
+// Reads the request body into memory and restores it, so that signers may read it as often as they need to
+// and the wrapped handler still receives it in full. GetBody is set to replay the buffered body.
+func (m *Middleware) bufferBody(req *http.Request) *signers.AuthenticationError {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	var r io.Reader = req.Body
+	if m.maxBodySize > 0 {
+		r = io.LimitReader(req.Body, m.maxBodySize+1)
+	}
+	data, err := ioutil.ReadAll(r)
+	req.Body.Close()
+	if err != nil {
+		return signers.Errorf(400, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
+	}
+	if m.maxBodySize > 0 && int64(len(data)) > m.maxBodySize {
+		return signers.Errorf(413, signers.ErrorTypeBodyTooLarge, "Request body exceeds %d bytes.", m.maxBodySize)
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+	"strings"
+)
+
+// Challenge is sent in a WWW-Authenticate header when a request fails authentication, so that clients and
+// API gateways can discover the expected scheme and realm.
+type Challenge struct {
+	// Defaults to acquia-http-hmac.
+	Scheme string
+	Realm  string
+}
+
+// WithChallenge makes requests failing signature verification respond 401 with a WWW-Authenticate
+// challenge, instead of 403. Rate limited and unauthorized requests are not affected.
+func WithChallenge(challenge Challenge) Option {
+	return func(m *Middleware) {
+		if challenge.Scheme == "" {
+			challenge.Scheme = "acquia-http-hmac"
+		}
+		m.challenge = &challenge
+	}
+}
+
+func (c *Challenge) String() string {
+	r := strings.NewReplacer("\\", "\\\\", "\"", "\\\"")
+	return c.Scheme + " realm=\"" + r.Replace(c.Realm) + "\""
+}
+
+// Responds to a request that failed verification.
+func (m *Middleware) challengeFail(w http.ResponseWriter, req *http.Request, err *signers.AuthenticationError) {
+	err = m.mapStatus(err)
+	if m.challenge != nil && (err.HttpStatus == 401 || (err.HttpStatus == 403 && m.statuses == nil)) {
+		w.Header().Set("WWW-Authenticate", m.challenge.String())
+		challenged := *err
+		challenged.HttpStatus = 401
+		err = &challenged
+	}
+	m.fail(w, req, err)
+}
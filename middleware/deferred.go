@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+)
+
+// WithDeferredBodyVerification checks signatures against the signed content hash header without reading
+// the body first, for signers that support it (v2). The handler then reads the body through a verifying
+// reader, which fails at the end of a body that does not match, and the middleware replaces the response
+// with an error as long as none has been written before the body is verified: the first write to the
+// response reads whatever is left of the body. Large uploads are thus only read once and never buffered;
+// WithMaxBodySize does not apply, use V2Signer.MaxBodyBytes instead. Only Handler defers the check; Verify
+// and VerifyBatch still read the body first.
+func WithDeferredBodyVerification() Option {
+	return func(m *Middleware) {
+		m.deferBody = true
+	}
+}
+
+func (m *Middleware) checkDeferred(req *http.Request, signer signers.DeferredChecker, authHeaders map[string]string) (string, *signers.BodyVerifier, *signers.AuthenticationError) {
+	secret, err := m.Keys.GetSecret(authHeaders["realm"], authHeaders["id"])
+	if err != nil {
+		return "", nil, err
+	}
+	body, err := signer.CheckDeferred(req, secret)
+	return secret, body, err
+}
+
+// Verifies the rest of the request body before the response is committed, failing the request instead if
+// the body does not match its signed hash.
+type bodyCheckWriter struct {
+	http.ResponseWriter
+	m       *Middleware
+	req     *http.Request
+	body    *signers.BodyVerifier
+	checked bool
+	err     *signers.AuthenticationError
+}
+
+func (b *bodyCheckWriter) check() bool {
+	if !b.checked {
+		b.checked = true
+		if b.err = b.body.Verify(); b.err != nil {
+			b.m.fail(b.ResponseWriter, b.req, b.err)
+		}
+	}
+	return b.err == nil
+}
+
+func (b *bodyCheckWriter) WriteHeader(status int) {
+	if b.check() {
+		b.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (b *bodyCheckWriter) Write(p []byte) (int, error) {
+	if !b.check() {
+		return len(p), nil
+	}
+	return b.ResponseWriter.Write(p)
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+	"strings"
+)
+
+// ErrorResponder writes the response for a request that failed verification, rate limiting or
+// authorization, so that it can match the error envelope of the API.
+type ErrorResponder func(w http.ResponseWriter, req *http.Request, err *signers.AuthenticationError)
+
+func WithErrorResponder(responder ErrorResponder) Option {
+	return func(m *Middleware) {
+		m.errorResponder = responder
+	}
+}
+
+// ErrorCode returns a stable, machine readable code for an error type, e.g. "signature_mismatch".
+func ErrorCode(errtype signers.ErrorType) string {
+	return strings.Replace(signers.GetErrorTypeText(errtype), " ", "_", -1)
+}
+
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSONErrorResponder is the default ErrorResponder. It responds with the status of the error and a body
+// of the form {"code":"signature_mismatch","message":"..."}.
+func JSONErrorResponder(w http.ResponseWriter, req *http.Request, err *signers.AuthenticationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(err.HttpStatus)
+	json.NewEncoder(w).Encode(&errorBody{
+		Code:    ErrorCode(err.ErrorType),
+		Message: err.Message,
+	})
+}
+
+// PlainErrorResponder responds with the status of the error and its message as plain text.
+func PlainErrorResponder(w http.ResponseWriter, req *http.Request, err *signers.AuthenticationError) {
+	http.Error(w, err.Message, err.HttpStatus)
+}
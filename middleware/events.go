@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// FailureSource is what repeated signature failures are counted by.
+type FailureSource int
+
+const (
+	FailuresByKey FailureSource = iota
+	FailuresByIP
+)
+
+// SecurityHooks are called on the failures of requests that suggest an attack, e.g. to feed fail2ban-style
+// blocking or alerting. Nil hooks are not called. Key IDs are those claimed by the rejected requests.
+type SecurityHooks struct {
+	// Called when a request reuses the nonce of a verified one.
+	OnReplay func(req *http.Request, keyID, nonce string)
+	// Called when Threshold signature failures of a key ID or a client IP, given by value, occur within
+	// Window, with the number of failures, and then on every further failure within the window.
+	OnRepeatedFailures func(req *http.Request, source FailureSource, value string, failures int)
+	// Called when the Authorization header, or another header the signature requires, cannot be parsed or
+	// matches no supported signature version.
+	OnMalformedHeader func(req *http.Request, err *signers.AuthenticationError)
+	// Defaults to 5.
+	Threshold int
+	// Defaults to 5 minutes.
+	Window time.Duration
+}
+
+type securityEvents struct {
+	SecurityHooks
+	byKey, byIP *failureCounter
+}
+
+// WithSecurityHooks calls hooks on replayed nonces, repeated signature failures and malformed headers.
+func WithSecurityHooks(hooks SecurityHooks) Option {
+	return func(m *Middleware) {
+		if hooks.Threshold == 0 {
+			hooks.Threshold = 5
+		}
+		if hooks.Window == 0 {
+			hooks.Window = 5 * time.Minute
+		}
+		m.events = &securityEvents{
+			SecurityHooks: hooks,
+			byKey:         newFailureCounter(hooks.Window),
+			byIP:          newFailureCounter(hooks.Window),
+		}
+	}
+}
+
+// Calls the hooks matching the failure of a request.
+func (m *Middleware) securityEvent(req *http.Request, err *signers.AuthenticationError) {
+	e := m.events
+	if e == nil {
+		return
+	}
+	switch err.ErrorType {
+	case signers.ErrorTypeReplayedRequest:
+		if e.OnReplay != nil {
+			identity := m.credential(req)
+			e.OnReplay(req, identity.KeyID, identity.Nonce)
+		}
+	case signers.ErrorTypeSignatureMismatch:
+		if e.OnRepeatedFailures == nil {
+			return
+		}
+		if id := m.credential(req).KeyID; id != "" {
+			if n := e.byKey.add(id); n >= e.Threshold {
+				e.OnRepeatedFailures(req, FailuresByKey, id, n)
+			}
+		}
+		if ip := clientIP(req); ip != "" {
+			if n := e.byIP.add(ip); n >= e.Threshold {
+				e.OnRepeatedFailures(req, FailuresByIP, ip, n)
+			}
+		}
+	case signers.ErrorTypeInvalidAuthHeader, signers.ErrorTypeInvalidRequiredHeader, signers.ErrorTypeUnknownSignatureType:
+		if e.OnMalformedHeader != nil {
+			e.OnMalformedHeader(req, err)
+		}
+	}
+}
+
+// Returns the IP address of the client of a request.
+func clientIP(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// Counts the failures of every key within a window starting at its first failure.
+type failureCounter struct {
+	window time.Duration
+	mu     sync.Mutex
+	counts map[string]*failureCount
+}
+
+type failureCount struct {
+	n     int
+	start time.Time
+}
+
+func newFailureCounter(window time.Duration) *failureCounter {
+	return &failureCounter{
+		window: window,
+		counts: map[string]*failureCount{},
+	}
+}
+
+// Records a failure of key. Returns the number of failures of key within the window.
+func (c *failureCounter) add(key string) int {
+	now := signers.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fc, ok := c.counts[key]
+	if !ok || !now.Before(fc.start.Add(c.window)) {
+		if len(c.counts) >= 10000 {
+			c.prune(now)
+		}
+		fc = &failureCount{start: now}
+		c.counts[key] = fc
+	}
+	fc.n++
+	return fc.n
+}
+
+// Forgets the keys whose window is over, or all of them if none, so that their number stays bounded.
+func (c *failureCounter) prune(now time.Time) {
+	for key, fc := range c.counts {
+		if !now.Before(fc.start.Add(c.window)) {
+			delete(c.counts, key)
+		}
+	}
+	if len(c.counts) >= 10000 {
+		c.counts = map[string]*failureCount{}
+	}
+}
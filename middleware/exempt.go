@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SkipFunc reports whether a request bypasses verification.
+type SkipFunc func(req *http.Request) bool
+
+// WithSkip passes requests for which skip returns true on to the handler without verifying them, and
+// without an identity in their context. Skip rules of several options add up.
+func WithSkip(skip SkipFunc) Option {
+	return func(m *Middleware) {
+		m.skip = append(m.skip, skip)
+	}
+}
+
+// WithSkipPaths skips verification of requests for exactly the given paths, e.g. "/healthz".
+func WithSkipPaths(paths ...string) Option {
+	exempt := map[string]bool{}
+	for _, p := range paths {
+		exempt[p] = true
+	}
+	return WithSkip(func(req *http.Request) bool {
+		return exempt[req.URL.Path]
+	})
+}
+
+// WithSkipPathPrefixes skips verification of requests whose path starts with one of the prefixes, e.g.
+// "/metrics/". Prefixes are matched as strings, so "/metrics" also matches "/metricsfoo".
+func WithSkipPathPrefixes(prefixes ...string) Option {
+	return WithSkip(func(req *http.Request) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(req.URL.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithSkipMethods skips verification of requests with the given methods, e.g. "OPTIONS" for CORS preflight
+// requests, which browsers send without credentials.
+func WithSkipMethods(methods ...string) Option {
+	exempt := map[string]bool{}
+	for _, method := range methods {
+		exempt[strings.ToUpper(method)] = true
+	}
+	return WithSkip(func(req *http.Request) bool {
+		return exempt[req.Method]
+	})
+}
+
+func (m *Middleware) skipped(req *http.Request) bool {
+	for _, skip := range m.skip {
+		if skip(req) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,341 @@
+package middleware
+
+import (
+	"container/list"
+	"github.com/acquia/http-hmac-go/nonce"
+	"github.com/acquia/http-hmac-go/signers"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IdempotencyConfig enables the deduplication of redelivered requests: the response to a verified request
+// with a nonce is recorded under its key ID and nonce, and a request bearing the same signature again, which
+// replay protection would reject, gets the recorded response instead of reaching the handler a second time.
+// Clients retrying payment-style requests sign them with the same nonce, e.g. with hmacclient.WithRequestNonce.
+// Redeliveries arriving while the first delivery is handled by the same instance wait for its response.
+// Requests rejected once verified (e.g. by the rate limiter or the authorizer) and server errors (5xx) are
+// not recorded: their redeliveries are handled again. Recorded responses are signed anew for each
+// redelivery, so that clients re-signing their retries can check them. Requests with safe methods (GET,
+// HEAD and OPTIONS) are not recorded, and replay protection must be enabled.
+type IdempotencyConfig struct {
+	// Records the responses. Defaults to a MemoryResponseCache of 10000 responses.
+	Cache ResponseCache
+	// How long responses are replayed. Defaults to nonce.DefaultTTL, the time nonces are remembered.
+	TTL time.Duration
+	// Responses with a larger body are not recorded, and their redeliveries are rejected as replays.
+	// Defaults to 1 MiB.
+	MaxBodySize int
+}
+
+// CachedResponse is a response recorded for replay.
+type CachedResponse struct {
+	// Zero if the request was not answered for good, in which case redeliveries are handled again.
+	Status int
+	Header http.Header
+	Body   []byte
+	// Values of the trailers declared in Header.
+	Trailer http.Header
+}
+
+// ResponseCache records the responses to requests by key ID and nonce, e.g. in a store shared by several
+// instances.
+type ResponseCache interface {
+	// Returns false if no response is recorded under key, or it has expired.
+	Get(key string) (*CachedResponse, bool, error)
+	Set(key string, resp *CachedResponse, ttl time.Duration) error
+}
+
+type idempotency struct {
+	IdempotencyConfig
+	mu sync.Mutex
+	// Closed once the response to the request being handled under a key is recorded.
+	inflight map[string]chan struct{}
+}
+
+func WithIdempotency(config IdempotencyConfig) Option {
+	return func(m *Middleware) {
+		if config.Cache == nil {
+			config.Cache = NewMemoryResponseCache(10000)
+		}
+		if config.TTL == 0 {
+			config.TTL = nonce.DefaultTTL
+		}
+		if config.MaxBodySize == 0 {
+			config.MaxBodySize = 1 << 20
+		}
+		m.idempotency = &idempotency{
+			IdempotencyConfig: config,
+			inflight:          map[string]chan struct{}{},
+		}
+	}
+}
+
+// Returns the key the response to a request is recorded under, or false if it is not recorded.
+func (d *idempotency) key(req *http.Request, authHeaders map[string]string) (string, bool) {
+	if d == nil || authHeaders["nonce"] == "" {
+		return "", false
+	}
+	switch strings.ToUpper(req.Method) {
+	case "GET", "HEAD", "OPTIONS":
+		return "", false
+	}
+	return authHeaders["id"] + ":" + authHeaders["nonce"], true
+}
+
+// Marks the response to key as being recorded, unless it already is. Returns a function releasing the mark,
+// or nil if it was already marked.
+func (d *idempotency) begin(key string) func() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.inflight[key]; ok {
+		return nil
+	}
+	done := make(chan struct{})
+	d.inflight[key] = done
+	return func() {
+		d.mu.Lock()
+		delete(d.inflight, key)
+		d.mu.Unlock()
+		close(done)
+	}
+}
+
+// Records that the request under key was not answered for good, for its redeliveries to be handled again.
+func (d *idempotency) retry(key string) {
+	if err := d.Cache.Set(key, &CachedResponse{}, d.TTL); err != nil {
+		signers.Logf("Could not record response: %s", err.Error())
+	}
+}
+
+// Looks up the response recorded for a redelivered request, waiting for it if the first delivery is still
+// being handled. Returns the recorded response, or, if the request is to be handled again, the function
+// releasing the mark it is handled under. Fails with the replay error if no response is recorded.
+func (m *Middleware) redelivered(req *http.Request, v *verification) (*CachedResponse, func(), *signers.AuthenticationError) {
+	d := m.idempotency
+	key := v.idempotencyKey
+	for {
+		d.mu.Lock()
+		done, ok := d.inflight[key]
+		d.mu.Unlock()
+		if ok {
+			select {
+			case <-done:
+				continue
+			case <-req.Context().Done():
+				return nil, nil, v.replay
+			}
+		}
+		release := d.begin(key)
+		if release == nil {
+			continue
+		}
+		resp, ok, err := d.Cache.Get(key)
+		switch {
+		case err != nil:
+			release()
+			return nil, nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not read recorded response: %w", err)
+		case !ok:
+			release()
+			return nil, nil, v.replay
+		case resp.Status == 0:
+			return nil, release, nil
+		}
+		release()
+		return resp, nil, nil
+	}
+}
+
+// Answers a redelivered request with the recorded response, signed for it if responses are signed.
+func (m *Middleware) replay(w http.ResponseWriter, req *http.Request, v *verification, resp *CachedResponse) {
+	m.recordDecision(req, v.identity, nil)
+	recorded := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for k, v := range resp.Header {
+			w.Header()[k] = append([]string{}, v...)
+		}
+		w.WriteHeader(resp.Status)
+		w.Write(resp.Body)
+		for k, v := range resp.Trailer {
+			w.Header()[k] = append([]string{}, v...)
+		}
+	})
+	if m.signResponses {
+		m.serveSigned(w, req, recorded, v)
+		return
+	}
+	recorded.ServeHTTP(w, req)
+}
+
+// Wraps next to record its response, before it is signed, for redeliveries of the request.
+func (m *Middleware) recording(next http.Handler, v *verification) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rw := &recordingWriter{ResponseWriter: w, limit: m.idempotency.MaxBodySize, resp: &CachedResponse{}}
+		defer m.record(rw, v)
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// Writes a response through while recording it.
+type recordingWriter struct {
+	http.ResponseWriter
+	limit int
+	resp  *CachedResponse
+	// Set once the body exceeds the limit.
+	overflow bool
+}
+
+func (r *recordingWriter) WriteHeader(status int) {
+	if r.resp.Status == 0 {
+		r.resp.Status = status
+		r.resp.Header = r.Header().Clone()
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recordingWriter) Write(b []byte) (int, error) {
+	if r.resp.Status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.recordBody(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recordingWriter) recordBody(b []byte) {
+	if r.overflow {
+		return
+	}
+	if len(r.resp.Body)+len(b) > r.limit {
+		r.overflow = true
+		r.resp.Body = nil
+	} else {
+		r.resp.Body = append(r.resp.Body, b...)
+	}
+}
+
+// ReadFrom keeps the fast path of the underlying writer (see signers.SignableResponseWriter.ReadFrom),
+// recording what it reads.
+func (r *recordingWriter) ReadFrom(src io.Reader) (int64, error) {
+	rf, ok := r.ResponseWriter.(io.ReaderFrom)
+	if !ok {
+		return io.Copy(struct{ io.Writer }{r}, src)
+	}
+	if r.resp.Status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	if r.overflow {
+		return rf.ReadFrom(src)
+	}
+	return rf.ReadFrom(io.TeeReader(src, bodyRecorder{r}))
+}
+
+// Records what is read from the source of ReadFrom.
+type bodyRecorder struct {
+	r *recordingWriter
+}
+
+func (b bodyRecorder) Write(p []byte) (int, error) {
+	b.r.recordBody(p)
+	return len(p), nil
+}
+
+func (r *recordingWriter) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Records the response once the handler returned, unless it is too large. Server errors, and responses to
+// requests whose body turns out not to match its signature, are recorded as not answered for good.
+func (m *Middleware) record(r *recordingWriter, v *verification) {
+	if r.overflow {
+		return
+	}
+	if r.resp.Status == 0 {
+		r.resp.Status = http.StatusOK
+		r.resp.Header = r.Header().Clone()
+	}
+	if r.resp.Status >= 500 || (v.body != nil && v.body.Verify() != nil) {
+		m.idempotency.retry(v.idempotencyKey)
+		return
+	}
+	for _, names := range r.resp.Header.Values("Trailer") {
+		for _, name := range strings.Split(names, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if v, ok := r.Header()[name]; ok {
+				if r.resp.Trailer == nil {
+					r.resp.Trailer = http.Header{}
+				}
+				r.resp.Trailer[name] = append([]string{}, v...)
+			}
+		}
+	}
+	if err := m.idempotency.Cache.Set(v.idempotencyKey, r.resp, m.idempotency.TTL); err != nil {
+		signers.Logf("Could not record response: %s", err.Error())
+	}
+}
+
+// MemoryResponseCache is an in-memory ResponseCache for single-instance services, a least-recently-used
+// cache of bounded size.
+type MemoryResponseCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type cachedEntry struct {
+	key     string
+	resp    *CachedResponse
+	expires time.Time
+}
+
+// NewMemoryResponseCache creates a cache remembering up to capacity responses.
+func NewMemoryResponseCache(capacity int) *MemoryResponseCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &MemoryResponseCache{
+		capacity: capacity,
+		entries:  map[string]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+func (c *MemoryResponseCache) Get(key string) (*CachedResponse, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*cachedEntry)
+	if !signers.Now().Before(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(el)
+	return entry.resp, true, nil
+}
+
+func (c *MemoryResponseCache) Set(key string, resp *CachedResponse, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+		delete(c.entries, key)
+	}
+	for c.order.Len() >= c.capacity {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.entries, last.Value.(*cachedEntry).key)
+	}
+	c.entries[key] = c.order.PushFront(&cachedEntry{
+		key:     key,
+		resp:    resp,
+		expires: signers.Now().Add(ttl),
+	})
+	return nil
+}
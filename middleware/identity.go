@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Identity describes the credential a verified request was signed with.
+type Identity struct {
+	KeyID string
+	// Empty for signature versions without a realm (v1).
+	Realm   string
+	Version int
+	// The time the request claims to have been signed at: the timestamp header of the signer for v2,
+	// X-Authorization-Timestamp by default, the Date header for v1. Zero if it could not be determined, e.g.
+	// for session authenticated requests.
+	Timestamp time.Time
+	// Empty for signature versions without a nonce and session authenticated requests. Clients may derive
+	// it from an idempotency key, see hmacclient.WithRequestNonce, for it to double as a deduplication key.
+	Nonce string
+	// Headers covered by the signature, as listed in the Authorization header.
+	SignedHeaders []string
+}
+
+func newIdentity(signer signers.Signer, authHeaders map[string]string, req *http.Request) *Identity {
+	ret := &Identity{
+		KeyID:   authHeaders["id"],
+		Realm:   authHeaders["realm"],
+		Version: signer.Version(),
+		Nonce:   authHeaders["nonce"],
+	}
+	if h := authHeaders["headers"]; h != "" {
+		ret.SignedHeaders = strings.Split(h, ";")
+	}
+	ret.Timestamp, _ = requestTime(req, signer)
+	return ret
+}
+
+// Returns the time a request claims to have been signed at, see Identity.Timestamp. The timestamp is read
+// and parsed as configured on the timestamp validator of signer, if it has one.
+func requestTime(req *http.Request, signer signers.Signer) (time.Time, bool) {
+	tv := signers.DefaultTimestampValidator
+	if s, ok := signer.(signers.TimestampedSigner); ok {
+		tv = s.TimestampValidator()
+	}
+	if ts := req.Header.Get(tv.HeaderName()); ts != "" {
+		if t, err := tv.Parse(ts); err == nil {
+			return t, true
+		}
+	} else if date := req.Header.Get("Date"); date != "" {
+		if t, err := http.ParseTime(date); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+type contextKey int
+
+const identityKey contextKey = 0
+
+// NewContext returns a copy of ctx carrying the identity.
+func NewContext(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, identity)
+}
+
+// FromContext returns the identity of the verified request a context belongs to, as stored by the
+// middleware before calling the handler.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey).(*Identity)
+	return identity, ok
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"sync"
+	"time"
+)
+
+// LockoutPolicy throttles online brute-force attempts against secrets: it is told of the signature failures
+// and successes of every key ID, and consulted before the signature of a request is checked.
+type LockoutPolicy interface {
+	// Returns how long the key ID remains locked out, zero if it is not. Requests of a locked out key ID are
+	// rejected with 429 without checking their signature.
+	Locked(id string) time.Duration
+	// Called when a request of the key ID fails with a signature mismatch.
+	Failed(id string)
+	// Called when a request of the key ID is verified.
+	Succeeded(id string)
+}
+
+func WithLockout(policy LockoutPolicy) Option {
+	return func(m *Middleware) {
+		m.lockout = policy
+	}
+}
+
+// Lockout is a LockoutPolicy locking a key ID out once Threshold consecutive signature failures occur, for
+// Backoff, doubled on every further failure up to MaxBackoff. A verified request resets the count.
+type Lockout struct {
+	Threshold  int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Source of the current time. Defaults to the package clock.
+	Clock signers.Clock
+
+	mu      sync.Mutex
+	entries map[string]*lockoutEntry
+}
+
+type lockoutEntry struct {
+	failures int
+	until    time.Time
+}
+
+func NewLockout(threshold int, backoff, maxBackoff time.Duration) *Lockout {
+	return &Lockout{
+		Threshold:  threshold,
+		Backoff:    backoff,
+		MaxBackoff: maxBackoff,
+		entries:    map[string]*lockoutEntry{},
+	}
+}
+
+func (l *Lockout) Locked(id string) time.Duration {
+	now := signers.NowFrom(l.Clock)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.entries[id]; ok && now.Before(e.until) {
+		return e.until.Sub(now)
+	}
+	return 0
+}
+
+func (l *Lockout) Failed(id string) {
+	now := signers.NowFrom(l.Clock)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.entries == nil {
+		l.entries = map[string]*lockoutEntry{}
+	}
+	e, ok := l.entries[id]
+	if !ok {
+		e = &lockoutEntry{}
+		l.entries[id] = e
+	}
+	e.failures++
+	if e.failures < l.Threshold {
+		return
+	}
+	backoff := l.Backoff
+	for i := l.Threshold; i < e.failures && (l.MaxBackoff == 0 || backoff < l.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if l.MaxBackoff > 0 && backoff > l.MaxBackoff {
+		backoff = l.MaxBackoff
+	}
+	e.until = now.Add(backoff)
+}
+
+func (l *Lockout) Succeeded(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, id)
+}
+
+// Rejects the requests of locked out key IDs.
+func (m *Middleware) checkLockout(authHeaders map[string]string) *signers.AuthenticationError {
+	if m.lockout == nil {
+		return nil
+	}
+	if d := m.lockout.Locked(authHeaders["id"]); d > 0 {
+		return signers.Errorf(429, signers.ErrorTypeLockedOut, "Key ID %s is locked out for %s after repeated signature failures.", authHeaders["id"], d.Round(time.Second))
+	}
+	return nil
+}
+
+// Reports the outcome of a signature check to the lockout policy.
+func (m *Middleware) reportLockout(authHeaders map[string]string, err *signers.AuthenticationError) {
+	if m.lockout == nil {
+		return
+	}
+	if err == nil {
+		m.lockout.Succeeded(authHeaders["id"])
+	} else if err.ErrorType == signers.ErrorTypeSignatureMismatch {
+		m.lockout.Failed(authHeaders["id"])
+	}
+}
@@ -0,0 +1,454 @@
+package middleware
+
+import (
+	"context"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/nonce"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/compat"
+	"github.com/acquia/http-hmac-go/signers/v1"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"net/http"
+	"strings"
+)
+
+// Middleware verifies the HMAC signature of incoming requests before handing them to the wrapped handler.
+type Middleware struct {
+	Identifier signers.Identifier
+	Keys       keys.Provider
+	// Records nonces of verified requests to reject replays. Nil disables replay protection.
+	Nonces        nonce.Store
+	session       *SessionConfig
+	token         *TokenConfig
+	limiter       RateLimiter
+	onRequestAge  RequestAgeHook
+	audit         AuditSink
+	events        *securityEvents
+	lockout       LockoutPolicy
+	statuses      StatusTable
+	idempotency   *idempotency
+	authorizer    Authorizer
+	signResponses bool
+	// Whether signed responses are streamed, with the signature in a trailer.
+	streamResponses bool
+	// If positive, the size beyond which signed responses are no longer buffered.
+	responseBufferLimit int
+	largeResponses      LargeResponsePolicy
+	onLargeResponse     func(req *http.Request)
+	// Defaults to JSONErrorResponder.
+	errorResponder ErrorResponder
+	challenge      *Challenge
+	// Headers that must be signed, by realm.
+	requiredHeaders map[string][]string
+	// Accepted realms. Nil accepts any realm.
+	realms map[string]bool
+	// Maximum size of buffered request bodies. Zero means unlimited.
+	maxBodySize int64
+	deferBody   bool
+	// Header carrying signatures. Empty means Authorization.
+	authHeader string
+	// Rules for requests passed on without verification.
+	skip []SkipFunc
+	// Lets unsigned requests through as anonymous.
+	optional bool
+	// Assembles v2 signatures sent in individual X-Authorization-* headers.
+	paramHeaders bool
+}
+
+type Option func(*Middleware)
+
+// Authorizer decides whether a verified identity may perform a request, e.g. by checking per-key ACLs on the
+// path and method. Returning an error rejects the request with 403.
+type Authorizer func(ctx context.Context, identity *Identity, req *http.Request) error
+
+func WithAuthorizer(authorizer Authorizer) Option {
+	return func(m *Middleware) {
+		m.authorizer = authorizer
+	}
+}
+
+// WithNonceStore replaces the default in-memory nonce store, e.g. with one shared by several instances.
+// Passing nil disables replay protection.
+func WithNonceStore(store nonce.Store) Option {
+	return func(m *Middleware) {
+		m.Nonces = store
+	}
+}
+
+// WithAuthorizationHeader reads signatures from another header than Authorization, e.g.
+// X-Acquia-Authorization where intermediaries consume or strip the Authorization header. The v2 signer of
+// the default identifier is configured to match; a custom Identifier must be configured by the caller,
+// and must be set before this option is applied.
+func WithAuthorizationHeader(name string) Option {
+	return func(m *Middleware) {
+		m.authHeader = name
+		if id, ok := m.Identifier.(*compat.SignatureIdentifier); ok {
+			if signer, ok := id.GetSigner(2).(*v2.V2Signer); ok {
+				signer.AuthorizationHeader = name
+			}
+		}
+	}
+}
+
+// WithMissingSignedHeaders accepts v2 signatures listing headers in their headers parameter that are absent
+// from the request, signed as empty values, for clients that predate the check. It configures the v2 signer
+// of the identifier, which must be set before this option is applied.
+func WithMissingSignedHeaders() Option {
+	return func(m *Middleware) {
+		if id, ok := m.Identifier.(interface{ GetSigner(int) signers.Signer }); ok {
+			if signer, ok := id.GetSigner(2).(*v2.V2Signer); ok {
+				signer.AllowMissingSignedHeaders = true
+			}
+		}
+	}
+}
+
+// WithOptionalRealm accepts v2 signatures without a realm parameter, verified as signed for the empty realm,
+// for deployments without realms. It configures the v2 signer of the identifier, which must be set before
+// this option is applied.
+func WithOptionalRealm() Option {
+	return func(m *Middleware) {
+		if id, ok := m.Identifier.(interface{ GetSigner(int) signers.Signer }); ok {
+			if signer, ok := id.GetSigner(2).(*v2.V2Signer); ok {
+				signer.OptionalRealm = true
+			}
+		}
+	}
+}
+
+// WithProfile verifies v2 requests with the given profile, v2.Strict or v2.Compatible. It configures the v2
+// signer of the identifier, which must be set before this option is applied.
+func WithProfile(p v2.Profile) Option {
+	return func(m *Middleware) {
+		if id, ok := m.Identifier.(interface{ GetSigner(int) signers.Signer }); ok {
+			if signer, ok := id.GetSigner(2).(*v2.V2Signer); ok {
+				signer.Profile = p
+			}
+		}
+	}
+}
+
+// WithDeprecationHook calls hook whenever a v1 request is accepted, with the key ID and route, to track the
+// integrations left to migrate before turning v1 off. It configures the v1 signer of the identifier, which
+// must be set before this option is applied.
+func WithDeprecationHook(hook signers.DeprecationHook) Option {
+	return func(m *Middleware) {
+		if id, ok := m.Identifier.(interface{ GetSigner(int) signers.Signer }); ok {
+			if signer, ok := id.GetSigner(1).(*v1.V1Signer); ok {
+				signer.OnUse = hook
+			}
+		}
+	}
+}
+
+// WithParamHeaders accepts v2 signatures whose parameters are sent in individual headers, X-Authorization-Id,
+// X-Authorization-Signature and so on (see v2.AuthorizationFromParamHeaders), for clients behind CDNs and
+// WAFs that mangle the Authorization header. They are only read from requests without an Authorization
+// header, which is then set from them.
+func WithParamHeaders() Option {
+	return func(m *Middleware) {
+		m.paramHeaders = true
+	}
+}
+
+func (m *Middleware) readParamHeaders(req *http.Request) {
+	if !m.paramHeaders || req.Header.Get(m.authorizationHeader()) != "" {
+		return
+	}
+	if auth, ok := v2.AuthorizationFromParamHeaders(req.Header); ok {
+		req.Header.Set(m.authorizationHeader(), auth)
+	}
+}
+
+func (m *Middleware) authorizationHeader() string {
+	if m.authHeader == "" {
+		return "Authorization"
+	}
+	return m.authHeader
+}
+
+func New(provider keys.Provider, options ...Option) *Middleware {
+	m := &Middleware{
+		Identifier: compat.NewSupportedSignatureIdentifier(),
+		Keys:       provider,
+		Nonces:     nonce.NewMemoryStore(100000),
+	}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+// Verify identifies the signature version of a request, looks up the secret belonging to its key ID
+// and checks the signature. Returns the identity the request was signed with on success. The body is read
+// and checked against the signed content hash before Verify returns, even with
+// WithDeferredBodyVerification, as there is no handler to fail once the body is read.
+func (m *Middleware) Verify(req *http.Request) (*Identity, *signers.AuthenticationError) {
+	v, err := m.verify(req, false)
+	if err != nil {
+		return nil, err
+	}
+	if v.release != nil {
+		v.release()
+	}
+	if v.replay != nil {
+		return nil, v.replay
+	}
+	return v.identity, nil
+}
+
+// The outcome of a successful verification. Signer is nil for session authenticated requests.
+type verification struct {
+	identity *Identity
+	signer   signers.Signer
+	secret   string
+	// Set if the body is verified while the handler reads it.
+	body *signers.BodyVerifier
+	// The key the response is recorded under, if deduplicated (see WithIdempotency).
+	idempotencyKey string
+	// Set if the request is a redelivery, to be answered with the recorded response or failed with this error.
+	replay *signers.AuthenticationError
+	// Releases the mark of the response to the request as being recorded, if deduplicated.
+	release func()
+}
+
+// Identifies the signature scheme of the Authorization header. If the request carries several credentials,
+// in several header values or comma separated (e.g. appended by gateways), the first of a supported scheme
+// is selected, and left as the only value of the header for the signer to read.
+func (m *Middleware) identify(req *http.Request) (string, signers.Signer) {
+	m.readParamHeaders(req)
+	name := m.authorizationHeader()
+	values := req.Header.Values(name)
+	cred, signer := signers.IdentifyCredential(m.Identifier, values)
+	if signer != nil && (len(values) > 1 || cred != strings.TrimSpace(values[0])) {
+		req.Header.Set(name, cred)
+	}
+	return cred, signer
+}
+
+// Verifies a request. If deferBody is set, the body is checked while the handler reads it (see
+// WithDeferredBodyVerification) rather than before verify returns.
+func (m *Middleware) verify(req *http.Request, deferBody bool) (v *verification, err *signers.AuthenticationError) {
+	auth, signer := m.identify(req)
+	if auth == "" {
+		if ri, ok := m.Identifier.(signers.RequestIdentifier); ok {
+			signer = ri.IdentifyRequest(req)
+		}
+	}
+	if signer == nil && auth == "" {
+		return nil, signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header %s.", m.authorizationHeader())
+	}
+	if signer == nil {
+		return nil, signers.Errorf(403, signers.ErrorTypeUnknownSignatureType, "Authorization header does not match any supported signature version.")
+	}
+	authHeaders := signer.ParseAuthHeaders(req)
+	if m.onRequestAge != nil {
+		defer func() {
+			m.reportAge(req, signer, authHeaders, err)
+		}()
+	}
+	if err := m.checkRealm(authHeaders); err != nil {
+		return nil, err
+	}
+	if err := m.checkLockout(authHeaders); err != nil {
+		return nil, err
+	}
+	var secret string
+	var body *signers.BodyVerifier
+	if dc, ok := signer.(signers.DeferredChecker); ok && deferBody {
+		secret, body, err = m.checkDeferred(req, dc, authHeaders)
+		m.reportLockout(authHeaders, err)
+	} else if err = m.bufferBody(req); err == nil {
+		secret, err = m.checkSignature(req, signer, authHeaders)
+		m.reportLockout(authHeaders, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if nc, ok := signer.(signers.NarrowingChecker); ok && nc.NarrowsCredential() {
+		authHeaders = signer.ParseAuthHeaders(req)
+	}
+	if err := m.checkRequiredHeaders(req, authHeaders); err != nil {
+		return nil, err
+	}
+	key, dedup := m.idempotency.key(req, authHeaders)
+	var release func()
+	var replay *signers.AuthenticationError
+	if dedup {
+		// Marked before the nonce is recorded, so that a redelivery finding it recorded waits for the response.
+		release = m.idempotency.begin(key)
+	}
+	if dedup && release == nil {
+		// Another delivery holds the mark, and only its holder may record the nonce as fresh: this one is a
+		// redelivery waiting for its response.
+		replay = replayedNonce(authHeaders["nonce"])
+	} else {
+		replay = m.checkReplay(signer, authHeaders)
+	}
+	if replay != nil && (!dedup || replay.ErrorType != signers.ErrorTypeReplayedRequest) {
+		if release != nil {
+			release()
+		}
+		return nil, replay
+	}
+	return &verification{
+		identity:       newIdentity(signer, authHeaders, req),
+		signer:         signer,
+		secret:         secret,
+		body:           body,
+		idempotencyKey: key,
+		replay:         replay,
+		release:        release,
+	}, nil
+}
+
+// Checks the signature with decoded key material if both the key provider and the signer support it, unless
+// responses are signed, which needs the string secret. Returns the string secret if one was looked up.
+func (m *Middleware) checkSignature(req *http.Request, signer signers.Signer, authHeaders map[string]string) (string, *signers.AuthenticationError) {
+	if sp, ok := m.Keys.(keys.SecretProvider); ok && !m.signResponses {
+		if sc, ok := signer.(signers.SecretChecker); ok {
+			key, release, err := sp.GetSecretKey(authHeaders["realm"], authHeaders["id"])
+			if err != nil {
+				return "", err
+			}
+			defer release()
+			return "", sc.CheckSecret(req, key)
+		}
+	}
+	secret, err := m.Keys.GetSecret(authHeaders["realm"], authHeaders["id"])
+	if err != nil {
+		return "", err
+	}
+	return secret, signer.Check(req, secret)
+}
+
+// Records the nonce of a verified request for as long as the timestamp validator of signer accepts it.
+// Signature versions without a nonce (v1) are not protected.
+func (m *Middleware) checkReplay(signer signers.Signer, authHeaders map[string]string) *signers.AuthenticationError {
+	n := authHeaders["nonce"]
+	if m.Nonces == nil || n == "" {
+		return nil
+	}
+	ttl := nonce.DefaultTTL
+	if s, ok := signer.(signers.TimestampedSigner); ok {
+		ttl = s.TimestampValidator().NonceTTL()
+	}
+	fresh, err := m.Nonces.Add(authHeaders["id"]+":"+n, ttl)
+	if err != nil {
+		return signers.Errorf(500, signers.ErrorTypeInternalError, "Could not record nonce: %w", err)
+	}
+	if !fresh {
+		return replayedNonce(n)
+	}
+	return nil
+}
+
+func replayedNonce(n string) *signers.AuthenticationError {
+	return signers.Errorf(403, signers.ErrorTypeReplayedRequest, "Nonce %s has already been used.", n)
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if m.skipped(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		m.readParamHeaders(req)
+		var v *verification
+		if m.session != nil && req.Header.Get(m.authorizationHeader()) == "" {
+			if st, err := m.session.verify(req); err == nil {
+				v = &verification{
+					identity: st.identity(),
+				}
+			}
+		}
+		if v == nil && m.optional && m.unsigned(req) {
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), anonymousKey, true)))
+			return
+		}
+		if v == nil {
+			var err *signers.AuthenticationError
+			v, err = m.verify(req, m.deferBody)
+			if err != nil {
+				m.challengeFail(w, req, err)
+				return
+			}
+			if m.session != nil {
+				m.session.issue(w, v.identity)
+			}
+		}
+		if v.replay != nil {
+			if v.release != nil {
+				v.release()
+			}
+			resp, release, err := m.redelivered(req, v)
+			if err != nil {
+				m.fail(w, req, err)
+				return
+			}
+			if resp != nil {
+				m.replay(w, req, v, resp)
+				return
+			}
+			v.release, v.replay = release, nil
+		}
+		if v.release != nil {
+			defer v.release()
+		}
+		// Rejections past this point leave redeliveries to be handled again.
+		reject := func(err *signers.AuthenticationError) {
+			if v.idempotencyKey != "" {
+				m.idempotency.retry(v.idempotencyKey)
+			}
+			m.fail(w, req, err)
+		}
+		identity := v.identity
+		if m.limiter != nil && !m.limiter.Allow(identity.KeyID) {
+			reject(signers.Errorf(429, signers.ErrorTypeRateLimited, "Rate limit exceeded for key ID %s.", identity.KeyID))
+			return
+		}
+		req = req.WithContext(NewContext(req.Context(), identity))
+		if m.authorizer != nil {
+			if err := m.authorizer(req.Context(), identity, req); err != nil {
+				reject(signers.Errorf(403, signers.ErrorTypeAccessDenied, "Access denied: %w", err))
+				return
+			}
+		}
+		if m.token != nil {
+			token, err := m.token.Mint(identity)
+			if err != nil {
+				reject(err)
+				return
+			}
+			req.Header.Set(m.token.HeaderName, token)
+			req = req.WithContext(context.WithValue(req.Context(), tokenKey, token))
+		}
+		m.recordDecision(req, identity, nil)
+		h := next
+		if v.idempotencyKey != "" {
+			h = m.recording(h, v)
+		}
+		if v.body != nil {
+			bw := &bodyCheckWriter{ResponseWriter: w, m: m, req: req, body: v.body}
+			defer bw.check()
+			w = bw
+		}
+		if m.signResponses {
+			m.serveSigned(w, req, h, v)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+func (m *Middleware) fail(w http.ResponseWriter, req *http.Request, err *signers.AuthenticationError) {
+	err = m.mapStatus(err)
+	m.recordDecision(req, nil, err)
+	m.securityEvent(req, err)
+	signers.Logf("Request verification failed: %s", err.Message)
+	if m.errorResponder == nil {
+		JSONErrorResponder(w, req, err)
+		return
+	}
+	m.errorResponder(w, req, err)
+}
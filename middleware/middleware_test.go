@@ -0,0 +1,1474 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/nonce"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/compat"
+	"github.com/acquia/http-hmac-go/signers/httpsig"
+	"github.com/acquia/http-hmac-go/signers/mock"
+	"github.com/acquia/http-hmac-go/signers/v1"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testKeys = keys.Static{
+	"efdde334-fe7b-11e4-a322-1697f925ec7b": "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI=",
+}
+
+func LogTest(t *testing.T, args ...interface{}) {
+	t.Log("\033[34;1mTEST\033[0m", fmt.Sprint(args...))
+}
+
+func LogFail(t *testing.T, args ...interface{}) {
+	t.Log("\033[31;1mFAIL\033[0m", fmt.Sprint(args...))
+}
+
+func LogPass(t *testing.T, args ...interface{}) {
+	t.Log("\033[32;1mPASS\033[0m", fmt.Sprint(args...))
+}
+
+func LogSkip(t *testing.T, args ...interface{}) {
+	t.Log("\033[33;1mSKIP\033[0m", fmt.Sprint(args...))
+}
+
+func signedRequest(t *testing.T, id string, secret string) *http.Request {
+	req := httptest.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	signer, err := v2.NewV2Signer(sha256.New)
+	if err != nil {
+		t.Fatal("Failed to create signer: ", err.Message)
+	}
+	n, nerr := nonce.New()
+	if nerr != nil {
+		t.Fatal("Failed to generate nonce: ", nerr.Error())
+	}
+	authHeaders := map[string]string{
+		"realm": "Pipet service",
+		"id":    id,
+		"nonce": n,
+	}
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	return req
+}
+
+func serve(m *Middleware, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})).ServeHTTP(rec, req)
+	return rec
+}
+
+func panics(f func()) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+	f()
+	return false
+}
+
+func TestMiddleware(t *testing.T) {
+	evaluated := 0
+	skipped := 0
+	skipped_failure := 0
+	passed := 0
+	failed := 0
+
+	session := SessionConfig{Key: []byte("0123456789abcdef0123456789abcdef")}
+	m := New(testKeys, WithSession(session))
+
+	cases := []struct {
+		name     string
+		request  func() *http.Request
+		expected int
+	}{
+		{"valid signature", func() *http.Request {
+			return signedRequest(t, "efdde334-fe7b-11e4-a322-1697f925ec7b", testKeys["efdde334-fe7b-11e4-a322-1697f925ec7b"])
+		}, 200},
+		{"wrong secret", func() *http.Request {
+			return signedRequest(t, "efdde334-fe7b-11e4-a322-1697f925ec7b", "bXlzZWNyZXRzZWNyZXR0aGluZ3Rva2VlcA==")
+		}, 403},
+		{"unknown key", func() *http.Request {
+			return signedRequest(t, "615d6517-1cea-4aa3-b48e-96d83c16c4dd", testKeys["efdde334-fe7b-11e4-a322-1697f925ec7b"])
+		}, 403},
+		{"no authorization", func() *http.Request {
+			return httptest.NewRequest("GET", "http://example.acquiapipet.net/", nil)
+		}, 403},
+		{"forged session cookie", func() *http.Request {
+			req := httptest.NewRequest("GET", "http://example.acquiapipet.net/", nil)
+			req.AddCookie(&http.Cookie{Name: "hmac_session", Value: "eyJpZCI6ImFkbWluIiwiZXhwIjo5OTk5OTk5OTk5fQ.AAAA"})
+			return req
+		}, 403},
+	}
+
+	for k, c := range cases {
+		LogTest(t, "case ", k, " - ", c.name)
+		evaluated++
+		rec := serve(m, c.request())
+		if rec.Code != c.expected {
+			LogFail(t, "Expected status ", c.expected, " but got ", rec.Code, ": ", rec.Body.String())
+			failed++
+			t.Fail()
+		} else {
+			LogPass(t, "Got expected status ", c.expected)
+			passed++
+		}
+	}
+
+	LogTest(t, "replayed request is rejected")
+	evaluated++
+	replayed := signedRequest(t, "efdde334-fe7b-11e4-a322-1697f925ec7b", testKeys["efdde334-fe7b-11e4-a322-1697f925ec7b"])
+	serve(m, replayed)
+	if rec := serve(m, replayed); rec.Code != 403 {
+		LogFail(t, "Replayed request was accepted with status ", rec.Code)
+		failed++
+		t.Fail()
+	} else {
+		LogPass(t, "Replayed request rejected.")
+		passed++
+	}
+
+	LogTest(t, "session token issued after verification is accepted")
+	evaluated++
+	rec := serve(m, signedRequest(t, "efdde334-fe7b-11e4-a322-1697f925ec7b", testKeys["efdde334-fe7b-11e4-a322-1697f925ec7b"]))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "hmac_session" {
+		LogFail(t, "Expected a session cookie, got ", cookies)
+		failed++
+		skipped_failure++
+		t.Fail()
+	} else {
+		req := httptest.NewRequest("GET", "http://example.acquiapipet.net/dashboard", nil)
+		req.AddCookie(cookies[0])
+		if rec := serve(m, req); rec.Code != 200 {
+			LogFail(t, "Session cookie was rejected with status ", rec.Code, ": ", rec.Body.String())
+			failed++
+			t.Fail()
+		} else {
+			LogPass(t, "Session cookie accepted.")
+			passed++
+		}
+	}
+
+	t.Log("")
+	t.Log("Test results:")
+	t.Logf("%d \033[34mexpectations evaluated.\033[0m", evaluated)
+	t.Logf("%d \033[32mexpectations met.\033[0m", passed)
+	t.Logf("%d \033[31mexpectations not met.\033[0m", failed)
+	t.Logf("%d \033[33mpotential expectations skipped.\033[0m", skipped)
+	if failed > 0 {
+		t.Logf("(%d skipped expectations \033[31mnever evaluated due to failure.\033[0m)", skipped_failure)
+	}
+	if failed > 0 {
+		t.Log("Conclusion: test FAILED.")
+	} else {
+		t.Log("Conclusion: test PASSED.")
+	}
+}
+
+func TestSessionKeyLength(t *testing.T) {
+	for _, key := range [][]byte{nil, []byte("session-key")} {
+		if !panics(func() { WithSession(SessionConfig{Key: key}) }) {
+			t.Errorf("Expected a session key of %d bytes to be refused.", len(key))
+		}
+	}
+}
+
+func TestMiddlewareWithMockSigner(t *testing.T) {
+	accept := mock.Accepting(map[string]string{"id": "efdde334-fe7b-11e4-a322-1697f925ec7b"})
+	m := New(testKeys)
+	m.Identifier = &mock.Identifier{Signer: accept}
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("Authorization", "mock")
+	if rec := serve(m, req); rec.Code != 200 {
+		t.Error("Expected mock signer to accept request, got status ", rec.Code)
+	}
+	calls := accept.Calls()
+	if len(calls) == 0 || calls[len(calls)-1].Method != "Check" || calls[len(calls)-1].Secret != testKeys["efdde334-fe7b-11e4-a322-1697f925ec7b"] {
+		t.Error("Expected Check to be called with the looked up secret, got ", calls)
+	}
+
+	m.Identifier = &mock.Identifier{Signer: mock.Rejecting(signers.Errorf(403, signers.ErrorTypeSignatureMismatch, "nope"))}
+	if rec := serve(m, req); rec.Code != 403 {
+		t.Error("Expected mock signer to reject request, got status ", rec.Code)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	limiter := NewTokenBucket(1, 2)
+	for i, expected := range []bool{true, true, false} {
+		if limiter.Allow("a") != expected {
+			t.Error("Request ", i, " expected to be allowed: ", expected)
+		}
+	}
+	if !limiter.Allow("b") {
+		t.Error("Buckets are not kept per key ID.")
+	}
+	signers.OverrideClock(1432075983)
+	if !limiter.Allow("a") {
+		t.Error("Bucket did not refill.")
+	}
+	signers.RestoreClock()
+
+	m := New(testKeys, WithRateLimiter(NewTokenBucket(0, 1)))
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	if rec := serve(m, signedRequest(t, id, testKeys[id])); rec.Code != 200 {
+		t.Error("First request was rejected with status ", rec.Code)
+	}
+	if rec := serve(m, signedRequest(t, id, testKeys[id])); rec.Code != 429 {
+		t.Error("Expected second request to be rate limited, got status ", rec.Code)
+	}
+}
+
+func TestRateLimiterLiteral(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	limiter := &TokenBucket{Rate: 5, Burst: 1}
+	if !limiter.Allow("a") || limiter.Allow("a") {
+		t.Error("Expected a token bucket created as a struct literal to allow one request.")
+	}
+}
+
+func TestIdentityContext(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	var got *Identity
+	rec := httptest.NewRecorder()
+	New(testKeys).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	})).ServeHTTP(rec, signedRequest(t, id, testKeys[id]))
+	if got == nil || got.KeyID != id || got.Realm != "Pipet service" || got.Version != 2 {
+		t.Error("Handler did not receive the verified identity: ", got)
+	}
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("Found an identity in an empty context.")
+	}
+}
+
+func TestAuthorizer(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	m := New(testKeys, WithAuthorizer(func(ctx context.Context, identity *Identity, req *http.Request) error {
+		if identity.KeyID != id || identity.Realm != "Pipet service" || identity.Version != 2 || identity.Timestamp.IsZero() {
+			return fmt.Errorf("unexpected identity %v", *identity)
+		}
+		if req.Header.Get("X-Deny") != "" {
+			return fmt.Errorf("key %s is denied", identity.KeyID)
+		}
+		return nil
+	}))
+	if rec := serve(m, signedRequest(t, id, testKeys[id])); rec.Code != 200 {
+		t.Error("Authorized request was rejected with status ", rec.Code, ": ", rec.Body.String())
+	}
+	req := signedRequest(t, id, testKeys[id])
+	req.Header.Set("X-Deny", "1")
+	if rec := serve(m, req); rec.Code != 403 || !strings.Contains(rec.Body.String(), "denied") {
+		t.Error("Expected request to be denied by the authorizer, got status ", rec.Code, ": ", rec.Body.String())
+	}
+}
+
+func TestResponseSigning(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	m := New(testKeys, WithResponseSigning())
+	req := signedRequest(t, id, testKeys[id])
+	rec := serve(m, req)
+	if rec.Code != 200 || rec.Body.String() != "ok" {
+		t.Fatal("Unexpected response ", rec.Code, ": ", rec.Body.String())
+	}
+	signer, _ := v2.NewV2Signer(sha256.New)
+	if err := signer.GetResponseSigner().Check(req, rec.Result(), testKeys[id]); err != nil {
+		t.Error("Response signature does not verify: ", err.Message)
+	}
+}
+
+func TestSkipResponseSigning(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	m := New(testKeys, WithResponseSigning())
+	for _, h := range []http.Handler{
+		WithoutResponseSigning(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("streamed"))
+		})),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("stream"))
+			SkipResponseSigning(r)
+			w.Write([]byte("ed"))
+		}),
+	} {
+		rec := httptest.NewRecorder()
+		m.Handler(h).ServeHTTP(rec, signedRequest(t, id, testKeys[id]))
+		if rec.Body.String() != "streamed" {
+			t.Error("Unexpected response body: ", rec.Body.String())
+		}
+		if rec.Header().Get("X-Server-Authorization-HMAC-SHA256") != "" {
+			t.Error("Response was signed despite opting out.")
+		}
+	}
+}
+
+func TestErrorResponder(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	req := signedRequest(t, id, "c2VjcmV0")
+	rec := serve(New(testKeys), req)
+	if rec.Code != 403 || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatal("Unexpected default error response ", rec.Code, ": ", rec.Body.String())
+	}
+	body := map[string]string{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal("Default error body is not JSON: ", rec.Body.String())
+	}
+	if body["code"] != "signature_mismatch" || body["message"] == "" {
+		t.Error("Unexpected default error body: ", rec.Body.String())
+	}
+
+	m := New(testKeys, WithErrorResponder(func(w http.ResponseWriter, r *http.Request, err *signers.AuthenticationError) {
+		w.WriteHeader(401)
+		fmt.Fprintf(w, "%s %s: %s", r.Method, r.URL.Path, ErrorCode(err.ErrorType))
+	}))
+	rec = serve(m, signedRequest(t, "unknown", "c2VjcmV0"))
+	if rec.Code != 401 || rec.Body.String() != "GET /v1.0/task-status/133: unknown_key" {
+		t.Error("Unexpected custom error response ", rec.Code, ": ", rec.Body.String())
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	if rec := serve(New(testKeys), signedRequest(t, id, "c2VjcmV0")); rec.Code != 403 || rec.Header().Get("WWW-Authenticate") != "" {
+		t.Error("Expected no challenge by default, got status ", rec.Code, " and ", rec.Header().Get("WWW-Authenticate"))
+	}
+
+	m := New(testKeys, WithChallenge(Challenge{Realm: `Pipet "service"`}), WithRateLimiter(NewTokenBucket(0, 1)))
+	rec := serve(m, signedRequest(t, id, "c2VjcmV0"))
+	if rec.Code != 401 || rec.Header().Get("WWW-Authenticate") != `acquia-http-hmac realm="Pipet \"service\""` {
+		t.Error("Expected a challenge, got status ", rec.Code, " and ", rec.Header().Get("WWW-Authenticate"))
+	}
+	if rec := serve(m, signedRequest(t, id, testKeys[id])); rec.Code != 200 || rec.Header().Get("WWW-Authenticate") != "" {
+		t.Error("Unexpected response to a valid request: ", rec.Code)
+	}
+	if rec := serve(m, signedRequest(t, id, testKeys[id])); rec.Code != 429 || rec.Header().Get("WWW-Authenticate") != "" {
+		t.Error("Expected rate limited request not to be challenged, got status ", rec.Code)
+	}
+}
+
+func TestRequiredHeaders(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	signer, err := v2.NewV2Signer(sha256.New)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	sign := func(realm string, requestID string, signed string) *http.Request {
+		req := httptest.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133", nil)
+		if requestID != "" {
+			req.Header.Set("X-Request-ID", requestID)
+		}
+		n, _ := nonce.New()
+		authHeaders := map[string]string{
+			"realm": realm,
+			"id":    id,
+			"nonce": n,
+		}
+		if signed != "" {
+			authHeaders["headers"] = signed
+		}
+		if err := signer.SignDirect(req, authHeaders, testKeys[id]); err != nil {
+			t.Fatal("Failed to sign request: ", err.Message)
+		}
+		return req
+	}
+	m := New(testKeys, WithRequiredHeaders("Pipet service", "X-Request-ID"))
+	expected := map[*http.Request]int{
+		sign("Pipet service", "42", "x-request-id"): 200,
+		sign("Pipet service", "42", ""):             403,
+		sign("Pipet service", "", ""):               403,
+		sign("Other service", "", ""):               200,
+	}
+	for req, code := range expected {
+		if rec := serve(m, req); rec.Code != code {
+			t.Errorf("Expected status %d for request signed with %s, got %d: %s", code, req.Header.Get("Authorization"), rec.Code, rec.Body.String())
+		}
+	}
+
+	m = New(testKeys, WithRequiredHeaders("", "X-Request-ID"))
+	if rec := serve(m, sign("Other service", "", "")); rec.Code != 403 {
+		t.Error("Expected the default policy to apply to other realms, got status ", rec.Code)
+	}
+}
+
+// Hands out decoded secrets and wipes them on release.
+type wipingKeys struct {
+	keys.Static
+	released int
+}
+
+func (k *wipingKeys) GetSecretKey(realm string, id string) (signers.Secret, func(), *signers.AuthenticationError) {
+	encoded, err := k.GetSecret(realm, id)
+	if err != nil {
+		return signers.Secret{}, nil, err
+	}
+	secret, err := signers.Base64Secret(encoded)
+	if err != nil {
+		return signers.Secret{}, nil, err
+	}
+	return secret, func() {
+		secret.Wipe()
+		k.released++
+	}, nil
+}
+
+func TestSecretProvider(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	provider := &wipingKeys{Static: testKeys}
+	m := New(provider)
+	if rec := serve(m, signedRequest(t, id, testKeys[id])); rec.Code != 200 {
+		t.Error("Request verified with a decoded secret was rejected with status ", rec.Code, ": ", rec.Body.String())
+	}
+	if rec := serve(m, signedRequest(t, id, "c2VjcmV0")); rec.Code != 403 {
+		t.Error("Expected request with the wrong secret to be rejected, got status ", rec.Code)
+	}
+	if provider.released != 2 {
+		t.Errorf("Expected both secrets to be released, got %d.", provider.released)
+	}
+}
+
+type countingKeys struct {
+	keys.Static
+	lookups int32
+}
+
+func (c *countingKeys) GetSecret(realm string, id string) (string, *signers.AuthenticationError) {
+	atomic.AddInt32(&c.lookups, 1)
+	return c.Static.GetSecret(realm, id)
+}
+
+func TestVerifyBatch(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	provider := &countingKeys{Static: testKeys}
+	m := New(provider)
+	msgs := []*SignedMessage{}
+	for i := 0; i < 20; i++ {
+		msgs = append(msgs, &SignedMessage{Request: signedRequest(t, id, testKeys[id])})
+	}
+	replayed := signedRequest(t, id, testKeys[id])
+	if _, err := m.Verify(replayed); err != nil {
+		t.Fatal(err.Message)
+	}
+	msgs = append(msgs, &SignedMessage{Request: replayed}, &SignedMessage{Request: signedRequest(t, id, "c2VjcmV0")})
+	atomic.StoreInt32(&provider.lookups, 0)
+
+	if failed := m.VerifyBatch(context.Background(), msgs); failed != 1 {
+		t.Errorf("Expected one message to fail, got %d.", failed)
+	}
+	for i, msg := range msgs[:21] {
+		if msg.Err != nil || msg.Identity == nil || msg.Identity.KeyID != id {
+			t.Errorf("Message %d was not verified: %v", i, msg.Err)
+		}
+	}
+	if err := msgs[21].Err; err == nil || err.ErrorType != signers.ErrorTypeSignatureMismatch {
+		t.Error("Expected message signed with the wrong secret to fail.")
+	}
+	if n := atomic.LoadInt32(&provider.lookups); n != 1 {
+		t.Errorf("Expected a single key lookup for the batch, got %d.", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	msgs = []*SignedMessage{{Request: signedRequest(t, id, testKeys[id])}}
+	if failed := m.VerifyBatch(ctx, msgs); failed != 1 || msgs[0].Err == nil {
+		t.Error("Expected messages not to be verified once the context is done.")
+	}
+
+	lockout := NewLockout(1, time.Minute, time.Minute)
+	m = New(testKeys, WithLockout(lockout))
+	msgs = []*SignedMessage{{Request: signedRequest(t, id, "c2VjcmV0")}}
+	if failed := m.VerifyBatch(context.Background(), msgs); failed != 1 {
+		t.Errorf("Expected the message to fail, got %d failures.", failed)
+	}
+	if d := lockout.Locked(id); d != 0 {
+		t.Error("Expected batch failures not to lock the key out, locked for ", d)
+	}
+}
+
+// Blocks the lookup of a key until another key is looked up.
+type blockingKeys struct {
+	keys.Static
+	other chan struct{}
+}
+
+func (b *blockingKeys) GetSecret(realm string, id string) (string, *signers.AuthenticationError) {
+	if id == "a" {
+		select {
+		case <-b.other:
+		case <-time.After(time.Second):
+			return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Lookups are serialized.")
+		}
+	} else {
+		close(b.other)
+	}
+	return b.Static.GetSecret(realm, id)
+}
+
+func TestBatchKeysConcurrency(t *testing.T) {
+	b := &batchKeys{
+		provider: &blockingKeys{Static: keys.Static{"a": "c2VjcmV0", "b": "c2VjcmV0"}, other: make(chan struct{})},
+		secrets:  map[batchKey]*batchSecret{},
+	}
+	done := make(chan *signers.AuthenticationError)
+	go func() {
+		_, err := b.GetSecret("", "a")
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := b.GetSecret("", "b"); err != nil {
+		t.Fatal(err.Message)
+	}
+	if err := <-done; err != nil {
+		t.Error("Expected lookups of different keys to run concurrently: ", err.Message)
+	}
+}
+
+func signedPost(t *testing.T, body string) *http.Request {
+	req := httptest.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/plain")
+	signer, _ := v2.NewV2Signer(sha256.New)
+	n, _ := nonce.New()
+	authHeaders := map[string]string{
+		"realm": "Pipet service",
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": n,
+	}
+	if err := signer.SignDirect(req, authHeaders, "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	req.GetBody = nil
+	return req
+}
+
+func TestMaxBodySize(t *testing.T) {
+	m := New(testKeys, WithMaxBodySize(16))
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, signedPost(t, "small payload"))
+	if rec.Code != 200 || rec.Body.String() != "small payload" {
+		t.Errorf("Expected the handler to receive the verified body, got status %d and %q.", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, signedPost(t, "a payload larger than the limit"))
+	if rec.Code != 413 || !strings.Contains(rec.Body.String(), "body_too_large") {
+		t.Errorf("Expected oversized body to be rejected with 413, got status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDeferredBodyVerification(t *testing.T) {
+	m := New(testKeys, WithDeferredBodyVerification())
+	var handlerErr error
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, handlerErr = io.Copy(w, r.Body)
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, signedPost(t, "streamed upload"))
+	if rec.Code != 200 || rec.Body.String() != "streamed upload" || handlerErr != nil {
+		t.Errorf("Expected the streamed body to verify, got status %d and %q.", rec.Code, rec.Body.String())
+	}
+
+	tampered := signedPost(t, "streamed upload")
+	tampered.Body = ioutil.NopCloser(strings.NewReader("tampered upload"))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tampered)
+	if rec.Code != 403 || strings.Contains(rec.Body.String(), "tampered") || handlerErr == nil {
+		t.Errorf("Expected tampered body to fail the request, got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Handlers that respond without reading the body still get it verified.
+	tampered = signedPost(t, "streamed upload")
+	tampered.Body = ioutil.NopCloser(strings.NewReader("tampered upload"))
+	rec = serve(m, tampered)
+	if rec.Code != 403 {
+		t.Errorf("Expected unread tampered body to fail the request, got status %d.", rec.Code)
+	}
+
+	// Verify has no handler to fail later, so it checks the body before returning.
+	tampered = signedPost(t, "streamed upload")
+	tampered.Body = ioutil.NopCloser(strings.NewReader("tampered upload"))
+	if _, err := m.Verify(tampered); err == nil || err.ErrorType != signers.ErrorTypeInvalidRequiredHeader {
+		t.Error("Expected Verify to reject a tampered body.")
+	}
+	req := signedPost(t, "streamed upload")
+	if _, err := m.Verify(req); err != nil {
+		t.Fatal("Expected Verify to accept the signed body: ", err.Message)
+	}
+	if body, _ := ioutil.ReadAll(req.Body); string(body) != "streamed upload" {
+		t.Errorf("Expected the verified body to be readable after Verify, got %q.", body)
+	}
+}
+
+func TestWith(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	base := New(testKeys, WithRequiredHeaders("Other service", "X-Request-ID"))
+	admin := base.With(WithRealms("Admin"))
+	other := base.With(WithKeys(keys.Static{}))
+
+	if rec := serve(base, signedRequest(t, id, testKeys[id])); rec.Code != 200 {
+		t.Error("Expected the base middleware to be unaffected by copies, got status ", rec.Code)
+	}
+	if rec := serve(admin, signedRequest(t, id, testKeys[id])); rec.Code != 403 {
+		t.Error("Expected a request of another realm to be rejected, got status ", rec.Code)
+	}
+	if rec := serve(base.With(WithRealms("Admin", "Pipet service")), signedRequest(t, id, testKeys[id])); rec.Code != 200 {
+		t.Error("Expected a request of an accepted realm to pass, got status ", rec.Code)
+	}
+	admin = base.With(WithRequiredHeaders("Pipet service", "X-Request-ID"))
+	if rec := serve(admin, signedRequest(t, id, testKeys[id])); rec.Code != 403 {
+		t.Error("Expected the route's required headers to apply, got status ", rec.Code)
+	}
+	if _, ok := admin.requiredHeaders["Other service"]; !ok {
+		t.Error("Expected the copy to inherit the required headers of the base middleware")
+	}
+	if rec := serve(other, signedRequest(t, id, testKeys[id])); rec.Code != 403 {
+		t.Error("Expected the route's key provider to be used, got status ", rec.Code)
+	}
+
+	req := signedRequest(t, id, testKeys[id])
+	replay := req.Clone(context.Background())
+	serve(base, req)
+	if rec := serve(base.With(), replay); rec.Code != 403 {
+		t.Error("Expected copies to share the nonce store, got status ", rec.Code)
+	}
+}
+
+func TestWithSignerOptions(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	unsigned := func() *http.Request {
+		req := signedRequest(t, id, testKeys[id])
+		req.Header.Set("X-Authorization-Extra", "unsigned")
+		return req
+	}
+	for _, identifier := range []signers.Identifier{compat.NewSupportedSignatureIdentifier(), compat.NewMigrationIdentifier(compat.MigrationConfig{})} {
+		base := New(testKeys)
+		base.Identifier = identifier
+		strict := base.With(WithProfile(v2.Strict), WithExtendedResponseSigning("Content-Type"))
+		if rec := serve(strict, unsigned()); rec.Code != 403 {
+			t.Errorf("Expected the route's profile to apply with %T, got status %d.", identifier, rec.Code)
+		}
+		if rec := serve(base, unsigned()); rec.Code != 200 {
+			t.Errorf("Expected the parent to be unaffected by the route's profile with %T, got status %d.", identifier, rec.Code)
+		}
+		rs := base.Identifier.(interface{ GetSigner(int) signers.Signer }).GetSigner(2).GetResponseSigner().(*v2.V2ResponseSigner)
+		if rs.Extended {
+			t.Errorf("Expected the parent's response signer to be unaffected with %T.", identifier)
+		}
+	}
+}
+
+func TestAuthorizationHeader(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	req := signedRequest(t, id, testKeys[id])
+	req.Header.Set("X-Acquia-Authorization", req.Header.Get("Authorization"))
+	req.Header.Del("Authorization")
+	if rec := serve(New(testKeys), req.Clone(context.Background())); rec.Code != 403 {
+		t.Error("Expected a request without Authorization to be rejected by default, got status ", rec.Code)
+	}
+	if rec := serve(New(testKeys, WithAuthorizationHeader("X-Acquia-Authorization")), req); rec.Code != 200 {
+		t.Error("Expected the signature to be read from X-Acquia-Authorization, got status ", rec.Code, ": ", rec.Body.String())
+	}
+}
+
+func TestMessageSignatures(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	signer, err := httpsig.NewMessageSigner(sha256.New)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	req := httptest.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(`{"task":1}`))
+	n, _ := nonce.New()
+	if err := signer.SignDirect(req, map[string]string{"id": id, "nonce": n, "realm": "Pipet service"}, testKeys[id]); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	m := New(testKeys)
+	replay := req.Clone(context.Background())
+	replay.Body = ioutil.NopCloser(strings.NewReader(`{"task":1}`))
+	if rec := serve(m, req); rec.Code != 200 {
+		t.Error("Expected an HTTP Message Signature to be verified with the same keys, got status ", rec.Code, ": ", rec.Body.String())
+	}
+	if rec := serve(m, replay); !strings.Contains(rec.Body.String(), "replayed_request") {
+		t.Error("Expected the nonce of an HTTP Message Signature to be recorded, got ", rec.Code, ": ", rec.Body.String())
+	}
+}
+
+func TestToken(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	config := TokenConfig{
+		Key:      []byte("downstream-key-downstream-key-do"),
+		Issuer:   "edge",
+		Audience: "backend",
+	}
+	m := New(testKeys, WithToken(config))
+	var token string
+	var fromContext string
+	req := signedRequest(t, id, testKeys[id])
+	req.Header.Set("X-Hmac-Token", "forged")
+	rec := httptest.NewRecorder()
+	m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Hmac-Token")
+		fromContext, _ = TokenFromContext(r.Context())
+	})).ServeHTTP(rec, req)
+	if rec.Code != 200 || token == "" || token == "forged" || token != fromContext {
+		t.Fatal("Expected a token to be minted, got ", rec.Code, " ", token)
+	}
+
+	identity, err := config.ParseToken(token)
+	if err != nil {
+		t.Fatal("Failed to parse minted token: ", err.Message)
+	}
+	if identity.KeyID != id || identity.Realm != "Pipet service" || identity.Version != 2 {
+		t.Error("Unexpected identity in token: ", identity)
+	}
+	other := config
+	other.Audience = "another"
+	if _, err := other.ParseToken(token); err == nil {
+		t.Error("Expected a token for another audience to be rejected.")
+	}
+	other = config
+	other.Key = []byte("another-key-another-key-another-")
+	if _, err := other.ParseToken(token); err == nil || err.ErrorType != signers.ErrorTypeSignatureMismatch {
+		t.Error("Expected a token signed with another key to be rejected.")
+	}
+	other.Key = nil
+	if _, err := other.ParseToken(token); err == nil || err.ErrorType != signers.ErrorTypeInternalError {
+		t.Error("Expected parsing a token without a key to fail.")
+	}
+	if _, err := other.Mint(identity); err == nil || err.ErrorType != signers.ErrorTypeInternalError {
+		t.Error("Expected minting a token without a key to fail.")
+	}
+	if !panics(func() { WithToken(TokenConfig{Key: []byte("downstream-key")}) }) {
+		t.Error("Expected a short token key to be refused.")
+	}
+	parts := strings.Split(token, ".")
+	if _, err := config.ParseToken("eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + parts[1] + "."); err == nil {
+		t.Error("Expected an unsigned token to be rejected.")
+	}
+	signers.OverrideClock(time.Now().Unix() + 3600)
+	defer signers.RestoreClock()
+	if _, err := config.ParseToken(token); err == nil || err.ErrorType != signers.ErrorTypeTimestampRangeError {
+		t.Error("Expected an expired token to be rejected.")
+	}
+}
+
+func TestDeprecationHook(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	signer, err := v1.NewV1Signer(sha256.New)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	req := httptest.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133", nil)
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	if err := signer.SignDirect(req, map[string]string{"id": id, "realm": "Pipet service"}, testKeys[id]); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	var events []*signers.DeprecationEvent
+	m := New(testKeys, WithDeprecationHook(func(event *signers.DeprecationEvent) {
+		events = append(events, event)
+	}))
+	if rec := serve(m, req); rec.Code != 200 {
+		t.Fatal("Expected a v1 request to be accepted, got status ", rec.Code, ": ", rec.Body.String())
+	}
+	if rec := serve(m, signedRequest(t, id, testKeys[id])); rec.Code != 200 {
+		t.Fatal("Expected a v2 request to be accepted, got status ", rec.Code, ": ", rec.Body.String())
+	}
+	if len(events) != 1 {
+		t.Fatal("Expected one deprecation event, got ", len(events))
+	}
+	if e := events[0]; e.Version != 1 || e.KeyID != id || e.Method != "GET" || e.Path != "/v1.0/task-status/133" || e.Signed {
+		t.Error("Unexpected deprecation event: ", e)
+	}
+}
+
+func TestSkip(t *testing.T) {
+	m := New(testKeys, WithSkipPaths("/healthz"), WithSkipPathPrefixes("/metrics/"), WithSkipMethods("options"),
+		WithSkip(func(req *http.Request) bool {
+			return req.Header.Get("X-Internal-Probe") != ""
+		}))
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "http://example.acquiapipet.net/healthz", nil),
+		httptest.NewRequest("GET", "http://example.acquiapipet.net/metrics/runtime", nil),
+		httptest.NewRequest("OPTIONS", "http://example.acquiapipet.net/v1.0/task", nil),
+	} {
+		if rec := serve(m, req); rec.Code != 200 {
+			t.Error("Expected ", req.Method, " ", req.URL.Path, " to skip verification, got status ", rec.Code)
+		}
+	}
+	probe := httptest.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task", nil)
+	probe.Header.Set("X-Internal-Probe", "1")
+	if rec := serve(m, probe); rec.Code != 200 {
+		t.Error("Expected the predicate to skip verification, got status ", rec.Code)
+	}
+	for _, path := range []string{"/healthz/details", "/metrics", "/v1.0/task"} {
+		if rec := serve(m, httptest.NewRequest("GET", "http://example.acquiapipet.net"+path, nil)); rec.Code == 200 {
+			t.Error("Expected GET ", path, " to be verified.")
+		}
+	}
+}
+
+func TestOptionalAuthentication(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	m := New(testKeys, WithOptionalAuthentication())
+	var anonymous, identified bool
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		anonymous = IsAnonymous(r.Context())
+		_, identified = FromContext(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133", nil))
+	if rec.Code != 200 || !anonymous || identified {
+		t.Error("Expected an unsigned request to be let through as anonymous, got status ", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedRequest(t, id, testKeys[id]))
+	if rec.Code != 200 || anonymous || !identified {
+		t.Error("Expected a signed request to be verified, got status ", rec.Code)
+	}
+
+	req := signedRequest(t, id, "c2VjcmV0")
+	if rec := serve(m, req); rec.Code != 403 {
+		t.Error("Expected a request with an invalid signature to be rejected, got status ", rec.Code)
+	}
+}
+
+func TestMultipleCredentials(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	m := New(testKeys)
+	req := signedRequest(t, id, testKeys[id])
+	req.Header.Add("Authorization", "Bearer gateway-token")
+	req.Header["Authorization"][0], req.Header["Authorization"][1] = req.Header["Authorization"][1], req.Header["Authorization"][0]
+	if rec := serve(m, req); rec.Code != 200 {
+		t.Error("Expected the signature to be found among several Authorization values, got status ", rec.Code, ": ", rec.Body.String())
+	}
+
+	req = signedRequest(t, id, testKeys[id])
+	req.Header.Set("Authorization", `Basic dXNlcjpwYXNz, `+req.Header.Get("Authorization")+`, Bearer gateway-token`)
+	var seen string
+	rec := httptest.NewRecorder()
+	m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get("Authorization")
+	})).ServeHTTP(rec, req)
+	if rec.Code != 200 || !strings.HasPrefix(seen, "acquia-http-hmac ") || strings.Contains(seen, "Bearer") {
+		t.Error("Expected the signature to be selected among comma separated credentials, got status ", rec.Code, ": ", rec.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133", nil)
+	req.Header.Add("Authorization", "Basic dXNlcjpwYXNz")
+	req.Header.Add("Authorization", "Bearer gateway-token")
+	if rec := serve(m, req); !strings.Contains(rec.Body.String(), "unknown_signature_type") {
+		t.Error("Expected credentials of unsupported schemes only to be rejected, got ", rec.Code, ": ", rec.Body.String())
+	}
+}
+
+func TestParamHeaders(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	req := signedRequest(t, id, testKeys[id])
+	a, err := v2.ParseAuthorization(req.Header.Get("Authorization"))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	req.Header.Del("Authorization")
+	a.SetParamHeaders(req.Header)
+	if rec := serve(New(testKeys), req.Clone(context.Background())); rec.Code != 403 {
+		t.Error("Expected parameter headers to be ignored by default, got status ", rec.Code)
+	}
+	if rec := serve(New(testKeys, WithParamHeaders()), req); rec.Code != 200 {
+		t.Error("Expected a signature in parameter headers to be verified, got status ", rec.Code, ": ", rec.Body.String())
+	}
+}
+
+func TestMissingSignedHeaders(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	req := httptest.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	signer, _ := v2.NewV2Signer(sha256.New)
+	signer.AllowMissingSignedHeaders = true
+	authHeaders := map[string]string{
+		"realm":   "Pipet service",
+		"id":      id,
+		"nonce":   "d1954337-5319-4821-8427-115542e08d10",
+		"headers": "X-Custom-Signer1",
+	}
+	if err := signer.SignDirect(req, authHeaders, testKeys[id]); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	if rec := serve(New(testKeys), req.Clone(context.Background())); rec.Code != 403 || !strings.Contains(rec.Body.String(), "missing_signed_header") {
+		t.Error("Expected a request missing a signed header to be rejected, got status ", rec.Code, ": ", rec.Body.String())
+	}
+	if rec := serve(New(testKeys, WithMissingSignedHeaders()), req); rec.Code != 200 {
+		t.Error("Expected a request missing a signed header to be accepted when allowed, got status ", rec.Code, ": ", rec.Body.String())
+	}
+}
+
+func TestProfile(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	req := httptest.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", nil)
+	signer, _ := v2.NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"realm": "Pipet service",
+		"id":    id,
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+	}
+	if err := signer.SignDirect(req, authHeaders, testKeys[id]); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	if rec := serve(New(testKeys), req.Clone(context.Background())); rec.Code != 200 {
+		t.Error("Expected a bodyless POST to be accepted by default, got status ", rec.Code, ": ", rec.Body.String())
+	}
+	if rec := serve(New(testKeys, WithProfile(v2.Strict)), req); rec.Code != 403 || !strings.Contains(rec.Body.String(), "missing_required_header") {
+		t.Error("Expected a bodyless POST without content hash to be rejected by the strict profile, got status ", rec.Code, ": ", rec.Body.String())
+	}
+}
+
+// A response writer recording whether ReadFrom was used.
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+func (r *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.readFrom = true
+	return io.Copy(r.ResponseRecorder, src)
+}
+
+func TestResponseReadFrom(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	m := New(testKeys, WithResponseSigning())
+	body := strings.Repeat("0123456789", 10000)
+	for _, skip := range []bool{false, true} {
+		rec := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+		req := signedRequest(t, id, testKeys[id])
+		m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := w.(io.ReaderFrom); !ok {
+				t.Error("Expected the response writer to implement io.ReaderFrom.")
+			}
+			if skip {
+				SkipResponseSigning(r)
+			}
+			// Hides the WriteTo method of the source, which io.Copy would prefer.
+			io.Copy(w, struct{ io.Reader }{strings.NewReader(body)})
+		})).ServeHTTP(rec, req)
+		if rec.Body.String() != body {
+			t.Error("Unexpected response body of ", rec.Body.Len(), " bytes.")
+		}
+		if skip != rec.readFrom {
+			t.Error("Expected ReadFrom of the underlying writer to be used only once signing is skipped, got ", rec.readFrom)
+		}
+		if skip {
+			continue
+		}
+		signer, _ := v2.NewV2Signer(sha256.New)
+		if err := signer.GetResponseSigner().Check(req, rec.Result(), testKeys[id]); err != nil {
+			t.Error("Response signature does not verify: ", err.Message)
+		}
+	}
+}
+
+func TestStreamingResponseSigning(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	body := strings.Repeat("0123456789", 10000)
+	srv := httptest.NewServer(New(testKeys, WithStreamingResponseSigning()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body[:10]))
+		w.(http.Flusher).Flush()
+		io.WriteString(w, body[10:])
+	})))
+	defer srv.Close()
+
+	req := signedRequest(t, id, testKeys[id])
+	sent, _ := http.NewRequest(req.Method, srv.URL+req.URL.RequestURI(), nil)
+	sent.Host = req.Host
+	sent.Header = req.Header.Clone()
+	resp, err := http.DefaultClient.Do(sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength != -1 || resp.Header.Get("X-Server-Authorization-HMAC-SHA256") != "" {
+		t.Error("Expected the response to be streamed with the signature in a trailer.")
+	}
+	if err := v2.VerifyResponse(req, resp, testKeys[id]); err != nil {
+		t.Error("Streamed response signature does not verify: ", err.Message)
+	}
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != body {
+		t.Error("Unexpected response body of ", len(b), " bytes.")
+	}
+}
+
+func TestResponseBufferLimit(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	var body string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < len(body); i += 100 {
+			io.WriteString(w, body[i:i+100])
+		}
+	})
+	get := func(srv *httptest.Server) (*http.Request, *http.Response) {
+		req := signedRequest(t, id, testKeys[id])
+		sent, _ := http.NewRequest(req.Method, srv.URL+req.URL.RequestURI(), nil)
+		sent.Host = req.Host
+		sent.Header = req.Header.Clone()
+		resp, err := http.DefaultClient.Do(sent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req, resp
+	}
+
+	for _, policy := range []LargeResponsePolicy{StreamLargeResponses, SkipSigningLargeResponses} {
+		large := 0
+		srv := httptest.NewServer(New(testKeys, WithResponseSigning(), WithResponseBufferLimit(1000, policy, func(*http.Request) {
+			large++
+		})).Handler(handler))
+
+		body = strings.Repeat("0123456789", 50)
+		req, resp := get(srv)
+		if err := v2.VerifyResponse(req, resp, testKeys[id]); err != nil || resp.Header.Get("X-Server-Authorization-HMAC-SHA256") == "" {
+			t.Error("Expected a response below the limit to be buffered and signed, got ", err)
+		}
+		resp.Body.Close()
+
+		body = strings.Repeat("0123456789", 500)
+		req, resp = get(srv)
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != body || large != 1 {
+			t.Error("Unexpected response of ", len(b), " bytes, with ", large, " calls to the hook.")
+		}
+		signed := resp.Trailer.Get("X-Server-Authorization-HMAC-SHA256") != ""
+		if signed != (policy == StreamLargeResponses) || resp.Header.Get("X-Server-Authorization-HMAC-SHA256") != "" {
+			t.Error("Expected only the streaming policy to sign a large response in a trailer, got policy ", policy, " signed ", signed)
+		}
+		if signed {
+			resp.Body = ioutil.NopCloser(strings.NewReader(body))
+			if err := v2.VerifyResponse(req, resp, testKeys[id]); err != nil {
+				t.Error("Large response signature does not verify: ", err.Message)
+			}
+		}
+		srv.Close()
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	calls := 0
+	h := New(testKeys, WithResponseSigning(), WithIdempotency(IdempotencyConfig{})).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Charge", strconv.Itoa(calls))
+		w.WriteHeader(201)
+		w.Write(body)
+	}))
+	signed := signedPost(t, "charge 10")
+	deliver := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", signed.URL.String(), strings.NewReader("charge 10"))
+		req.Header = signed.Header.Clone()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	first, second := deliver(), deliver()
+	if calls != 1 {
+		t.Fatal("Expected the handler to be called once, got ", calls)
+	}
+	if second.Code != 201 || second.Body.String() != "charge 10" || second.Header().Get("X-Charge") != "1" {
+		t.Errorf("Expected the redelivery to get the recorded response, got status %d: %s", second.Code, second.Body.String())
+	}
+	if sig := second.Header().Get("X-Server-Authorization-HMAC-SHA256"); sig == "" || sig != first.Header().Get("X-Server-Authorization-HMAC-SHA256") {
+		t.Error("Expected the recorded response signature to be replayed, got ", sig)
+	}
+	if err := v2.VerifyResponse(signed, second.Result(), testKeys[id]); err != nil {
+		t.Error("Replayed response signature does not verify: ", err.Message)
+	}
+
+	m := New(testKeys, WithIdempotency(IdempotencyConfig{}))
+	req := signedRequest(t, id, testKeys[id])
+	serve(m, req)
+	if rec := serve(m, req); rec.Code != 403 || !strings.Contains(rec.Body.String(), "replayed_request") {
+		t.Errorf("Expected replayed GET requests to be rejected, got status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestIdempotentRetries(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	n, _ := nonce.New()
+	// Signs the request with the same nonce each time, as clients re-signing their retries do.
+	sign := func() *http.Request {
+		req := httptest.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader("charge 10"))
+		signer, _ := v2.NewV2Signer(sha256.New)
+		authHeaders := map[string]string{"realm": "Pipet service", "id": id, "nonce": n}
+		if err := signer.SignDirect(req, authHeaders, testKeys[id]); err != nil {
+			t.Fatal("Failed to sign request: ", err.Message)
+		}
+		req.Body = ioutil.NopCloser(strings.NewReader("charge 10"))
+		return req
+	}
+	calls, denied := 0, 0
+	m := New(testKeys, WithResponseSigning(), WithIdempotency(IdempotencyConfig{}), WithAuthorizer(func(ctx context.Context, identity *Identity, req *http.Request) error {
+		if denied == 0 {
+			denied++
+			return fmt.Errorf("not yet")
+		}
+		return nil
+	}))
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(503)
+			return
+		}
+		w.WriteHeader(201)
+		io.Copy(w, r.Body)
+	}))
+	deliver := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := deliver(sign()); rec.Code != 403 || calls != 0 {
+		t.Fatalf("Expected the first delivery to be denied, got status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := deliver(sign()); rec.Code != 503 || calls != 1 {
+		t.Fatalf("Expected the redelivery of a denied request to be handled, got status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := deliver(sign()); rec.Code != 201 || calls != 2 {
+		t.Fatalf("Expected the redelivery of a failed request to be handled, got status %d: %s", rec.Code, rec.Body.String())
+	}
+	signers.OverrideClock(1432075982 + 10)
+	retry := sign()
+	rec := deliver(retry)
+	if rec.Code != 201 || rec.Body.String() != "charge 10" || calls != 2 {
+		t.Fatalf("Expected the recorded response, got status %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := v2.VerifyResponse(retry, rec.Result(), testKeys[id]); err != nil {
+		t.Error("Expected the recorded response to be signed for the re-signed retry: ", err.Message)
+	}
+}
+
+// Runs a hook once the first nonce is recorded, before the request reaches the handler.
+type hookedNonces struct {
+	nonce.Store
+	hooked int32
+	added  func()
+}
+
+func (n *hookedNonces) Add(key string, ttl time.Duration) (bool, error) {
+	fresh, err := n.Store.Add(key, ttl)
+	if atomic.CompareAndSwapInt32(&n.hooked, 0, 1) {
+		n.added()
+	}
+	return fresh, err
+}
+
+func TestIdempotentRedeliveryInFlight(t *testing.T) {
+	calls := 0
+	store := &hookedNonces{Store: nonce.NewMemoryStore(100)}
+	m := New(testKeys, WithNonceStore(store), WithResponseSigning(), WithIdempotency(IdempotencyConfig{}))
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(201)
+		io.Copy(w, r.Body)
+	}))
+	signed := signedPost(t, "charge 10")
+	deliver := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", signed.URL.String(), strings.NewReader("charge 10"))
+		req.Header = signed.Header.Clone()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	// The redelivery arrives once the nonce of the first delivery is recorded, and is answered after it.
+	redelivered := make(chan *httptest.ResponseRecorder, 1)
+	store.added = func() {
+		go func() {
+			redelivered <- deliver()
+		}()
+		time.Sleep(50 * time.Millisecond)
+	}
+	first := deliver()
+	second := <-redelivered
+	if calls != 1 || first.Code != 201 {
+		t.Fatal("Expected the handler to be called once, got ", calls, " calls and status ", first.Code)
+	}
+	if second.Code != 201 || second.Body.String() != "charge 10" {
+		t.Errorf("Expected the redelivery to wait for the recorded response, got status %d: %s", second.Code, second.Body.String())
+	}
+}
+
+func TestReplayWithinTolerance(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	identifier := compat.NewSupportedSignatureIdentifier()
+	identifier.GetSigner(2).(*v2.V2Signer).Timestamps = &signers.TimestampValidator{Tolerance: time.Hour}
+	m := New(testKeys, WithNonceStore(nonce.NewMemoryStore(100)))
+	m.Identifier = identifier
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	req := signedRequest(t, id, testKeys[id])
+	replayed := req.Clone(req.Context())
+	if rec := serve(m, req); rec.Code != 200 {
+		t.Fatal("Expected the request to be accepted, got ", rec.Code)
+	}
+	signers.OverrideClock(1432075982 + 31*60)
+	if rec := serve(m, replayed); rec.Code != 403 || !strings.Contains(rec.Body.String(), "replayed_request") {
+		t.Errorf("Expected the replay to be rejected while its timestamp is accepted, got status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// Blocks the first nonce being recorded until proceed is closed.
+type blockingNonces struct {
+	nonce.Store
+	blocked int32
+	entered chan struct{}
+	proceed chan struct{}
+}
+
+func (n *blockingNonces) Add(key string, ttl time.Duration) (bool, error) {
+	if atomic.CompareAndSwapInt32(&n.blocked, 0, 1) {
+		close(n.entered)
+		<-n.proceed
+	}
+	return n.Store.Add(key, ttl)
+}
+
+func TestIdempotentRedeliveryBeforeNonce(t *testing.T) {
+	var calls int32
+	store := &blockingNonces{Store: nonce.NewMemoryStore(100), entered: make(chan struct{}), proceed: make(chan struct{})}
+	m := New(testKeys, WithNonceStore(store), WithIdempotency(IdempotencyConfig{}))
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(201)
+		io.Copy(w, r.Body)
+	}))
+	signed := signedPost(t, "charge 10")
+	deliver := func(delivered chan<- *httptest.ResponseRecorder) {
+		req := httptest.NewRequest("POST", signed.URL.String(), strings.NewReader("charge 10"))
+		req.Header = signed.Header.Clone()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		delivered <- rec
+	}
+	// The redelivery arrives while the first delivery holds the mark, before it recorded the nonce.
+	first, second := make(chan *httptest.ResponseRecorder, 1), make(chan *httptest.ResponseRecorder, 1)
+	go deliver(first)
+	<-store.entered
+	go deliver(second)
+	time.Sleep(50 * time.Millisecond)
+	close(store.proceed)
+	for name, delivered := range map[string]chan *httptest.ResponseRecorder{"first delivery": first, "redelivery": second} {
+		if rec := <-delivered; rec.Code != 201 || rec.Body.String() != "charge 10" {
+			t.Errorf("Expected the %s to get the response, got status %d: %s", name, rec.Code, rec.Body.String())
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("Expected the handler to be called once, got ", n, " calls")
+	}
+}
+
+func TestRequestAgeHook(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	var ages []time.Duration
+	var errs []*signers.AuthenticationError
+	m := New(testKeys, WithRequestAgeHook(func(req *http.Request, keyID string, age time.Duration, err *signers.AuthenticationError) {
+		if keyID != id {
+			t.Error("Unexpected key ID ", keyID)
+		}
+		ages = append(ages, age)
+		errs = append(errs, err)
+	}))
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	early, late := signedRequest(t, id, testKeys[id]), signedRequest(t, id, testKeys[id])
+	signers.OverrideClock(1432075982 + 30)
+	serve(m, early)
+	signers.OverrideClock(1432075982 + 3600)
+	serve(m, late)
+	if len(ages) != 2 || ages[0] != 30*time.Second || ages[1] != time.Hour {
+		t.Fatal("Unexpected request ages ", ages)
+	}
+	if errs[0] != nil || errs[1] == nil || errs[1].ErrorType != signers.ErrorTypeTimestampRangeError {
+		t.Error("Expected the hook to get the verification outcome, got ", errs)
+	}
+	serve(m, httptest.NewRequest("GET", "http://example.acquiapipet.net/", nil))
+	if len(ages) != 2 {
+		t.Error("Expected unsigned requests not to be reported.")
+	}
+}
+
+func TestAuditSink(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	var b strings.Builder
+	m := New(testKeys, WithAuditSink(NewJSONAuditSink(&b)))
+	req := signedRequest(t, id, testKeys[id])
+	req.RemoteAddr = "192.0.2.1:1234"
+	serve(m, req)
+	bad := signedRequest(t, id, "c2VjcmV0LW9mLWFub3RoZXIta2V5")
+	serve(m, bad)
+	serve(m, httptest.NewRequest("GET", "http://example.acquiapipet.net/", nil))
+
+	records := []AuditRecord{}
+	dec := json.NewDecoder(strings.NewReader(b.String()))
+	for dec.More() {
+		var r AuditRecord
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 3 {
+		t.Fatal("Expected a record per request, got ", b.String())
+	}
+	if r := records[0]; r.Decision != AuditAllow || r.KeyID != id || r.Realm != "Pipet service" || r.Path != "/v1.0/task-status/133" || r.RemoteAddr != "192.0.2.1:1234" || r.ErrorType != "" {
+		t.Errorf("Unexpected record of a verified request: %+v", r)
+	}
+	if r := records[1]; r.Decision != AuditDeny || r.KeyID != id || r.ErrorType != "signature_mismatch" {
+		t.Errorf("Unexpected record of a rejected request: %+v", r)
+	}
+	if r := records[2]; r.Decision != AuditDeny || r.KeyID != "" || r.ErrorType != "missing_required_header" {
+		t.Errorf("Unexpected record of an unsigned request: %+v", r)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+	for name, expected := range map[string]string{"audit.log": "fourth\n", "audit.log.1": "third\n", "audit.log.2": "second\n"} {
+		if b, _ := ioutil.ReadFile(filepath.Join(dir, name)); string(b) != expected {
+			t.Errorf("Expected %s to contain %q, got %q.", name, expected, b)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Expected backups beyond the limit to be removed.")
+	}
+}
+
+func TestSecurityHooks(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	var replays, malformed []string
+	failures := map[FailureSource][]int{}
+	m := New(testKeys, WithSecurityHooks(SecurityHooks{
+		OnReplay: func(req *http.Request, keyID, nonce string) {
+			replays = append(replays, keyID+":"+nonce)
+		},
+		OnRepeatedFailures: func(req *http.Request, source FailureSource, value string, n int) {
+			failures[source] = append(failures[source], n)
+		},
+		OnMalformedHeader: func(req *http.Request, err *signers.AuthenticationError) {
+			malformed = append(malformed, ErrorCode(err.ErrorType))
+		},
+		Threshold: 2,
+	}))
+	req := signedRequest(t, id, testKeys[id])
+	serve(m, req)
+	serve(m, req)
+	if len(replays) != 1 || replays[0] != id+":"+v2.ParseAuthHeaders(req)["nonce"] {
+		t.Error("Expected the replay hook to be called with the key ID and nonce, got ", replays)
+	}
+
+	for i := 0; i < 3; i++ {
+		req := signedRequest(t, id, "c2VjcmV0LW9mLWFub3RoZXIta2V5")
+		req.RemoteAddr = "192.0.2.1:1234"
+		serve(m, req)
+	}
+	if fmt.Sprint(failures[FailuresByKey]) != "[2 3]" || fmt.Sprint(failures[FailuresByIP]) != "[2 3]" {
+		t.Error("Expected the failure hook to be called from the threshold on, got ", failures)
+	}
+
+	req = httptest.NewRequest("GET", "http://example.acquiapipet.net/", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	serve(m, req)
+	if len(malformed) != 1 || malformed[0] != "unknown_signature_type" {
+		t.Error("Expected the malformed header hook to be called, got ", malformed)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	lockout := NewLockout(2, time.Minute, 3*time.Minute)
+	m := New(testKeys, WithLockout(lockout))
+	fail := func() *httptest.ResponseRecorder {
+		return serve(m, signedRequest(t, id, "c2VjcmV0LW9mLWFub3RoZXIta2V5"))
+	}
+	fail()
+	if rec := serve(m, signedRequest(t, id, testKeys[id])); rec.Code != 200 {
+		t.Fatal("Expected a key below the threshold to be accepted, got ", rec.Code)
+	}
+	fail()
+	fail()
+	if rec := serve(m, signedRequest(t, id, testKeys[id])); rec.Code != 429 || !strings.Contains(rec.Body.String(), "locked_out") {
+		t.Errorf("Expected consecutive failures to lock the key out, got status %d: %s", rec.Code, rec.Body.String())
+	}
+	for i, expected := range []time.Duration{2 * time.Minute, 3 * time.Minute} {
+		signers.OverrideClock(signers.Now().Unix() + int64(lockout.Locked(id)/time.Second))
+		fail()
+		if d := lockout.Locked(id); d != expected {
+			t.Errorf("Expected failure %d after the lockout to back off for %s, got %s.", i+1, expected, d)
+		}
+	}
+	signers.OverrideClock(signers.Now().Unix() + 180)
+	if rec := serve(m, signedRequest(t, id, testKeys[id])); rec.Code != 200 || lockout.Locked(id) != 0 {
+		t.Error("Expected the key to be accepted once the lockout is over, got ", rec.Code)
+	}
+}
+
+func TestStatusTable(t *testing.T) {
+	id := "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	m := New(testKeys, WithStatusTable(StandardStatuses), WithChallenge(Challenge{Realm: "Pipet service"}))
+	malformed := httptest.NewRequest("GET", "http://example.acquiapipet.net/", nil)
+	malformed.Header.Set("Authorization", `acquia-http-hmac realm="Pipet service",id="`+id+`",nonce="n",version="2.0",headers="",signature="%%%"`)
+	malformed.Header.Set("X-Authorization-Timestamp", "yesterday")
+	for _, c := range []struct {
+		name      string
+		req       *http.Request
+		status    int
+		challenge bool
+	}{
+		{"malformed header", malformed, 400, false},
+		{"bad signature", signedRequest(t, id, "c2VjcmV0LW9mLWFub3RoZXIta2V5"), 401, true},
+		{"unknown key", signedRequest(t, "revoked-key", "c2VjcmV0LW9mLWFub3RoZXIta2V5"), 403, false},
+	} {
+		rec := serve(m, c.req)
+		if rec.Code != c.status || (rec.Header().Get("WWW-Authenticate") != "") != c.challenge {
+			t.Errorf("Expected the %s to be rejected with %d, challenged: %v, got %d: %s", c.name, c.status, c.challenge, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := serve(New(testKeys), signedRequest(t, "revoked-key", "c2VjcmV0LW9mLWFub3RoZXIta2V5")); rec.Code != 403 {
+		t.Error("Expected errors to keep their status without a table, got ", rec.Code)
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"context"
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+)
+
+const anonymousKey contextKey = 3
+
+// WithOptionalAuthentication lets requests without a signature through to the handler, for endpoints
+// serving both public and keyed traffic. They carry no identity, and IsAnonymous reports true for their
+// context; the rate limiter and authorizer are not consulted. Requests with a signature are verified as
+// usual, and rejected if it is invalid.
+func WithOptionalAuthentication() Option {
+	return func(m *Middleware) {
+		m.optional = true
+	}
+}
+
+// IsAnonymous reports whether the request a context belongs to was let through without a signature by a
+// middleware with optional authentication.
+func IsAnonymous(ctx context.Context) bool {
+	anonymous, _ := ctx.Value(anonymousKey).(bool)
+	return anonymous
+}
+
+// Reports whether the request bears no signature of any supported scheme.
+func (m *Middleware) unsigned(req *http.Request) bool {
+	if req.Header.Get(m.authorizationHeader()) != "" {
+		return false
+	}
+	if ri, ok := m.Identifier.(signers.RequestIdentifier); ok {
+		return ri.IdentifyRequest(req) == nil
+	}
+	return true
+}
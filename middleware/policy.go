@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+	"strings"
+)
+
+// WithRequiredHeaders requires requests of a realm to carry the given headers and to include them in the
+// signed headers list. The empty realm applies to requests of any realm without a policy of their own,
+// including v1 requests, which carry no realm. Later calls for the same realm replace earlier ones.
+func WithRequiredHeaders(realm string, headers ...string) Option {
+	return func(m *Middleware) {
+		if m.requiredHeaders == nil {
+			m.requiredHeaders = map[string][]string{}
+		}
+		m.requiredHeaders[realm] = headers
+	}
+}
+
+// WithRealms only accepts requests signed for one of the given realms, rejecting others with 403 before
+// their secret is looked up. Requests of signature versions without a realm (v1) are accepted if the
+// empty realm is given.
+func WithRealms(realms ...string) Option {
+	return func(m *Middleware) {
+		m.realms = map[string]bool{}
+		for _, realm := range realms {
+			m.realms[realm] = true
+		}
+	}
+}
+
+func (m *Middleware) checkRealm(authHeaders map[string]string) *signers.AuthenticationError {
+	if m.realms == nil || m.realms[authHeaders["realm"]] {
+		return nil
+	}
+	return signers.Errorf(403, signers.ErrorTypeAccessDenied, "Realm %s is not accepted.", authHeaders["realm"])
+}
+
+func (m *Middleware) checkRequiredHeaders(req *http.Request, authHeaders map[string]string) *signers.AuthenticationError {
+	required, ok := m.requiredHeaders[authHeaders["realm"]]
+	if !ok {
+		required = m.requiredHeaders[""]
+	}
+	if len(required) == 0 {
+		return nil
+	}
+	signed := map[string]bool{}
+	if hdr := authHeaders["headers"]; hdr != "" {
+		for _, h := range strings.Split(hdr, ";") {
+			signed[http.CanonicalHeaderKey(strings.TrimSpace(h))] = true
+		}
+	}
+	for _, h := range required {
+		if req.Header.Get(h) == "" {
+			return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header %s.", h)
+		}
+		if !signed[http.CanonicalHeaderKey(h)] {
+			return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Header %s must be included in the signed headers.", h)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"sync"
+	"time"
+)
+
+// RateLimiter is consulted with the key ID of every verified request before the handler runs.
+type RateLimiter interface {
+	// Returns false if the credential has exhausted its quota, which rejects the request with 429.
+	Allow(id string) bool
+}
+
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(m *Middleware) {
+		m.limiter = limiter
+	}
+}
+
+// TokenBucket is a RateLimiter giving every key ID a bucket of Burst tokens that refills at Rate tokens
+// per second. Each request takes one token.
+type TokenBucket struct {
+	Rate  float64
+	Burst int
+	// Source of the current time. Defaults to the package clock.
+	Clock signers.Clock
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		Rate:    rate,
+		Burst:   burst,
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (t *TokenBucket) Allow(id string) bool {
+	now := signers.NowFrom(t.Clock)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.buckets == nil {
+		t.buckets = map[string]*bucket{}
+	}
+	b, ok := t.buckets[id]
+	if !ok {
+		b = &bucket{
+			tokens: float64(t.Burst),
+			last:   now,
+		}
+		t.buckets[id] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * t.Rate
+		if b.tokens > float64(t.Burst) {
+			b.tokens = float64(t.Burst)
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
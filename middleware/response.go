@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"context"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"hash"
+	"io"
+	"net/http"
+)
+
+// WithResponseSigning makes the middleware sign the responses to verified requests: the handler writes into
+// a SignableResponseWriter, and once it returns the signature is set in X-Server-Authorization-HMAC-SHA256
+// before the buffered response is sent. Requests authenticated through a session token, and signature
+// versions without response signing (v1), get unsigned responses.
+// Handlers may opt out with SkipResponseSigning.
+func WithResponseSigning() Option {
+	return func(m *Middleware) {
+		m.signResponses = true
+	}
+}
+
+// WithExtendedResponseSigning signs responses like WithResponseSigning, with v2 signatures also covering the
+// status code and the given response headers (see v2.V2ResponseSigner.Extended), which clients must check
+// likewise, e.g. with hmacclient.WithExtendedResponseSigning. It configures the v2 signer of the
+// identifier, which must be set before this option is applied.
+func WithExtendedResponseSigning(headers ...string) Option {
+	return func(m *Middleware) {
+		m.signResponses = true
+		if id, ok := m.Identifier.(interface{ GetSigner(int) signers.Signer }); ok {
+			if signer, ok := id.GetSigner(2).(*v2.V2Signer); ok {
+				rs := signer.GetResponseSigner().(*v2.V2ResponseSigner)
+				rs.Extended = true
+				rs.Headers = headers
+			}
+		}
+	}
+}
+
+// WithStreamingResponseSigning signs responses like WithResponseSigning, but streams them to the client as
+// the handler writes them, hashing the body on the way, and sends the v2 signature in an
+// X-Server-Authorization-HMAC-SHA256 trailer, so that large responses are not held in memory. Clients must
+// read trailers, as http.Client and hmacclient do. Signers that cannot stream (v1) get buffered responses.
+func WithStreamingResponseSigning() Option {
+	return func(m *Middleware) {
+		m.signResponses = true
+		m.streamResponses = true
+	}
+}
+
+// LargeResponsePolicy is what the middleware does with responses exceeding the limit of WithResponseBufferLimit.
+type LargeResponsePolicy int
+
+const (
+	// StreamLargeResponses streams the response from then on, with the signature in a trailer as with
+	// WithStreamingResponseSigning, if the signer can (v2), and sends it unsigned otherwise.
+	StreamLargeResponses LargeResponsePolicy = iota
+	// SkipSigningLargeResponses sends the response unsigned, as if the handler called SkipResponseSigning.
+	SkipSigningLargeResponses
+)
+
+// WithResponseBufferLimit caps the responses buffered for signing at n bytes, so that download endpoints do
+// not exhaust memory: beyond, the response is handled according to policy, and hook, if not nil, is called
+// with the request, e.g. to count the responses concerned.
+func WithResponseBufferLimit(n int, policy LargeResponsePolicy, hook func(req *http.Request)) Option {
+	return func(m *Middleware) {
+		m.responseBufferLimit = n
+		m.largeResponses = policy
+		m.onLargeResponse = hook
+	}
+}
+
+type signingState struct {
+	skip bool
+}
+
+const signingStateKey contextKey = 1
+
+// SkipResponseSigning disables response signing for the current request, e.g. for streaming endpoints,
+// file downloads or proxy passthroughs. Output written from then on goes straight to the client. Has no
+// effect if the middleware does not sign responses.
+func SkipResponseSigning(req *http.Request) {
+	if st, ok := req.Context().Value(signingStateKey).(*signingState); ok {
+		st.skip = true
+	}
+}
+
+// WithoutResponseSigning wraps a route's handler so that its responses are never signed, while the request
+// is still verified.
+func WithoutResponseSigning(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		SkipResponseSigning(req)
+		h.ServeHTTP(w, req)
+	})
+}
+
+// Buffers output for signing until the handler opts out, then writes through.
+type optOutWriter struct {
+	*signers.SignableResponseWriter
+	w      http.ResponseWriter
+	state  *signingState
+	direct bool
+	// If positive, overflow is called before more than limit bytes are buffered.
+	limit    int
+	overflow func()
+}
+
+func (o *optOutWriter) passthrough() bool {
+	if !o.state.skip {
+		return false
+	}
+	if !o.direct {
+		o.direct = true
+		if o.Body.Len() > 0 || o.Status() != 0 {
+			o.SignableResponseWriter.Close()
+		}
+	}
+	return true
+}
+
+func (o *optOutWriter) Write(b []byte) (int, error) {
+	if o.passthrough() {
+		return o.w.Write(b)
+	}
+	if o.limit > 0 && !o.Streaming() && o.Body.Len()+len(b) > o.limit {
+		o.limit = 0
+		o.overflow()
+		if o.passthrough() {
+			return o.w.Write(b)
+		}
+	}
+	return o.SignableResponseWriter.Write(b)
+}
+
+// ReadFrom keeps the sendfile path of the underlying writer once the handler opts out.
+func (o *optOutWriter) ReadFrom(r io.Reader) (int64, error) {
+	if o.passthrough() {
+		if rf, ok := o.w.(io.ReaderFrom); ok {
+			return rf.ReadFrom(r)
+		}
+		return io.Copy(o.w, r)
+	}
+	if o.limit > 0 {
+		// Copied through Write, for the limit to be enforced.
+		return io.Copy(struct{ io.Writer }{o}, r)
+	}
+	return o.SignableResponseWriter.ReadFrom(r)
+}
+
+func (o *optOutWriter) WriteHeader(status int) {
+	if o.passthrough() {
+		o.w.WriteHeader(status)
+		return
+	}
+	o.SignableResponseWriter.WriteHeader(status)
+}
+
+func (o *optOutWriter) Flush() {
+	if o.passthrough() {
+		if f, ok := o.w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return
+	}
+	o.SignableResponseWriter.Flush()
+}
+
+func (m *Middleware) serveSigned(w http.ResponseWriter, req *http.Request, next http.Handler, v *verification) {
+	var rs signers.ResponseSigner
+	if v.signer != nil {
+		rs = v.signer.GetResponseSigner()
+	}
+	if rs == nil {
+		next.ServeHTTP(w, req)
+		return
+	}
+	state := &signingState{}
+	req = req.WithContext(context.WithValue(req.Context(), signingStateKey, state))
+	ow := &optOutWriter{
+		SignableResponseWriter: signers.NewSignableResponseWriter(w),
+		w:                      w,
+		state:                  state,
+	}
+	srs, canStream := rs.(signers.StreamingResponseSigner)
+	if s, ok := rs.(interface{ Streams() bool }); ok && canStream {
+		canStream = s.Streams()
+	}
+	start := func(rw *signers.SignableResponseWriter) (hash.Hash, *signers.AuthenticationError) {
+		return srs.StartResponse(req, rw, v.secret)
+	}
+	if canStream && m.streamResponses {
+		rs.SetTrailer(w)
+		ow.SignableResponseWriter = signers.NewStreamingResponseWriter(w, start)
+	} else if m.responseBufferLimit > 0 {
+		ow.limit = m.responseBufferLimit
+		ow.overflow = func() {
+			if m.onLargeResponse != nil {
+				m.onLargeResponse(req)
+			}
+			if canStream && m.largeResponses == StreamLargeResponses {
+				rs.SetTrailer(w)
+				ow.Stream(start)
+				return
+			}
+			state.skip = true
+		}
+	}
+	next.ServeHTTP(ow, req)
+	if ow.direct {
+		return
+	}
+	stream := ow.Streaming()
+	if stream {
+		// The body is already written: the signature follows it as a trailer.
+		ow.SignableResponseWriter.Close()
+	}
+	if !state.skip {
+		if err := rs.SignResponseDirect(req, ow.SignableResponseWriter, v.secret); err != nil {
+			signers.Logf("Could not sign response: %s", err.Message)
+		}
+	}
+	if stream {
+		return
+	}
+	if _, err := ow.SignableResponseWriter.Close(); err != nil {
+		signers.Logf("Could not write response: %s", err.Error())
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/signers"
+)
+
+// WithKeys replaces the key provider, e.g. for routes accepting a different set of keys than the rest of
+// the API.
+func WithKeys(provider keys.Provider) Option {
+	return func(m *Middleware) {
+		m.Keys = provider
+	}
+}
+
+// With returns a copy of the middleware with further options applied, for verification policies that
+// differ per route. The copy shares the nonce store, so a nonce used on one route cannot be replayed on
+// another; required headers are merged by realm, later options replacing the policy of a realm. The
+// identifier is copied along with its signers if it supports it (see signers.IdentifierCloner), as the
+// default one does, so that options configuring the signers, such as WithProfile, only apply to the copy.
+//
+// Handler has the signature of a gorilla/mux MiddlewareFunc, so copies can be used on subrouters:
+//
+//	m := middleware.New(provider)
+//	api := r.PathPrefix("/api").Subrouter()
+//	api.Use(m.Handler)
+//	admin := r.PathPrefix("/admin").Subrouter()
+//	admin.Use(m.With(middleware.WithRealms("Admin"), middleware.WithRequiredHeaders("Admin", "X-Request-ID")).Handler)
+//
+// Do not nest them, e.g. with r.Use(m.Handler) on the parent router: a request verified twice fails the
+// replay check the second time.
+func (m *Middleware) With(options ...Option) *Middleware {
+	c := *m
+	if ic, ok := m.Identifier.(signers.IdentifierCloner); ok {
+		c.Identifier = ic.CloneIdentifier()
+	}
+	if m.requiredHeaders != nil {
+		c.requiredHeaders = make(map[string][]string, len(m.requiredHeaders))
+		for realm, headers := range m.requiredHeaders {
+			c.requiredHeaders[realm] = headers
+		}
+	}
+	c.skip = append([]SkipFunc{}, m.skip...)
+	for _, option := range options {
+		option(&c)
+	}
+	return &c
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SessionConfig enables the session bridge: once a request passes HMAC verification, the middleware
+// issues a short-lived session token so that subsequent browser requests may authenticate with the
+// token instead of a full request signature.
+type SessionConfig struct {
+	// Key used to sign session tokens, at least MinKeyLength bytes long. It should not be one of the HMAC
+	// key secrets.
+	Key []byte
+	// Lifetime of an issued token. Defaults to 15 minutes.
+	TTL time.Duration
+	// Name of the session cookie. Defaults to "hmac_session".
+	CookieName string
+	// If set, the token is sent and accepted in this header instead of a cookie.
+	HeaderName string
+	// Source of the current time. Defaults to the package clock.
+	Clock signers.Clock
+}
+
+type sessionToken struct {
+	ID      string `json:"id"`
+	Realm   string `json:"realm,omitempty"`
+	Version int    `json:"ver"`
+	Expires int64  `json:"exp"`
+}
+
+func (st *sessionToken) identity() *Identity {
+	return &Identity{
+		KeyID:   st.ID,
+		Realm:   st.Realm,
+		Version: st.Version,
+	}
+}
+
+// MinKeyLength is the minimum length of the keys signing session tokens, matching the output of
+// HMAC-SHA256.
+const MinKeyLength = 32
+
+// WithSession issues session tokens to verified requests and accepts them in place of a signature. It
+// panics if config.Key is shorter than MinKeyLength, as tokens signed with a short key can be forged.
+func WithSession(config SessionConfig) Option {
+	if len(config.Key) < MinKeyLength {
+		panic("middleware: WithSession key must be at least 32 bytes long")
+	}
+	return func(m *Middleware) {
+		if config.TTL == 0 {
+			config.TTL = 15 * time.Minute
+		}
+		if config.CookieName == "" {
+			config.CookieName = "hmac_session"
+		}
+		m.session = &config
+	}
+}
+
+func (s *SessionConfig) sign(payload string) string {
+	h := hmac.New(sha256.New, s.Key)
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (s *SessionConfig) issue(w http.ResponseWriter, identity *Identity) {
+	expires := signers.NowFrom(s.Clock).Add(s.TTL)
+	data, err := json.Marshal(&sessionToken{
+		ID:      identity.KeyID,
+		Realm:   identity.Realm,
+		Version: identity.Version,
+		Expires: expires.Unix(),
+	})
+	if err != nil {
+		signers.Logf("Could not encode session token: %s", err.Error())
+		return
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	token := payload + "." + s.sign(payload)
+	if s.HeaderName != "" {
+		w.Header().Set(s.HeaderName, token)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.CookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func (s *SessionConfig) verify(req *http.Request) (*sessionToken, *signers.AuthenticationError) {
+	var token string
+	if s.HeaderName != "" {
+		token = req.Header.Get(s.HeaderName)
+	} else if cookie, err := req.Cookie(s.CookieName); err == nil {
+		token = cookie.Value
+	}
+	if token == "" {
+		return nil, signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "No session token present.")
+	}
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return nil, signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Malformed session token.")
+	}
+	if !hmac.Equal([]byte(s.sign(parts[0])), []byte(parts[1])) {
+		return nil, signers.Errorf(403, signers.ErrorTypeSignatureMismatch, "Session token signature does not match.")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Malformed session token: %w", err)
+	}
+	st := &sessionToken{}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Malformed session token: %w", err)
+	}
+	if st.Expires < signers.NowFrom(s.Clock).Unix() {
+		return nil, signers.Errorf(403, signers.ErrorTypeTimestampRangeError, "Session token expired.")
+	}
+	return st, nil
+}
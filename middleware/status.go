@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+)
+
+// StatusTable sets the status of the responses to requests failing with an error type, instead of the
+// status of the error. Error types missing from the table keep theirs.
+type StatusTable map[signers.ErrorType]int
+
+// StandardStatuses tells malformed credentials (400) from failed authentication (401) and keys that may not
+// be used (403), rather than rejecting most requests with 403.
+var StandardStatuses = StatusTable{
+	signers.ErrorTypeInvalidAuthHeader:     400,
+	signers.ErrorTypeInvalidRequiredHeader: 400,
+	signers.ErrorTypeMissingSignedHeader:   400,
+	signers.ErrorTypeMissingRequiredHeader: 401,
+	signers.ErrorTypeUnknownSignatureType:  401,
+	signers.ErrorTypeSignatureMismatch:     401,
+	signers.ErrorTypeTimestampRangeError:   401,
+	signers.ErrorTypeReplayedRequest:       401,
+	signers.ErrorTypeUnknownKey:            403,
+	signers.ErrorTypeOutdatedKeypair:       403,
+	signers.ErrorTypeUnapprovedAlgorithm:   403,
+	signers.ErrorTypeAccessDenied:          403,
+}
+
+// WithStatusTable responds to failed requests with the status the table gives their error type, e.g.
+// StandardStatuses. With WithChallenge, only the responses with status 401 then carry a challenge.
+func WithStatusTable(table StatusTable) Option {
+	return func(m *Middleware) {
+		m.statuses = table
+	}
+}
+
+// Returns err with the status given by the status table, if any.
+func (m *Middleware) mapStatus(err *signers.AuthenticationError) *signers.AuthenticationError {
+	status, ok := m.statuses[err.ErrorType]
+	if !ok || status == err.HttpStatus {
+		return err
+	}
+	mapped := *err
+	mapped.HttpStatus = status
+	return &mapped
+}
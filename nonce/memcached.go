@@ -0,0 +1,137 @@
+package nonce
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemcachedStore is a Store shared between service instances through memcached. Nonces are recorded with
+// the memcached "add" command, which only succeeds if the key does not exist yet, and expire through the
+// item expiration time. Keys are distributed over the servers by hash.
+type MemcachedStore struct {
+	// Prepended to every key, to share a memcached cluster with other applications.
+	Prefix string
+	// Timeout for connecting and for each command. Defaults to 500ms.
+	Timeout time.Duration
+	// Maximum number of idle connections kept per server. Defaults to 2.
+	MaxIdleConns int
+
+	servers []string
+	mu      sync.Mutex
+	idle    map[string][]*memcachedConn
+}
+
+type memcachedConn struct {
+	net.Conn
+	rw *bufio.ReadWriter
+}
+
+// NewMemcachedStore creates a store using the given servers (host:port).
+func NewMemcachedStore(servers ...string) *MemcachedStore {
+	return &MemcachedStore{
+		Prefix:       "hmac-nonce:",
+		Timeout:      500 * time.Millisecond,
+		MaxIdleConns: 2,
+		servers:      servers,
+		idle:         map[string][]*memcachedConn{},
+	}
+}
+
+// Keys are hashed, as nonces and key IDs come from the request and may contain characters memcached does
+// not allow in keys.
+func (m *MemcachedStore) key(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return m.Prefix + hex.EncodeToString(sum[:])
+}
+
+func (m *MemcachedStore) server(key string) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return m.servers[h.Sum32()%uint32(len(m.servers))]
+}
+
+func (m *MemcachedStore) conn(server string) (*memcachedConn, error) {
+	m.mu.Lock()
+	if conns := m.idle[server]; len(conns) > 0 {
+		c := conns[len(conns)-1]
+		m.idle[server] = conns[:len(conns)-1]
+		m.mu.Unlock()
+		return c, nil
+	}
+	m.mu.Unlock()
+	nc, err := net.DialTimeout("tcp", server, m.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &memcachedConn{
+		Conn: nc,
+		rw:   bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc)),
+	}, nil
+}
+
+func (m *MemcachedStore) release(server string, c *memcachedConn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.idle[server]) >= m.MaxIdleConns {
+		c.Close()
+		return
+	}
+	m.idle[server] = append(m.idle[server], c)
+}
+
+func (m *MemcachedStore) Add(nonce string, ttl time.Duration) (bool, error) {
+	if len(m.servers) == 0 {
+		return false, fmt.Errorf("memcached: no servers configured")
+	}
+	key := m.key(nonce)
+	server := m.server(key)
+	c, err := m.conn(server)
+	if err != nil {
+		return false, err
+	}
+	c.SetDeadline(time.Now().Add(m.Timeout))
+	// Round the expiration up to whole seconds so the nonce is never forgotten early.
+	exptime := int64((ttl + time.Second - 1) / time.Second)
+	if _, err := fmt.Fprintf(c.rw, "add %s 0 %d 1\r\n1\r\n", key, exptime); err != nil {
+		c.Close()
+		return false, err
+	}
+	if err := c.rw.Flush(); err != nil {
+		c.Close()
+		return false, err
+	}
+	line, err := c.rw.ReadString('\n')
+	if err != nil {
+		c.Close()
+		return false, err
+	}
+	m.release(server, c)
+	switch strings.TrimRight(line, "\r\n") {
+	case "STORED":
+		return true, nil
+	case "NOT_STORED":
+		return false, nil
+	default:
+		return false, fmt.Errorf("memcached: unexpected reply to add: %q", strings.TrimRight(line, "\r\n"))
+	}
+}
+
+// Close closes all idle connections.
+func (m *MemcachedStore) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for server, conns := range m.idle {
+		for _, c := range conns {
+			c.Close()
+		}
+		delete(m.idle, server)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package nonce
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Serves just enough of the memcached text protocol for the add command.
+func fakeMemcached(t *testing.T) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	items := map[string]bool{}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					f := strings.Fields(line)
+					if len(f) != 5 || f[0] != "add" {
+						c.Write([]byte("ERROR\r\n"))
+						continue
+					}
+					r.ReadString('\n')
+					mu.Lock()
+					if items[f[1]] {
+						c.Write([]byte("NOT_STORED\r\n"))
+					} else {
+						items[f[1]] = true
+						c.Write([]byte("STORED\r\n"))
+					}
+					mu.Unlock()
+				}
+			}(c)
+		}
+	}()
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func TestMemcachedStore(t *testing.T) {
+	addr, stop := fakeMemcached(t)
+	defer stop()
+	s := NewMemcachedStore(addr)
+	defer s.Close()
+
+	if ok, err := s.Add("id:nonce with spaces", time.Minute); err != nil || !ok {
+		t.Error("First use of a nonce was rejected: ", err)
+	}
+	if ok, err := s.Add("id:nonce with spaces", time.Minute); err != nil || ok {
+		t.Error("Second use of a nonce was accepted: ", err)
+	}
+	if ok, err := s.Add("id:other", time.Minute); err != nil || !ok {
+		t.Error("Different nonce was rejected: ", err)
+	}
+
+	stop()
+	s.Close()
+	if _, err := s.Add("id:unreachable", time.Minute); err == nil {
+		t.Error("Expected an error once the server is gone.")
+	}
+}
@@ -0,0 +1,98 @@
+package nonce
+
+import (
+	"container/list"
+	"github.com/acquia/http-hmac-go/signers"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const memoryShards = 32
+
+// MemoryStore is an in-memory Store for single-instance services. It is split into independently locked
+// shards, each a least-recently-used cache, so that the total number of nonces stays bounded.
+// Once full, the oldest nonces are forgotten before they expire, so the capacity should comfortably exceed
+// the number of requests expected within the TTL.
+type MemoryStore struct {
+	shards [memoryShards]*memoryShard
+}
+
+type memoryShard struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type memoryEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+// NewMemoryStore creates a store remembering up to capacity nonces.
+func NewMemoryStore(capacity int) *MemoryStore {
+	perShard := capacity / memoryShards
+	if perShard < 1 {
+		perShard = 1
+	}
+	s := &MemoryStore{}
+	for i := range s.shards {
+		s.shards[i] = &memoryShard{
+			capacity: perShard,
+			entries:  map[string]*list.Element{},
+			order:    list.New(),
+		}
+	}
+	return s
+}
+
+func (s *MemoryStore) shard(nonce string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(nonce))
+	return s.shards[h.Sum32()%memoryShards]
+}
+
+func (s *MemoryStore) Add(nonce string, ttl time.Duration) (bool, error) {
+	return s.shard(nonce).add(nonce, signers.Now(), ttl), nil
+}
+
+// Len returns the number of nonces currently remembered, including expired ones not yet evicted.
+func (s *MemoryStore) Len() int {
+	n := 0
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		n += sh.order.Len()
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+func (sh *memoryShard) add(nonce string, now time.Time, ttl time.Duration) bool {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if el, ok := sh.entries[nonce]; ok {
+		entry := el.Value.(*memoryEntry)
+		if now.Before(entry.expires) {
+			return false
+		}
+		entry.expires = now.Add(ttl)
+		sh.order.MoveToFront(el)
+		return true
+	}
+	// Drop expired entries from the tail before evicting live ones.
+	for sh.order.Len() > 0 {
+		last := sh.order.Back()
+		entry := last.Value.(*memoryEntry)
+		if now.Before(entry.expires) && sh.order.Len() < sh.capacity {
+			break
+		}
+		sh.order.Remove(last)
+		delete(sh.entries, entry.nonce)
+	}
+	sh.entries[nonce] = sh.order.PushFront(&memoryEntry{
+		nonce:   nonce,
+		expires: now.Add(ttl),
+	})
+	return true
+}
@@ -0,0 +1,58 @@
+package nonce
+
+import (
+	"fmt"
+	"github.com/acquia/http-hmac-go/signers"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	s := NewMemoryStore(64)
+	if ok, _ := s.Add("a", time.Minute); !ok {
+		t.Error("First use of a nonce was rejected.")
+	}
+	if ok, _ := s.Add("a", time.Minute); ok {
+		t.Error("Second use of a nonce was accepted.")
+	}
+	signers.OverrideClock(1432075982 + 61)
+	if ok, _ := s.Add("a", time.Minute); !ok {
+		t.Error("Reuse of an expired nonce was rejected.")
+	}
+
+	for i := 0; i < 1000; i++ {
+		s.Add(fmt.Sprintf("n%d", i), time.Hour)
+	}
+	if s.Len() > 64 {
+		t.Error("Store grew beyond its capacity: ", s.Len())
+	}
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	s := NewMemoryStore(10000)
+	var wg sync.WaitGroup
+	accepted := make(chan bool, 800)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				ok, _ := s.Add(fmt.Sprintf("n%d", i), time.Hour)
+				accepted <- ok
+			}
+		}()
+	}
+	wg.Wait()
+	close(accepted)
+	n := 0
+	for ok := range accepted {
+		if ok {
+			n++
+		}
+	}
+	if n != 100 {
+		t.Error("Expected every nonce to be accepted exactly once, got ", n, " acceptances.")
+	}
+}
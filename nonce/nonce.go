@@ -0,0 +1,41 @@
+package nonce
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"time"
+)
+
+// DefaultTTL is how long a nonce must be remembered to cover the timestamp window accepted at the default
+// tolerance: a request may be up to 15 minutes in the future or in the past. Signers with a configured
+// tolerance need signers.TimestampValidator.NonceTTL instead.
+const DefaultTTL = 30 * time.Minute
+
+// Store records the nonces of verified requests so that replayed requests can be rejected.
+type Store interface {
+	// Add records a nonce for the given duration. Returns false if the nonce was already recorded and has
+	// not expired yet, meaning the request is a replay.
+	Add(nonce string, ttl time.Duration) (bool, error)
+}
+
+// New generates a random (version 4) UUID, as used for the nonce of v2 signatures.
+func New() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// Derive returns a UUID derived from key, e.g. an idempotency key, so that every delivery of the same
+// request is signed with the same nonce and servers can use it to deduplicate them. The UUID is made of
+// the SHA-256 digest of key, with the version 8 (custom) bits set.
+func Derive(key string) string {
+	b := sha256.Sum256([]byte(key))
+	b[6] = (b[6] & 0x0f) | 0x80
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
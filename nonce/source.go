@@ -0,0 +1,89 @@
+package nonce
+
+import (
+	"crypto/rand"
+	"github.com/acquia/http-hmac-go/signers"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Source generates nonces for signing requests.
+type Source interface {
+	Nonce() (string, error)
+}
+
+// SourceFunc adapts a function to Source.
+type SourceFunc func() (string, error)
+
+func (f SourceFunc) Nonce() (string, error) {
+	return f()
+}
+
+// UUIDv4 generates random UUIDs with New. It is the default source.
+var UUIDv4 Source = SourceFunc(New)
+
+// ULIDSource generates ULIDs: a millisecond timestamp followed by 80 random bits, encoded in 26 characters
+// of Crockford's base32, so that nonces sort by creation time. Nonces created in the same millisecond are
+// made monotonic by incrementing the random part of the previous one.
+type ULIDSource struct {
+	// Source of the timestamps. Defaults to the package clock.
+	Clock signers.Clock
+
+	mu   sync.Mutex
+	last uint64
+	hi   uint16
+	lo   uint64
+}
+
+func NewULIDSource() *ULIDSource {
+	return &ULIDSource{}
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (u *ULIDSource) Nonce() (string, error) {
+	ms := uint64(signers.NowFrom(u.Clock).UnixNano() / int64(time.Millisecond))
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if ms == u.last {
+		u.lo++
+		if u.lo == 0 {
+			u.hi++
+		}
+	} else {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		u.last = ms
+		u.hi = uint16(b[0])<<8 | uint16(b[1])
+		u.lo = 0
+		for _, c := range b[2:] {
+			u.lo = u.lo<<8 | uint64(c)
+		}
+	}
+	// 128 bits as hi:lo, with the timestamp in the top 48 bits.
+	hi := ms<<16 | uint64(u.hi)
+	lo := u.lo
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out), nil
+}
+
+// Counter generates the deterministic sequence Prefix1, Prefix2, ..., e.g. for tests. The prefix can
+// namespace nonces, but a counter does not survive restarts, so it must not be used where nonces are
+// checked against replays across them.
+type Counter struct {
+	Prefix string
+	n      uint64
+}
+
+func (c *Counter) Nonce() (string, error) {
+	return c.Prefix + strconv.FormatUint(atomic.AddUint64(&c.n, 1), 10), nil
+}
@@ -0,0 +1,58 @@
+package nonce
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"regexp"
+	"testing"
+)
+
+func TestULIDSource(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	u := NewULIDSource()
+	re := regexp.MustCompile("^[0-9A-HJKMNP-TV-Z]{26}$")
+	prev := ""
+	for i := 0; i < 100; i++ {
+		n, err := u.Nonce()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !re.MatchString(n) || n <= prev {
+			t.Fatalf("Expected increasing ULIDs, got %s after %s.", n, prev)
+		}
+		prev = n
+	}
+	// The first 10 characters encode the timestamp, 1432075982000 ms.
+	if prev[:10] != "019NQ62N5G" {
+		t.Error("Unexpected timestamp part: ", prev[:10])
+	}
+	signers.OverrideClock(1432075983)
+	if n, _ := u.Nonce(); n <= prev {
+		t.Error("ULIDs of a later millisecond do not sort after earlier ones.")
+	}
+}
+
+func TestCounter(t *testing.T) {
+	c := &Counter{Prefix: "test-"}
+	for _, expected := range []string{"test-1", "test-2", "test-3"} {
+		if n, _ := c.Nonce(); n != expected {
+			t.Errorf("Expected %s, got %s.", expected, n)
+		}
+	}
+	if n, _ := UUIDv4.Nonce(); len(n) != 36 {
+		t.Error("Unexpected UUID: ", n)
+	}
+}
+
+func TestDerive(t *testing.T) {
+	n := Derive("order-1234")
+	if !regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-8[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$").MatchString(n) {
+		t.Error("Expected a version 8 UUID, got ", n)
+	}
+	if Derive("order-1234") != n {
+		t.Error("Expected the same key to derive the same nonce.")
+	}
+	if Derive("order-1235") == n {
+		t.Error("Expected different keys to derive different nonces.")
+	}
+}
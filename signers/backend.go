@@ -0,0 +1,102 @@
+package signers
+
+import (
+	"context"
+	"crypto/hmac"
+	"hash"
+)
+
+// MACer computes and verifies the MAC over a signable string. Signers build the signable string and leave
+// the cryptography to a MACer, so keys can be held by a KMS, an HSM or a remote signing service. The key is
+// whatever the MACer needs to find it: the encoded secret for HMAC, a key reference for a backend.
+type MACer interface {
+	MAC(ctx context.Context, key string, message []byte) ([]byte, *AuthenticationError)
+	VerifyMAC(ctx context.Context, key string, message []byte, mac []byte) *AuthenticationError
+}
+
+// HMAC is the local MACer, keyed with the decoded secret.
+type HMAC struct {
+	Digest func() hash.Hash
+	// Decodes secrets. Defaults to base64.
+	Decoder SecretDecoder
+	// Overwrite the decoded key material once the MAC is computed.
+	Wipe bool
+}
+
+func (m *HMAC) decode(secret string) (Secret, *AuthenticationError) {
+	if m.Decoder == nil {
+		return Base64Secret(secret)
+	}
+	return DecodeSecret(secret, m.Decoder)
+}
+
+func (m *HMAC) MAC(ctx context.Context, secret string, message []byte) ([]byte, *AuthenticationError) {
+	h, err := m.New(secret)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(message)
+	return h.Sum(nil), nil
+}
+
+// New returns the HMAC keyed with the decoded secret, for messages hashed as they are streamed.
+func (m *HMAC) New(secret string) (hash.Hash, *AuthenticationError) {
+	key, err := m.decode(secret)
+	if err != nil {
+		return nil, err
+	}
+	if m.Wipe {
+		// The HMAC keeps its own copy of the key.
+		defer key.Wipe()
+	}
+	return hmac.New(m.Digest, key.Bytes()), nil
+}
+
+func (m *HMAC) VerifyMAC(ctx context.Context, secret string, message []byte, mac []byte) *AuthenticationError {
+	expected, err := m.MAC(ctx, secret, message)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, mac) {
+		return Errorf(403, ErrorTypeSignatureMismatch, "Signature does not match expected signature.")
+	}
+	return nil
+}
+
+// SignerBackend computes and verifies MACs with keys it holds itself, such as a KMS or an HSM, so that
+// the secret never exists in application memory. Keys are designated by a backend specific reference.
+type SignerBackend interface {
+	GenerateMAC(ctx context.Context, keyRef string, message []byte) ([]byte, error)
+	// Returns false, without an error, if the MAC does not match.
+	VerifyMAC(ctx context.Context, keyRef string, message []byte, mac []byte) (bool, error)
+}
+
+// BackendMACer adapts a SignerBackend to MACer. Backend failures are reported as internal errors.
+func BackendMACer(b SignerBackend) MACer {
+	return &backendMACer{
+		backend: b,
+	}
+}
+
+type backendMACer struct {
+	backend SignerBackend
+}
+
+func (m *backendMACer) MAC(ctx context.Context, keyRef string, message []byte) ([]byte, *AuthenticationError) {
+	mac, err := m.backend.GenerateMAC(ctx, keyRef, message)
+	if err != nil {
+		return nil, Errorf(500, ErrorTypeInternalError, "MAC backend failed to sign: %w", err)
+	}
+	return mac, nil
+}
+
+func (m *backendMACer) VerifyMAC(ctx context.Context, keyRef string, message []byte, mac []byte) *AuthenticationError {
+	valid, err := m.backend.VerifyMAC(ctx, keyRef, message, mac)
+	if err != nil {
+		return Errorf(500, ErrorTypeInternalError, "MAC backend failed to verify: %w", err)
+	}
+	if !valid {
+		return Errorf(403, ErrorTypeSignatureMismatch, "Signature does not match expected signature.")
+	}
+	return nil
+}
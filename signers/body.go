@@ -0,0 +1,93 @@
+package signers
+
+import (
+	"encoding/base64"
+	"hash"
+	"io"
+	"io/ioutil"
+)
+
+// BodyVerifier wraps a request body and hashes it as it is read, so that a signed content hash can be
+// checked without reading the body twice. Once the body is exhausted, reads fail if it does not match.
+type BodyVerifier struct {
+	body     io.ReadCloser
+	h        hash.Hash
+	expected string
+	// If positive, reads fail with ErrBodyTooLarge beyond this many bytes.
+	Max int64
+	// The header carrying the expected digest, named in errors. Defaults to X-Authorization-Content-SHA256.
+	Header string
+	n      int64
+	done   bool
+	err    *AuthenticationError
+}
+
+// NewBodyVerifier wraps body, which may be nil, expecting its base64 encoded digest to be expected. An
+// empty expected digest only matches an empty body.
+func NewBodyVerifier(body io.ReadCloser, digest func() hash.Hash, expected string) *BodyVerifier {
+	return &BodyVerifier{
+		body:     body,
+		h:        digest(),
+		expected: expected,
+	}
+}
+
+func (b *BodyVerifier) Read(p []byte) (int, error) {
+	if b.done {
+		if b.err != nil {
+			return 0, b.err.ToError()
+		}
+		return 0, io.EOF
+	}
+	if b.body == nil {
+		return 0, b.finish()
+	}
+	n, err := b.body.Read(p)
+	b.h.Write(p[:n])
+	b.n += int64(n)
+	if b.Max > 0 && b.n > b.Max {
+		b.done = true
+		b.err = Errorf(413, ErrorTypeBodyTooLarge, "Request body exceeds %d bytes.", b.Max)
+		return 0, ErrBodyTooLarge
+	}
+	if err == io.EOF {
+		return n, b.finish()
+	}
+	return n, err
+}
+
+func (b *BodyVerifier) finish() error {
+	b.done = true
+	header := b.Header
+	if header == "" {
+		header = "X-Authorization-Content-SHA256"
+	}
+	switch {
+	case b.n == 0 && b.expected == "":
+	case b.expected == "":
+		b.err = Errorf(403, ErrorTypeMissingRequiredHeader, "Missing required header %s.", header)
+	case base64.StdEncoding.EncodeToString(b.h.Sum(nil)) != b.expected:
+		b.err = Errorf(403, ErrorTypeInvalidRequiredHeader, "Content mismatch - %s must match the SHA hash of the request body.", header)
+	}
+	if b.err != nil {
+		return b.err.ToError()
+	}
+	return io.EOF
+}
+
+func (b *BodyVerifier) Close() error {
+	if b.body == nil {
+		return nil
+	}
+	return b.body.Close()
+}
+
+// Verify reads whatever is left of the body and reports whether it matched the expected digest.
+func (b *BodyVerifier) Verify() *AuthenticationError {
+	if !b.done {
+		if _, err := io.Copy(ioutil.Discard, b); err != nil && b.err == nil {
+			return Errorf(400, ErrorTypeInternalError, "Failed to read request body: %w", err)
+		}
+	}
+	return b.err
+}
@@ -0,0 +1,411 @@
+// Package cavage implements the HMAC variant of the draft-cavage HTTP Signatures scheme, still widely
+// deployed by Mastodon-style and legacy partner APIs: a Signature header, or an Authorization header with
+// the Signature scheme, of the form
+//
+//	keyId="key-id",algorithm="hmac-sha256",headers="(request-target) host date digest",signature="<base64>"
+//
+// where the signature is an HMAC over the listed headers. The body is covered through a Digest header.
+// Importing the package registers the scheme as "cavage".
+package cavage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/acquia/http-hmac-go/signers"
+	"hash"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Algorithm     = "hmac-sha256"
+	DefaultHeader = "Signature"
+)
+
+func init() {
+	signers.Register("cavage", func(digest func() hash.Hash) (signers.Signer, *signers.AuthenticationError) {
+		return NewCavageSigner(digest)
+	})
+}
+
+// CavageSigner signs and verifies draft-cavage HTTP Signatures. The authorization headers map to the
+// parameters of the scheme: "id" is keyId and "headers" lists header fields to sign, separated by
+// semicolons, in addition to (request-target), host, date and, for requests with a body, digest. Check
+// rejects signatures that do not cover (request-target) and host.
+// ParseAuthHeaders reports the signature as "nonce", since the scheme has none, so the replay protection
+// of the verification middleware applies.
+type CavageSigner struct {
+	*signers.Digester
+	*signers.Identifiable
+	// Header SignDirect writes the signature to: Signature, or Authorization for the Signature
+	// authentication scheme. Defaults to Signature. Check accepts either.
+	Header string
+	// Decodes secrets into key material. Defaults to base64, as for v2, so that both schemes can share a
+	// key provider.
+	Decoder signers.SecretDecoder
+	// Validates the Date header, or the (created) parameter, during Check. Defaults to a tolerance of 5
+	// minutes on Clock.
+	Timestamps *signers.TimestampValidator
+	// Source of the current time. Defaults to the package clock.
+	Clock signers.Clock
+}
+
+func NewCavageSigner(digest func() hash.Hash) (*CavageSigner, *signers.AuthenticationError) {
+	if err := signers.CheckDigest(digest); err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile("(?i)^\\s*(signature\\s+)?keyid=\"")
+	if err != nil {
+		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not compile regular expression for identifier: %w", err)
+	}
+	return &CavageSigner{
+		Digester: &signers.Digester{
+			Digest: digest,
+		},
+		Identifiable: &signers.Identifiable{
+			IdRegex: re,
+		},
+	}, nil
+}
+
+func (v *CavageSigner) header() string {
+	if v.Header == "" {
+		return DefaultHeader
+	}
+	return v.Header
+}
+
+func (v *CavageSigner) timestamps() *signers.TimestampValidator {
+	if v.Timestamps == nil {
+		return &signers.TimestampValidator{
+			Tolerance: 5 * time.Minute,
+			Clock:     v.Clock,
+		}
+	}
+	return v.Timestamps
+}
+
+// TimestampValidator returns the validator of the created parameter and Date header of signatures,
+// Timestamps or its default.
+func (v *CavageSigner) TimestampValidator() *signers.TimestampValidator {
+	return v.timestamps()
+}
+
+// IdentificationHeader returns Signature, the header GetIdentificationRegex applies to for requests
+// without an Authorization header.
+func (v *CavageSigner) IdentificationHeader() string {
+	return DefaultHeader
+}
+
+// Returns the signature parameters, from an Authorization header of the Signature scheme or else from the
+// Signature header.
+func signatureParams(req *http.Request) map[string]string {
+	value := req.Header.Get(DefaultHeader)
+	if auth := req.Header.Get("Authorization"); len(auth) > 10 && strings.EqualFold(auth[:10], "signature ") {
+		value = auth[10:]
+	}
+	return ParseSignatureHeader(value)
+}
+
+// ParseSignatureHeader parses the comma separated key="value" parameters of a signature (see
+// signers.AuthParamScanner). Parameters following a syntax error are dropped.
+func ParseSignatureHeader(value string) map[string]string {
+	ret := map[string]string{}
+	sc := signers.NewAuthParamScanner(value)
+	for sc.Next() {
+		ret[sc.Name()] = sc.Value()
+	}
+	return ret
+}
+
+// Returns "id", "signature", "nonce", "algorithm", the signed header fields as "headers", and "created" and
+// "expires" if present. Does not alter the request.
+func (v *CavageSigner) ParseAuthHeaders(req *http.Request) map[string]string {
+	params := signatureParams(req)
+	ret := map[string]string{}
+	for param, key := range map[string]string{"keyId": "id", "signature": "signature", "algorithm": "algorithm", "created": "created", "expires": "expires"} {
+		if value, ok := params[param]; ok {
+			ret[key] = value
+		}
+	}
+	if sig, ok := params["signature"]; ok {
+		// Re-encoded, so that the nonce is that of the signature bytes whatever the unused padding bits, which
+		// Check rejects anyway.
+		if b, err := base64.StdEncoding.DecodeString(sig); err == nil {
+			sig = base64.StdEncoding.EncodeToString(b)
+		}
+		ret["nonce"] = sig
+	}
+	headers := []string{}
+	for _, h := range signedHeaders(params) {
+		if !strings.HasPrefix(h, "(") {
+			headers = append(headers, h)
+		}
+	}
+	if len(headers) > 0 {
+		ret["headers"] = strings.Join(headers, ";")
+	}
+	return ret
+}
+
+// The header fields Check requires signatures to cover, so that they cannot be reused for another method,
+// path or host.
+var requiredHeaders = []string{"(request-target)", "host"}
+
+// Returns the headers parameter, which defaults to date.
+func signedHeaders(params map[string]string) []string {
+	h, ok := params["headers"]
+	if !ok {
+		return []string{"date"}
+	}
+	return strings.Fields(strings.ToLower(h))
+}
+
+// Returns the header fields to sign for a request with authHeaders.
+func headersToSign(req *http.Request, authHeaders map[string]string) []string {
+	ret := []string{"(request-target)", "host", "date"}
+	if req.Header.Get("Digest") != "" {
+		ret = append(ret, "digest")
+	}
+	if hdr := authHeaders["headers"]; hdr != "" {
+		for _, h := range strings.Split(hdr, ";") {
+			if h = strings.ToLower(strings.TrimSpace(h)); h != "" && h != "host" && h != "date" && h != "digest" {
+				ret = append(ret, h)
+			}
+		}
+	}
+	return ret
+}
+
+// Builds the signing string of draft-cavage-http-signatures section 2.3.
+func signingString(req *http.Request, headers []string, params map[string]string) (string, *signers.AuthenticationError) {
+	lines := make([]string, len(headers))
+	for i, h := range headers {
+		var value string
+		switch h {
+		case "(request-target)":
+			value = strings.ToLower(req.Method) + " " + req.URL.RequestURI()
+		case "(created)", "(expires)":
+			var ok bool
+			if value, ok = params[strings.Trim(h, "()")]; !ok {
+				return "", signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signed header %s requires the %s parameter.", h, strings.Trim(h, "()"))
+			}
+		case "host":
+			value = req.Host
+		default:
+			values, ok := req.Header[http.CanonicalHeaderKey(h)]
+			if !ok {
+				return "", signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing signed header %s.", h)
+			}
+			trimmed := make([]string, len(values))
+			for j, val := range values {
+				trimmed[j] = strings.TrimSpace(val)
+			}
+			value = strings.Join(trimmed, ", ")
+		}
+		lines[i] = h + ": " + value
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (v *CavageSigner) mac(s string, secret string) (string, *signers.AuthenticationError) {
+	decoder := v.Decoder
+	if decoder == nil {
+		decoder = base64.StdEncoding.DecodeString
+	}
+	key, err := signers.DecodeSecret(secret, decoder)
+	if err != nil {
+		return "", err
+	}
+	h := hmac.New(v.Digest, key.Bytes())
+	h.Write([]byte(s))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// Returns the Digest header value of the body, or an empty string if there is none.
+func digestHeader(req *http.Request) (string, *signers.AuthenticationError) {
+	sum, n, err := signers.HashRequestBody(req, sha256.New)
+	if err != nil {
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
+	}
+	if n == 0 {
+		return "", nil
+	}
+	return "SHA-256=" + sum, nil
+}
+
+// Sign signs the request's Date and Digest headers, which must be present; SignDirect sets them.
+func (v *CavageSigner) Sign(req *http.Request, authHeaders map[string]string, secret string) (string, *signers.AuthenticationError) {
+	if _, ok := authHeaders["id"]; !ok {
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Missing access key for signature.")
+	}
+	s, err := signingString(req, headersToSign(req, authHeaders), nil)
+	if err != nil {
+		return "", err
+	}
+	return v.mac(s, secret)
+}
+
+func (v *CavageSigner) Check(req *http.Request, secret string) *signers.AuthenticationError {
+	params := signatureParams(req)
+	if len(params) == 0 {
+		return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header Signature.")
+	}
+	if params["keyId"] == "" || params["signature"] == "" {
+		return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signature must contain keyId and signature.")
+	}
+	if alg, ok := params["algorithm"]; ok && !strings.EqualFold(alg, Algorithm) {
+		return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Unsupported signature algorithm %s.", alg)
+	}
+	presented, derr := base64.StdEncoding.Strict().DecodeString(params["signature"])
+	if derr != nil {
+		return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signature is not valid base64.")
+	}
+	headers := signedHeaders(params)
+	for _, required := range requiredHeaders {
+		if !contains(headers, required) {
+			return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signature must cover %s.", required)
+		}
+	}
+	if err := v.checkTime(req, headers, params); err != nil {
+		return err
+	}
+	digest, err := digestHeader(req)
+	if err != nil {
+		return err
+	}
+	if digest != "" {
+		if !contains(headers, "digest") {
+			return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Digest must be signed for requests with a body.")
+		}
+		if !digestMatches(req.Header.Get("Digest"), digest) {
+			return signers.Errorf(403, signers.ErrorTypeInvalidRequiredHeader, "Content mismatch - Digest must match the SHA-256 digest of the request body.")
+		}
+	}
+	s, err := signingString(req, headers, params)
+	if err != nil {
+		return err
+	}
+	expected, err := v.mac(s, secret)
+	if err != nil {
+		return err
+	}
+	want, _ := base64.StdEncoding.DecodeString(expected)
+	if !hmac.Equal(want, presented) {
+		return signers.Errorf(403, signers.ErrorTypeSignatureMismatch, "Signature does not match expected signature.")
+	}
+	return nil
+}
+
+// Requires a signed timestamp, the (created) parameter or the Date header, within the tolerance, and
+// rejects expired signatures.
+func (v *CavageSigner) checkTime(req *http.Request, headers []string, params map[string]string) *signers.AuthenticationError {
+	switch {
+	case contains(headers, "(created)"):
+		if _, err := v.timestamps().Validate(params["created"]); err != nil {
+			return err
+		}
+	case contains(headers, "date"):
+		date, err := http.ParseTime(req.Header.Get("Date"))
+		if err != nil {
+			return signers.Errorf(403, signers.ErrorTypeInvalidRequiredHeader, "Invalid Date header: %w", err)
+		}
+		if _, err := v.timestamps().Validate(strconv.FormatInt(date.Unix(), 10)); err != nil {
+			return err
+		}
+	default:
+		return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Signature must cover the date header or (created).")
+	}
+	if expires, ok := params["expires"]; ok {
+		exp, err := strconv.ParseFloat(expires, 64)
+		if err != nil {
+			return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Invalid expires parameter: %w", err)
+		}
+		if float64(signers.NowFrom(v.Clock).Unix()) > exp {
+			return signers.Errorf(403, signers.ErrorTypeTimestampRangeError, "Signature expired at %s.", expires)
+		}
+	}
+	return nil
+}
+
+// Finds the SHA-256 digest among those listed in a Digest header.
+func digestMatches(header string, digest string) bool {
+	for _, d := range strings.Split(header, ",") {
+		if d = strings.TrimSpace(d); len(d) > 8 && strings.EqualFold(d[:8], digest[:8]) && d[8:] == digest[8:] {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SignDirect sets the Date header if missing, the Digest header for requests with a body, and the
+// signature header.
+func (v *CavageSigner) SignDirect(req *http.Request, authHeaders map[string]string, secret string) *signers.AuthenticationError {
+	if req.Header.Get("Date") == "" {
+		req.Header.Set("Date", signers.NowFrom(v.Clock).UTC().Format(http.TimeFormat))
+	}
+	digest, err := digestHeader(req)
+	if err != nil {
+		return err
+	}
+	if digest != "" {
+		req.Header.Set("Digest", digest)
+	}
+	sig, err := v.Sign(req, authHeaders, secret)
+	if err != nil {
+		return err
+	}
+	value, err := v.GenerateAuthorization(req, authHeaders, sig)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(v.header(), "Authorization") {
+		value = "Signature " + value
+	}
+	req.Header.Set(v.header(), value)
+	return nil
+}
+
+// GenerateAuthorization returns the signature parameters, without the Signature scheme name.
+func (v *CavageSigner) GenerateAuthorization(req *http.Request, authHeaders map[string]string, signature string) (string, *signers.AuthenticationError) {
+	id, ok := authHeaders["id"]
+	if !ok {
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Missing access key for signature.")
+	}
+	return fmt.Sprintf("keyId=\"%s\",algorithm=\"%s\",headers=\"%s\",signature=\"%s\"", id, Algorithm, strings.Join(headersToSign(req, authHeaders), " "), signature), nil
+}
+
+func (v *CavageSigner) HashBody(req *http.Request) (string, *signers.AuthenticationError) {
+	sum, _, err := signers.HashRequestBody(req, sha256.New)
+	if err != nil {
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
+	}
+	return sum, nil
+}
+
+func (v *CavageSigner) GetIdentificationRegex() *regexp.Regexp {
+	return v.IdRegex
+}
+
+// GetResponseSigner returns nil: the scheme does not sign responses.
+func (v *CavageSigner) GetResponseSigner() signers.ResponseSigner {
+	return nil
+}
+
+func (v *CavageSigner) Version() int {
+	return 0
+}
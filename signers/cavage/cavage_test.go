@@ -0,0 +1,183 @@
+package cavage
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/middleware"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/compat"
+	"github.com/acquia/http-hmac-go/signers/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSecret = "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+
+func post(body string) *http.Request {
+	req, _ := http.NewRequest("POST", "http://example.com/foo?param=value&pet=dog", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestCavageSigner(t *testing.T) {
+	signers.OverrideClock(1402170695)
+	defer signers.RestoreClock()
+	signer, err := NewCavageSigner(sha256.New)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	req := post(`{"hello": "world"}`)
+	if err := signer.SignDirect(req, map[string]string{"id": "Test", "headers": "Content-Type"}, testSecret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	if date := req.Header.Get("Date"); date != "Sat, 07 Jun 2014 19:51:35 GMT" {
+		t.Error("Unexpected Date header: ", date)
+	}
+	if digest := req.Header.Get("Digest"); digest != "SHA-256=X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=" {
+		t.Error("Unexpected Digest header: ", digest)
+	}
+	header := req.Header.Get("Signature")
+	if !strings.HasPrefix(header, `keyId="Test",algorithm="hmac-sha256",headers="(request-target) host date digest content-type",signature="`) {
+		t.Error("Unexpected Signature header: ", header)
+	}
+	if err := signer.Check(req, testSecret); err != nil {
+		t.Error("Failed to verify signature: ", err.Message)
+	}
+	ah := signer.ParseAuthHeaders(req)
+	if ah["id"] != "Test" || ah["headers"] != "host;date;digest;content-type" || ah["nonce"] != ah["signature"] {
+		t.Error("Unexpected authorization headers: ", ah)
+	}
+
+	tampered := post(`{"hello": "there"}`)
+	tampered.Header = req.Header
+	if err := signer.Check(tampered, testSecret); err == nil || err.ErrorType != signers.ErrorTypeInvalidRequiredHeader {
+		t.Error("Expected a content mismatch for an altered body.")
+	}
+	moved := post(`{"hello": "world"}`)
+	moved.Header = req.Header
+	moved.URL.RawQuery = "param=other"
+	if err := signer.Check(moved, testSecret); err == nil || err.ErrorType != signers.ErrorTypeSignatureMismatch {
+		t.Error("Expected a signature mismatch for another request target.")
+	}
+
+	signers.OverrideClock(1402170695 + 3600)
+	if err := signer.Check(req, testSecret); err == nil || err.ErrorType != signers.ErrorTypeTimestampRangeError {
+		t.Error("Expected an old signature to be rejected.")
+	}
+}
+
+func TestAuthorizationScheme(t *testing.T) {
+	signers.OverrideClock(1402170695)
+	defer signers.RestoreClock()
+	signer, _ := NewCavageSigner(sha256.New)
+	signer.Header = "Authorization"
+	req, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	if err := signer.SignDirect(req, map[string]string{"id": "Test"}, testSecret); err != nil {
+		t.Fatal(err.Message)
+	}
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, `Signature keyId="Test",`) {
+		t.Error("Unexpected Authorization header: ", auth)
+	}
+	if err := signer.Check(req, testSecret); err != nil {
+		t.Error("Failed to verify signature: ", err.Message)
+	}
+	identifier := compat.NewSupportedSignatureIdentifier()
+	if _, ok := identifier.IdentifySignature(auth).(*CavageSigner); !ok {
+		t.Error("Expected the Authorization header to be identified as a draft-cavage signature.")
+	}
+
+	signer.Header = ""
+	req, _ = http.NewRequest("GET", "http://example.com/foo", nil)
+	signer.SignDirect(req, map[string]string{"id": "Test"}, testSecret)
+	if _, ok := identifier.IdentifyRequest(req).(*CavageSigner); !ok {
+		t.Error("Expected the Signature header to be identified as a draft-cavage signature.")
+	}
+}
+
+func TestRequiredHeaders(t *testing.T) {
+	signers.OverrideClock(1402170695)
+	defer signers.RestoreClock()
+	signer, _ := NewCavageSigner(sha256.New)
+	req, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	req.Header.Set("Date", "Sat, 07 Jun 2014 19:51:35 GMT")
+	s, err := signingString(req, []string{"date"}, nil)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	sig, err := signer.mac(s, testSecret)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	// Without a headers parameter, the signature only covers the Date header.
+	req.Header.Set("Signature", `keyId="Test",algorithm="hmac-sha256",signature="`+sig+`"`)
+	if err := signer.Check(req, testSecret); err == nil || err.ErrorType != signers.ErrorTypeInvalidAuthHeader {
+		t.Error("Expected a signature over the Date header only to be rejected.")
+	}
+}
+
+func TestParseSignatureHeader(t *testing.T) {
+	params := ParseSignatureHeader(`keyId="Te\"st", algorithm="hmac-sha256",created=1402170695, headers="(request-target) (created)",signature="a,b="`)
+	expected := map[string]string{
+		"keyId":     `Te"st`,
+		"algorithm": "hmac-sha256",
+		"created":   "1402170695",
+		"headers":   "(request-target) (created)",
+		"signature": "a,b=",
+	}
+	for k, v := range expected {
+		if params[k] != v {
+			t.Errorf("Expected %s to be %q, got %q", k, v, params[k])
+		}
+	}
+}
+
+func TestReplayedPaddingVariant(t *testing.T) {
+	signers.OverrideClock(1402170695)
+	defer signers.RestoreClock()
+	signer, _ := NewCavageSigner(sha256.New)
+	signed := post(`{"hello": "world"}`)
+	if err := signer.SignDirect(signed, map[string]string{"id": "Test"}, testSecret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	m := middleware.New(keys.Static{"Test": testSecret})
+	m.Identifier = &mock.Identifier{Signer: signer}
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	send := func(header string) int {
+		req := post(`{"hello": "world"}`)
+		req.Header = signed.Header.Clone()
+		req.Header.Del("Signature")
+		req.Header.Set("Authorization", "Signature "+header)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	header := signed.Header.Get("Signature")
+	sig := ParseSignatureHeader(header)["signature"]
+	// The last character before the padding carries 2 unused bits, zero in the canonical encoding.
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	last := len(sig) - 2
+	variant := sig[:last] + string(alphabet[strings.IndexByte(alphabet, sig[last])+1]) + sig[last+1:]
+	if code := send(header); code != 200 {
+		t.Fatal("Failed to verify signature, got status ", code)
+	}
+	if _, err := base64.StdEncoding.DecodeString(variant); err != nil {
+		t.Fatal("Expected the variant to decode leniently: ", err)
+	}
+	if code := send(strings.Replace(header, sig, variant, 1)); code != 403 {
+		t.Error("Expected the padding bit variant of a replayed signature to be rejected, got status ", code)
+	}
+	req := post(`{"hello": "world"}`)
+	req.Header = signed.Header.Clone()
+	req.Header.Set("Signature", strings.Replace(header, sig, variant, 1))
+	if n := signer.ParseAuthHeaders(req)["nonce"]; n != sig {
+		t.Error("Expected the nonce of the variant to be that of the canonical signature, got ", n)
+	}
+	if err := signer.Check(req, testSecret); err == nil || err.ErrorType != signers.ErrorTypeInvalidAuthHeader {
+		t.Error("Expected a non-canonical signature encoding to be rejected.")
+	}
+}
@@ -6,65 +6,161 @@ import (
 	"github.com/acquia/http-hmac-go/signers/v1"
 	"github.com/acquia/http-hmac-go/signers/v2"
 	"hash"
+	"net/http"
 )
 
 type SignatureIdentifier struct {
 	compatSigners map[int]signers.Signer
+	schemes       []string
+	schemeSigners map[string]signers.Signer
 }
 
+// NewAllSignaturesIdentifier is like NewSignatureIdentifier for versions 1 and 2.
 func NewAllSignaturesIdentifier(digest func() hash.Hash) *SignatureIdentifier {
 	return NewSignatureIdentifier(digest, 1, 2)
 }
 
+// NewSupportedSignatureIdentifier is like NewAllSignaturesIdentifier with SHA-256.
 func NewSupportedSignatureIdentifier() *SignatureIdentifier {
-	return NewSignatureIdentifier(sha256.New, 1, 2)
+	return NewAllSignaturesIdentifier(sha256.New)
 }
 
+func mustSignatureIdentifier(inst *SignatureIdentifier, err *signers.AuthenticationError) *SignatureIdentifier {
+	if err != nil {
+		panic(err.Message)
+	}
+	return inst
+}
+
+// NewSignatureIdentifier is like NewSignatureIdentifierE, but panics if it fails.
 func NewSignatureIdentifier(digest func() hash.Hash, MinimumSupportedVersion int, MaximumSupportedVersion int) *SignatureIdentifier {
+	return mustSignatureIdentifier(NewSignatureIdentifierE(digest, MinimumSupportedVersion, MaximumSupportedVersion))
+}
+
+// NewSignatureIdentifierE identifies the signatures of the given versions and of the registered schemes.
+// Versions and schemes FIPS mode rules out are left out. Fails if a signer cannot be created, e.g. if the
+// factory of a registered scheme fails.
+func NewSignatureIdentifierE(digest func() hash.Hash, MinimumSupportedVersion int, MaximumSupportedVersion int) (*SignatureIdentifier, *signers.AuthenticationError) {
 	inst := &SignatureIdentifier{
 		compatSigners: map[int]signers.Signer{},
+		schemes:       []string{},
+		schemeSigners: map[string]signers.Signer{},
 	}
 	for version := MinimumSupportedVersion; version <= MaximumSupportedVersion; version++ {
-		signer := inst.getNewInstanceByVersion(digest, version)
+		signer, err := inst.getNewInstanceByVersion(digest, version)
+		if err != nil {
+			return nil, err
+		}
 		if signer != nil {
 			inst.compatSigners[version] = signer
 		}
 	}
-	return inst
+	for _, scheme := range signers.RegisteredSchemes() {
+		signer, err := signers.NewRegisteredSigner(scheme, digest)
+		if err != nil {
+			if err.ErrorType == signers.ErrorTypeUnapprovedAlgorithm {
+				continue
+			}
+			return nil, err
+		}
+		inst.schemes = append(inst.schemes, scheme)
+		inst.schemeSigners[scheme] = signer
+	}
+	return inst, nil
 }
 
-func (s *SignatureIdentifier) getNewInstanceByVersion(digest func() hash.Hash, version int) signers.Signer {
+// Returns nil for versions that do not exist, or that FIPS mode rules out.
+func (s *SignatureIdentifier) getNewInstanceByVersion(digest func() hash.Hash, version int) (signers.Signer, *signers.AuthenticationError) {
+	var sig signers.Signer
+	var err *signers.AuthenticationError
 	switch version {
 	case 1:
-		sig, err := v1.NewV1Signer(digest)
-		if err != nil {
-			panic(err.Message)
-		}
-		return sig
+		sig, err = v1.NewV1Signer(digest)
 	case 2:
-		sig, err := v2.NewV2Signer(digest)
-		if err != nil {
-			panic(err.Message)
-		}
-		return sig
+		sig, err = v2.NewV2Signer(digest)
 	default:
-		return nil
+		return nil, nil
 	}
+	if err != nil {
+		if err.ErrorType == signers.ErrorTypeUnapprovedAlgorithm {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return sig, nil
 }
 
 func (s *SignatureIdentifier) IdentifySignature(auth_header string) signers.Signer {
 	for _, signer := range s.compatSigners {
-		reg := signer.GetIdentificationRegex()
-		if reg.MatchString(auth_header) {
+		if signers.MatchAuthorization(signer, auth_header) {
+			return signer
+		}
+	}
+	for _, scheme := range s.schemes {
+		signer := s.schemeSigners[scheme]
+		if signers.MatchAuthorization(signer, auth_header) {
 			return signer
 		}
 	}
 	return nil // incompatible signature
 }
 
+// IdentifyRequest returns the signer of a registered scheme signing in another header than Authorization
+// (see signers.HeaderIdentifiable) whose identification regex matches that header of the request, or nil.
+func (s *SignatureIdentifier) IdentifyRequest(req *http.Request) signers.Signer {
+	for _, scheme := range s.schemes {
+		signer := s.schemeSigners[scheme]
+		hi, ok := signer.(signers.HeaderIdentifiable)
+		if !ok {
+			continue
+		}
+		if value := req.Header.Get(hi.IdentificationHeader()); value != "" && signers.MatchAuthorization(signer, value) {
+			return signer
+		}
+	}
+	return nil
+}
+
+// CloneIdentifier returns a copy of the identifier with copies of its signers, those that cannot be copied
+// (see signers.SignerCloner) being shared.
+func (s *SignatureIdentifier) CloneIdentifier() signers.Identifier {
+	return s.clone()
+}
+
+func (s *SignatureIdentifier) clone() *SignatureIdentifier {
+	c := &SignatureIdentifier{
+		compatSigners: make(map[int]signers.Signer, len(s.compatSigners)),
+		schemes:       append([]string{}, s.schemes...),
+		schemeSigners: make(map[string]signers.Signer, len(s.schemeSigners)),
+	}
+	for version, signer := range s.compatSigners {
+		c.compatSigners[version] = cloneSigner(signer)
+	}
+	for scheme, signer := range s.schemeSigners {
+		c.schemeSigners[scheme] = cloneSigner(signer)
+	}
+	return c
+}
+
+func cloneSigner(signer signers.Signer) signers.Signer {
+	if sc, ok := signer.(signers.SignerCloner); ok {
+		return sc.CloneSigner()
+	}
+	return signer
+}
+
 func (s *SignatureIdentifier) GetSigner(version int) signers.Signer {
 	if signer, ok := s.compatSigners[version]; ok {
 		return signer
 	}
 	return nil
 }
+
+// Returns the signer of a custom scheme registered through signers.Register, or nil if it was not
+// registered when the identifier was created.
+func (s *SignatureIdentifier) GetSchemeSigner(scheme string) signers.Signer {
+	if signer, ok := s.schemeSigners[scheme]; ok {
+		return signer
+	}
+	return nil
+}
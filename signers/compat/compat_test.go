@@ -1,11 +1,21 @@
 package compat
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"fmt"
 	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/mock"
 	"github.com/acquia/http-hmac-go/signers/v1"
 	"github.com/acquia/http-hmac-go/signers/v2"
+	"hash"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func LogTest(t *testing.T, args ...interface{}) {
@@ -99,3 +109,167 @@ func TestIdentifyAndSign(t *testing.T) {
 		t.Log("Conclusion: test PASSED.")
 	}
 }
+
+type customSigner struct {
+	*mock.Signer
+}
+
+func (c *customSigner) GetIdentificationRegex() *regexp.Regexp {
+	return regexp.MustCompile("^Custom ")
+}
+
+// Registers the custom scheme once, as the registry is global and rejects duplicates, e.g. under -count=2.
+var registerCustom sync.Once
+
+func TestRegisteredScheme(t *testing.T) {
+	registerCustom.Do(func() {
+		signers.Register("custom", func(digest func() hash.Hash) (signers.Signer, *signers.AuthenticationError) {
+			return &customSigner{Signer: &mock.Signer{VersionNumber: 0}}, nil
+		})
+	})
+	ident := NewSupportedSignatureIdentifier()
+	if _, ok := ident.IdentifySignature("Custom abc").(*customSigner); !ok {
+		LogFail(t, "Registered scheme was not identified.")
+		t.Fail()
+	}
+	if ident.GetSchemeSigner("custom") == nil {
+		LogFail(t, "Registered scheme signer was not created.")
+		t.Fail()
+	}
+	if _, ok := ident.IdentifySignature("Acquia efdde334-fe7b-11e4-a322-1697f925ec7b:7Tq3+JP3lAu4FoJz81XEx5+qfOc=").(*v1.V1Signer); !ok {
+		LogFail(t, "Built-in version was not identified ahead of registered schemes.")
+		t.Fail()
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	for k, v := range signers.Fixtures {
+		eh, ok := v.ExpectedHeader["v2"]
+		if !ok {
+			continue
+		}
+		LogTest(t, "fixture ", k, " - ", v.TestName)
+		req := v.Request.Clone(v.Request.Context())
+		req.Header.Set("Authorization", eh)
+		id := NewSupportedSignatureIdentifier().Identify(req)
+		if id == nil {
+			LogFail(t, "Signature was not identified.")
+			t.Fail()
+			continue
+		}
+		if id.Version != 2 || id.ID != v.AuthHeaders["id"] || id.Realm != v.AuthHeaders["realm"] || id.Nonce != v.AuthHeaders["nonce"] || id.Signature != v.Expected["v2"] {
+			LogFail(t, "Identification does not match fixture: ", *id)
+			t.Fail()
+			continue
+		}
+		if strings.Join(id.Headers, ";") != v.AuthHeaders["headers"] {
+			LogFail(t, "Unexpected signed headers: ", id.Headers)
+			t.Fail()
+			continue
+		}
+		LogPass(t, "Identification matches.")
+	}
+}
+
+func TestIdentifyResolvesHeader(t *testing.T) {
+	auth := `acquia-http-hmac realm="Pipet%20service",id="efdde334-fe7b-11e4-a322-1697f925ec7b",nonce="d1954337-5319-4821-8427-115542e08d10",version="2.0",headers="",signature="MRlPr/Z1WQY2sMthcaEqETRMw4gPYXlPcTpaLWS2gcc="`
+	a, _ := v2.ParseAuthorization(auth)
+	ident := NewSupportedSignatureIdentifier()
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	a.SetParamHeaders(req.Header)
+	if id := ident.Identify(req); id == nil || id.Version != 2 || id.ID != a.ID || id.Signature != a.Signature {
+		t.Error("Expected the parameter headers to be identified, got ", id)
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Error("Expected Identify not to alter the request.")
+	}
+
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz, "+auth)
+	if id := ident.Identify(req); id == nil || id.Version != 2 || id.Nonce != a.Nonce {
+		t.Error("Expected the v2 credential among several to be identified, got ", id)
+	}
+
+	ident.GetSigner(2).(*v2.V2Signer).AuthorizationHeader = "X-Acquia-Authorization"
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Acquia-Authorization", auth)
+	if id := ident.Identify(req); id == nil || id.Version != 2 || id.Realm != "Pipet service" {
+		t.Error("Expected the header configured on the v2 signer to be identified, got ", id)
+	}
+}
+
+func TestFIPSMode(t *testing.T) {
+	signers.SetFIPSMode(true)
+	defer signers.SetFIPSMode(false)
+
+	if _, err := v1.NewV1Signer(sha1.New); err == nil || err.ErrorType != signers.ErrorTypeUnapprovedAlgorithm {
+		t.Error("Expected v1 to be rejected in FIPS mode.")
+	}
+	if _, err := v2.NewV2Signer(sha1.New); err == nil || err.ErrorType != signers.ErrorTypeUnapprovedAlgorithm {
+		t.Error("Expected HMAC-SHA1 to be rejected in FIPS mode.")
+	}
+	for _, digest := range []func() hash.Hash{sha256.New, sha512.New384, sha512.New} {
+		if _, err := v2.NewV2Signer(digest); err != nil {
+			t.Error("Expected approved digest to be accepted in FIPS mode: ", err.Message)
+		}
+	}
+
+	identifier := NewSupportedSignatureIdentifier()
+	if identifier.IdentifySignature("Acquia 1:ABC+def/123=") != nil {
+		t.Error("Expected v1 signatures not to be identified in FIPS mode.")
+	}
+	if identifier.IdentifySignature(`acquia-http-hmac id="a",nonce="b",realm="c",signature="d",version="2.0"`) == nil {
+		t.Error("Expected v2 signatures to be identified in FIPS mode.")
+	}
+
+	if !signers.FIPSMode() {
+		t.Error("Expected FIPS mode to be enabled.")
+	}
+}
+
+func TestMigrationIdentifier(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	v1auth := "Acquia efdde334-fe7b-11e4-a322-1697f925ec7b:7Tq3+JP3lAu4FoJz81XEx5+qfOc="
+	v2auth := `acquia-http-hmac realm="Pipet%20service",id="efdde334-fe7b-11e4-a322-1697f925ec7b",nonce="d1954337-5319-4821-8427-115542e08d10",version="2.0",headers="",signature="MRlPr/Z1WQY2sMthcaEqETRMw4gPYXlPcTpaLWS2gcc="`
+	events := []*MigrationEvent{}
+	config := MigrationConfig{
+		V1Until: time.Unix(1432075982+60, 0),
+		OnV1: func(event *MigrationEvent) {
+			events = append(events, event)
+		},
+	}
+	ident := NewMigrationIdentifier(config)
+	if _, ok := ident.IdentifySignature(v1auth).(*v1.V1Signer); !ok {
+		LogFail(t, "v1 signature was not identified during the transition period.")
+		t.Fail()
+	}
+	if _, ok := ident.IdentifySignature(v2auth).(*v2.V2Signer); !ok {
+		LogFail(t, "v2 signature was not identified.")
+		t.Fail()
+	}
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("Authorization", v1auth)
+	if id := ident.Identify(req); id == nil || !id.Deprecated || id.Version != 1 {
+		LogFail(t, "Expected the v1 identification to be tagged deprecated, got ", id)
+		t.Fail()
+	}
+	if len(events) != 2 || events[0].KeyID != "efdde334-fe7b-11e4-a322-1697f925ec7b" || events[0].Rejected {
+		LogFail(t, "Unexpected migration events: ", events)
+		t.Fail()
+	}
+
+	signers.OverrideClock(1432075982 + 120)
+	if ident.IdentifySignature(v1auth) != nil {
+		LogFail(t, "v1 signature was identified after the transition period.")
+		t.Fail()
+	}
+	if ident.IdentifySignature(v2auth) == nil {
+		LogFail(t, "v2 signature was not identified after the transition period.")
+		t.Fail()
+	}
+	if len(events) != 3 || !events[2].Rejected {
+		LogFail(t, "Expected the rejected v1 signature to be reported, got ", events)
+		t.Fail()
+	}
+}
@@ -0,0 +1,82 @@
+package compat
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"net/http"
+	"strings"
+)
+
+// Identification describes the signature a request bears, as far as it can be told without verifying it.
+type Identification struct {
+	Signer signers.Signer
+	// The signature version, or 0 for registered custom schemes.
+	Version int
+	// The name of the registered scheme, or empty for built-in versions.
+	Scheme    string
+	ID        string
+	Realm     string
+	Nonce     string
+	Headers   []string
+	Signature string
+	// All parameters parsed from the Authorization header.
+	AuthHeaders map[string]string
+	// Set by MigrationIdentifier for signatures of a version being migrated away from.
+	Deprecated bool
+	// The credential the signer was identified by.
+	credential string
+}
+
+// Identify finds the signer matching the authorization of a request and parses it, resolving the header as
+// the verification middleware does: the header the v2 signer reads (see v2.V2Signer.AuthorizationHeader),
+// or else the v2 parameter headers (see v2.AuthorizationFromParamHeaders), the first credential a signer
+// matches if there are several, and the headers of schemes signing in another header (see IdentifyRequest).
+// Returns nil if no signer matches. Does not alter the request.
+func (s *SignatureIdentifier) Identify(req *http.Request) *Identification {
+	name := s.authorizationHeader()
+	req = req.Clone(req.Context())
+	if req.Header.Get(name) == "" {
+		if auth, ok := v2.AuthorizationFromParamHeaders(req.Header); ok {
+			req.Header.Set(name, auth)
+		}
+	}
+	cred, signer := signers.IdentifyCredential(s, req.Header.Values(name))
+	if signer != nil {
+		req.Header.Set(name, cred)
+	} else if cred == "" {
+		signer = s.IdentifyRequest(req)
+	}
+	if signer == nil {
+		return nil
+	}
+	ret := &Identification{
+		Signer:     signer,
+		Version:    signer.Version(),
+		Headers:    []string{},
+		credential: cred,
+	}
+	for _, scheme := range s.schemes {
+		if s.schemeSigners[scheme] == signer {
+			ret.Scheme = scheme
+		}
+	}
+	ah := signer.ParseAuthHeaders(req)
+	ret.AuthHeaders = ah
+	ret.ID = ah["id"]
+	ret.Realm = ah["realm"]
+	ret.Nonce = ah["nonce"]
+	ret.Signature = ah["signature"]
+	if hdr := ah["headers"]; hdr != "" {
+		ret.Headers = strings.Split(hdr, ";")
+	}
+	return ret
+}
+
+// Returns the header the v2 signer reads its signature from, which the middleware configures along with its
+// own (see middleware.WithAuthorizationHeader).
+func (s *SignatureIdentifier) authorizationHeader() string {
+	if n, ok := s.GetSigner(2).(signers.AuthorizationHeaderNamer); ok {
+		return n.AuthorizationHeaderName()
+	}
+	return "Authorization"
+}
@@ -0,0 +1,88 @@
+package compat
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v1"
+	"net/http"
+	"time"
+)
+
+// MigrationConfig configures a transition from v1 to v2 signatures, during which both are accepted.
+type MigrationConfig struct {
+	// v1 signatures are identified until this time, and no longer afterwards, so that verification fails
+	// with ErrorTypeUnknownSignatureType. Zero accepts them until the configuration is changed.
+	V1Until time.Time
+	// Called whenever a v1 signature is identified, including after V1Until, to track the integrations
+	// left to migrate.
+	OnV1 func(event *MigrationEvent)
+	// Source of the current time. Defaults to the package clock.
+	Clock signers.Clock
+}
+
+// MigrationEvent reports a v1 signature seen during a migration.
+type MigrationEvent struct {
+	KeyID string
+	Time  time.Time
+	// Whether the signature was rejected because the transition period is over.
+	Rejected bool
+}
+
+// MigrationIdentifier identifies v1 and v2 signatures, and registered schemes, like the identifier of
+// NewSupportedSignatureIdentifier, reporting v1 signatures to the migration's hook and rejecting them once
+// the transition period is over. Identification.Deprecated tags v1 signatures.
+type MigrationIdentifier struct {
+	*SignatureIdentifier
+	config MigrationConfig
+}
+
+func NewMigrationIdentifier(config MigrationConfig) *MigrationIdentifier {
+	return &MigrationIdentifier{
+		SignatureIdentifier: NewSupportedSignatureIdentifier(),
+		config:              config,
+	}
+}
+
+// CloneIdentifier returns a copy of the identifier with copies of its signers.
+func (m *MigrationIdentifier) CloneIdentifier() signers.Identifier {
+	return &MigrationIdentifier{
+		SignatureIdentifier: m.SignatureIdentifier.clone(),
+		config:              m.config,
+	}
+}
+
+// Reports a v1 signature and returns whether it is still accepted.
+func (m *MigrationIdentifier) acceptV1(authHeader string) bool {
+	now := signers.NowFrom(m.config.Clock)
+	accepted := m.config.V1Until.IsZero() || now.Before(m.config.V1Until)
+	if m.config.OnV1 != nil {
+		req := &http.Request{Header: http.Header{"Authorization": []string{authHeader}}}
+		m.config.OnV1(&MigrationEvent{
+			KeyID:    v1.ParseAuthHeaders(req)["id"],
+			Time:     now,
+			Rejected: !accepted,
+		})
+	}
+	return accepted
+}
+
+func (m *MigrationIdentifier) IdentifySignature(authHeader string) signers.Signer {
+	signer := m.SignatureIdentifier.IdentifySignature(authHeader)
+	if signer != nil && signer.Version() == 1 && !m.acceptV1(authHeader) {
+		return nil
+	}
+	return signer
+}
+
+// Identify is like SignatureIdentifier.Identify, setting Deprecated for v1 signatures and returning nil for
+// v1 signatures after the transition period.
+func (m *MigrationIdentifier) Identify(req *http.Request) *Identification {
+	ret := m.SignatureIdentifier.Identify(req)
+	if ret == nil || ret.Version != 1 {
+		return ret
+	}
+	if !m.acceptV1(ret.credential) {
+		return nil
+	}
+	ret.Deprecated = true
+	return ret
+}
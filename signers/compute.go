@@ -0,0 +1,77 @@
+package signers
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// AuthorizationHeaderNamer is implemented by signers that may send their signature in another header than
+// Authorization, e.g. v2 signers with an AuthorizationHeader.
+type AuthorizationHeaderNamer interface {
+	AuthorizationHeaderName() string
+}
+
+// Returns the header signer sends its signature in.
+func authorizationHeaderName(signer Signer) string {
+	if n, ok := signer.(AuthorizationHeaderNamer); ok {
+		return n.AuthorizationHeaderName()
+	}
+	return "Authorization"
+}
+
+// ComputeAuthorization signs a copy of req with SignDirect and returns the value of the Authorization header,
+// or of the header the signer sends its signature in (see AuthorizationHeaderNamer), along with the other
+// headers the signer set or changed, e.g. X-Authorization-Timestamp, so that req and authHeaders are left
+// untouched. Headers the signer removes from the copy, such as those of an existing signature, are not
+// reported. A body without GetBody has to be buffered, after which req.Body is replaced by an equivalent
+// reader.
+func ComputeAuthorization(signer Signer, req *http.Request, authHeaders map[string]string, secret string) (string, http.Header, *AuthenticationError) {
+	clone := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return "", nil, Errorf(500, ErrorTypeInternalError, "Failed to copy request body: %w", err)
+			}
+			clone.Body = body
+		} else {
+			data, err := ReadBody(req)
+			if err != nil {
+				return "", nil, Errorf(500, ErrorTypeInternalError, "Failed to read request body: %w", err)
+			}
+			clone.Body = ioutil.NopCloser(bytes.NewReader(data))
+			clone.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(data)), nil
+			}
+		}
+	}
+	ah := make(map[string]string, len(authHeaders))
+	for k, v := range authHeaders {
+		ah[k] = v
+	}
+	if err := signer.SignDirect(clone, ah, secret); err != nil {
+		return "", nil, err
+	}
+	name := http.CanonicalHeaderKey(authorizationHeaderName(signer))
+	extra := http.Header{}
+	for k, vals := range clone.Header {
+		if k != name && !equalValues(req.Header[k], vals) {
+			extra[k] = vals
+		}
+	}
+	return clone.Header.Get(name), extra, nil
+}
+
+func equalValues(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
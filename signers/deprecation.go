@@ -0,0 +1,33 @@
+package signers
+
+import (
+	"net/http"
+	"time"
+)
+
+// DeprecationEvent reports a signature of a deprecated version, v1, that was produced or accepted, so that
+// operators can track the integrations left to migrate.
+type DeprecationEvent struct {
+	Version int
+	KeyID   string
+	Method  string
+	Path    string
+	// True if the signature was produced, false if it was accepted.
+	Signed bool
+	Time   time.Time
+}
+
+// DeprecationHook receives deprecation events. It is called synchronously and should not block.
+type DeprecationHook func(event *DeprecationEvent)
+
+// NewDeprecationEvent describes the use of a deprecated signature version on a request.
+func NewDeprecationEvent(req *http.Request, version int, id string, signed bool) *DeprecationEvent {
+	return &DeprecationEvent{
+		Version: version,
+		KeyID:   id,
+		Method:  req.Method,
+		Path:    req.URL.Path,
+		Signed:  signed,
+		Time:    Now(),
+	}
+}
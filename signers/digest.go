@@ -0,0 +1,94 @@
+package signers
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+var (
+	digestsMu sync.RWMutex
+	digests   = map[string]func() hash.Hash{
+		"sha1":   sha1.New,
+		"sha256": sha256.New,
+		"sha384": sha512.New384,
+		"sha512": sha512.New,
+	}
+)
+
+// Pools of hashers of the standard digests, keyed by the code pointer of their constructors, which bodies
+// are hashed with. Other digests, e.g. closures, are not pooled.
+var hashers = map[uintptr]*sync.Pool{}
+
+func init() {
+	for _, digest := range []func() hash.Hash{sha1.New, sha256.New, sha512.New384, sha512.New} {
+		digest := digest
+		hashers[reflect.ValueOf(digest).Pointer()] = &sync.Pool{New: func() interface{} {
+			return digest()
+		}}
+	}
+}
+
+// Returns a hasher of digest, and the function returning it to its pool once done with it.
+func acquireHasher(digest func() hash.Hash) (hash.Hash, func()) {
+	pool, ok := hashers[reflect.ValueOf(digest).Pointer()]
+	if !ok {
+		return digest(), func() {}
+	}
+	h := pool.Get().(hash.Hash)
+	h.Reset()
+	return h, func() {
+		pool.Put(h)
+	}
+}
+
+// RegisterDigest names a hash function, e.g. from a contrib package, for tools that select digests by name.
+// RegisterDigest panics if the name is already registered, and is meant to be called from init().
+func RegisterDigest(name string, digest func() hash.Hash) {
+	digestsMu.Lock()
+	defer digestsMu.Unlock()
+	if digest == nil {
+		panic("signers: RegisterDigest digest is nil for " + name)
+	}
+	if _, dup := digests[name]; dup {
+		panic("signers: RegisterDigest called twice for " + name)
+	}
+	digests[name] = digest
+}
+
+// DigestByName returns a digest registered under a name: sha1, sha256, sha384, sha512 or a registered one.
+func DigestByName(name string) (func() hash.Hash, bool) {
+	digestsMu.RLock()
+	defer digestsMu.RUnlock()
+	d, ok := digests[name]
+	return d, ok
+}
+
+// DigestNames returns the names of the known digests, sorted.
+func DigestNames() []string {
+	digestsMu.RLock()
+	defer digestsMu.RUnlock()
+	ret := []string{}
+	for name := range digests {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// DigestName returns the name of a known digest, or an empty string.
+func DigestName(digest func() hash.Hash) string {
+	sum := digestSum(digest)
+	for _, name := range DigestNames() {
+		d, _ := DigestByName(name)
+		if bytes.Equal(sum, digestSum(d)) {
+			return name
+		}
+	}
+	return ""
+}
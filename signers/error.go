@@ -1,6 +1,9 @@
 package signers
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // AuthenticationError no longer implements the error interface because:
 // - go is dumb
@@ -16,6 +19,8 @@ type AuthenticationError struct {
 	Message    string
 	HttpStatus int
 	ErrorType  ErrorType
+	// The error that caused this one, e.g. an I/O or decoding error, if any.
+	Cause error
 }
 
 type ErrorType int
@@ -31,19 +36,53 @@ const (
 	ErrorTypeOutdatedKeypair
 	ErrorTypeInternalError
 	ErrorTypeSignatureMismatch
+	ErrorTypeUnknownKey
+	ErrorTypeReplayedRequest
+	ErrorTypeRateLimited
+	ErrorTypeAccessDenied
+	ErrorTypeAlreadySigned
+	ErrorTypeUnapprovedAlgorithm
+	ErrorTypeBodyTooLarge
+	ErrorTypeMissingSignedHeader
+	ErrorTypeLockedOut
 )
 
+// Errorf formats the message as fmt.Errorf does: an error given with the %w verb becomes the Cause.
 func Errorf(status int, errtype ErrorType, format string, args ...interface{}) *AuthenticationError {
+	err := fmt.Errorf(format, args...)
 	return &AuthenticationError{
-		Message:    fmt.Sprintf(format, args...),
+		Message:    err.Error(),
 		HttpStatus: status,
 		ErrorType:  errtype,
+		Cause:      errors.Unwrap(err),
 	}
 }
 
-// Here you go.
+// Unwrap returns the cause of the error, to tell transient failures such as I/O errors from rejected
+// credentials, e.g. with errors.Is(a.Unwrap(), io.ErrUnexpectedEOF).
+func (a *AuthenticationError) Unwrap() error {
+	return a.Cause
+}
+
+// Here you go. The error returned unwraps to the cause.
 func (a *AuthenticationError) ToError() error {
-	return fmt.Errorf(fmt.Sprintf("(%d), %s: %s", a.HttpStatus, GetErrorTypeText(a.ErrorType), a.Message))
+	return &wrappedError{
+		message: fmt.Sprintf("(%d), %s: %s", a.HttpStatus, GetErrorTypeText(a.ErrorType), a.Message),
+		cause:   a.Cause,
+	}
+}
+
+type wrappedError struct {
+	message string
+	cause   error
+}
+
+func (w *wrappedError) Error() string {
+	return w.message
+}
+
+func (w *wrappedError) Unwrap() error {
+	return w.cause
 }
 
 func GetErrorTypeText(e ErrorType) string {
@@ -64,6 +103,26 @@ func GetErrorTypeText(e ErrorType) string {
 		return "keypair version error"
 	case ErrorTypeInternalError:
 		return "internal authorization error"
+	case ErrorTypeSignatureMismatch:
+		return "signature mismatch"
+	case ErrorTypeUnknownKey:
+		return "unknown key"
+	case ErrorTypeReplayedRequest:
+		return "replayed request"
+	case ErrorTypeRateLimited:
+		return "rate limit exceeded"
+	case ErrorTypeAccessDenied:
+		return "access denied"
+	case ErrorTypeAlreadySigned:
+		return "already signed"
+	case ErrorTypeUnapprovedAlgorithm:
+		return "unapproved algorithm"
+	case ErrorTypeBodyTooLarge:
+		return "body too large"
+	case ErrorTypeMissingSignedHeader:
+		return "missing signed header"
+	case ErrorTypeLockedOut:
+		return "locked out"
 	case ErrorTypeUnknown:
 		fallthrough
 	default:
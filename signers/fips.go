@@ -0,0 +1,69 @@
+package signers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"sync/atomic"
+)
+
+// FIPS mode restricts signers to HMAC with SHA-256, SHA-384 or SHA-512. Signers built on other algorithms,
+// such as v1 with its MD5 body hash, fail to construct with ErrorTypeUnapprovedAlgorithm. The mode is
+// enabled at runtime with SetFIPSMode, or permanently by building with the fips tag.
+var fipsMode int32
+
+func init() {
+	if fipsBuild {
+		fipsMode = 1
+	}
+}
+
+// SetFIPSMode enables or disables FIPS mode. It cannot be disabled in builds with the fips tag. Signers
+// constructed before the mode was enabled are not affected.
+func SetFIPSMode(enabled bool) {
+	if fipsBuild || enabled {
+		atomic.StoreInt32(&fipsMode, 1)
+		return
+	}
+	atomic.StoreInt32(&fipsMode, 0)
+}
+
+func FIPSMode() bool {
+	return atomic.LoadInt32(&fipsMode) == 1
+}
+
+var approvedDigests = [][]byte{
+	digestSum(sha256.New),
+	digestSum(sha512.New384),
+	digestSum(sha512.New),
+}
+
+// Digests are told apart by their output, as the hash functions have no names.
+func digestSum(digest func() hash.Hash) []byte {
+	h := digest()
+	h.Write([]byte("http-hmac-go"))
+	return h.Sum(nil)
+}
+
+// CheckDigest fails in FIPS mode unless digest is SHA-256, SHA-384 or SHA-512.
+func CheckDigest(digest func() hash.Hash) *AuthenticationError {
+	if !FIPSMode() {
+		return nil
+	}
+	sum := digestSum(digest)
+	for _, approved := range approvedDigests {
+		if bytes.Equal(sum, approved) {
+			return nil
+		}
+	}
+	return Errorf(500, ErrorTypeUnapprovedAlgorithm, "The digest is not approved in FIPS mode; use SHA-256, SHA-384 or SHA-512.")
+}
+
+// CheckAlgorithm fails in FIPS mode, for signers that depend on an algorithm that is never approved.
+func CheckAlgorithm(name string) *AuthenticationError {
+	if !FIPSMode() {
+		return nil
+	}
+	return Errorf(500, ErrorTypeUnapprovedAlgorithm, "%s is not approved in FIPS mode.", name)
+}
@@ -0,0 +1,78 @@
+// Package fuzz contains entry points for fuzzing the parsing and verification code paths with
+// malformed input. The functions follow the go-fuzz convention: they return 1 if the input was
+// interesting (it parsed), 0 otherwise, and must never panic.
+package fuzz
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"github.com/acquia/http-hmac-go/signers/compat"
+	"github.com/acquia/http-hmac-go/signers/v1"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"net/http"
+)
+
+const secret = "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+
+var identifier = compat.NewSupportedSignatureIdentifier()
+
+func headerRequest(auth []byte) *http.Request {
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("Authorization", string(auth))
+	return req
+}
+
+// Reads a raw HTTP/1.x request. Returns nil if the data is not a request.
+func rawRequest(data []byte) *http.Request {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil
+	}
+	return req
+}
+
+// FuzzParseAuthHeader feeds the data as an Authorization header value to the header parsers and the
+// signature identifier.
+func FuzzParseAuthHeader(data []byte) int {
+	req := headerRequest(data)
+	identifier.IdentifySignature(string(data))
+	v1.ParseAuthHeaders(req)
+	if len(v2.ParseAuthHeaders(req)) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// FuzzSignable parses the data as a raw HTTP request and builds its v2 signable string.
+func FuzzSignable(data []byte) int {
+	req := rawRequest(data)
+	if req == nil {
+		return 0
+	}
+	signer, err := v2.NewV2Signer(sha256.New)
+	if err != nil {
+		panic(err.Message)
+	}
+	bodyhash, serr := signer.HashBody(req)
+	if serr != nil {
+		return 0
+	}
+	signer.CreateSignable(req, v2.ParseAuthHeaders(req), bodyhash)
+	return 1
+}
+
+// FuzzCheck parses the data as a raw HTTP request and verifies it with whichever signer its
+// Authorization header identifies.
+func FuzzCheck(data []byte) int {
+	req := rawRequest(data)
+	if req == nil {
+		return 0
+	}
+	signer := identifier.IdentifySignature(req.Header.Get("Authorization"))
+	if signer == nil {
+		return 0
+	}
+	signer.Check(req, secret)
+	return 1
+}
@@ -0,0 +1,60 @@
+//go:build go1.18
+// +build go1.18
+
+package fuzz_test
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/fuzz"
+	"net/http/httputil"
+	"testing"
+)
+
+// Seeds the corpus with the authorization headers and requests of the signer fixtures.
+func seedHeaders(f *testing.F) {
+	for _, v := range signers.Fixtures {
+		for _, eh := range v.ExpectedHeader {
+			f.Add([]byte(eh))
+		}
+	}
+	f.Add([]byte(`acquia-http-hmac realm="a,b",id="c"`))
+	f.Add([]byte(`acquia-http-hmac`))
+	f.Add([]byte(`acquia-http-hmac version="2.0"`))
+}
+
+func seedRequests(f *testing.F) {
+	for _, v := range signers.Fixtures {
+		req := v.Request.Clone(v.Request.Context())
+		if req.Host == "" {
+			req.Host = req.URL.Host
+		}
+		for _, eh := range v.ExpectedHeader {
+			req.Header.Set("Authorization", eh)
+		}
+		dump, err := httputil.DumpRequest(req, false)
+		if err == nil {
+			f.Add(dump)
+		}
+	}
+}
+
+func FuzzParseAuthHeader(f *testing.F) {
+	seedHeaders(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzz.FuzzParseAuthHeader(data)
+	})
+}
+
+func FuzzSignable(f *testing.F) {
+	seedRequests(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzz.FuzzSignable(data)
+	})
+}
+
+func FuzzCheck(f *testing.F) {
+	seedRequests(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzz.FuzzCheck(data)
+	})
+}
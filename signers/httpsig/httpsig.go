@@ -0,0 +1,436 @@
+// Package httpsig implements HTTP Message Signatures (RFC 9421) with HMAC-SHA256: a Signature-Input header
+// listing the covered components and signature parameters, and a Signature header carrying the MAC of the
+// signature base, e.g.
+//
+//	Signature-Input: sig1=("@method" "@authority" "@path" "@query" "content-digest");created=1618884473;keyid="key-id";alg="hmac-sha256"
+//	Signature: sig1=:<base64 MAC>:
+//
+// The body is covered through a Content-Digest header (RFC 9530). Secrets are base64 encoded, as for v2,
+// so the same key provider serves both schemes during a migration. Importing the package registers the
+// scheme as "rfc9421".
+package httpsig
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/acquia/http-hmac-go/signers"
+	"hash"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	Algorithm    = "hmac-sha256"
+	DefaultLabel = "sig1"
+)
+
+func init() {
+	signers.Register("rfc9421", func(digest func() hash.Hash) (signers.Signer, *signers.AuthenticationError) {
+		return NewMessageSigner(digest)
+	})
+}
+
+// MessageSigner signs and verifies requests with HTTP Message Signatures. The authorization headers map to
+// signature parameters: "id" is keyid, "nonce" is nonce, "realm" is tag and "created" is created, and
+// "headers" lists the header fields to cover, separated by semicolons, in addition to @method,
+// @authority, @path, @query, Content-Type and Content-Digest. Check requires @method, @authority, @path
+// and, for requests with a query, @query to be covered. ParseAuthHeaders reports the signature as "nonce" if the nonce parameter is
+// absent, so the replay protection of the verification middleware applies, as for draft-cavage.
+type MessageSigner struct {
+	*signers.Digester
+	*signers.Identifiable
+	// Label of the signature to create or verify. Defaults to sig1 when signing; Check verifies the first
+	// signature of the request if unset.
+	Label string
+	// Validates the created parameter during Check. Defaults to signers.DefaultTimestampValidator, or a
+	// validator on Clock if set.
+	Timestamps *signers.TimestampValidator
+	// Source of the created parameter of signatures. Defaults to the package clock.
+	Clock signers.Clock
+}
+
+// NewMessageSigner returns a signer MACing signature bases with digest, which should be sha256.New: the
+// signatures are labeled hmac-sha256.
+func NewMessageSigner(digest func() hash.Hash) (*MessageSigner, *signers.AuthenticationError) {
+	if err := signers.CheckDigest(digest); err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile("^\\s*[a-z*][a-z0-9_.*-]*=\\(")
+	if err != nil {
+		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not compile regular expression for identifier: %w", err)
+	}
+	return &MessageSigner{
+		Digester: &signers.Digester{
+			Digest: digest,
+		},
+		Identifiable: &signers.Identifiable{
+			IdRegex: re,
+		},
+	}, nil
+}
+
+func (v *MessageSigner) timestamps() *signers.TimestampValidator {
+	if v.Timestamps == nil {
+		if v.Clock != nil {
+			return &signers.TimestampValidator{Clock: v.Clock}
+		}
+		return signers.DefaultTimestampValidator
+	}
+	return v.Timestamps
+}
+
+// TimestampValidator returns the validator of the created parameter of signatures, Timestamps or its
+// default.
+func (v *MessageSigner) TimestampValidator() *signers.TimestampValidator {
+	return v.timestamps()
+}
+
+func (v *MessageSigner) label() string {
+	if v.Label == "" {
+		return DefaultLabel
+	}
+	return v.Label
+}
+
+// IdentificationHeader returns Signature-Input, the header GetIdentificationRegex applies to.
+func (v *MessageSigner) IdentificationHeader() string {
+	return "Signature-Input"
+}
+
+// ParseAuthHeaders returns the parameters of the signature Check verifies as "id", "nonce", "realm" and
+// "created", its covered header fields as "headers", its label as "label" and the base64 MAC as
+// "signature", which is also "nonce" without a nonce parameter. Does not alter the request.
+func (v *MessageSigner) ParseAuthHeaders(req *http.Request) map[string]string {
+	ret := map[string]string{}
+	input, err := v.input(req)
+	if err != nil {
+		return ret
+	}
+	for param, key := range map[string]string{"keyid": "id", "nonce": "nonce", "tag": "realm", "created": "created"} {
+		if value, ok := input.params[param]; ok {
+			ret[key] = value
+		}
+	}
+	headers := []string{}
+	for _, c := range input.components {
+		if !strings.HasPrefix(c, "@") {
+			headers = append(headers, c)
+		}
+	}
+	if len(headers) > 0 {
+		ret["headers"] = strings.Join(headers, ";")
+	}
+	ret["label"] = input.label
+	if sig, ok := dictionary(req.Header.Get("Signature"))[input.label]; ok {
+		ret["signature"] = strings.Trim(sig, ":")
+		if _, ok := ret["nonce"]; !ok {
+			// Re-encoded, so that the nonce is that of the signature bytes whatever the unused padding bits.
+			n := ret["signature"]
+			if b, err := base64.StdEncoding.DecodeString(n); err == nil {
+				n = base64.StdEncoding.EncodeToString(b)
+			}
+			ret["nonce"] = n
+		}
+	}
+	return ret
+}
+
+// A parsed Signature-Input member.
+type signatureInput struct {
+	label      string
+	components []string
+	params     map[string]string
+	// The member value as sent, which the signature base ends with.
+	raw string
+}
+
+// Returns the Signature-Input member with the configured label, or the first one.
+func (v *MessageSigner) input(req *http.Request) (*signatureInput, *signers.AuthenticationError) {
+	header := req.Header.Get("Signature-Input")
+	if header == "" {
+		return nil, signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header Signature-Input.")
+	}
+	members := dictionaryMembers(header)
+	for _, m := range members {
+		if v.Label != "" && m[0] != v.Label {
+			continue
+		}
+		input, ok := parseInput(m[1])
+		if !ok {
+			return nil, signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signature-Input of %s is malformed.", m[0])
+		}
+		input.label = m[0]
+		return input, nil
+	}
+	return nil, signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signature-Input has no signature labeled %s.", v.label())
+}
+
+func (v *MessageSigner) HashBody(req *http.Request) (string, *signers.AuthenticationError) {
+	sum, _, err := signers.HashRequestBody(req, sha256.New)
+	if err != nil {
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
+	}
+	return sum, nil
+}
+
+// Returns the Content-Digest value of the body, or an empty string if there is none.
+func (v *MessageSigner) contentDigest(req *http.Request) (string, *signers.AuthenticationError) {
+	sum, n, err := signers.HashRequestBody(req, sha256.New)
+	if err != nil {
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
+	}
+	if n == 0 {
+		return "", nil
+	}
+	return "sha-256=:" + sum + ":", nil
+}
+
+// Returns the components Check requires the signature of a request to cover, including @query for requests
+// with a query.
+func requiredComponents(req *http.Request) []string {
+	ret := []string{"@method", "@authority", "@path"}
+	if req.URL.RawQuery != "" || req.URL.ForceQuery {
+		ret = append(ret, "@query")
+	}
+	return ret
+}
+
+// Returns the covered components for signing a request with authHeaders.
+func components(req *http.Request, authHeaders map[string]string) []string {
+	ret := []string{"@method", "@authority", "@path", "@query"}
+	if req.Header.Get("Content-Type") != "" {
+		ret = append(ret, "content-type")
+	}
+	if req.Header.Get("Content-Digest") != "" {
+		ret = append(ret, "content-digest")
+	}
+	if hdr := authHeaders["headers"]; hdr != "" {
+		for _, h := range strings.Split(hdr, ";") {
+			if h = strings.ToLower(strings.TrimSpace(h)); h != "" && h != "content-type" && h != "content-digest" {
+				ret = append(ret, h)
+			}
+		}
+	}
+	return ret
+}
+
+// Serializes the signature parameters of authHeaders over the covered components.
+func params(components []string, authHeaders map[string]string) string {
+	var b strings.Builder
+	b.WriteString("(")
+	for i, c := range components {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(quote(c))
+	}
+	b.WriteString(")")
+	b.WriteString(";created=" + authHeaders["created"])
+	b.WriteString(";keyid=" + quote(authHeaders["id"]))
+	if n, ok := authHeaders["nonce"]; ok {
+		b.WriteString(";nonce=" + quote(n))
+	}
+	if realm, ok := authHeaders["realm"]; ok {
+		b.WriteString(";tag=" + quote(realm))
+	}
+	b.WriteString(";alg=" + quote(Algorithm))
+	return b.String()
+}
+
+// Builds the signature base of RFC 9421 section 2.5.
+func signatureBase(req *http.Request, components []string, params string) ([]byte, *signers.AuthenticationError) {
+	var b strings.Builder
+	for _, c := range components {
+		value, err := componentValue(req, c)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(quote(c))
+		b.WriteString(": ")
+		b.WriteString(value)
+		b.WriteString("\n")
+	}
+	b.WriteString("\"@signature-params\": ")
+	b.WriteString(params)
+	return []byte(b.String()), nil
+}
+
+func componentValue(req *http.Request, component string) (string, *signers.AuthenticationError) {
+	switch component {
+	case "@method":
+		return strings.ToUpper(req.Method), nil
+	case "@authority":
+		return strings.ToLower(req.Host), nil
+	case "@path":
+		if p := req.URL.EscapedPath(); p != "" {
+			return p, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	}
+	if strings.HasPrefix(component, "@") {
+		return "", signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Unsupported derived component %s.", component)
+	}
+	values, ok := req.Header[http.CanonicalHeaderKey(component)]
+	if !ok {
+		return "", signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing signed header %s.", component)
+	}
+	trimmed := make([]string, len(values))
+	for i, value := range values {
+		trimmed[i] = strings.TrimSpace(value)
+	}
+	return strings.Join(trimmed, ", "), nil
+}
+
+func (v *MessageSigner) mac(base []byte, secret string) (string, *signers.AuthenticationError) {
+	key, err := signers.Base64Secret(secret)
+	if err != nil {
+		return "", err
+	}
+	h := hmac.New(v.Digest, key.Bytes())
+	h.Write(base)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// Sign signs the request with authHeaders["created"], or the current time if absent. The request must
+// already carry the Content-Digest header if it has a body; SignDirect sets it.
+func (v *MessageSigner) Sign(req *http.Request, authHeaders map[string]string, secret string) (string, *signers.AuthenticationError) {
+	if _, ok := authHeaders["id"]; !ok {
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Missing access key for signature.")
+	}
+	ah := map[string]string{}
+	for k, val := range authHeaders {
+		ah[k] = val
+	}
+	if _, ok := ah["created"]; !ok {
+		ah["created"] = strconv.FormatInt(signers.NowFrom(v.Clock).Unix(), 10)
+	}
+	base, err := signatureBase(req, components(req, ah), params(components(req, ah), ah))
+	if err != nil {
+		return "", err
+	}
+	return v.mac(base, secret)
+}
+
+func (v *MessageSigner) Check(req *http.Request, secret string) *signers.AuthenticationError {
+	input, err := v.input(req)
+	if err != nil {
+		return err
+	}
+	if alg, ok := input.params["alg"]; ok && alg != Algorithm {
+		return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Unsupported signature algorithm %s.", alg)
+	}
+	created, ok := input.params["created"]
+	if !ok {
+		return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signature parameters must include created.")
+	}
+	if _, err := v.timestamps().Validate(created); err != nil {
+		return err
+	}
+	if expires, ok := input.params["expires"]; ok {
+		exp, perr := strconv.ParseInt(expires, 10, 64)
+		if perr != nil {
+			return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Invalid expires parameter: %w", perr)
+		}
+		if signers.NowFrom(v.Clock).Unix() > exp {
+			return signers.Errorf(403, signers.ErrorTypeTimestampRangeError, "Signature expired at %d.", exp)
+		}
+	}
+	sig, ok := dictionary(req.Header.Get("Signature"))[input.label]
+	if !ok {
+		return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing signature %s in header Signature.", input.label)
+	}
+	presented, derr := base64.StdEncoding.DecodeString(strings.Trim(sig, ":"))
+	if derr != nil || len(sig) < 2 || sig[0] != ':' || sig[len(sig)-1] != ':' {
+		return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signature %s is not a base64 byte sequence.", input.label)
+	}
+	digest, err := v.contentDigest(req)
+	if err != nil {
+		return err
+	}
+	covered := false
+	for _, c := range input.components {
+		covered = covered || c == "content-digest"
+	}
+	if digest != "" && !covered {
+		return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Content-Digest must be signed for requests with a body.")
+	}
+	if covered && digest != "" && dictionary(req.Header.Get("Content-Digest"))["sha-256"] != strings.TrimPrefix(digest, "sha-256=") {
+		return signers.Errorf(403, signers.ErrorTypeInvalidRequiredHeader, "Content mismatch - Content-Digest must match the SHA-256 digest of the request body.")
+	}
+	for _, required := range requiredComponents(req) {
+		found := false
+		for _, c := range input.components {
+			found = found || c == required
+		}
+		if !found {
+			return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signature must cover %s.", required)
+		}
+	}
+	base, err := signatureBase(req, input.components, input.raw)
+	if err != nil {
+		return err
+	}
+	expected, err := v.mac(base, secret)
+	if err != nil {
+		return err
+	}
+	want, _ := base64.StdEncoding.DecodeString(expected)
+	if !hmac.Equal(want, presented) {
+		return signers.Errorf(403, signers.ErrorTypeSignatureMismatch, "Signature does not match expected signature.")
+	}
+	return nil
+}
+
+// SignDirect sets the Content-Digest header for requests with a body, and the Signature-Input and Signature
+// headers, replacing signatures with the same label.
+func (v *MessageSigner) SignDirect(req *http.Request, authHeaders map[string]string, secret string) *signers.AuthenticationError {
+	authHeaders = signers.CopyAuthHeaders(authHeaders)
+	if _, ok := authHeaders["created"]; !ok {
+		authHeaders["created"] = strconv.FormatInt(signers.NowFrom(v.Clock).Unix(), 10)
+	}
+	digest, err := v.contentDigest(req)
+	if err != nil {
+		return err
+	}
+	if digest != "" {
+		req.Header.Set("Content-Digest", digest)
+	}
+	sig, err := v.Sign(req, authHeaders, secret)
+	if err != nil {
+		return err
+	}
+	value, err := v.GenerateAuthorization(req, authHeaders, sig)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Signature-Input", v.label()+"="+params(components(req, authHeaders), authHeaders))
+	req.Header.Set("Signature", value)
+	return nil
+}
+
+// GenerateAuthorization returns the value of the Signature header.
+func (v *MessageSigner) GenerateAuthorization(req *http.Request, authHeaders map[string]string, signature string) (string, *signers.AuthenticationError) {
+	if signature == "" {
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Missing signature.")
+	}
+	return fmt.Sprintf("%s=:%s:", v.label(), signature), nil
+}
+
+func (v *MessageSigner) GetIdentificationRegex() *regexp.Regexp {
+	return v.IdRegex
+}
+
+// GetResponseSigner returns nil: responses are not signed.
+func (v *MessageSigner) GetResponseSigner() signers.ResponseSigner {
+	return nil
+}
+
+func (v *MessageSigner) Version() int {
+	return 0
+}
@@ -0,0 +1,185 @@
+package httpsig
+
+import (
+	"crypto/sha256"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/compat"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testSecret = "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+
+func post(body string) *http.Request {
+	req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task?limit=10", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+	return req
+}
+
+// The HMAC-SHA256 example of RFC 9421, appendix B.2.5. It covers neither @method nor @path, which Check
+// requires, so only the signature base and MAC are checked against it.
+func TestSpecExample(t *testing.T) {
+	signers.OverrideClock(1618884473)
+	defer signers.RestoreClock()
+	signer, _ := NewMessageSigner(sha256.New)
+	req, _ := http.NewRequest("GET", "http://example.com/foo?param=Value&Pet=dog", nil)
+	req.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Signature-Input", `sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`)
+	req.Header.Set("Signature", "sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:")
+	secret := "uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ=="
+	input, err := signer.input(req)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	base, err := signatureBase(req, input.components, input.raw)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if sig, _ := signer.mac(base, secret); sig != "pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=" {
+		t.Error("Unexpected signature of the example: ", sig)
+	}
+	if id := signer.ParseAuthHeaders(req)["id"]; id != "test-shared-secret" {
+		t.Error("Expected keyid to be reported as id, got ", id)
+	}
+	if err := signer.Check(req, secret); err == nil || err.ErrorType != signers.ErrorTypeInvalidAuthHeader {
+		t.Error("Expected a signature covering neither @method nor @path to be rejected.")
+	}
+}
+
+func TestRequiredQuery(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, _ := NewMessageSigner(sha256.New)
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task?limit=10", nil)
+	req.Header.Set("Signature-Input", `sig1=("@method" "@authority" "@path");created=1432075982;keyid="key"`)
+	input, err := signer.input(req)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	base, err := signatureBase(req, input.components, input.raw)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	sig, _ := signer.mac(base, testSecret)
+	req.Header.Set("Signature", "sig1=:"+sig+":")
+	if err := signer.Check(req, testSecret); err == nil || err.ErrorType != signers.ErrorTypeInvalidAuthHeader {
+		t.Error("Expected a signature not covering the query of the request to be rejected.")
+	}
+	req.URL.RawQuery = ""
+	if err := signer.Check(req, testSecret); err != nil {
+		t.Error("Expected a signature of a request without a query not to need @query: ", err.Message)
+	}
+}
+
+func TestSignatureNonce(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, _ := NewMessageSigner(sha256.New)
+	req := post(`{"task":1}`)
+	if err := signer.SignDirect(req, map[string]string{"id": "key"}, testSecret); err != nil {
+		t.Fatal(err.Message)
+	}
+	ah := signer.ParseAuthHeaders(req)
+	if ah["nonce"] == "" || ah["nonce"] != ah["signature"] {
+		t.Error("Expected the signature to be reported as nonce without a nonce parameter, got ", ah)
+	}
+}
+
+func TestMessageSigner(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, err := NewMessageSigner(sha256.New)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	req := post(`{"task":1}`)
+	authHeaders := map[string]string{
+		"id":      "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce":   "d1954337-5319-4821-8427-115542e08d10",
+		"realm":   "Pipet service",
+		"headers": "X-Tenant",
+	}
+	if err := signer.SignDirect(req, authHeaders, testSecret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	expected := `sig1=("@method" "@authority" "@path" "@query" "content-type" "content-digest" "x-tenant");created=1432075982;keyid="efdde334-fe7b-11e4-a322-1697f925ec7b";nonce="d1954337-5319-4821-8427-115542e08d10";tag="Pipet service";alg="hmac-sha256"`
+	if got := req.Header.Get("Signature-Input"); got != expected {
+		t.Error("Unexpected Signature-Input: ", got)
+	}
+	if err := signer.Check(req, testSecret); err != nil {
+		t.Error("Failed to verify signature: ", err.Message)
+	}
+	ah := signer.ParseAuthHeaders(req)
+	if ah["realm"] != "Pipet service" || ah["nonce"] != authHeaders["nonce"] || ah["headers"] != "content-type;content-digest;x-tenant" {
+		t.Error("Unexpected authorization headers: ", ah)
+	}
+
+	altered := post(`{"task":1}`)
+	altered.Header = req.Header.Clone()
+	altered.Header.Set("X-Tenant", "other")
+	if err := signer.Check(altered, testSecret); err == nil || err.ErrorType != signers.ErrorTypeSignatureMismatch {
+		t.Error("Expected a signature mismatch after altering a covered header.")
+	}
+
+	tampered := post(`{"task":2}`)
+	tampered.Header = req.Header
+	if err := signer.Check(tampered, testSecret); err == nil || err.ErrorType != signers.ErrorTypeInvalidRequiredHeader {
+		t.Error("Expected a content mismatch for an altered body.")
+	}
+
+	unsigned := post(`{"task":1}`)
+	unsigned.Header.Set("Signature-Input", `sig1=("@method" "@authority" "@path");created=1432075982;keyid="efdde334-fe7b-11e4-a322-1697f925ec7b"`)
+	unsigned.Header.Set("Signature", req.Header.Get("Signature"))
+	if err := signer.Check(unsigned, testSecret); err == nil || err.ErrorType != signers.ErrorTypeMissingRequiredHeader {
+		t.Error("Expected a request whose body is not covered to be rejected.")
+	}
+
+	signers.OverrideClock(1432075982 + 3600)
+	if err := signer.Check(req, testSecret); err == nil || err.ErrorType != signers.ErrorTypeTimestampRangeError {
+		t.Error("Expected an old signature to be rejected.")
+	}
+}
+
+func TestIdentifyRequest(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, _ := NewMessageSigner(sha256.New)
+	req := post("")
+	if err := signer.SignDirect(req, map[string]string{"id": "key"}, testSecret); err != nil {
+		t.Fatal(err.Message)
+	}
+	identified := compat.NewSupportedSignatureIdentifier().IdentifyRequest(req)
+	if _, ok := identified.(*MessageSigner); !ok {
+		t.Error("Expected the request to be identified as an HTTP Message Signature, got ", identified)
+	}
+	if identified := compat.NewSupportedSignatureIdentifier().IdentifyRequest(post("")); identified != nil {
+		t.Error("Expected an unsigned request not to be identified, got ", identified)
+	}
+}
+
+func TestSharedAuthHeaders(t *testing.T) {
+	signer, _ := NewMessageSigner(sha256.New)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"realm": "Pipet service",
+	}
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	if err := signer.SignDirect(post(`{"task":1}`), authHeaders, testSecret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	if _, ok := authHeaders["created"]; ok {
+		t.Error("Expected the authorization header map to be left untouched, got ", authHeaders)
+	}
+	signers.OverrideClock(1432075982 + 3600)
+	req := post(`{"task":1}`)
+	if err := signer.SignDirect(req, authHeaders, testSecret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	if err := signer.Check(req, testSecret); err != nil {
+		t.Error("Expected a request signed later with the same map to bear a fresh timestamp: ", err.Message)
+	}
+}
@@ -0,0 +1,127 @@
+package httpsig
+
+import (
+	"strings"
+)
+
+// A minimal parser for the structured field values (RFC 8941) used by Signature-Input, Signature and
+// Content-Digest: dictionaries whose members are inner lists of strings or byte sequences, with
+// parameters of strings, integers or tokens.
+
+// Splits a dictionary into its members' names and values, at commas outside strings and inner lists.
+func dictionaryMembers(value string) [][2]string {
+	ret := [][2]string{}
+	for _, member := range splitTopLevel(value, ',') {
+		member = strings.TrimSpace(member)
+		kv := strings.SplitN(member, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		ret = append(ret, [2]string{strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])})
+	}
+	return ret
+}
+
+// Returns the dictionary members by name. Later members of the same name replace earlier ones.
+func dictionary(value string) map[string]string {
+	ret := map[string]string{}
+	for _, m := range dictionaryMembers(value) {
+		ret[m[0]] = m[1]
+	}
+	return ret
+}
+
+func splitTopLevel(value string, sep byte) []string {
+	ret := []string{}
+	depth := 0
+	quoted := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			ret = append(ret, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(ret, value[start:])
+}
+
+// Parses a Signature-Input member value: an inner list of component names followed by parameters.
+func parseInput(raw string) (*signatureInput, bool) {
+	if !strings.HasPrefix(raw, "(") {
+		return nil, false
+	}
+	end := strings.IndexByte(raw, ')')
+	for end >= 0 && strings.Count(raw[:end], "\"")%2 == 1 {
+		next := strings.IndexByte(raw[end+1:], ')')
+		if next < 0 {
+			return nil, false
+		}
+		end += next + 1
+	}
+	if end < 0 {
+		return nil, false
+	}
+	ret := &signatureInput{
+		components: []string{},
+		params:     map[string]string{},
+		raw:        raw,
+	}
+	for _, item := range strings.Fields(raw[1:end]) {
+		c, ok := unquote(item)
+		if !ok {
+			return nil, false
+		}
+		ret.components = append(ret.components, c)
+	}
+	for _, param := range splitTopLevel(raw[end+1:], ';')[1:] {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if kv[0] == "" {
+			return nil, false
+		}
+		if len(kv) == 1 {
+			ret.params[kv[0]] = "?1"
+			continue
+		}
+		if strings.HasPrefix(kv[1], "\"") {
+			v, ok := unquote(kv[1])
+			if !ok {
+				return nil, false
+			}
+			ret.params[kv[0]] = v
+			continue
+		}
+		ret.params[kv[0]] = kv[1]
+	}
+	return ret, true
+}
+
+func quote(s string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(s) + "\""
+}
+
+func unquote(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' {
+			i++
+			if i == len(s)-1 {
+				return "", false
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), true
+}
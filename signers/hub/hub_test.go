@@ -0,0 +1,55 @@
+package hub
+
+import (
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Example from the GitHub documentation on validating webhook deliveries.
+const (
+	testSecret    = "It's a Secret to Everybody"
+	testPayload   = "Hello, World!"
+	testSignature = "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+)
+
+var _ signers.Verifier = &HubVerifier{}
+
+func delivery(signature string) *http.Request {
+	req, _ := http.NewRequest("POST", "http://example.com/hooks", strings.NewReader(testPayload))
+	if signature != "" {
+		req.Header.Set(DefaultHeader, signature)
+	}
+	return req
+}
+
+func TestHubVerifier(t *testing.T) {
+	if got := Sign([]byte(testPayload), testSecret); got != testSignature {
+		t.Errorf("Expected signature %s, got %s.", testSignature, got)
+	}
+
+	v := NewHubVerifier("github")
+	provider := keys.Static{"github": testSecret}
+	if err := v.Verify(delivery(testSignature), provider); err != nil {
+		t.Error("Failed to verify delivery: ", err.Message)
+	}
+	if ah := v.ParseAuthHeaders(delivery(testSignature)); ah["id"] != "github" || "sha256="+ah["signature"] != testSignature {
+		t.Error("Unexpected authorization headers: ", ah)
+	}
+
+	expected := map[string]signers.ErrorType{
+		"":                        signers.ErrorTypeMissingRequiredHeader,
+		"sha1=757107ea0eb2509fc2": signers.ErrorTypeInvalidAuthHeader,
+		"sha256=00":               signers.ErrorTypeSignatureMismatch,
+	}
+	for signature, errorType := range expected {
+		if err := v.Verify(delivery(signature), provider); err == nil || err.ErrorType != errorType {
+			t.Errorf("Expected error type %s for signature %q.", signers.GetErrorTypeText(errorType), signature)
+		}
+	}
+	if err := v.Verify(delivery(testSignature), keys.Static{}); err == nil || err.ErrorType != signers.ErrorTypeUnknownKey {
+		t.Error("Expected unknown key to be rejected.")
+	}
+}
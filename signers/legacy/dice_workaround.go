@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v2"
 	"hash"
 	"net/http"
 	"net/url"
@@ -20,37 +21,17 @@ type V2SignerDiceLegacy struct {
 	*signers.Digester
 	*signers.Identifiable
 	respSigner *V2DiceLegacyResponseSigner
+	// Source of the current time. Defaults to the package clock.
+	Clock signers.Clock
 }
 
 func EscapeProper(s string) string {
 	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
 }
 
+// ParseAuthHeadersDice reads the Authorization header, which has the format of v2.
 func ParseAuthHeadersDice(req *http.Request) map[string]string {
-	auth := req.Header.Get("Authorization")
-	ret := map[string]string{}
-	s1 := strings.SplitN(auth, " ", 2)
-	s2 := strings.Split(s1[1], ",")
-	for len(s2) > 0 {
-		var vardef string
-		vardef, s2 = strings.TrimLeft(s2[0], " \t\n"), s2[1:]
-		for !strings.HasSuffix(strings.TrimRight(vardef, " \t\n"), "\"") {
-			if len(s2) > 0 {
-				vardef, s2 = fmt.Sprintf("%s,%s", vardef, s2[0]), s2[1:]
-			} else {
-				return map[string]string{}
-			}
-		}
-		vardef = strings.TrimRight(vardef, " \t\n")
-		parts := strings.SplitN(vardef, "=", 2)
-		k := strings.Trim(parts[0], " \t\n")
-		qu := strings.Trim(parts[1], " \t\n\"")
-		if k != "signature" { // hack
-			qu, _ = url.QueryUnescape(qu)
-		}
-		ret[k] = qu
-	}
-	return ret
+	return v2.ParseAuthHeaders(req)
 }
 
 func (v *V2SignerDiceLegacy) ParseAuthHeaders(req *http.Request) map[string]string {
@@ -58,9 +39,12 @@ func (v *V2SignerDiceLegacy) ParseAuthHeaders(req *http.Request) map[string]stri
 }
 
 func NewV2SignerDiceLegacy(digest func() hash.Hash) (*V2SignerDiceLegacy, *signers.AuthenticationError) {
+	if err := signers.CheckDigest(digest); err != nil {
+		return nil, err
+	}
 	re, err := regexp.Compile("(?i)^\\s*acquia-http-hmac.*?version=\"2\\.0\".*?$")
 	if err != nil {
-		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not compile regular expression for identifier: %s", err.Error())
+		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not compile regular expression for identifier: %w", err)
 	}
 	return &V2SignerDiceLegacy{
 		Digester: &signers.Digester{
@@ -80,7 +64,7 @@ func (v *V2SignerDiceLegacy) stringAuthHeaders(authHeaders map[string]string) st
 func (v *V2SignerDiceLegacy) HashBody(req *http.Request) (string, *signers.AuthenticationError) {
 	data, err := signers.ReadBody(req)
 	if err != nil {
-		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %s", err.Error())
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
 	}
 	return v.HashBytes(data), nil
 }
@@ -174,7 +158,7 @@ func (v *V2SignerDiceLegacy) Sign(req *http.Request, authHeaders map[string]stri
 	var bodyhash string = ""
 	body, err := signers.ReadBody(req)
 	if err != nil {
-		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %s", err.Error())
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
 	}
 	if len(body) > 0 {
 		bodyhash = v.HashBytes(body)
@@ -198,7 +182,7 @@ func (v *V2SignerDiceLegacy) Check(req *http.Request, secret string) *signers.Au
 	}
 	body, err := signers.ReadBody(req)
 	if err != nil {
-		return signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %s", err.Error())
+		return signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
 	}
 	if len(body) > 0 {
 		if req.Header.Get("X-Authorization-Content-Sha256") == "" {
@@ -210,12 +194,13 @@ func (v *V2SignerDiceLegacy) Check(req *http.Request, secret string) *signers.Au
 	}
 	timestamp, err := strconv.ParseInt(req.Header.Get("X-Authorization-Timestamp"), 10, 64)
 	if err != nil {
-		return signers.Errorf(403, signers.ErrorTypeInvalidRequiredHeader, "Timestamp parse error: %s", err.Error())
+		return signers.Errorf(403, signers.ErrorTypeInvalidRequiredHeader, "Timestamp parse error: %w", err)
 	}
-	if timestamp > signers.Now().Unix()+900 {
+	now := signers.NowFrom(v.Clock).Unix()
+	if timestamp > now+900 {
 		return signers.Errorf(403, signers.ErrorTypeTimestampRangeError, "Timestamp given in X-Authorization-Timestamp (%d) was too far in the future.", timestamp)
 	}
-	if timestamp < signers.Now().Unix()-900 {
+	if timestamp < now-900 {
 		return signers.Errorf(403, signers.ErrorTypeTimestampRangeError, "Timestamp given in X-Authorization-Timestamp (%d) was too far in the past.", timestamp)
 	}
 
@@ -237,11 +222,11 @@ func (v *V2SignerDiceLegacy) Check(req *http.Request, secret string) *signers.Au
 
 func (v *V2SignerDiceLegacy) SignDirect(req *http.Request, authHeaders map[string]string, secret string) *signers.AuthenticationError {
 	if req.Header.Get("X-Authorization-Timestamp") == "" {
-		req.Header.Set("X-Authorization-Timestamp", strconv.Itoa(int(signers.Now().Unix())))
+		req.Header.Set("X-Authorization-Timestamp", strconv.Itoa(int(signers.NowFrom(v.Clock).Unix())))
 	}
 	body, err := signers.ReadBody(req)
 	if err != nil {
-		return signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %s", err.Error())
+		return signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
 	}
 	if len(body) > 0 && req.Header.Get("X-Authorization-Content-Sha256") == "" {
 		req.Header.Set("X-Authorization-Content-Sha256", v.HashBytes(body))
@@ -269,6 +254,7 @@ func (v *V2SignerDiceLegacy) GenerateAuthorization(req *http.Request, authHeader
 	if _, ok := authHeaders["realm"]; !ok {
 		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Missing realm for signature.")
 	}
+	authHeaders = signers.CopyAuthHeaders(authHeaders)
 	if _, ok := authHeaders["version"]; !ok {
 		authHeaders["version"] = "2.0"
 	}
@@ -66,7 +66,7 @@ func (v *V2DiceLegacyResponseSigner) Check(req *http.Request, resp *http.Respons
 	}
 	rb, err := signers.ReadResponseBody(resp)
 	if err != nil {
-		return signers.Errorf(500, signers.ErrorTypeUnknown, "Cannot read response body: "+err.Error())
+		return signers.Errorf(500, signers.ErrorTypeUnknown, "Cannot read response body: %w", err)
 	}
 	srw := signers.NewDummySignableResponseWriter(rb)
 	sig, serr := v.SignResponse(req, srw, secret)
@@ -23,9 +23,12 @@ type LiftSigner struct {
 }
 
 func NewLiftSigner() (*LiftSigner, *signers.AuthenticationError) {
+	if err := signers.CheckAlgorithm("HMAC-SHA1"); err != nil {
+		return nil, err
+	}
 	re, err := regexp.Compile("(?i)^\\s*HMAC\\s*[^:]+\\s*:\\s*[0-9a-zA-Z\\+/=]+\\s*$")
 	if err != nil {
-		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not compile regular expression for identifier: %s", err.Error())
+		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not compile regular expression for identifier: %w", err)
 	}
 	return &LiftSigner{
 		Digester: &signers.Digester{
@@ -41,7 +44,7 @@ func (v *LiftSigner) HashBody(req *http.Request) (string, *signers.Authenticatio
 	h := md5.New()
 	data, err := signers.ReadBody(req)
 	if err != nil {
-		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %s", err.Error())
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
 	}
 	h.Write(data)
 
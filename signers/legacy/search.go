@@ -12,7 +12,6 @@ import (
 	"os"
 	"regexp"
 	"strconv"
-	"time"
 )
 
 var logger = log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
@@ -21,12 +20,17 @@ type SearchSigner struct {
 	*signers.Digester
 	*signers.Identifiable
 	respSigner *SearchResponseSigner
+	// Source of the current time. Defaults to the package clock.
+	Clock signers.Clock
 }
 
 func NewSearchSigner(digest func() hash.Hash) (*SearchSigner, *signers.AuthenticationError) {
+	if err := signers.CheckAlgorithm("HMAC-SHA1"); err != nil {
+		return nil, err
+	}
 	re, err := regexp.Compile("(?i)^\\s*acquia_solr_time.*?$")
 	if err != nil {
-		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not compile regular expression for identifier: %s", err.Error())
+		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not compile regular expression for identifier: %w", err)
 	}
 
 	return &SearchSigner{
@@ -49,11 +53,11 @@ func (v *SearchSigner) Sign(r *http.Request, authHeaders map[string]string, secr
 	// get / validate headers
 	auth_headers := v.ParseAuthHeaders(r)
 
-	request_time = time.Now().Unix()
+	request_time = signers.NowFrom(v.Clock).Unix()
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %s", err.Error())
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
 	}
 
 	if r.Method == "POST" {
@@ -75,12 +79,13 @@ func (v *SearchSigner) Check(r *http.Request, secret string) *signers.Authentica
 	// Check if request time is more than fifteen minutes before or after current time
 	request_timestamp, err := strconv.ParseInt(auth_headers["acquia_solr_time"], 10, 64)
 	if err != nil {
-		return signers.Errorf(403, signers.ErrorTypeInvalidRequiredHeader, "Timestamp parse error: %s", err.Error())
+		return signers.Errorf(403, signers.ErrorTypeInvalidRequiredHeader, "Timestamp parse error: %w", err)
 	}
-	if request_timestamp > signers.Now().Unix()+900 {
+	now := signers.NowFrom(v.Clock).Unix()
+	if request_timestamp > now+900 {
 		return signers.Errorf(403, signers.ErrorTypeTimestampRangeError, "Timestamp given in X-Authorization-Timestamp (%d) was too far in the future.", request_timestamp)
 	}
-	if request_timestamp < signers.Now().Unix()-900 {
+	if request_timestamp < now-900 {
 		return signers.Errorf(403, signers.ErrorTypeTimestampRangeError, "Timestamp given in X-Authorization-Timestamp (%d) was too far in the past.", request_timestamp)
 	}
 
@@ -88,7 +93,7 @@ func (v *SearchSigner) Check(r *http.Request, secret string) *signers.Authentica
 	if r.Method == "POST" {
 		body, err := signers.ReadBody(r)
 		if err != nil {
-			return signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %s", err.Error())
+			return signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
 		}
 		hash = generateSignature(string(body), request_timestamp, secret, auth_headers["acquia_solr_nonce"])
 
@@ -112,10 +117,10 @@ func (v *SearchSigner) SignDirect(r *http.Request, authHeaders map[string]string
 	var path_and_query string
 	var request_time int64
 
-	request_time = time.Now().Unix()
+	request_time = signers.NowFrom(v.Clock).Unix()
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %s", err.Error())
+		return signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
 	}
 
 	if r.Method == "POST" {
@@ -60,7 +60,7 @@ func (v *SearchResponseSigner) Check(req *http.Request, resp *http.Response, sec
 	}
 	rb, err := signers.ReadResponseBody(resp)
 	if err != nil {
-		return signers.Errorf(500, signers.ErrorTypeUnknown, "Cannot read response body: "+err.Error())
+		return signers.Errorf(500, signers.ErrorTypeUnknown, "Cannot read response body: %w", err)
 	}
 	srw := signers.NewDummySignableResponseWriter(rb)
 	sig, serr := v.SignResponse(req, srw, secret)
@@ -0,0 +1,33 @@
+package signers
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"hash"
+	"io"
+)
+
+// SignString returns the base64 encoded HMAC of a canonical message. It is the primitive the signers use
+// on the signable string they build from a request, for protocols that carry messages other than HTTP
+// requests.
+func SignString(digest func() hash.Hash, key []byte, message string) string {
+	h := hmac.New(digest, key)
+	io.WriteString(h, message)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// HashBody returns the base64 encoded digest of everything read from r.
+func HashBody(digest func() hash.Hash, r io.Reader) (string, error) {
+	sum, _, err := hashReader(digest, r)
+	return sum, err
+}
+
+func hashReader(digest func() hash.Hash, r io.Reader) (string, int64, error) {
+	h, release := acquireHasher(digest)
+	defer release()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), n, nil
+}
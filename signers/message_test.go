@@ -0,0 +1,22 @@
+package signers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"strings"
+	"testing"
+)
+
+func TestHashBodyPooled(t *testing.T) {
+	sum := sha256.Sum256([]byte("body"))
+	expected := base64.StdEncoding.EncodeToString(sum[:])
+	custom := func() hash.Hash { return sha256.New() }
+	for i := 0; i < 3; i++ {
+		for _, digest := range []func() hash.Hash{sha256.New, custom} {
+			if got, err := HashBody(digest, strings.NewReader("body")); err != nil || got != expected {
+				t.Errorf("Expected hash %s, got %s (%v)", expected, got, err)
+			}
+		}
+	}
+}
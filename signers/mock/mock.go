@@ -0,0 +1,144 @@
+// Package mock provides fake signers for unit testing code that signs or verifies requests, without real
+// keys or hashing.
+package mock
+
+import (
+	"fmt"
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+	"regexp"
+	"sync"
+)
+
+// Call records a single invocation of a Signer method.
+type Call struct {
+	Method  string
+	Request *http.Request
+	Secret  string
+}
+
+// Signer is a configurable signers.Signer. The zero value accepts every request and signs with an empty
+// signature. It is safe for concurrent use.
+type Signer struct {
+	// Returned by Sign, and embedded in the Authorization header by SignDirect and GenerateAuthorization.
+	Signature string
+	// Returned by ParseAuthHeaders.
+	AuthHeaders map[string]string
+	// Returned by every method that can fail.
+	Err *signers.AuthenticationError
+	// If set, called by Check instead of returning Err.
+	CheckFunc func(req *http.Request, secret string) *signers.AuthenticationError
+	// Returned by GetResponseSigner.
+	ResponseSigner signers.ResponseSigner
+	// Returned by Version.
+	VersionNumber int
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Accepting returns a Signer whose Check succeeds for any request, reporting the given authorization headers.
+func Accepting(authHeaders map[string]string) *Signer {
+	return &Signer{
+		AuthHeaders: authHeaders,
+	}
+}
+
+// Rejecting returns a Signer whose methods all fail with the given error.
+func Rejecting(err *signers.AuthenticationError) *Signer {
+	return &Signer{
+		Err: err,
+	}
+}
+
+func (s *Signer) record(method string, req *http.Request, secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{
+		Method:  method,
+		Request: req,
+		Secret:  secret,
+	})
+}
+
+// Calls returns the invocations recorded so far, in order.
+func (s *Signer) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call{}, s.calls...)
+}
+
+func (s *Signer) Sign(req *http.Request, authHeaders map[string]string, secret string) (string, *signers.AuthenticationError) {
+	s.record("Sign", req, secret)
+	if s.Err != nil {
+		return "", s.Err
+	}
+	return s.Signature, nil
+}
+
+func (s *Signer) GetIdentificationRegex() *regexp.Regexp {
+	return regexp.MustCompile(".*")
+}
+
+func (s *Signer) HashBody(req *http.Request) (string, *signers.AuthenticationError) {
+	s.record("HashBody", req, "")
+	if s.Err != nil {
+		return "", s.Err
+	}
+	return "", nil
+}
+
+func (s *Signer) GetResponseSigner() signers.ResponseSigner {
+	return s.ResponseSigner
+}
+
+func (s *Signer) ParseAuthHeaders(req *http.Request) map[string]string {
+	s.record("ParseAuthHeaders", req, "")
+	ret := map[string]string{}
+	for k, v := range s.AuthHeaders {
+		ret[k] = v
+	}
+	return ret
+}
+
+func (s *Signer) Check(req *http.Request, secret string) *signers.AuthenticationError {
+	s.record("Check", req, secret)
+	if s.CheckFunc != nil {
+		return s.CheckFunc(req, secret)
+	}
+	return s.Err
+}
+
+func (s *Signer) SignDirect(req *http.Request, authHeaders map[string]string, secret string) *signers.AuthenticationError {
+	s.record("SignDirect", req, secret)
+	if s.Err != nil {
+		return s.Err
+	}
+	ah, _ := s.GenerateAuthorization(req, authHeaders, s.Signature)
+	req.Header.Set("Authorization", ah)
+	return nil
+}
+
+func (s *Signer) GenerateAuthorization(req *http.Request, authHeaders map[string]string, signature string) (string, *signers.AuthenticationError) {
+	if s.Err != nil {
+		return "", s.Err
+	}
+	return fmt.Sprintf("mock %s:%s", authHeaders["id"], signature), nil
+}
+
+func (s *Signer) Version() int {
+	return s.VersionNumber
+}
+
+// Identifier is a signers.Identifier that identifies every non-empty Authorization header as belonging to
+// Signer. If Signer is nil, nothing is identified.
+type Identifier struct {
+	Signer signers.Signer
+}
+
+func (i *Identifier) IdentifySignature(authHeader string) signers.Signer {
+	if authHeader == "" || i.Signer == nil {
+		return nil
+	}
+	return i.Signer
+}
@@ -0,0 +1,223 @@
+package signers
+
+import (
+	"encoding/hex"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QueryNormalization controls how the query string is canonicalized before signing. The zero value
+// leaves the query untouched, as the specification requires the exact string sent by the client. The
+// options help when the client and server HTTP stacks encode the same URL differently; both ends must
+// use the same options.
+type QueryNormalization struct {
+	// Sort parameters by name, keeping the order of repeated parameters.
+	Sort bool
+	// Uppercase the hex digits of percent-encoded octets, e.g. %2f becomes %2F.
+	UppercaseEscapes bool
+	// Encode spaces as %20 where the query uses +.
+	PlusAsPercent20 bool
+}
+
+// ReferenceQueryNormalization matches the reference implementations, which encode query values per
+// RFC 3986: uppercase escapes and spaces as %20.
+var ReferenceQueryNormalization = QueryNormalization{
+	UppercaseEscapes: true,
+	PlusAsPercent20:  true,
+}
+
+var escapeRegex = regexp.MustCompile("%[0-9a-fA-F]{2}")
+
+func upperEscapes(s string) string {
+	return escapeRegex.ReplaceAllStringFunc(s, strings.ToUpper)
+}
+
+// Normalize returns the canonical form of a raw query string.
+func (q QueryNormalization) Normalize(raw string) string {
+	if raw == "" || q == (QueryNormalization{}) {
+		return raw
+	}
+	params := strings.Split(raw, "&")
+	for i, p := range params {
+		if q.PlusAsPercent20 {
+			p = strings.Replace(p, "+", "%20", -1)
+		}
+		if q.UppercaseEscapes {
+			p = upperEscapes(p)
+		}
+		params[i] = p
+	}
+	if q.Sort {
+		sort.SliceStable(params, func(i, j int) bool {
+			return queryName(params[i]) < queryName(params[j])
+		})
+	}
+	return strings.Join(params, "&")
+}
+
+func queryName(param string) string {
+	if i := strings.IndexByte(param, '='); i >= 0 {
+		return param[:i]
+	}
+	return param
+}
+
+// PathNormalization controls how the request path is canonicalized before signing, for proxies that
+// rewrite paths in equivalent ways. The zero value follows the specification. Whatever the options, a
+// leading slash is ensured and trailing slashes are removed, as with Path. Both ends must use the same
+// options.
+type PathNormalization struct {
+	// Collapse runs of slashes, e.g. /a//b becomes /a/b.
+	CollapseSlashes bool
+	// Resolve . and .. segments as described in RFC 3986 section 5.2.4.
+	ResolveDotSegments bool
+	// Sign the escaped path with normalized percent-encoding (uppercase hex digits, unreserved characters
+	// decoded) instead of the decoded path, so that escaped slashes stay distinguishable from separators.
+	NormalizeEscapes bool
+}
+
+// Normalize returns the canonical path of a URL.
+func (p PathNormalization) Normalize(u *url.URL) string {
+	if p == (PathNormalization{}) {
+		return Path(u)
+	}
+	s := u.Path
+	if p.NormalizeEscapes {
+		s = normalizeEscapes(u.EscapedPath())
+	}
+	var segments []string
+	for i, seg := range strings.Split(s, "/") {
+		if i > 0 && seg == "" && p.CollapseSlashes {
+			continue
+		}
+		if p.ResolveDotSegments {
+			if seg == "." {
+				continue
+			}
+			if seg == ".." {
+				if len(segments) > 1 {
+					segments = segments[:len(segments)-1]
+				}
+				continue
+			}
+		}
+		segments = append(segments, seg)
+	}
+	return strings.TrimRight("/"+strings.TrimLeft(strings.Join(segments, "/"), "/"), "/")
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func normalizeEscapes(s string) string {
+	return escapeRegex.ReplaceAllStringFunc(s, func(e string) string {
+		b, err := hex.DecodeString(e[1:])
+		if err == nil && isUnreserved(b[0]) {
+			return string(b)
+		}
+		return strings.ToUpper(e)
+	})
+}
+
+// HostNormalization controls how the host is canonicalized before signing, for HTTP stacks that write the
+// same host differently, typically IP literals: [::1]:3000, [0:0::1]:3000 and [::1] with a default port
+// are the same host. The zero value signs the host as sent. Both ends must use the same options.
+type HostNormalization struct {
+	// Lowercase the host, as the specification describes.
+	Lowercase bool
+	// Write IPv6 literals in their canonical form (RFC 5952), within brackets, adding brackets to literals
+	// sent without, and IPv4 literals without leading zeros, e.g. 192.000.002.001 as 192.0.2.1. Without it,
+	// literals keep their brackets or lack of them.
+	CanonicalIP bool
+	// Remove the ports 80 and 443, which some clients send and others omit.
+	StripDefaultPort bool
+}
+
+// Normalize returns the canonical form of a Host header.
+func (h HostNormalization) Normalize(host string) string {
+	if h == (HostNormalization{}) {
+		return host
+	}
+	if h.Lowercase {
+		host = strings.ToLower(host)
+	}
+	name, port, bracketed := splitHost(host)
+	if h.StripDefaultPort && (port == "80" || port == "443") {
+		port = ""
+	}
+	if h.CanonicalIP {
+		name, bracketed = canonicalIP(name)
+	}
+	if bracketed {
+		name = "[" + name + "]"
+	}
+	if port != "" {
+		return name + ":" + port
+	}
+	return name
+}
+
+// Splits a host into its name, without brackets, and port, and reports whether the name was bracketed. An
+// IPv6 literal may be sent without brackets when there is no port.
+func splitHost(host string) (string, string, bool) {
+	if strings.HasPrefix(host, "[") {
+		if end := strings.IndexByte(host, ']'); end > 0 {
+			return host[1:end], strings.TrimPrefix(host[end+1:], ":"), true
+		}
+	}
+	if strings.Count(host, ":") == 1 {
+		i := strings.IndexByte(host, ':')
+		return host[:i], host[i+1:], false
+	}
+	return host, "", false
+}
+
+// Returns the canonical form of an IP literal, with any zone, and whether it is an IPv6 literal. Names
+// that are not IP literals are returned as they are.
+func canonicalIP(name string) (string, bool) {
+	addr, zone := name, ""
+	if i := strings.IndexByte(name, '%'); i >= 0 {
+		addr, zone = name[:i], name[i:]
+	}
+	if !strings.Contains(addr, ":") {
+		if ip := parseIPv4(addr); ip != nil {
+			return ip.String(), false
+		}
+		return name, false
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return name, true
+	}
+	if v4 := ip.To4(); v4 != nil {
+		// net.IP writes IPv4-mapped addresses as IPv4.
+		return "::ffff:" + v4.String() + zone, true
+	}
+	return ip.String() + zone, true
+}
+
+// Parses a dotted-decimal IPv4 literal, leading zeros included, which net.ParseIP rejects. They are read as
+// decimal, not octal.
+func parseIPv4(addr string) net.IP {
+	parts := strings.Split(addr, ".")
+	if len(parts) != 4 {
+		return nil
+	}
+	b := [4]byte{}
+	for i, part := range parts {
+		if part == "" || len(part) > 3 || strings.Trim(part, "0123456789") != "" {
+			return nil
+		}
+		n, _ := strconv.Atoi(part)
+		if n > 255 {
+			return nil
+		}
+		b[i] = byte(n)
+	}
+	return net.IPv4(b[0], b[1], b[2], b[3])
+}
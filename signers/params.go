@@ -0,0 +1,191 @@
+package signers
+
+import (
+	"strings"
+)
+
+// AuthParamScanner tokenizes a list of authorization parameters (RFC 7235 auth-param): comma separated
+// name=value pairs, in any order, whose values are tokens or quoted strings. Quoted strings may contain
+// commas, and quotes or backslashes escaped with a backslash. Empty list elements are skipped.
+//
+// Like bufio.Scanner, Next advances to each parameter in turn, until the end of the list or an error:
+//
+//	sc := signers.NewAuthParamScanner(params)
+//	for sc.Next() {
+//		use(sc.Name(), sc.Value())
+//	}
+//	if err := sc.Err(); err != nil {
+//
+// Names and values are slices of the list, except for quoted strings with escapes, so scanning does not
+// allocate otherwise.
+type AuthParamScanner struct {
+	s     string
+	i     int
+	name  string
+	value string
+	err   *AuthenticationError
+}
+
+func NewAuthParamScanner(params string) AuthParamScanner {
+	return AuthParamScanner{s: params}
+}
+
+// Name returns the name of the current parameter.
+func (p *AuthParamScanner) Name() string {
+	return p.name
+}
+
+// Value returns the value of the current parameter, unquoted.
+func (p *AuthParamScanner) Value() string {
+	return p.value
+}
+
+// Err returns the error that stopped scanning, or nil at the end of the list.
+func (p *AuthParamScanner) Err() *AuthenticationError {
+	return p.err
+}
+
+// Next advances to the next parameter. Returns false at the end of the list or on a syntax error.
+func (p *AuthParamScanner) Next() bool {
+	s, i := p.s, p.i
+	if p.err != nil {
+		return false
+	}
+	for i < len(s) && (isSpace(s[i]) || s[i] == ',') {
+		i++
+	}
+	if i >= len(s) {
+		p.i = i
+		return false
+	}
+	eq := strings.IndexByte(s[i:], '=')
+	if eq < 0 {
+		return p.fail(Errorf(403, ErrorTypeInvalidAuthHeader, "Authorization parameter without value at offset %d.", i))
+	}
+	name := strings.TrimRight(s[i:i+eq], " \t\n\r")
+	if name == "" || strings.ContainsAny(name, ",\"") {
+		return p.fail(Errorf(403, ErrorTypeInvalidAuthHeader, "Malformed authorization parameter name at offset %d.", i))
+	}
+	i += eq + 1
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	var value string
+	if i < len(s) && s[i] == '"' {
+		var ok bool
+		value, i, ok = scanQuoted(s, i)
+		if !ok {
+			return p.fail(Errorf(403, ErrorTypeInvalidAuthHeader, "Unterminated quoted value for authorization parameter %s.", name))
+		}
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		if i < len(s) && s[i] != ',' {
+			return p.fail(Errorf(403, ErrorTypeInvalidAuthHeader, "Unexpected character after quoted value for authorization parameter %s.", name))
+		}
+	} else {
+		end := strings.IndexByte(s[i:], ',')
+		if end < 0 {
+			end = len(s) - i
+		}
+		value = strings.TrimRight(s[i:i+end], " \t\n\r")
+		i += end
+	}
+	p.i, p.name, p.value = i, name, value
+	return true
+}
+
+func (p *AuthParamScanner) fail(err *AuthenticationError) bool {
+	p.err = err
+	return false
+}
+
+// Reads the quoted string starting at s[start], returning its unescaped content and the offset following
+// the closing quote.
+func scanQuoted(s string, start int) (string, int, bool) {
+	escaped := false
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			escaped = true
+			i++
+		case '"':
+			if !escaped {
+				return s[start+1 : i], i + 1, true
+			}
+			return unescapeQuoted(s[start+1 : i]), i + 1, true
+		}
+	}
+	return "", len(s), false
+}
+
+func unescapeQuoted(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// SplitCredentials splits the value of an Authorization header carrying several comma separated credentials
+// (RFC 7235), e.g. `Basic dXNlcjpwYXNz, acquia-http-hmac id="...",...`, into one value per credential. A
+// comma outside quoted strings starts a new credential if it is followed by an authentication scheme: a
+// token followed by a space or the end of the value, rather than by "=" like parameter names.
+func SplitCredentials(value string) []string {
+	ret := []string{}
+	start := 0
+	quoted := false
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == ',' && startsCredential(value[i+1:]):
+			if cred := strings.TrimSpace(value[start:i]); cred != "" {
+				ret = append(ret, cred)
+			}
+			start = i + 1
+		}
+	}
+	if cred := strings.TrimSpace(value[start:]); cred != "" {
+		ret = append(ret, cred)
+	}
+	return ret
+}
+
+func startsCredential(s string) bool {
+	s = strings.TrimLeft(s, " \t")
+	i := 0
+	for i < len(s) && isTokenChar(s[i]) {
+		i++
+	}
+	if i == 0 {
+		return false
+	}
+	if i == len(s) {
+		return true
+	}
+	if s[i] != ' ' {
+		return false
+	}
+	rest := strings.TrimLeft(s[i:], " \t")
+	return rest == "" || rest[0] != '='
+}
+
+// Reports whether c may appear in a token (RFC 7230 tchar).
+func isTokenChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,58 @@
+package signers
+
+import (
+	"hash"
+	"sort"
+	"sync"
+)
+
+// SignerFactory creates a signer for a custom signature scheme using the given digest.
+type SignerFactory func(digest func() hash.Hash) (Signer, *AuthenticationError)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]SignerFactory{}
+)
+
+// Register makes a custom signature scheme available to signature identifiers (see compat) created
+// afterwards, alongside the built-in versions. Schemes are tried in name order after the built-in versions,
+// so a scheme's identification regex must not match v1 or v2 headers.
+// Register panics if the name is already registered or the factory is nil, and is meant to be called
+// from init().
+func Register(scheme string, factory SignerFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("signers: Register factory is nil for scheme " + scheme)
+	}
+	if _, dup := registry[scheme]; dup {
+		panic("signers: Register called twice for scheme " + scheme)
+	}
+	registry[scheme] = factory
+}
+
+// RegisteredSchemes returns the names of the registered custom schemes, sorted.
+func RegisteredSchemes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	ret := []string{}
+	for name := range registry {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// NewRegisteredSigner creates a signer for a registered scheme. Fails if the scheme is unknown.
+func NewRegisteredSigner(scheme string, digest func() hash.Hash) (Signer, *AuthenticationError) {
+	registryMu.RLock()
+	factory, ok := registry[scheme]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, Errorf(500, ErrorTypeUnknownSignatureType, "Signature scheme %s is not registered.", scheme)
+	}
+	if err := CheckDigest(digest); err != nil {
+		return nil, err
+	}
+	return factory(digest)
+}
@@ -2,15 +2,28 @@ package signers
 
 import (
 	"bytes"
+	"hash"
+	"io"
 	"net/http"
 )
 
 type SignableResponseWriter struct {
 	http.ResponseWriter
 	code int
+	// The buffered body, empty for streaming writers.
 	Body bytes.Buffer
+	// The MAC of streaming writers, fed the body as it is written through once start returned it.
+	start   ResponseMACStarter
+	mac     hash.Hash
+	err     *AuthenticationError
+	started bool
 }
 
+// ResponseMACStarter returns the MAC of a response, already fed with what precedes the body in the signable
+// string. It is called before the first byte of the body is written, once the status code and headers are
+// final.
+type ResponseMACStarter func(rw *SignableResponseWriter) (hash.Hash, *AuthenticationError)
+
 type dummyResponseWriter struct {
 	header http.Header
 }
@@ -34,6 +47,17 @@ func NewDummySignableResponseWriter(body []byte) *SignableResponseWriter {
 	return ret
 }
 
+// NewSignableResponse returns a SignableResponseWriter holding a received response, with its status code, a
+// copy of its headers and body, for checking its signature.
+func NewSignableResponse(resp *http.Response, body []byte) *SignableResponseWriter {
+	ret := NewDummySignableResponseWriter(body)
+	for name, values := range resp.Header {
+		ret.Header()[name] = append([]string{}, values...)
+	}
+	ret.WriteHeader(resp.StatusCode)
+	return ret
+}
+
 func NewSignableResponseWriter(h http.ResponseWriter) *SignableResponseWriter {
 	return &SignableResponseWriter{
 		ResponseWriter: h,
@@ -41,19 +65,125 @@ func NewSignableResponseWriter(h http.ResponseWriter) *SignableResponseWriter {
 	}
 }
 
+// NewStreamingResponseWriter returns a SignableResponseWriter writing the response through instead of
+// buffering it, and feeding the body to the MAC returned by start as it goes, so that large responses are
+// signed without being held in memory. The signature must then be sent in a trailer, declared before the
+// first write.
+func NewStreamingResponseWriter(h http.ResponseWriter, start ResponseMACStarter) *SignableResponseWriter {
+	ret := NewSignableResponseWriter(h)
+	ret.start = start
+	return ret
+}
+
+// Stream turns a buffering writer into a streaming one, see NewStreamingResponseWriter, and writes what was
+// buffered so far. The trailer of the signature must be declared first.
+func (s *SignableResponseWriter) Stream(start ResponseMACStarter) (int, error) {
+	if s.start != nil {
+		return 0, nil
+	}
+	s.start = start
+	buffered := s.Body.Bytes()
+	s.Body = bytes.Buffer{}
+	if len(buffered) == 0 {
+		return 0, nil
+	}
+	return s.Write(buffered)
+}
+
+// Streaming reports whether the response is written through rather than buffered.
+func (s *SignableResponseWriter) Streaming() bool {
+	return s.start != nil
+}
+
+// MAC returns the MAC of a streaming writer and any error starting it, starting it if no byte was written
+// yet. Returns nil for buffering writers, whose signature is computed from Body.
+func (s *SignableResponseWriter) MAC() (hash.Hash, *AuthenticationError) {
+	if s.start == nil {
+		return nil, nil
+	}
+	s.begin(nil)
+	return s.mac, s.err
+}
+
+// Starts the MAC before the first bytes of the body, b, are written, and writes the status code. As net/http
+// would, a missing Content-Type is detected from b first.
+func (s *SignableResponseWriter) begin(b []byte) {
+	if s.started {
+		return
+	}
+	s.started = true
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	if _, ok := s.Header()["Content-Type"]; !ok && len(b) > 0 {
+		s.Header().Set("Content-Type", http.DetectContentType(b))
+	}
+	s.mac, s.err = s.start(s)
+	s.ResponseWriter.WriteHeader(s.code)
+}
+
 func (s *SignableResponseWriter) Header() http.Header {
 	return s.ResponseWriter.Header()
 }
 
 func (s *SignableResponseWriter) Write(b []byte) (int, error) {
+	if s.start != nil {
+		s.begin(b)
+		if s.mac != nil {
+			s.mac.Write(b)
+		}
+		return s.ResponseWriter.Write(b)
+	}
 	return s.Body.Write(b)
 }
 
+// ReadFrom implements io.ReaderFrom, so that io.Copy and http.ServeContent fill the buffer with large reads
+// rather than through small writes. Streaming writers hash what they copy.
+func (s *SignableResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if s.start != nil {
+		return io.Copy(writerOnly{s}, r)
+	}
+	return s.Body.ReadFrom(r)
+}
+
+// Hides the ReadFrom method of a writer, for io.Copy not to call it back.
+type writerOnly struct {
+	io.Writer
+}
+
+// Flush sends what was written so far to the client for streaming writers, and does nothing otherwise.
+func (s *SignableResponseWriter) Flush() {
+	if s.start == nil {
+		return
+	}
+	s.begin(nil)
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (s *SignableResponseWriter) WriteHeader(status int) {
+	if s.started {
+		return
+	}
 	s.code = status
 }
 
+// Returns the status code set by WriteHeader, or 0 if it was not called yet.
+func (s *SignableResponseWriter) Status() int {
+	return s.code
+}
+
+// Close writes the buffered response. Streaming writers only write the status code if nothing else was
+// written.
 func (s *SignableResponseWriter) Close() (int, error) {
+	if s.start != nil {
+		s.begin(nil)
+		return 0, nil
+	}
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
 	s.ResponseWriter.WriteHeader(s.code)
 	return s.ResponseWriter.Write(s.Body.Bytes())
 }
@@ -0,0 +1,83 @@
+package signers
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// Secret holds decoded key material. Signers keyed with string secrets decode them according to their
+// specification (base64 for v2); a Secret lets key material from KMS or HSM sources be used as the raw
+// bytes it is, without a round trip through a string encoding.
+type Secret struct {
+	key []byte
+}
+
+// SecretDecoder converts an encoded secret into key material.
+type SecretDecoder func(encoded string) ([]byte, error)
+
+var (
+	DecodeBase64 SecretDecoder = base64.StdEncoding.DecodeString
+	DecodeHex    SecretDecoder = hex.DecodeString
+	// Uses the bytes of the string as they are, as v1 does.
+	DecodeRaw SecretDecoder = func(encoded string) ([]byte, error) {
+		return []byte(encoded), nil
+	}
+)
+
+// RawSecret wraps key material. The slice is not copied.
+func RawSecret(key []byte) Secret {
+	return Secret{
+		key: key,
+	}
+}
+
+// DecodeSecret decodes a secret with the given decoder. Fails with ErrorTypeOutdatedKeypair if the secret
+// is not in the expected format.
+func DecodeSecret(encoded string, decoder SecretDecoder) (Secret, *AuthenticationError) {
+	key, err := decoder(encoded)
+	if err != nil {
+		return Secret{}, Errorf(403, ErrorTypeOutdatedKeypair, "The provided secret key is not in a valid format: %w", err)
+	}
+	return RawSecret(key), nil
+}
+
+// Base64Secret decodes a base64 encoded secret, the format of v2 secrets.
+func Base64Secret(encoded string) (Secret, *AuthenticationError) {
+	key, err := DecodeBase64(encoded)
+	if err != nil {
+		return Secret{}, Errorf(403, ErrorTypeOutdatedKeypair, "The provided secret key is not in a valid base64 format: %w", err)
+	}
+	return RawSecret(key), nil
+}
+
+// HexSecret decodes a hex encoded secret.
+func HexSecret(encoded string) (Secret, *AuthenticationError) {
+	return DecodeSecret(encoded, DecodeHex)
+}
+
+// Bytes returns the key material. The slice is shared with the Secret and must not be modified.
+func (s Secret) Bytes() []byte {
+	return s.key
+}
+
+// Base64 returns the secret in the encoding expected by string keyed v2 signers.
+func (s Secret) Base64() string {
+	return base64.StdEncoding.EncodeToString(s.key)
+}
+
+// Wipe overwrites the key material with zeros. The Secret, and any Secret sharing its bytes, is unusable
+// afterwards.
+func (s Secret) Wipe() {
+	for i := range s.key {
+		s.key[i] = 0
+	}
+}
+
+func (s Secret) IsZero() bool {
+	return len(s.key) == 0
+}
+
+// String does not reveal the key material, so that secrets do not end up in logs.
+func (s Secret) String() string {
+	return "[secret]"
+}
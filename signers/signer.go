@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 )
 
 type Digester struct {
@@ -15,6 +16,10 @@ type Identifiable struct {
 	IdRegex *regexp.Regexp
 }
 
+// Signer computes and checks the signatures of one scheme. Signers are safe for concurrent use by multiple
+// goroutines: hash instances and buffers are created for each call, and the authHeaders maps passed in
+// are not modified, so one signer, and one map, can be shared by concurrent requests. Exported fields,
+// such as clocks and timestamp validators, must be set before the signer is shared.
 type Signer interface {
 	// Generates a signature according to a request. Does not alter the request.
 	// Fails if headers necessary for signing are missing.
@@ -54,6 +59,171 @@ type Signer interface {
 	Version() int
 }
 
+// AuthorizationMatcher is implemented by signers that can identify their Authorization headers without
+// running their identification regular expression, which is faster on busy servers. See MatchAuthorization.
+type AuthorizationMatcher interface {
+	MatchAuthorization(auth string) bool
+}
+
+// MatchAuthorization reports whether the Authorization header auth is of the signature scheme of signer,
+// preferring AuthorizationMatcher over GetIdentificationRegex.
+func MatchAuthorization(signer Signer, auth string) bool {
+	if m, ok := signer.(AuthorizationMatcher); ok {
+		return m.MatchAuthorization(auth)
+	}
+	return signer.GetIdentificationRegex().MatchString(auth)
+}
+
+// RequestSigner is the part of Signer needed by clients, which only sign outgoing requests.
+type RequestSigner interface {
+	SignDirect(req *http.Request, authHeaders map[string]string, secret string) *AuthenticationError
+}
+
+// Verifier is the part of Signer needed by servers, which only verify incoming requests.
+type Verifier interface {
+	ParseAuthHeaders(req *http.Request) map[string]string
+	Check(req *http.Request, secret string) *AuthenticationError
+}
+
+// SecretChecker is implemented by signers that can verify requests with decoded key material, so that
+// secrets held as raw bytes need not be encoded into strings.
+type SecretChecker interface {
+	CheckSecret(req *http.Request, secret Secret) *AuthenticationError
+}
+
+// DeferredChecker is implemented by signers whose signature covers a digest of the body sent in a header.
+// CheckDeferred checks the signature against that header without reading the body, and replaces req.Body
+// with a BodyVerifier checking the body as it is read. The request is only authentic once the returned
+// verifier's Verify succeeds.
+type DeferredChecker interface {
+	CheckDeferred(req *http.Request, secret string) (*BodyVerifier, *AuthenticationError)
+}
+
+// NarrowingChecker is implemented by signers whose credential may carry more than what Check verifies, e.g.
+// several signatures of which one matched. Check then leaves only what it verified in the request, which
+// must be parsed again for the nonce to be derived from it.
+type NarrowingChecker interface {
+	NarrowsCredential() bool
+}
+
+// Result describes a successfully verified request.
+type Result struct {
+	KeyID string
+	// Empty for signature versions without a realm (v1).
+	Realm   string
+	Version int
+	// Empty for signature versions without a nonce (v1).
+	Nonce string
+	// Zero if the signature version carries no timestamp.
+	Timestamp time.Time
+	// Names of the headers covered by the signature, as listed in the Authorization header.
+	SignedHeaders []string
+}
+
+// ResultVerifier is implemented by signers that report what they verified.
+type ResultVerifier interface {
+	Verify(req *http.Request, secret string) (*Result, *AuthenticationError)
+}
+
+// Verify checks a request with signer and returns the result, built from the parsed authorization headers
+// for signers that do not implement ResultVerifier.
+func Verify(signer Signer, req *http.Request, secret string) (*Result, *AuthenticationError) {
+	if rv, ok := signer.(ResultVerifier); ok {
+		return rv.Verify(req, secret)
+	}
+	if err := signer.Check(req, secret); err != nil {
+		return nil, err
+	}
+	authHeaders := signer.ParseAuthHeaders(req)
+	ret := &Result{
+		KeyID:   authHeaders["id"],
+		Realm:   authHeaders["realm"],
+		Version: signer.Version(),
+		Nonce:   authHeaders["nonce"],
+	}
+	if h := authHeaders["headers"]; h != "" {
+		ret.SignedHeaders = strings.Split(h, ";")
+	}
+	return ret, nil
+}
+
+// Identifier selects the signer matching the value of an Authorization header, or returns nil if none does.
+// Implemented by compat.SignatureIdentifier.
+type Identifier interface {
+	IdentifySignature(authHeader string) Signer
+}
+
+// IdentifyCredential returns the first of the values of an Authorization header, or of the credentials
+// within a value (see SplitCredentials), that identifier matches, along with its signer. Returns the first
+// value and a nil signer if none matches, and an empty credential without values.
+func IdentifyCredential(identifier Identifier, values []string) (string, Signer) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	for _, value := range values {
+		for _, cred := range SplitCredentials(value) {
+			if signer := identifier.IdentifySignature(cred); signer != nil {
+				return cred, signer
+			}
+		}
+	}
+	return values[0], nil
+}
+
+// SignerCloner is implemented by signers that can be copied, for the copy to be configured without affecting
+// the original.
+type SignerCloner interface {
+	CloneSigner() Signer
+}
+
+// IdentifierCloner is implemented by identifiers that can be copied along with their signers, e.g. for the
+// middleware of a route to configure its own (see middleware.Middleware.With).
+type IdentifierCloner interface {
+	CloneIdentifier() Identifier
+}
+
+// HeaderIdentifiable is implemented by signers of schemes that sign in other headers than Authorization, such
+// as HTTP Message Signatures. Their identification regex matches the value of the returned header.
+type HeaderIdentifiable interface {
+	IdentificationHeader() string
+}
+
+// RequestIdentifier is implemented by identifiers that also select signers of HeaderIdentifiable schemes,
+// for requests without an Authorization header.
+type RequestIdentifier interface {
+	IdentifyRequest(req *http.Request) Signer
+}
+
+// ExistingSignaturePolicy decides what SignDirect does with a request that already bears an Authorization
+// header of the signer's version, e.g. when a retry wrapper signs a request a second time.
+type ExistingSignaturePolicy int
+
+const (
+	// Sign with the given authorization headers, replacing the existing signature. The body hash is
+	// recomputed, the timestamp is kept.
+	ReplaceExistingSignature ExistingSignaturePolicy = iota
+	// Fail with ErrorTypeAlreadySigned.
+	RefuseExistingSignature
+	// Sign again with the id, realm and headers of the existing signature, refreshing the nonce, timestamp
+	// and body hash. The given authorization headers are ignored, except their nonce if set: a fresh one is
+	// generated otherwise.
+	ResignExistingSignature
+)
+
+// Canonicalizer builds the string that is signed for a request from the request, the authorization
+// headers and the body hash (empty if there is no body). Custom canonicalizers let gateways that alter
+// requests in known ways leave those parts out of the signature.
+type Canonicalizer interface {
+	Canonicalize(req *http.Request, authHeaders map[string]string, bodyhash string) []byte
+}
+
+// CanonicalizerFunc adapts a function to the Canonicalizer interface.
+type CanonicalizerFunc func(req *http.Request, authHeaders map[string]string, bodyhash string) []byte
+
+func (f CanonicalizerFunc) Canonicalize(req *http.Request, authHeaders map[string]string, bodyhash string) []byte {
+	return f(req, authHeaders, bodyhash)
+}
+
 type ResponseSigner interface {
 	SignResponse(req *http.Request, rw *SignableResponseWriter, secret string) (string, *AuthenticationError)
 	SignResponseDirect(req *http.Request, rw *SignableResponseWriter, secret string) *AuthenticationError
@@ -61,6 +231,18 @@ type ResponseSigner interface {
 	SetTrailer(rw http.ResponseWriter)
 }
 
+// StreamingResponseSigner is implemented by response signers that can sign a response while it is streamed
+// to the client, see NewStreamingResponseWriter. SignResponse then returns the signature of what was written.
+type StreamingResponseSigner interface {
+	StartResponse(req *http.Request, rw *SignableResponseWriter, secret string) (hash.Hash, *AuthenticationError)
+}
+
+// BoundResponseChecker is implemented by response signers that can check a response against the nonce and
+// timestamp its request was signed with, as remembered by the client.
+type BoundResponseChecker interface {
+	CheckBound(nonce string, timestamp string, resp *http.Response, secret string) *AuthenticationError
+}
+
 func NormalizedHeaderName(key string) string {
 	return strings.ToLower(key)
 }
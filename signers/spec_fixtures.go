@@ -0,0 +1,148 @@
+package signers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Environment variable pointing at a checkout of the fixtures directory of
+// https://github.com/acquia/http-hmac-spec (e.g. http-hmac-spec/fixtures/2.0).
+const SpecFixturesEnv = "HTTP_HMAC_SPEC_FIXTURES"
+
+// SpecFixture mirrors a single JSON test vector of the upstream specification.
+type SpecFixture struct {
+	Name  string `json:"name"`
+	Input struct {
+		Host          string            `json:"host"`
+		URL           string            `json:"url"`
+		Method        string            `json:"method"`
+		ContentBody   string            `json:"content_body"`
+		ContentType   string            `json:"content_type"`
+		ContentSHA    string            `json:"content_sha"`
+		Timestamp     int64             `json:"timestamp"`
+		ID            string            `json:"id"`
+		Secret        string            `json:"secret"`
+		Realm         string            `json:"realm"`
+		Nonce         string            `json:"nonce"`
+		SignedHeaders []string          `json:"signed_headers"`
+		Headers       map[string]string `json:"headers"`
+	} `json:"input"`
+	Expectations struct {
+		AuthorizationHeader string `json:"authorization_header"`
+		SignableMessage     string `json:"signable_message"`
+		MessageSignature    string `json:"message_signature"`
+		ResponseBody        string `json:"response_body"`
+		ResponseSignature   string `json:"response_signature"`
+	} `json:"expectations"`
+}
+
+// LoadSpecFixtures reads every *.json vector in a directory, in file name order. Each file may hold a
+// single vector or an array of them.
+func LoadSpecFixtures(dir string) ([]*SpecFixture, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	ret := []*SpecFixture{}
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+			list := []*SpecFixture{}
+			if err := json.Unmarshal(data, &list); err != nil {
+				return nil, fmt.Errorf("%s: %w", fn, err)
+			}
+			ret = append(ret, list...)
+			continue
+		}
+		f := &SpecFixture{}
+		if err := json.Unmarshal(data, f); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		ret = append(ret, f)
+	}
+	return ret, nil
+}
+
+// LoadSpecFixturesFromEnv loads the vectors from the directory named by SpecFixturesEnv, falling back to
+// the given directory. Returns no fixtures if neither exists.
+func LoadSpecFixturesFromEnv(fallback string) ([]*SpecFixture, error) {
+	dir := os.Getenv(SpecFixturesEnv)
+	if dir == "" {
+		dir = fallback
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return []*SpecFixture{}, nil
+	}
+	return LoadSpecFixtures(dir)
+}
+
+// ToTestFixture converts a specification vector into the fixture format used by the signer tests.
+func (s *SpecFixture) ToTestFixture() *TestFixture {
+	in := s.Input
+	headers := map[string][]string{
+		"X-Authorization-Timestamp": []string{fmt.Sprintf("%d", in.Timestamp)},
+	}
+	for k, v := range in.Headers {
+		headers[k] = []string{v}
+	}
+	if in.ContentType != "" {
+		headers["Content-Type"] = []string{in.ContentType}
+	}
+	if in.ContentSHA != "" {
+		headers["X-Authorization-Content-SHA256"] = []string{in.ContentSHA}
+	}
+	req := &http.Request{
+		Method: in.Method,
+		Header: MakeHeader(headers),
+		Host:   in.Host,
+		URL:    SilentURLParse(in.URL),
+	}
+	if in.ContentBody != "" {
+		req.Body = MakeBody(in.ContentBody)
+		req.ContentLength = int64(len(in.ContentBody))
+	}
+	authHeaders := map[string]string{
+		"id":      in.ID,
+		"nonce":   in.Nonce,
+		"realm":   in.Realm,
+		"version": "2.0",
+	}
+	if len(in.SignedHeaders) > 0 {
+		authHeaders["headers"] = strings.Join(in.SignedHeaders, ";")
+	}
+	f := &TestFixture{
+		TestName:   "spec - " + s.Name,
+		SystemTime: in.Timestamp,
+		Digest:     sha256.New,
+		Expected: map[string]string{
+			"v2": s.Expectations.MessageSignature,
+		},
+		Request:     req,
+		AuthHeaders: authHeaders,
+		SecretKey:   in.Secret,
+		ErrorType:   map[string]ErrorType{},
+		ExpectedHeader: map[string]string{
+			"v2": s.Expectations.AuthorizationHeader,
+		},
+	}
+	if s.Expectations.ResponseSignature != "" {
+		f.Response = &ResponseFixture{
+			Expected: map[string]string{
+				"v2": s.Expectations.ResponseSignature,
+			},
+			Response: PrepareResponseWriter(s.Expectations.ResponseBody),
+		}
+	}
+	return f
+}
@@ -0,0 +1,254 @@
+// Package stripe implements the timestamped webhook signature scheme used by Stripe: a Stripe-Signature
+// header of the form t=<unix timestamp>,v1=<hex HMAC>, where the HMAC covers "<timestamp>.<raw body>" and
+// is keyed with the plain webhook secret. The HMAC covers neither the method, the path nor the host of the
+// request, so the scheme is only suitable for verifying webhook endpoints, not for request authentication.
+package stripe
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"github.com/acquia/http-hmac-go/nonce"
+	"github.com/acquia/http-hmac-go/signers"
+	"hash"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultHeader = "Stripe-Signature"
+
+var registerOnce sync.Once
+
+// Register registers the scheme as "stripe", for signature identifiers (see compat) created afterwards to
+// accept Stripe-Signature headers. Only register it for servers that exclusively serve webhook endpoints:
+// identifiers then accept the scheme on every route, and, unless a signer with an ID is used, the key is
+// looked up for an empty key ID. Register may be called more than once.
+func Register() {
+	registerOnce.Do(func() {
+		signers.Register("stripe", func(digest func() hash.Hash) (signers.Signer, *signers.AuthenticationError) {
+			return NewStripeSigner(digest)
+		})
+	})
+}
+
+type StripeSigner struct {
+	*signers.Digester
+	*signers.Identifiable
+	// Header carrying the signature. Defaults to Stripe-Signature.
+	Header string
+	// Key ID reported by ParseAuthHeaders, since the scheme carries none.
+	ID string
+	// Validates the signature timestamp during Check. Defaults to a tolerance of 5 minutes on Clock.
+	Timestamps *signers.TimestampValidator
+	// Source of the current time. Defaults to the package clock.
+	Clock signers.Clock
+	// If set, Check rejects signatures it has already accepted. Servers using the verification middleware
+	// do not need this: ParseAuthHeaders reports the verified signature as nonce, so the middleware's store
+	// applies.
+	Nonces nonce.Store
+}
+
+func NewStripeSigner(digest func() hash.Hash) (*StripeSigner, *signers.AuthenticationError) {
+	if err := signers.CheckDigest(digest); err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile("^\\s*t=\\d+,.*v1=[0-9a-fA-F]+")
+	if err != nil {
+		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not compile regular expression for identifier: %w", err)
+	}
+	return &StripeSigner{
+		Digester: &signers.Digester{
+			Digest: digest,
+		},
+		Identifiable: &signers.Identifiable{
+			IdRegex: re,
+		},
+	}, nil
+}
+
+func (v *StripeSigner) header() string {
+	if v.Header == "" {
+		return DefaultHeader
+	}
+	return v.Header
+}
+
+// AuthorizationHeaderName returns the header carrying the signature, Header or Stripe-Signature.
+func (v *StripeSigner) AuthorizationHeaderName() string {
+	return v.header()
+}
+
+func (v *StripeSigner) timestamps() *signers.TimestampValidator {
+	if v.Timestamps == nil {
+		return &signers.TimestampValidator{
+			Header:    v.header(),
+			Tolerance: 5 * time.Minute,
+			Clock:     v.Clock,
+		}
+	}
+	return v.Timestamps
+}
+
+// ParseSignatureHeader parses a header value into the timestamp and all v1 signatures, several of which
+// are sent while a secret is being rolled.
+func ParseSignatureHeader(value string) (string, []string) {
+	var timestamp string
+	sigs := []string{}
+	for _, part := range strings.Split(value, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			sigs = append(sigs, kv[1])
+		}
+	}
+	return timestamp, sigs
+}
+
+// Returns "timestamp" and the first v1 "signature", lowercased, which doubles as "nonce" with the timestamp.
+// Does not alter the request. Once Check verified the request, the signature is the one that matched.
+func (v *StripeSigner) ParseAuthHeaders(req *http.Request) map[string]string {
+	ret := map[string]string{}
+	timestamp, sigs := ParseSignatureHeader(req.Header.Get(v.header()))
+	if v.ID != "" {
+		ret["id"] = v.ID
+	}
+	if timestamp != "" {
+		ret["timestamp"] = timestamp
+	}
+	if len(sigs) > 0 {
+		sig := strings.ToLower(sigs[0])
+		ret["signature"] = sig
+		ret["nonce"] = timestamp + ":" + sig
+	}
+	return ret
+}
+
+func (v *StripeSigner) sign(timestamp string, body []byte, secret string) string {
+	h := hmac.New(v.Digest, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Sign signs the request body with authHeaders["timestamp"], or the current time if absent.
+func (v *StripeSigner) Sign(req *http.Request, authHeaders map[string]string, secret string) (string, *signers.AuthenticationError) {
+	timestamp, ok := authHeaders["timestamp"]
+	if !ok {
+		timestamp = strconv.FormatInt(signers.NowFrom(v.Clock).Unix(), 10)
+	}
+	body, err := signers.ReadBody(req)
+	if err != nil {
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
+	}
+	return v.sign(timestamp, body, secret), nil
+}
+
+var hexSignature = regexp.MustCompile("^[0-9a-fA-F]+$")
+
+// Check verifies the request against every v1 signature of the header, which must all be hex encoded. The
+// header is then left with the timestamp and the signature that matched, lowercased, so that its nonce
+// (see ParseAuthHeaders) cannot be varied by changing the case of the signature or adding others.
+func (v *StripeSigner) Check(req *http.Request, secret string) *signers.AuthenticationError {
+	value := req.Header.Get(v.header())
+	if value == "" {
+		return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header %s.", v.header())
+	}
+	timestamp, sigs := ParseSignatureHeader(value)
+	if timestamp == "" || len(sigs) == 0 {
+		return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "%s must contain a timestamp and a v1 signature.", v.header())
+	}
+	for _, sig := range sigs {
+		if !hexSignature.MatchString(sig) {
+			return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "%s must contain hex encoded v1 signatures.", v.header())
+		}
+	}
+	if _, err := v.timestamps().Validate(timestamp); err != nil {
+		return err
+	}
+	body, rerr := signers.ReadBody(req)
+	if rerr != nil {
+		return signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", rerr)
+	}
+	expected := []byte(v.sign(timestamp, body, secret))
+	for _, sig := range sigs {
+		sig = strings.ToLower(sig)
+		if !hmac.Equal(expected, []byte(sig)) {
+			continue
+		}
+		req.Header.Set(v.header(), "t="+timestamp+",v1="+sig)
+		if v.Nonces != nil {
+			fresh, nerr := v.Nonces.Add(timestamp+":"+sig, v.timestamps().NonceTTL())
+			if nerr != nil {
+				return signers.Errorf(500, signers.ErrorTypeInternalError, "Could not record nonce: %w", nerr)
+			}
+			if !fresh {
+				return signers.Errorf(403, signers.ErrorTypeReplayedRequest, "Signature has already been used.")
+			}
+		}
+		return nil
+	}
+	return signers.Errorf(403, signers.ErrorTypeSignatureMismatch, "Signature does not match expected signature.")
+}
+
+// NarrowsCredential reports that Check leaves only the matching signature in the header.
+func (v *StripeSigner) NarrowsCredential() bool {
+	return true
+}
+
+func (v *StripeSigner) SignDirect(req *http.Request, authHeaders map[string]string, secret string) *signers.AuthenticationError {
+	authHeaders = signers.CopyAuthHeaders(authHeaders)
+	if _, ok := authHeaders["timestamp"]; !ok {
+		authHeaders["timestamp"] = strconv.FormatInt(signers.NowFrom(v.Clock).Unix(), 10)
+	}
+	sig, err := v.Sign(req, authHeaders, secret)
+	if err != nil {
+		return err
+	}
+	value, err := v.GenerateAuthorization(req, authHeaders, sig)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(v.header(), value)
+	return nil
+}
+
+// GenerateAuthorization returns the value of the signature header.
+func (v *StripeSigner) GenerateAuthorization(req *http.Request, authHeaders map[string]string, signature string) (string, *signers.AuthenticationError) {
+	timestamp, ok := authHeaders["timestamp"]
+	if !ok {
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Missing timestamp for signature.")
+	}
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, signature), nil
+}
+
+func (v *StripeSigner) HashBody(req *http.Request) (string, *signers.AuthenticationError) {
+	body, err := signers.ReadBody(req)
+	if err != nil {
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
+	}
+	h := v.Digest()
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (v *StripeSigner) GetIdentificationRegex() *regexp.Regexp {
+	return v.IdRegex
+}
+
+func (v *StripeSigner) GetResponseSigner() signers.ResponseSigner {
+	return nil
+}
+
+func (v *StripeSigner) Version() int {
+	return 0
+}
@@ -0,0 +1,136 @@
+package stripe
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"github.com/acquia/http-hmac-go/nonce"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/compat"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const (
+	testSecret  = "whsec_test_secret"
+	testPayload = `{"id":"evt_1","type":"payment_intent.succeeded"}`
+)
+
+func event(header string) *http.Request {
+	req, _ := http.NewRequest("POST", "http://example.com/stripe", strings.NewReader(testPayload))
+	if header != "" {
+		req.Header.Set(DefaultHeader, header)
+	}
+	return req
+}
+
+func TestStripeSigner(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, err := NewStripeSigner(sha256.New)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	signer.Nonces = nonce.NewMemoryStore(100)
+
+	req := event("")
+	if err := signer.SignDirect(req, map[string]string{}, testSecret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	header := req.Header.Get(DefaultHeader)
+	if !strings.HasPrefix(header, "t=1432075982,v1=") {
+		t.Error("Unexpected signature header: ", header)
+	}
+	if err := signer.Check(event(header), testSecret); err != nil {
+		t.Error("Failed to verify signature: ", err.Message)
+	}
+	if err := signer.Check(event(header), testSecret); err == nil || err.ErrorType != signers.ErrorTypeReplayedRequest {
+		t.Error("Expected replayed signature to be rejected.")
+	}
+
+	// A secret being rolled: only one of the signatures needs to match.
+	_, sigs := ParseSignatureHeader(header)
+	rolled := "t=1432075982,v1=" + strings.Repeat("0", 64) + ",v1=" + sigs[0]
+	signer.Nonces = nil
+	if err := signer.Check(event(rolled), testSecret); err != nil {
+		t.Error("Failed to verify signature among several: ", err.Message)
+	}
+
+	expected := map[string]signers.ErrorType{
+		"":                           signers.ErrorTypeMissingRequiredHeader,
+		"v1=" + sigs[0]:              signers.ErrorTypeInvalidAuthHeader,
+		"t=1432075982,v1=00":         signers.ErrorTypeSignatureMismatch,
+		"t=1432070000,v1=" + sigs[0]: signers.ErrorTypeTimestampRangeError,
+	}
+	for h, errorType := range expected {
+		if err := signer.Check(event(h), testSecret); err == nil || err.ErrorType != errorType {
+			t.Errorf("Expected error type %s for header %q.", signers.GetErrorTypeText(errorType), h)
+		}
+	}
+}
+
+func TestFIPSMode(t *testing.T) {
+	signers.SetFIPSMode(true)
+	defer signers.SetFIPSMode(false)
+	if _, err := NewStripeSigner(sha1.New); err == nil || err.ErrorType != signers.ErrorTypeUnapprovedAlgorithm {
+		t.Error("Expected HMAC-SHA1 to be rejected in FIPS mode.")
+	}
+	if _, err := NewStripeSigner(sha256.New); err != nil {
+		t.Error("Expected HMAC-SHA256 to be accepted in FIPS mode: ", err.Message)
+	}
+}
+
+func TestRegisteredStripeScheme(t *testing.T) {
+	Register()
+	identifier := compat.NewSupportedSignatureIdentifier()
+	if _, ok := identifier.IdentifySignature("t=1432075982,v1=abcdef").(*StripeSigner); !ok {
+		t.Error("Expected the stripe scheme to be identified.")
+	}
+	if _, ok := identifier.IdentifySignature(`acquia-http-hmac id="a",nonce="b",realm="c",signature="d",version="2.0"`).(*StripeSigner); ok {
+		t.Error("Expected v2 headers not to be identified as stripe.")
+	}
+}
+
+func TestStripeReplayVariants(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, _ := NewStripeSigner(sha256.New)
+	req := event("")
+	if err := signer.SignDirect(req, map[string]string{}, testSecret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	header := req.Header.Get(DefaultHeader)
+	_, sigs := ParseSignatureHeader(header)
+	variants := map[string]string{
+		"changed case":     "t=1432075982,v1=" + strings.ToUpper(sigs[0]),
+		"prepended decoy":  "t=1432075982,v1=00,v1=" + sigs[0],
+		"appended decoy":   header + ",v1=" + strings.Repeat("0", 64),
+		"original request": header,
+	}
+
+	store := nonce.NewMemoryStore(100)
+	signer.Nonces = store
+	if err := signer.Check(event(header), testSecret); err != nil {
+		t.Fatal("Failed to verify signature: ", err.Message)
+	}
+	for name, h := range variants {
+		if err := signer.Check(event(h), testSecret); err == nil || err.ErrorType != signers.ErrorTypeReplayedRequest {
+			t.Errorf("Expected the %s to be rejected as a replay, got %v.", name, err)
+		}
+	}
+
+	// Without a store of its own, the nonce reported once verified must be the same for every variant.
+	signer.Nonces = nil
+	for name, h := range variants {
+		r := event(h)
+		if err := signer.Check(r, testSecret); err != nil {
+			t.Fatal("Failed to verify the ", name, ": ", err.Message)
+		}
+		if n := signer.ParseAuthHeaders(r)["nonce"]; n != "1432075982:"+sigs[0] {
+			t.Errorf("Unexpected nonce %s for the %s.", n, name)
+		}
+	}
+	if err := signer.Check(event("t=1432075982,v1=zz,v1="+sigs[0]), testSecret); err == nil || err.ErrorType != signers.ErrorTypeInvalidAuthHeader {
+		t.Error("Expected non-hex signatures to be rejected.")
+	}
+}
@@ -0,0 +1,100 @@
+package signers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TimestampValidator parses request timestamps and checks that they are within a tolerance of the
+// current time.
+type TimestampValidator struct {
+	// Name of the header carrying the timestamp. Defaults to X-Authorization-Timestamp.
+	Header string
+	// Maximum accepted distance from the current time, in either direction. Defaults to 15 minutes. Nonces
+	// are remembered for twice the tolerance, see NonceTTL.
+	Tolerance time.Duration
+	// Accept fractional seconds, e.g. 1432075982.250. The specification only allows whole seconds.
+	AllowFractional bool
+	// Source of the current time. Defaults to the package clock (see Now).
+	Clock Clock
+}
+
+var DefaultTimestampValidator = &TimestampValidator{}
+
+// TimestampedSigner is implemented by signers whose signatures carry a timestamp, for clients and servers to
+// read its header and tolerance as configured on the signer.
+type TimestampedSigner interface {
+	TimestampValidator() *TimestampValidator
+}
+
+// HeaderName returns the name of the header carrying the timestamp.
+func (t *TimestampValidator) HeaderName() string {
+	if t.Header == "" {
+		return "X-Authorization-Timestamp"
+	}
+	return t.Header
+}
+
+func (t *TimestampValidator) tolerance() time.Duration {
+	if t.Tolerance == 0 {
+		return 900 * time.Second
+	}
+	return t.Tolerance
+}
+
+// NonceTTL returns how long nonces must be remembered for a replay to be rejected as long as its timestamp is
+// accepted: the window of twice the tolerance, plus a minute for clock skew between servers.
+func (t *TimestampValidator) NonceTTL() time.Duration {
+	return 2*t.tolerance() + time.Minute
+}
+
+func (t *TimestampValidator) now() time.Time {
+	return NowFrom(t.Clock)
+}
+
+// Parse converts a timestamp header value into a time.
+func (t *TimestampValidator) Parse(value string) (time.Time, *AuthenticationError) {
+	if t.AllowFractional {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			if err == nil {
+				err = strconv.ErrSyntax
+			}
+			return time.Time{}, Errorf(403, ErrorTypeInvalidRequiredHeader, "Timestamp parse error: %w", err)
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, Errorf(403, ErrorTypeInvalidRequiredHeader, "Timestamp parse error: %w", err)
+	}
+	return time.Unix(timestamp, 0), nil
+}
+
+// Validate parses a timestamp and checks it is within the tolerance.
+func (t *TimestampValidator) Validate(value string) (time.Time, *AuthenticationError) {
+	ts, err := t.Parse(value)
+	if err != nil {
+		return ts, err
+	}
+	now := t.now()
+	if ts.After(now.Add(t.tolerance())) {
+		return ts, Errorf(403, ErrorTypeTimestampRangeError, "Timestamp given in %s (%s) was too far in the future.", t.HeaderName(), value)
+	}
+	if ts.Before(now.Add(-t.tolerance())) {
+		return ts, Errorf(403, ErrorTypeTimestampRangeError, "Timestamp given in %s (%s) was too far in the past.", t.HeaderName(), value)
+	}
+	return ts, nil
+}
+
+// Check validates the timestamp header of a request. Fails if the header is missing.
+func (t *TimestampValidator) Check(req *http.Request) (time.Time, *AuthenticationError) {
+	value := req.Header.Get(t.HeaderName())
+	if value == "" {
+		return time.Time{}, Errorf(403, ErrorTypeMissingRequiredHeader, "Missing required header %s.", t.HeaderName())
+	}
+	return t.Validate(value)
+}
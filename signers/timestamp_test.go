@@ -0,0 +1,90 @@
+package signers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTimestampParse(t *testing.T) {
+	cases := []struct {
+		value      string
+		fractional bool
+		expected   time.Time
+		valid      bool
+	}{
+		{"1432075982", false, time.Unix(1432075982, 0), true},
+		{"1432075982", true, time.Unix(1432075982, 0), true},
+		{"1432075982.250", false, time.Time{}, false},
+		{"1432075982.250", true, time.Unix(1432075982, 250000000), true},
+		{"-1", false, time.Unix(-1, 0), true},
+		{"", false, time.Time{}, false},
+		{"", true, time.Time{}, false},
+		{"abc", true, time.Time{}, false},
+		{"1e9", false, time.Time{}, false},
+		{"1e9", true, time.Unix(1000000000, 0), true},
+		{"NaN", true, time.Time{}, false},
+		{"Inf", true, time.Time{}, false},
+		{"-Inf", true, time.Time{}, false},
+		{"+Infinity", true, time.Time{}, false},
+	}
+	for _, c := range cases {
+		v := &TimestampValidator{AllowFractional: c.fractional}
+		ts, err := v.Parse(c.value)
+		if !c.valid {
+			if err == nil || err.ErrorType != ErrorTypeInvalidRequiredHeader {
+				t.Errorf("Expected %q (fractional %t) to be rejected, got %s", c.value, c.fractional, ts)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed to parse %q (fractional %t): %s", c.value, c.fractional, err.Message)
+		} else if !ts.Equal(c.expected) {
+			t.Errorf("Expected %q (fractional %t) to be %s, got %s", c.value, c.fractional, c.expected, ts)
+		}
+	}
+}
+
+func TestTimestampValidate(t *testing.T) {
+	OverrideClock(1432075982)
+	defer RestoreClock()
+	cases := []struct {
+		value     string
+		tolerance time.Duration
+		errorType ErrorType
+	}{
+		{"1432075982", 0, ErrorTypeNoError},
+		{"1432076882", 0, ErrorTypeNoError},
+		{"1432076883", 0, ErrorTypeTimestampRangeError},
+		{"1432075082", 0, ErrorTypeNoError},
+		{"1432075081", 0, ErrorTypeTimestampRangeError},
+		{"1432075992", 10 * time.Second, ErrorTypeNoError},
+		{"1432075993", 10 * time.Second, ErrorTypeTimestampRangeError},
+		{"soon", 0, ErrorTypeInvalidRequiredHeader},
+	}
+	for _, c := range cases {
+		v := &TimestampValidator{Tolerance: c.tolerance}
+		_, err := v.Validate(c.value)
+		if c.errorType == ErrorTypeNoError && err != nil {
+			t.Errorf("Expected %q to be in range, got %s", c.value, err.Message)
+		}
+		if c.errorType != ErrorTypeNoError && (err == nil || err.ErrorType != c.errorType) {
+			t.Errorf("Expected %q to fail with error type %d, got %v", c.value, c.errorType, err)
+		}
+	}
+}
+
+func TestTimestampCheckHeader(t *testing.T) {
+	OverrideClock(1432075982)
+	defer RestoreClock()
+	v := &TimestampValidator{Header: "X-Timestamp"}
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/", nil)
+	req.Header.Set("X-Authorization-Timestamp", "1432075982")
+	if _, err := v.Check(req); err == nil || err.ErrorType != ErrorTypeMissingRequiredHeader {
+		t.Error("Expected the timestamp to be read from the configured header only.")
+	}
+	req.Header.Set("X-Timestamp", "1432075982")
+	if _, err := v.Check(req); err != nil {
+		t.Error("Failed to check the timestamp of the configured header: ", err.Message)
+	}
+}
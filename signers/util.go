@@ -2,12 +2,16 @@ package signers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,6 +24,16 @@ func Logf(format string, args ...interface{}) {
 	Log.Printf(format, args...)
 }
 
+// CopyAuthHeaders returns a copy of an authorization header map, for signers adding parameters to it without
+// altering the map of the caller, which may be shared by concurrent requests.
+func CopyAuthHeaders(authHeaders map[string]string) map[string]string {
+	ret := make(map[string]string, len(authHeaders)+2)
+	for k, v := range authHeaders {
+		ret[k] = v
+	}
+	return ret
+}
+
 func ReadBody(r *http.Request) ([]byte, error) {
 	var data []byte = []byte{}
 	if r.Body != nil {
@@ -35,6 +49,61 @@ func ReadBody(r *http.Request) ([]byte, error) {
 	return data, nil
 }
 
+// ErrBodyTooLarge is returned when a request body exceeds the limit it is read with.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// ReadBodyLimit is like ReadBody, but stops reading and fails with ErrBodyTooLarge once more than max bytes
+// have been read, leaving the body partially consumed. Zero means unlimited.
+func ReadBodyLimit(r *http.Request, max int64) ([]byte, error) {
+	if max <= 0 || r.Body == nil {
+		return ReadBody(r)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, ErrBodyTooLarge
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// HashRequestBody returns the base64 encoded digest of the request body and the number of bytes hashed.
+// If the request has GetBody set, as http.NewRequest does for in-memory bodies, a fresh copy of the body is
+// streamed through the digest and req.Body is left untouched. Otherwise the body is buffered with ReadBody.
+func HashRequestBody(req *http.Request, digest func() hash.Hash) (string, int64, error) {
+	return HashRequestBodyLimit(req, digest, 0)
+}
+
+// HashRequestBodyLimit is like HashRequestBody, but aborts with ErrBodyTooLarge once more than max bytes
+// have been hashed, so that oversized bodies cost neither the CPU to hash nor the memory to buffer them.
+// Zero means unlimited.
+func HashRequestBodyLimit(req *http.Request, digest func() hash.Hash, max int64) (string, int64, error) {
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return "", 0, err
+		}
+		defer body.Close()
+		var r io.Reader = body
+		if max > 0 {
+			r = io.LimitReader(body, max+1)
+		}
+		sum, n, err := hashReader(digest, r)
+		if err == nil && max > 0 && n > max {
+			return "", 0, ErrBodyTooLarge
+		}
+		return sum, n, err
+	}
+	data, err := ReadBodyLimit(req, max)
+	if err != nil {
+		return "", 0, err
+	}
+	return hashReader(digest, bytes.NewReader(data))
+}
+
 func ReadResponseBody(r *http.Response) ([]byte, error) {
 	var data []byte = []byte{}
 	if r.Body != nil {
@@ -54,10 +123,38 @@ func Path(u *url.URL) string {
 	return strings.TrimRight(fmt.Sprintf("/%s", strings.TrimLeft(u.Path, "/")), "/")
 }
 
+// Clock is the source of the current time for signing and verification. Signers and verifiers take one
+// in their Clock field, falling back to the package clock (see Now) if it is nil.
 type Clock interface {
 	Now() time.Time
 }
 
+// ClockFunc adapts a function to Clock.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// OffsetClock runs at a fixed offset from another clock, e.g. corrected for skew observed against a
+// server. A nil Clock means the package clock.
+type OffsetClock struct {
+	Clock  Clock
+	Offset time.Duration
+}
+
+func (o OffsetClock) Now() time.Time {
+	return NowFrom(o.Clock).Add(o.Offset)
+}
+
+// NowFrom returns the current time of c, or of the package clock if c is nil.
+func NowFrom(c Clock) time.Time {
+	if c == nil {
+		return Now()
+	}
+	return c.Now()
+}
+
 type TestClock struct {
 	Timestamp time.Time
 }
@@ -78,12 +175,25 @@ func (t RealClock) Now() time.Time {
 	return time.Now()
 }
 
-var clock Clock = RealClock{}
+var (
+	clockMu sync.RWMutex
+	clock   Clock = RealClock{}
+)
 
 func Now() time.Time {
+	clockMu.RLock()
+	defer clockMu.RUnlock()
 	return clock.Now()
 }
 
 func OverrideClock(timestamp int64) {
+	clockMu.Lock()
+	defer clockMu.Unlock()
 	clock = NewTestClock(timestamp)
 }
+
+func RestoreClock() {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	clock = RealClock{}
+}
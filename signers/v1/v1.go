@@ -17,12 +17,18 @@ import (
 type V1Signer struct {
 	*signers.Digester
 	*signers.Identifiable
+	// If set, called whenever SignDirect signs a request or Check accepts one, to track remaining v1
+	// integrations.
+	OnUse signers.DeprecationHook
 }
 
 func NewV1Signer(digest func() hash.Hash) (*V1Signer, *signers.AuthenticationError) {
+	if err := signers.CheckAlgorithm("The MD5 body hash of v1 signatures"); err != nil {
+		return nil, err
+	}
 	re, err := regexp.Compile("(?i)^\\s*Acquia\\s*[^:]+\\s*:\\s*[0-9a-zA-Z\\+/=]+\\s*$")
 	if err != nil {
-		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not compile regular expression for identifier: %s", err.Error())
+		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not compile regular expression for identifier: %w", err)
 	}
 	return &V1Signer{
 		Digester: &signers.Digester{
@@ -40,6 +46,9 @@ func ParseAuthHeaders(req *http.Request) map[string]string {
 	if len(p1) > 1 {
 		p2 := strings.SplitN(p1[1], ":", 2)
 		ret["id"] = p2[0]
+		if len(p2) > 1 {
+			ret["signature"] = p2[1]
+		}
 	}
 	return ret
 }
@@ -52,7 +61,7 @@ func (v *V1Signer) HashBody(req *http.Request) (string, *signers.AuthenticationE
 	h := md5.New()
 	data, err := signers.ReadBody(req)
 	if err != nil {
-		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %s", err.Error())
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
 	}
 	h.Write(data)
 
@@ -122,6 +131,9 @@ func (v *V1Signer) Check(req *http.Request, secret string) *signers.Authenticati
 	if sig != parts[1] {
 		return signers.Errorf(403, signers.ErrorTypeSignatureMismatch, "Signature does not match expected signature.")
 	}
+	if v.OnUse != nil {
+		v.OnUse(signers.NewDeprecationEvent(req, 1, ParseAuthHeaders(req)["id"], false))
+	}
 	return nil
 }
 
@@ -136,9 +148,18 @@ func (v *V1Signer) SignDirect(req *http.Request, authHeaders map[string]string,
 	}
 
 	req.Header.Set("Authorization", ah)
+	v.ReportSigned(req, authHeaders["id"])
 	return nil
 }
 
+// ReportSigned reports the signing of req with key id to OnUse, if set, e.g. for signatures reused from a
+// cache rather than computed by SignDirect.
+func (v *V1Signer) ReportSigned(req *http.Request, id string) {
+	if v.OnUse != nil {
+		v.OnUse(signers.NewDeprecationEvent(req, 1, id, true))
+	}
+}
+
 func (v *V1Signer) GenerateAuthorization(req *http.Request, authHeaders map[string]string, signature string) (string, *signers.AuthenticationError) {
 	if acc, ok := authHeaders["id"]; !ok {
 		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Missing access key for signature.")
@@ -151,6 +172,12 @@ func (v *V1Signer) GetIdentificationRegex() *regexp.Regexp {
 	return v.IdRegex
 }
 
+// CloneSigner returns a copy of the signer.
+func (v *V1Signer) CloneSigner() signers.Signer {
+	c := *v
+	return &c
+}
+
 func (v *V1Signer) GetResponseSigner() signers.ResponseSigner {
 	return nil
 }
@@ -0,0 +1,93 @@
+package v2
+
+import (
+	"fmt"
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Diagnosis details how a request compares to what Check expects of it.
+type Diagnosis struct {
+	// The parameters of the Authorization header.
+	AuthHeaders map[string]string
+	// The headers included in the signature, with the values they were signed with.
+	SignedHeaders map[string]string
+	// The message that was MACed. Empty if it could not be built.
+	Signable string
+
+	PresentedSignature string
+	// Includes the expected signature, so diagnoses must not be returned to clients.
+	ExpectedSignature string
+	SignatureMatch    bool
+
+	Timestamp time.Time
+	// How far the timestamp is from the current time; positive if it is in the future.
+	TimestampDelta   time.Duration
+	TimestampInRange bool
+
+	PresentedContentHash string
+	ExpectedContentHash  string
+	ContentHashMatch     bool
+
+	// The outcome of Check.
+	Err *signers.AuthenticationError
+}
+
+// Diagnose checks a request like Check, but reports each step of the verification, to shorten debugging
+// integrations with other implementations.
+func (v *V2Signer) Diagnose(req *http.Request, secret string) *Diagnosis {
+	d := &Diagnosis{
+		AuthHeaders:          v.ParseAuthHeaders(req),
+		SignedHeaders:        map[string]string{},
+		PresentedContentHash: req.Header.Get(v.ContentHashHeader()),
+	}
+	d.PresentedSignature = d.AuthHeaders["signature"]
+	for _, name := range v.readCustomHeaders(d.AuthHeaders) {
+		d.SignedHeaders[name] = req.Header.Get(name)
+	}
+	hash, err := v.contentHash(req)
+	if err != nil {
+		d.Err = err
+		return d
+	}
+	d.ExpectedContentHash = hash
+	d.ContentHashMatch = hash == d.PresentedContentHash
+	if ts := req.Header.Get(v.timestampHeader()); ts != "" {
+		if t, err := v.timestamps().Parse(ts); err == nil {
+			d.Timestamp = t
+			d.TimestampDelta = t.Sub(signers.NowFrom(v.Clock))
+			_, verr := v.timestamps().Check(req)
+			d.TimestampInRange = verr == nil
+		}
+	}
+	if v.signable(req, d.AuthHeaders) == nil {
+		d.Signable = string(v.CreateSignable(req, d.AuthHeaders, hash))
+		if sig, err := v.mac(req, d.AuthHeaders, secret, hash); err == nil {
+			d.ExpectedSignature = sig
+			d.SignatureMatch = sig == d.PresentedSignature
+		}
+	}
+	d.Err = v.Check(req, secret)
+	return d
+}
+
+// String formats the diagnosis as a multi-line report.
+func (d *Diagnosis) String() string {
+	var b strings.Builder
+	if d.Err == nil {
+		b.WriteString("Result: valid\n")
+	} else {
+		fmt.Fprintf(&b, "Result: %s: %s\n", signers.GetErrorTypeText(d.Err.ErrorType), d.Err.Message)
+	}
+	fmt.Fprintf(&b, "Key ID: %s, realm: %s, nonce: %s\n", d.AuthHeaders["id"], d.AuthHeaders["realm"], d.AuthHeaders["nonce"])
+	for name, value := range d.SignedHeaders {
+		fmt.Fprintf(&b, "Signed header %s: %s\n", name, value)
+	}
+	fmt.Fprintf(&b, "Timestamp: %s (%s from now, in range: %t)\n", d.Timestamp.UTC().Format(time.RFC3339), d.TimestampDelta, d.TimestampInRange)
+	fmt.Fprintf(&b, "Content hash: presented %q, computed %q (match: %t)\n", d.PresentedContentHash, d.ExpectedContentHash, d.ContentHashMatch)
+	fmt.Fprintf(&b, "Signature: presented %q, computed %q (match: %t)\n", d.PresentedSignature, d.ExpectedSignature, d.SignatureMatch)
+	fmt.Fprintf(&b, "Signable:\n%s\n", d.Signable)
+	return b.String()
+}
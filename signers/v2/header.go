@@ -0,0 +1,232 @@
+package v2
+
+import (
+	"fmt"
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// AuthorizationHeader is the typed form of a v2 Authorization header.
+type AuthorizationHeader struct {
+	ID        string
+	Nonce     string
+	Realm     string
+	Version   string
+	Headers   []string
+	Signature string
+	// Parameters not defined by the specification, kept so that the header survives a round trip.
+	Extra map[string]string
+}
+
+// ParseAuthorization parses the value of an Authorization header of the form
+// acquia-http-hmac id="...",nonce="...",realm="...",signature="...",version="2.0"
+// Values may be quoted, in which case they may contain commas and backslash-escaped quotes, and are
+// percent-decoded except for the signature. Parameters may come in any order.
+func ParseAuthorization(value string) (*AuthorizationHeader, *signers.AuthenticationError) {
+	params, err := parseAuthParams(value)
+	if err != nil {
+		return nil, err
+	}
+	return AuthorizationHeaderFromMap(params), nil
+}
+
+// AuthorizationHeaderFromMap converts authorization headers in the map form used by the signers.
+func AuthorizationHeaderFromMap(authHeaders map[string]string) *AuthorizationHeader {
+	ret := &AuthorizationHeader{
+		Headers: []string{},
+		Extra:   map[string]string{},
+	}
+	for k, v := range authHeaders {
+		switch k {
+		case "id":
+			ret.ID = v
+		case "nonce":
+			ret.Nonce = v
+		case "realm":
+			ret.Realm = v
+		case "version":
+			ret.Version = v
+		case "signature":
+			ret.Signature = v
+		case "headers":
+			if v != "" {
+				ret.Headers = strings.Split(v, ";")
+			}
+		default:
+			ret.Extra[k] = v
+		}
+	}
+	return ret
+}
+
+// ToMap converts the header into the map form used by the signers.
+func (a *AuthorizationHeader) ToMap() map[string]string {
+	ret := map[string]string{}
+	for k, v := range a.Extra {
+		ret[k] = v
+	}
+	ret["id"] = a.ID
+	ret["nonce"] = a.Nonce
+	ret["realm"] = a.Realm
+	if a.Version != "" {
+		ret["version"] = a.Version
+	}
+	if a.Signature != "" {
+		ret["signature"] = a.Signature
+	}
+	if len(a.Headers) > 0 {
+		ret["headers"] = strings.Join(a.Headers, ";")
+	}
+	return ret
+}
+
+// The headers carrying the parameters of a v2 signature individually, for clients behind CDNs and WAFs that
+// mangle the Authorization header. See AuthorizationFromParamHeaders.
+const (
+	IDHeader        = "X-Authorization-Id"
+	NonceHeader     = "X-Authorization-Nonce"
+	RealmHeader     = "X-Authorization-Realm"
+	SignatureHeader = "X-Authorization-Signature"
+	VersionHeader   = "X-Authorization-Version"
+	HeadersHeader   = "X-Authorization-Headers"
+)
+
+// AuthorizationFromParamHeaders assembles the Authorization header of a v2 signature whose parameters were
+// sent in the individual headers above, with plain values: signed headers separated by semicolons, and
+// the version defaulting to 2.0. Returns false if there is no X-Authorization-Signature header.
+func AuthorizationFromParamHeaders(h http.Header) (string, bool) {
+	a := &AuthorizationHeader{
+		ID:        h.Get(IDHeader),
+		Nonce:     h.Get(NonceHeader),
+		Realm:     h.Get(RealmHeader),
+		Version:   h.Get(VersionHeader),
+		Signature: h.Get(SignatureHeader),
+	}
+	if a.Signature == "" {
+		return "", false
+	}
+	if a.Version == "" {
+		a.Version = "2.0"
+	}
+	if hdr := h.Get(HeadersHeader); hdr != "" {
+		a.Headers = strings.Split(hdr, ";")
+	}
+	return a.String(), true
+}
+
+// SetParamHeaders sets the parameters of the header in the individual headers read by
+// AuthorizationFromParamHeaders.
+func (a *AuthorizationHeader) SetParamHeaders(h http.Header) {
+	h.Set(IDHeader, a.ID)
+	h.Set(NonceHeader, a.Nonce)
+	h.Set(RealmHeader, a.Realm)
+	h.Set(SignatureHeader, a.Signature)
+	if a.Version != "" {
+		h.Set(VersionHeader, a.Version)
+	}
+	if len(a.Headers) > 0 {
+		h.Set(HeadersHeader, strings.Join(a.Headers, ";"))
+	}
+}
+
+// String formats the header the same way GenerateAuthorization does.
+func (a *AuthorizationHeader) String() string {
+	return formatAuthorization(a.ToMap())
+}
+
+func formatAuthorization(authHeaders map[string]string) string {
+	return defaultBuilder.BuildMap(authHeaders)
+}
+
+var defaultBuilder = &AuthorizationBuilder{}
+
+// AuthorizationBuilder formats Authorization headers with a deterministic parameter order. The zero value
+// produces the same output as GenerateAuthorization: parameters in alphabetical order, separated by
+// commas, percent-encoded with EscapeProper except for the signature.
+type AuthorizationBuilder struct {
+	// Parameter names emitted first, in this order. Remaining parameters follow alphabetically.
+	Order []string
+	// Percent-encodes parameter values. Defaults to EscapeProper. The signature is never escaped.
+	Escape func(string) string
+	// Placed between parameters. Defaults to ",".
+	Separator string
+}
+
+// NewAuthorizationBuilder returns a builder emitting the given parameters first, in order.
+func NewAuthorizationBuilder(order ...string) *AuthorizationBuilder {
+	return &AuthorizationBuilder{
+		Order: order,
+	}
+}
+
+func (b *AuthorizationBuilder) Build(a *AuthorizationHeader) string {
+	return b.BuildMap(a.ToMap())
+}
+
+func (b *AuthorizationBuilder) BuildMap(authHeaders map[string]string) string {
+	escape := b.Escape
+	if escape == nil {
+		escape = EscapeProper
+	}
+	separator := b.Separator
+	if separator == "" {
+		separator = ","
+	}
+	ordered := []string{}
+	seen := map[string]bool{}
+	for _, k := range b.Order {
+		if _, ok := authHeaders[k]; ok && !seen[k] {
+			ordered = append(ordered, k)
+			seen[k] = true
+		}
+	}
+	rest := []string{}
+	for k := range authHeaders {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	ordered = append(ordered, rest...)
+
+	args := make([]string, 0, len(ordered))
+	for _, k := range ordered {
+		v := authHeaders[k]
+		if k != "signature" { // hack
+			v = escape(v)
+		}
+		args = append(args, fmt.Sprintf("%s=\"%s\"", k, v))
+	}
+	return fmt.Sprintf("acquia-http-hmac %s", strings.Join(args, separator))
+}
+
+func parseAuthParams(value string) (map[string]string, *signers.AuthenticationError) {
+	value = strings.TrimLeft(value, " \t\n\r")
+	i := strings.IndexAny(value, " \t\n\r")
+	if i < 0 || !strings.EqualFold(value[:i], "acquia-http-hmac") {
+		return nil, signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Authorization header is not of the acquia-http-hmac scheme.")
+	}
+	ret := map[string]string{}
+	sc := signers.NewAuthParamScanner(value[i:])
+	for sc.Next() {
+		k, v := sc.Name(), sc.Value()
+		if k != "signature" {
+			unescaped, err := url.QueryUnescape(v)
+			if err != nil {
+				return nil, signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Invalid percent-encoding in authorization parameter %s: %w", k, err)
+			}
+			v = unescaped
+		}
+		if _, dup := ret[k]; dup {
+			return nil, signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Duplicate authorization parameter %s.", k)
+		}
+		ret[k] = v
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
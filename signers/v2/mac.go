@@ -0,0 +1,45 @@
+package v2
+
+import (
+	"encoding/base64"
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+)
+
+func (v *V2Signer) macer() signers.MACer {
+	if v.MACer != nil {
+		return v.MACer
+	}
+	if v.Backend != nil {
+		return signers.BackendMACer(v.Backend)
+	}
+	return &signers.HMAC{
+		Digest: v.Digest,
+		Wipe:   v.WipeSecrets,
+	}
+}
+
+func (v *V2Signer) mac(req *http.Request, authHeaders map[string]string, key string, bodyhash string) (string, *signers.AuthenticationError) {
+	mac, err := v.macer().MAC(req.Context(), key, v.CreateSignable(req, authHeaders, bodyhash))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(mac), nil
+}
+
+// Verifies signatures through the MACer, so that a backend never has to reveal the expected MAC.
+func (v *V2Signer) macVerifier(req *http.Request, key string) signatureVerifier {
+	return func(authHeaders map[string]string, bodyhash string, got string) *signers.AuthenticationError {
+		if err := v.signable(req, authHeaders); err != nil {
+			return err
+		}
+		if got == "" {
+			return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signature missing from authorization header.")
+		}
+		mac, err := base64.StdEncoding.DecodeString(got)
+		if err != nil {
+			return signers.Errorf(403, signers.ErrorTypeSignatureMismatch, "Signature does not match expected signature.")
+		}
+		return v.macer().VerifyMAC(req.Context(), key, v.CreateSignable(req, authHeaders, bodyhash), mac)
+	}
+}
@@ -0,0 +1,23 @@
+package v2
+
+import (
+	"crypto/sha256"
+	"github.com/acquia/http-hmac-go/signers"
+	"io"
+)
+
+// SignString signs a canonical message with the conventions of the v2 specification: HMAC-SHA256 keyed
+// with the base64 decoded secret, encoded as base64. Message queue consumers and custom protocols can use
+// it to share keys and signatures with HTTP services without building requests.
+func SignString(secret string, message string) (string, *signers.AuthenticationError) {
+	key, err := signers.Base64Secret(secret)
+	if err != nil {
+		return "", err
+	}
+	return signers.SignString(sha256.New, key.Bytes(), message), nil
+}
+
+// HashBody returns the base64 encoded SHA-256 digest of a payload, as sent in X-Authorization-Content-SHA256.
+func HashBody(r io.Reader) (string, error) {
+	return signers.HashBody(sha256.New, r)
+}
@@ -0,0 +1,83 @@
+package v2
+
+import (
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+	"strings"
+)
+
+// Profile sets how strictly requests are verified beyond their signature. The zero value is Compatible.
+type Profile struct {
+	// Require the content hash header on POST, PUT and PATCH requests without a body, with the hash of the
+	// empty body. The specification omits it, so signers with this profile send it.
+	RequireEmptyContentHash bool
+	// Reject requests with a body but no Content-Type header, rather than signing the type as empty.
+	RequireContentType bool
+	// Reject requests bearing X-Authorization-* headers that are neither part of the protocol nor listed in
+	// the headers parameter, which the signature does not cover.
+	RejectUnsignedHeaders bool
+}
+
+var (
+	// Compatible accepts every request the specification allows, as earlier versions did.
+	Compatible = Profile{}
+	// Strict requires the content hash of bodyless POST, PUT and PATCH requests and the Content-Type of
+	// requests with a body, and rejects unsigned X-Authorization-* headers.
+	Strict = Profile{
+		RequireEmptyContentHash: true,
+		RequireContentType:      true,
+		RejectUnsignedHeaders:   true,
+	}
+)
+
+// The X-Authorization-* headers of the protocol, besides the content hash, which need not be listed in the
+// headers parameter.
+var protocolHeaders = map[string]bool{
+	"X-Authorization-Timestamp": true,
+	IDHeader:                    true,
+	NonceHeader:                 true,
+	RealmHeader:                 true,
+	SignatureHeader:             true,
+	VersionHeader:               true,
+	HeadersHeader:               true,
+}
+
+// Whether the profile requires the content hash of the request even without a body.
+func (p Profile) requiresContentHash(req *http.Request) bool {
+	if !p.RequireEmptyContentHash {
+		return false
+	}
+	switch strings.ToUpper(req.Method) {
+	case "POST", "PUT", "PATCH":
+		return true
+	}
+	return false
+}
+
+// Rejects the requests the profile of the signer forbids that can be told apart before the body is read.
+func (v *V2Signer) checkProfile(req *http.Request, authHeaders map[string]string) *signers.AuthenticationError {
+	p := v.Profile
+	hash := req.Header.Get(v.ContentHashHeader())
+	hasBody := req.ContentLength > 0 || (hash != "" && hash != v.HashBytes(nil))
+	if p.RequireContentType && hasBody && req.Header.Get("Content-Type") == "" {
+		return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header Content-Type.")
+	}
+	if req.ContentLength == 0 && p.requiresContentHash(req) && hash == "" {
+		return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header %s.", v.ContentHashHeader())
+	}
+	if !p.RejectUnsignedHeaders {
+		return nil
+	}
+	signed := map[string]bool{}
+	for _, name := range strings.Split(authHeaders["headers"], ";") {
+		signed[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+	}
+	signed[http.CanonicalHeaderKey(v.timestampHeader())] = true
+	for name := range req.Header {
+		name = http.CanonicalHeaderKey(name)
+		if strings.HasPrefix(name, "X-Authorization-") && !strings.HasPrefix(name, "X-Authorization-Content-") && !protocolHeaders[name] && !signed[name] {
+			return signers.Errorf(403, signers.ErrorTypeInvalidRequiredHeader, "Header %s is not covered by the signature.", name)
+		}
+	}
+	return nil
+}
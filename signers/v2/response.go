@@ -2,15 +2,29 @@ package v2
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
 	"github.com/acquia/http-hmac-go/signers"
 	"hash"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type V2ResponseSigner struct {
 	*signers.Digester
+	// The request signer, whose authorization header the request's nonce is read from. Nil means the
+	// Authorization header.
+	signer *V2Signer
+	// If set, signatures also cover the status code and the Headers of the response, so that the status of
+	// a signed body cannot be altered. The specification signs the body only: both ends must enable it.
+	Extended bool
+	// The response headers covered by extended signatures, e.g. Content-Type or Location. Headers absent
+	// from the response are signed as empty.
+	Headers []string
 }
 
 func NewV2ResponseSigner(digest func() hash.Hash) *V2ResponseSigner {
@@ -22,35 +36,152 @@ func NewV2ResponseSigner(digest func() hash.Hash) *V2ResponseSigner {
 }
 
 func (v *V2ResponseSigner) CreateSignable(req *http.Request, authHeaders map[string]string, rw *signers.SignableResponseWriter) []byte {
+	return v.signable(authHeaders["nonce"], req.Header.Get(v.timestampHeader()), rw)
+}
+
+func (v *V2ResponseSigner) signable(nonce string, timestamp string, rw *signers.SignableResponseWriter) []byte {
+	b := bytes.NewBuffer(v.prefix(nonce, timestamp, rw))
+	b.Write(rw.Body.Bytes())
+	return b.Bytes()
+}
+
+// Returns the signable string of a response up to its body.
+func (v *V2ResponseSigner) prefix(nonce string, timestamp string, rw *signers.SignableResponseWriter) []byte {
 	var b bytes.Buffer
-	b.WriteString(authHeaders["nonce"])
+	b.WriteString(nonce)
 	b.WriteString("\n")
-	b.WriteString(req.Header.Get("X-Authorization-Timestamp"))
+	b.WriteString(timestamp)
 	b.WriteString("\n")
-	b.WriteString(rw.Body.String())
+	if v.Extended {
+		// The status code, then the lowercase names and comma separated values of the headers, sorted.
+		status := rw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		b.WriteString(strconv.Itoa(status))
+		b.WriteString("\n")
+		names := make([]string, len(v.Headers))
+		for i, name := range v.Headers {
+			names[i] = signers.NormalizedHeaderName(name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b.WriteString(name)
+			b.WriteString(":")
+			b.WriteString(strings.Join(rw.Header().Values(name), ","))
+			b.WriteString("\n")
+		}
+	}
 	return b.Bytes()
 }
 
-func (v *V2ResponseSigner) SignResponse(req *http.Request, rw *signers.SignableResponseWriter, secret string) (string, *signers.AuthenticationError) {
+// Returns the nonce and timestamp of the request a response is signed for.
+func (v *V2ResponseSigner) requestParams(req *http.Request) (string, string, *signers.AuthenticationError) {
 	authHeaders := ParseAuthHeaders(req)
+	if v.signer != nil {
+		authHeaders = v.signer.ParseAuthHeaders(req)
+	}
 	if _, ok := authHeaders["nonce"]; !ok {
-		return "", signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Nonce must be present in authentication headers.")
+		return "", "", signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Nonce must be present in authentication headers.")
+	}
+	timestamp := req.Header.Get(v.timestampHeader())
+	if timestamp == "" {
+		return "", "", signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Authorization timestamp for request is required.")
 	}
-	if req.Header.Get("X-Authorization-Timestamp") == "" {
-		return "", signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Authorization timestamp for request is required.")
+	return authHeaders["nonce"], timestamp, nil
+}
+
+// Returns the timestamp header of the request signer.
+func (v *V2ResponseSigner) timestampHeader() string {
+	if v.signer != nil {
+		return v.signer.timestampHeader()
 	}
-	decoded, err := base64.StdEncoding.DecodeString(secret)
+	return signers.DefaultTimestampValidator.HeaderName()
+}
+
+// SignResponse signs the response written to rw. The signature of a streaming writer (see StartResponse) is
+// that of what it wrote so far.
+func (v *V2ResponseSigner) SignResponse(req *http.Request, rw *signers.SignableResponseWriter, secret string) (string, *signers.AuthenticationError) {
+	if mac, err := rw.MAC(); mac != nil || err != nil {
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+	}
+	nonce, timestamp, err := v.requestParams(req)
 	if err != nil {
-		return "", signers.Errorf(403, signers.ErrorTypeOutdatedKeypair, "The provided secret key is not in a valid base64 format: %s", err.Error())
+		return "", err
 	}
-	h := hmac.New(v.Digest, decoded)
-	b := v.CreateSignable(req, authHeaders, rw)
-	h.Write(b)
-	hsm := h.Sum(nil)
-	return base64.StdEncoding.EncodeToString(hsm), nil
+	return v.sign(req.Context(), nonce, timestamp, rw, secret)
+}
+
+// StartResponse implements signers.StreamingResponseSigner: it returns a MAC fed with the signable string of
+// the response up to its body, for a streaming writer to hash the body into.
+func (v *V2ResponseSigner) StartResponse(req *http.Request, rw *signers.SignableResponseWriter, secret string) (hash.Hash, *signers.AuthenticationError) {
+	nonce, timestamp, err := v.requestParams(req)
+	if err != nil {
+		return nil, err
+	}
+	return v.start(nonce, timestamp, rw, secret)
+}
+
+// Returns the MACer of the request signer, so that responses are signed with the same keys and backend as
+// requests.
+func (v *V2ResponseSigner) macer() signers.MACer {
+	if v.signer != nil {
+		return v.signer.macer()
+	}
+	return &signers.HMAC{
+		Digest: v.Digest,
+	}
+}
+
+// Streams reports whether responses can be signed while they are streamed, which takes a local HMAC: MACers
+// such as backends sign whole messages only.
+func (v *V2ResponseSigner) Streams() bool {
+	_, ok := v.macer().(*signers.HMAC)
+	return ok
+}
+
+func (v *V2ResponseSigner) start(nonce string, timestamp string, rw *signers.SignableResponseWriter, secret string) (hash.Hash, *signers.AuthenticationError) {
+	local, ok := v.macer().(*signers.HMAC)
+	if !ok {
+		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Responses cannot be streamed with a MACer other than HMAC.")
+	}
+	mac, serr := local.New(secret)
+	if serr != nil {
+		return nil, serr
+	}
+	mac.Write(v.prefix(nonce, timestamp, rw))
+	return mac, nil
+}
+
+func (v *V2ResponseSigner) sign(ctx context.Context, nonce string, timestamp string, rw *signers.SignableResponseWriter, secret string) (string, *signers.AuthenticationError) {
+	if v.Streams() {
+		mac, serr := v.start(nonce, timestamp, rw, secret)
+		if serr != nil {
+			return "", serr
+		}
+		// The buffered body is hashed in place rather than copied into the signable string.
+		mac.Write(rw.Body.Bytes())
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+	}
+	mac, serr := v.macer().MAC(ctx, secret, v.signable(nonce, timestamp, rw))
+	if serr != nil {
+		return "", serr
+	}
+	return base64.StdEncoding.EncodeToString(mac), nil
 }
 
 func (v *V2ResponseSigner) SignResponseDirect(req *http.Request, rw *signers.SignableResponseWriter, secret string) *signers.AuthenticationError {
+	if v.Extended && rw.Header().Get("Content-Type") == "" && rw.Body.Len() > 0 {
+		// Signed as net/http would sniff it once the response is written.
+		for _, name := range v.Headers {
+			if http.CanonicalHeaderKey(name) == "Content-Type" {
+				rw.Header().Set("Content-Type", http.DetectContentType(rw.Body.Bytes()))
+			}
+		}
+	}
 	rsig, err := v.SignResponse(req, rw, secret)
 	if err != nil {
 		return err
@@ -60,25 +191,64 @@ func (v *V2ResponseSigner) SignResponseDirect(req *http.Request, rw *signers.Sig
 }
 
 func (v *V2ResponseSigner) Check(req *http.Request, resp *http.Response, secret string) *signers.AuthenticationError {
-	got := resp.Header.Get("X-Server-Authorization-HMAC-SHA256")
-	if got == "" {
-		return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signature missing from response.")
+	return v.check(resp, func(srw *signers.SignableResponseWriter) (string, *signers.AuthenticationError) {
+		return v.SignResponse(req, srw, secret)
+	})
+}
+
+// CheckBound checks the signature of a response against the nonce and timestamp its request was signed
+// with, rather than those read back from the request, which the transport may have altered.
+func (v *V2ResponseSigner) CheckBound(nonce string, timestamp string, resp *http.Response, secret string) *signers.AuthenticationError {
+	if nonce == "" || timestamp == "" {
+		return signers.Errorf(500, signers.ErrorTypeInternalError, "Nonce and timestamp of the request are required to check its response.")
 	}
+	return v.check(resp, func(srw *signers.SignableResponseWriter) (string, *signers.AuthenticationError) {
+		ctx := context.Background()
+		if resp.Request != nil {
+			ctx = resp.Request.Context()
+		}
+		return v.sign(ctx, nonce, timestamp, srw, secret)
+	})
+}
+
+func (v *V2ResponseSigner) check(resp *http.Response, sign func(*signers.SignableResponseWriter) (string, *signers.AuthenticationError)) *signers.AuthenticationError {
 	rb, err := signers.ReadResponseBody(resp)
 	if err != nil {
-		return signers.Errorf(500, signers.ErrorTypeUnknown, "Cannot read response body: "+err.Error())
+		return signers.Errorf(500, signers.ErrorTypeUnknown, "Cannot read response body: %w", err)
 	}
-	srw := signers.NewDummySignableResponseWriter(rb)
-	sig, serr := v.SignResponse(req, srw, secret)
+	// Read after the body, as signatures sent in a trailer are only known once it is exhausted.
+	got := resp.Header.Get("X-Server-Authorization-HMAC-SHA256")
+	if got == "" {
+		got = resp.Trailer.Get("X-Server-Authorization-HMAC-SHA256")
+	}
+	if got == "" {
+		return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signature missing from response.")
+	}
+	srw := signers.NewSignableResponse(resp, rb)
+	sig, serr := sign(srw)
 	if serr != nil {
 		return serr
 	}
-	if sig != got {
+	if !hmac.Equal([]byte(sig), []byte(got)) {
 		return signers.Errorf(403, signers.ErrorTypeSignatureMismatch, "Signature does not match expected signature.")
 	}
 	return nil
 }
 
+// VerifyResponse checks the X-Server-Authorization-HMAC-SHA256 signature of a response to a v2 request, in
+// its headers or trailers, against the nonce and timestamp of the request and the base64 encoded secret.
+// If req is nil, the request of the response is used, as set by http.Client. The body is read and
+// replaced, so the response can still be consumed afterwards.
+func VerifyResponse(req *http.Request, resp *http.Response, secret string) *signers.AuthenticationError {
+	if req == nil {
+		req = resp.Request
+	}
+	if req == nil {
+		return signers.Errorf(500, signers.ErrorTypeInternalError, "The request of the response is required to check its signature.")
+	}
+	return NewV2ResponseSigner(sha256.New).Check(req, resp, secret)
+}
+
 func (v *V2ResponseSigner) SetTrailer(rw http.ResponseWriter) {
 	rw.Header().Add("Trailer", "X-Server-Authorization-HMAC-SHA256")
 }
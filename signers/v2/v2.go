@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"github.com/acquia/http-hmac-go/nonce"
 	"github.com/acquia/http-hmac-go/signers"
 	"hash"
 	"net/http"
@@ -20,6 +21,108 @@ type V2Signer struct {
 	*signers.Digester
 	*signers.Identifiable
 	respSigner *V2ResponseSigner
+	// Validates X-Authorization-Timestamp during Check. Defaults to signers.DefaultTimestampValidator, or a
+	// validator on Clock if set. Its Header, if set, replaces X-Authorization-Timestamp when signing too.
+	Timestamps *signers.TimestampValidator
+	// Source of the timestamps of signatures. Defaults to the package clock.
+	Clock signers.Clock
+	// If set, called with every signable string built while signing or checking, for debugging. The
+	// message reveals nothing about the secret, but does contain header values.
+	OnSignable func(req *http.Request, signable []byte)
+	// Builds the signable string. Defaults to SpecCanonicalizer, which follows the specification. Both ends
+	// must use the same canonicalization.
+	Canonicalizer signers.Canonicalizer
+	// What SignDirect does with requests that are already signed. Defaults to ReplaceExistingSignature.
+	OnExisting signers.ExistingSignaturePolicy
+	// Overwrite the key material decoded from string secrets once a signature is computed. Secrets passed
+	// to SignSecret and CheckSecret belong to the caller and are left alone.
+	WipeSecrets bool
+	// Computes and verifies MACs on the signable string. Defaults to HMAC with the Digest, keyed with the
+	// base64 decoded secret.
+	MACer signers.MACer
+	// If set and MACer is not, MACs are computed and verified by the backend, and the secret passed to Sign
+	// and Check is the backend's reference to the key, e.g. a KMS key ARN, rather than key material.
+	Backend signers.SignerBackend
+	// If positive, Check rejects requests whose body exceeds this many bytes with 413, aborting the hash
+	// as soon as the limit is crossed.
+	MaxBodyBytes int64
+	// Header carrying the signature, e.g. X-Acquia-Authorization where intermediaries consume or strip
+	// the Authorization header. Defaults to Authorization.
+	AuthorizationHeader string
+	// If set, headers listed in the headers parameter but absent from the request are signed as empty
+	// values, as older versions did, rather than failing with ErrorTypeMissingSignedHeader.
+	AllowMissingSignedHeaders bool
+	// If set, the realm parameter may be omitted, for deployments without realms. A missing realm is signed
+	// as an empty one, "realm=" in the normalized parameters, and an empty realm is left out of generated
+	// Authorization headers.
+	OptionalRealm bool
+	// How strictly requests are verified beyond their signature. Defaults to Compatible.
+	Profile Profile
+	// The digest of the content hash and the header carrying it, set by NewV2Signer for digests other than
+	// SHA-256. Empty for X-Authorization-Content-SHA256.
+	contentDigest func() hash.Hash
+	contentHeader string
+}
+
+func (v *V2Signer) authorizationHeader() string {
+	if v.AuthorizationHeader == "" {
+		return "Authorization"
+	}
+	return v.AuthorizationHeader
+}
+
+// AuthorizationHeaderName returns the header carrying the signature, AuthorizationHeader or Authorization.
+func (v *V2Signer) AuthorizationHeaderName() string {
+	return v.authorizationHeader()
+}
+
+// ContentHashHeader returns the header carrying the hash of the body: X-Authorization-Content-SHA256 as in
+// the specification, or X-Authorization-Content-SHA512 and so on for signers created with another known
+// digest, which also hash the body with it.
+func (v *V2Signer) ContentHashHeader() string {
+	if v.contentHeader == "" {
+		return "X-Authorization-Content-SHA256"
+	}
+	return v.contentHeader
+}
+
+func (v *V2Signer) bodyDigest() func() hash.Hash {
+	if v.contentDigest == nil {
+		return sha256.New
+	}
+	return v.contentDigest
+}
+
+// Rejects content hash headers other than that of the digest, e.g. X-Authorization-Content-SHA256 sent to
+// a SHA-512 signer, which would otherwise be ignored and leave the body unverified.
+func (v *V2Signer) checkContentHashHeaders(req *http.Request) *signers.AuthenticationError {
+	expected := http.CanonicalHeaderKey(v.ContentHashHeader())
+	for name := range req.Header {
+		if name = http.CanonicalHeaderKey(name); strings.HasPrefix(name, "X-Authorization-Content-") && name != expected {
+			return signers.Errorf(403, signers.ErrorTypeInvalidRequiredHeader, "Unexpected header %s: the content hash of this signature is sent in %s.", name, v.ContentHashHeader())
+		}
+	}
+	return nil
+}
+
+func (v *V2Signer) timestamps() *signers.TimestampValidator {
+	if v.Timestamps == nil {
+		if v.Clock != nil {
+			return &signers.TimestampValidator{Clock: v.Clock}
+		}
+		return signers.DefaultTimestampValidator
+	}
+	return v.Timestamps
+}
+
+// TimestampValidator returns the validator of the timestamps of signatures, Timestamps or its default.
+func (v *V2Signer) TimestampValidator() *signers.TimestampValidator {
+	return v.timestamps()
+}
+
+// Returns the name of the header carrying the timestamp of the signature.
+func (v *V2Signer) timestampHeader() string {
+	return v.timestamps().HeaderName()
 }
 
 func EscapeProper(s string) string {
@@ -27,74 +130,145 @@ func EscapeProper(s string) string {
 }
 
 func ParseAuthHeaders(req *http.Request) map[string]string {
-	auth := req.Header.Get("Authorization")
-	ret := map[string]string{}
-	if len(auth) == 0 {
-		return ret
-	}
-	s1 := strings.SplitN(auth, " ", 2)
-	s2 := strings.Split(s1[1], ",")
-	for len(s2) > 0 {
-		var vardef string
-		vardef, s2 = strings.TrimLeft(s2[0], " \t\n"), s2[1:]
-		for !strings.HasSuffix(strings.TrimRight(vardef, " \t\n"), "\"") {
-			if len(s2) > 0 {
-				vardef, s2 = fmt.Sprintf("%s,%s", vardef, s2[0]), s2[1:]
-			} else {
-				return map[string]string{}
-			}
-		}
-		vardef = strings.TrimRight(vardef, " \t\n")
-		parts := strings.SplitN(vardef, "=", 2)
-		k := strings.Trim(parts[0], " \t\n")
-		qu := strings.Trim(parts[1], " \t\n\"")
-		if k != "signature" { // hack
-			qu, _ = url.QueryUnescape(qu)
-		}
-		ret[k] = qu
+	return parseAuthorization(req.Header.Get("Authorization"))
+}
+
+// Parses the parameters of an Authorization header as ParseAuthorization does, so that the signer accepts
+// no header ParseAuthorization rejects. Returns an empty map if the header is malformed.
+func parseAuthorization(auth string) map[string]string {
+	params, err := parseAuthParams(auth)
+	if err != nil {
+		return map[string]string{}
 	}
-	return ret
+	return params
 }
 
 func (v *V2Signer) ParseAuthHeaders(req *http.Request) map[string]string {
-	return ParseAuthHeaders(req)
+	return parseAuthorization(req.Header.Get(v.authorizationHeader()))
 }
 
+// Matches v2 Authorization headers. MatchAuthorization implements it without the regular expression.
+var identificationRegex = regexp.MustCompile("(?i)^\\s*acquia-http-hmac.*?version=\"2\\.0\".*?$")
+
 func NewV2Signer(digest func() hash.Hash) (*V2Signer, *signers.AuthenticationError) {
-	re, err := regexp.Compile("(?i)^\\s*acquia-http-hmac.*?version=\"2\\.0\".*?$")
-	if err != nil {
-		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not compile regular expression for identifier: %s", err.Error())
+	if err := signers.CheckDigest(digest); err != nil {
+		return nil, err
 	}
-	return &V2Signer{
+	ret := &V2Signer{
 		Digester: &signers.Digester{
 			Digest: digest,
 		},
 		Identifiable: &signers.Identifiable{
-			IdRegex: re,
+			IdRegex: identificationRegex,
 		},
 		respSigner: NewV2ResponseSigner(digest),
-	}, nil
+	}
+	if name := signers.DigestName(digest); name != "" && name != "sha256" {
+		ret.contentDigest = digest
+		ret.contentHeader = "X-Authorization-Content-" + strings.ToUpper(name)
+	}
+	ret.respSigner.signer = ret
+	return ret, nil
 }
 
-func (v *V2Signer) stringAuthHeaders(authHeaders map[string]string) string {
+func stringAuthHeaders(authHeaders map[string]string) string {
 	return fmt.Sprintf("id=%s&nonce=%s&realm=%s&version=2.0", EscapeProper(authHeaders["id"]), EscapeProper(authHeaders["nonce"]), EscapeProper(authHeaders["realm"]))
 }
 
 func (v *V2Signer) HashBody(req *http.Request) (string, *signers.AuthenticationError) {
-	data, err := signers.ReadBody(req)
+	sum, _, err := signers.HashRequestBody(req, v.bodyDigest())
 	if err != nil {
-		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %s", err.Error())
+		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
 	}
-	return v.HashBytes(data), nil
+	return sum, nil
+}
+
+func bodyError(err error, max int64) *signers.AuthenticationError {
+	if err == signers.ErrBodyTooLarge {
+		return signers.Errorf(413, signers.ErrorTypeBodyTooLarge, "Request body exceeds %d bytes.", max)
+	}
+	return signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %w", err)
+}
+
+// Like HashBody, but returns an empty string if the request has no body.
+func (v *V2Signer) contentHash(req *http.Request) (string, *signers.AuthenticationError) {
+	sum, n, err := signers.HashRequestBodyLimit(req, v.bodyDigest(), v.MaxBodyBytes)
+	if err != nil {
+		return "", bodyError(err, v.MaxBodyBytes)
+	}
+	if n == 0 {
+		return "", nil
+	}
+	return sum, nil
 }
 
 func (v *V2Signer) HashBytes(b []byte) string {
-	h := sha256.New()
+	h := v.bodyDigest()()
 	h.Write(b)
 	return base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
 
 func (v *V2Signer) CreateSignable(req *http.Request, authHeaders map[string]string, bodyhash string) []byte {
+	ret := v.canonicalizer().Canonicalize(req, authHeaders, bodyhash)
+	signers.Logf("Signable:\n%s", string(ret))
+	if v.OnSignable != nil {
+		v.OnSignable(req, ret)
+	}
+	return ret
+}
+
+// SignableString returns the exact message that is MACed for a signed request, as found in its
+// Authorization, X-Authorization-Timestamp and X-Authorization-Content-SHA256 headers, for comparing
+// against the message built by another implementation when chasing signature mismatches. The body hash
+// is computed from the body, as Check does.
+func (v *V2Signer) SignableString(req *http.Request) (string, *signers.AuthenticationError) {
+	authHeaders := v.ParseAuthHeaders(req)
+	if err := v.signable(req, authHeaders); err != nil {
+		return "", err
+	}
+	bodyhash, err := v.contentHash(req)
+	if err != nil {
+		return "", err
+	}
+	return string(v.canonicalizer().Canonicalize(req, authHeaders, bodyhash)), nil
+}
+
+// Returns the Canonicalizer, defaulting to the specification's, reading the timestamp from the header of the
+// signer unless set otherwise.
+func (v *V2Signer) canonicalizer() signers.Canonicalizer {
+	switch c := v.Canonicalizer.(type) {
+	case nil:
+		return SpecCanonicalizer{TimestampHeader: v.timestampHeader()}
+	case SpecCanonicalizer:
+		if c.TimestampHeader == "" {
+			c.TimestampHeader = v.timestampHeader()
+		}
+		return c
+	default:
+		return c
+	}
+}
+
+// SpecCanonicalizer builds the signable string defined by the v2 specification.
+type SpecCanonicalizer struct {
+	// Applied to the query string. The zero value follows the specification.
+	Query signers.QueryNormalization
+	// Applied to the path. The zero value follows the specification.
+	Path signers.PathNormalization
+	// Applied to the host. The zero value signs the host as sent.
+	Host signers.HostNormalization
+	// Name of the header carrying the timestamp. Defaults to that of the Timestamps of the signer.
+	TimestampHeader string
+}
+
+func (c SpecCanonicalizer) timestampHeader() string {
+	if c.TimestampHeader == "" {
+		return signers.DefaultTimestampValidator.HeaderName()
+	}
+	return c.TimestampHeader
+}
+
+func (c SpecCanonicalizer) Canonicalize(req *http.Request, authHeaders map[string]string, bodyhash string) []byte {
 	var b bytes.Buffer
 
 	// The uppercase HTTP request method e.g. "GET", "POST".
@@ -104,23 +278,23 @@ func (v *V2Signer) CreateSignable(req *http.Request, authHeaders map[string]stri
 
 	// The (lowercase) hostname, matching the HTTP "Host" request header field
 	// (including any port number).
-	b.WriteString(req.Host)
+	b.WriteString(c.Host.Normalize(req.Host))
 	b.WriteString("\n")
 
 	// The HTTP request path with leading slash, e.g. /resource/11
-	b.WriteString(signers.Path(req.URL))
+	b.WriteString(c.Path.Normalize(req.URL))
 	b.WriteString("\n")
 
 	// Any query parameters or empty string. This should be the exact string sent
 	// by the client, including urlencoding.
-	b.WriteString(req.URL.RawQuery)
+	b.WriteString(c.Query.Normalize(req.URL.RawQuery))
 	b.WriteString("\n")
 
 	// normalized parameters similar to section 9.1.1 of OAuth 1.0a. The
 	// parameters are the id, nonce, realm, and version from the Authorization
 	// header. Parameters are sorted by name and separated by '&' with name and
 	// value separated by =, percent encoded (urlencoded).
-	b.WriteString(v.stringAuthHeaders(authHeaders))
+	b.WriteString(stringAuthHeaders(authHeaders))
 	b.WriteString("\n")
 
 	if hdr, ok := authHeaders["headers"]; ok {
@@ -137,7 +311,7 @@ func (v *V2Signer) CreateSignable(req *http.Request, authHeaders map[string]stri
 	}
 
 	// The value of the X-Authorization-Timestamp header.
-	b.WriteString(req.Header.Get("X-Authorization-Timestamp"))
+	b.WriteString(req.Header.Get(c.timestampHeader()))
 
 	if bodyhash != "" && req.ContentLength > 0 {
 		b.WriteString("\n")
@@ -151,10 +325,7 @@ func (v *V2Signer) CreateSignable(req *http.Request, authHeaders map[string]stri
 		// as the X-Authorization-Content-SHA256 header.
 		b.WriteString(bodyhash)
 	}
-
-	ret := b.Bytes()
-	signers.Logf("Signable:\n%s", string(ret))
-	return ret
+	return b.Bytes()
 }
 
 func (v *V2Signer) ahKeyCheck(authHeaders map[string]string, key string) *signers.AuthenticationError {
@@ -180,87 +351,253 @@ func (v *V2Signer) readCustomHeaders(authHeaders map[string]string) []string {
 	return []string{}
 }
 
-func (v *V2Signer) Sign(req *http.Request, authHeaders map[string]string, secret string) (string, *signers.AuthenticationError) {
-	if err := v.ahKeyCheckBulk(authHeaders, []string{"id", "nonce", "realm"}); err != nil {
-		return "", err
+// Fails if the request lacks what is needed for signing.
+func (v *V2Signer) signable(req *http.Request, authHeaders map[string]string) *signers.AuthenticationError {
+	required := []string{"id", "nonce", "realm"}
+	if v.OptionalRealm {
+		required = required[:2]
 	}
-	if req.Header.Get("X-Authorization-Timestamp") == "" {
-		return "", signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header X-Authorization-Timestamp.")
+	if err := v.ahKeyCheckBulk(authHeaders, required); err != nil {
+		return err
 	}
-	var bodyhash string = ""
-	body, err := signers.ReadBody(req)
-	if err != nil {
-		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %s", err.Error())
+	if req.Header.Get(v.timestampHeader()) == "" {
+		return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header %s.", v.timestampHeader())
 	}
-	if len(body) > 0 {
-		bodyhash = v.HashBytes(body)
+	return v.signedHeadersPresent(req, authHeaders)
+}
+
+// Fails if a header listed in the headers parameter is absent from the request, unless
+// AllowMissingSignedHeaders is set.
+func (v *V2Signer) signedHeadersPresent(req *http.Request, authHeaders map[string]string) *signers.AuthenticationError {
+	if v.AllowMissingSignedHeaders {
+		return nil
+	}
+	for _, name := range v.readCustomHeaders(authHeaders) {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := req.Header[http.CanonicalHeaderKey(name)]; !ok {
+			return signers.Errorf(403, signers.ErrorTypeMissingSignedHeader, "Signed header %s is missing from the request.", name)
+		}
 	}
+	return nil
+}
 
-	decoded, err := base64.StdEncoding.DecodeString(secret)
-	if err != nil {
-		return "", signers.Errorf(403, signers.ErrorTypeOutdatedKeypair, "The provided secret key is not in a valid base64 format: %s", err.Error())
+func (v *V2Signer) Sign(req *http.Request, authHeaders map[string]string, secret string) (string, *signers.AuthenticationError) {
+	if err := v.signable(req, authHeaders); err != nil {
+		return "", err
+	}
+	bodyhash, serr := v.contentHash(req)
+	if serr != nil {
+		return "", serr
+	}
+	return v.mac(req, authHeaders, secret, bodyhash)
+}
+
+// SignSecret is like Sign, with key material that is already decoded.
+func (v *V2Signer) SignSecret(req *http.Request, authHeaders map[string]string, secret signers.Secret) (string, *signers.AuthenticationError) {
+	if err := v.signable(req, authHeaders); err != nil {
+		return "", err
+	}
+	bodyhash, serr := v.contentHash(req)
+	if serr != nil {
+		return "", serr
 	}
-	h := hmac.New(v.Digest, decoded)
 	b := v.CreateSignable(req, authHeaders, bodyhash)
-	h.Write(b)
-	hsm := h.Sum(nil)
-	return base64.StdEncoding.EncodeToString(hsm), nil
+	return signers.SignString(v.Digest, secret.Bytes(), string(b)), nil
 }
 
 func (v *V2Signer) Check(req *http.Request, secret string) *signers.AuthenticationError {
-	authHeaders := ParseAuthHeaders(req)
-	if req.Header.Get("X-Authorization-Timestamp") == "" {
-		return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header X-Authorization-Timestamp.")
+	return v.check(req, v.macVerifier(req, secret))
+}
+
+// CheckSecret is like Check, with key material that is already decoded.
+func (v *V2Signer) CheckSecret(req *http.Request, secret signers.Secret) *signers.AuthenticationError {
+	return v.check(req, compareWith(func(authHeaders map[string]string) (string, *signers.AuthenticationError) {
+		return v.SignSecret(req, authHeaders, secret)
+	}))
+}
+
+// Verify is like Check, returning the verified key, nonce, timestamp and signed headers on success.
+func (v *V2Signer) Verify(req *http.Request, secret string) (*signers.Result, *signers.AuthenticationError) {
+	if err := v.Check(req, secret); err != nil {
+		return nil, err
 	}
-	body, err := signers.ReadBody(req)
-	if err != nil {
-		return signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %s", err.Error())
+	authHeaders := v.ParseAuthHeaders(req)
+	ts, _ := v.timestamps().Parse(req.Header.Get(v.timestampHeader()))
+	ret := &signers.Result{
+		KeyID:     authHeaders["id"],
+		Realm:     authHeaders["realm"],
+		Version:   v.Version(),
+		Nonce:     authHeaders["nonce"],
+		Timestamp: ts,
+	}
+	if _, ok := authHeaders["headers"]; ok {
+		ret.SignedHeaders = v.readCustomHeaders(authHeaders)
 	}
-	if len(body) > 0 {
-		if req.Header.Get("X-Authorization-Content-Sha256") == "" {
-			return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header X-Authorization-Content-SHA256.")
+	return ret, nil
+}
+
+// CheckDeferred implements signers.DeferredChecker, so that large uploads can be verified while the handler
+// streams them.
+func (v *V2Signer) CheckDeferred(req *http.Request, secret string) (*signers.BodyVerifier, *signers.AuthenticationError) {
+	if err := v.precheck(req); err != nil {
+		return nil, err
+	}
+	bodyhash := req.Header.Get(v.ContentHashHeader())
+	if err := v.checkSignature(req, bodyhash, v.macVerifier(req, secret)); err != nil {
+		return nil, err
+	}
+	body := signers.NewBodyVerifier(req.Body, v.bodyDigest(), bodyhash)
+	body.Max = v.MaxBodyBytes
+	body.Header = v.ContentHashHeader()
+	req.Body = body
+	req.GetBody = nil
+	return body, nil
+}
+
+// Verifies the signature of a request, given its authorization headers and body hash.
+type signatureVerifier func(authHeaders map[string]string, bodyhash string, signature string) *signers.AuthenticationError
+
+// Verifies signatures by computing the expected signature.
+func compareWith(sign func(authHeaders map[string]string) (string, *signers.AuthenticationError)) signatureVerifier {
+	return func(authHeaders map[string]string, bodyhash string, got string) *signers.AuthenticationError {
+		sig, serr := sign(authHeaders)
+		if serr != nil {
+			return serr
+		}
+		if got == "" {
+			return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signature missing from authorization header.")
 		}
-		if v.HashBytes(body) != req.Header.Get("X-Authorization-Content-Sha256") {
-			return signers.Errorf(403, signers.ErrorTypeInvalidRequiredHeader, "Content mismatch - X-Authorization-Content-SHA256 must match the SHA hash of the request body.")
+		if !hmac.Equal([]byte(sig), []byte(got)) {
+			return signers.Errorf(403, signers.ErrorTypeSignatureMismatch, "Signature does not match expected signature.")
 		}
+		return nil
 	}
-	timestamp, err := strconv.ParseInt(req.Header.Get("X-Authorization-Timestamp"), 10, 64)
-	if err != nil {
-		return signers.Errorf(403, signers.ErrorTypeInvalidRequiredHeader, "Timestamp parse error: %s", err.Error())
+}
+
+func (v *V2Signer) check(req *http.Request, verify signatureVerifier) *signers.AuthenticationError {
+	if err := v.precheck(req); err != nil {
+		return err
 	}
-	if timestamp > signers.Now().Unix()+900 {
-		return signers.Errorf(403, signers.ErrorTypeTimestampRangeError, "Timestamp given in X-Authorization-Timestamp (%d) was too far in the future.", timestamp)
+	bodyhash, serr := v.contentHash(req)
+	if serr != nil {
+		return serr
 	}
-	if timestamp < signers.Now().Unix()-900 {
-		return signers.Errorf(403, signers.ErrorTypeTimestampRangeError, "Timestamp given in X-Authorization-Timestamp (%d) was too far in the past.", timestamp)
+	expected := bodyhash
+	if expected == "" && v.Profile.requiresContentHash(req) {
+		expected = v.HashBytes(nil)
 	}
+	if header := v.ContentHashHeader(); expected != "" {
+		if req.Header.Get(header) == "" {
+			return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header %s.", header)
+		}
+		if expected != req.Header.Get(header) {
+			return signers.Errorf(403, signers.ErrorTypeInvalidRequiredHeader, "Content mismatch - %s must match the SHA hash of the request body.", header)
+		}
+	}
+	return v.checkSignature(req, bodyhash, verify)
+}
 
-	sig, serr := v.Sign(req, authHeaders, secret)
-	if serr != nil {
-		return serr
+// Rejects requests that cannot possibly be valid before the body is read: malformed authorization headers,
+// timestamps out of range and signatures of the wrong format.
+func (v *V2Signer) precheck(req *http.Request) *signers.AuthenticationError {
+	if req.Header.Get(v.timestampHeader()) == "" {
+		return signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header %s.", v.timestampHeader())
+	}
+	authHeaders := v.ParseAuthHeaders(req)
+	if version, ok := authHeaders["version"]; ok && version != "2.0" {
+		return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Unsupported signature version %s.", version)
+	}
+	if _, err := v.timestamps().Check(req); err != nil {
+		return err
 	}
-	got := authHeaders["signature"]
-	if got == "" {
+	if err := v.signedHeadersPresent(req, authHeaders); err != nil {
+		return err
+	}
+	if err := v.checkContentHashHeaders(req); err != nil {
+		return err
+	}
+	if err := v.checkProfile(req, authHeaders); err != nil {
+		return err
+	}
+	sig := authHeaders["signature"]
+	if sig == "" {
 		return signers.Errorf(403, signers.ErrorTypeInvalidAuthHeader, "Signature missing from authorization header.")
 	}
-	if sig != got {
+	mac, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil || (v.MACer == nil && v.Backend == nil && len(mac) != v.Digest().Size()) {
 		return signers.Errorf(403, signers.ErrorTypeSignatureMismatch, "Signature does not match expected signature.")
 	}
 	return nil
 }
 
-func (v *V2Signer) SignDirect(req *http.Request, authHeaders map[string]string, secret string) *signers.AuthenticationError {
-	if req.Header.Get("X-Authorization-Timestamp") == "" {
-		req.Header.Set("X-Authorization-Timestamp", strconv.Itoa(int(signers.Now().Unix())))
+func (v *V2Signer) checkSignature(req *http.Request, bodyhash string, verify signatureVerifier) *signers.AuthenticationError {
+	authHeaders := v.ParseAuthHeaders(req)
+	return verify(authHeaders, bodyhash, authHeaders["signature"])
+}
+
+func (v *V2Signer) handleExisting(req *http.Request, authHeaders map[string]string) (map[string]string, *signers.AuthenticationError) {
+	if !v.MatchAuthorization(req.Header.Get(v.authorizationHeader())) {
+		return authHeaders, nil
+	}
+	switch v.OnExisting {
+	case signers.RefuseExistingSignature:
+		return nil, signers.Errorf(500, signers.ErrorTypeAlreadySigned, "Request already bears a v2 signature.")
+	case signers.ResignExistingSignature:
+		existing := v.ParseAuthHeaders(req)
+		given := authHeaders
+		authHeaders = map[string]string{}
+		for _, k := range []string{"id", "realm", "headers"} {
+			if val, ok := existing[k]; ok {
+				authHeaders[k] = val
+			}
+		}
+		// The nonce of the existing signature is spent: servers that saw it would reject a replay.
+		authHeaders["nonce"] = given["nonce"]
+		if authHeaders["nonce"] == "" {
+			n, err := nonce.New()
+			if err != nil {
+				return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not generate nonce: %w", err)
+			}
+			authHeaders["nonce"] = n
+		}
+		req.Header.Del(v.timestampHeader())
 	}
-	body, err := signers.ReadBody(req)
+	req.Header.Del(v.authorizationHeader())
+	req.Header.Del(v.ContentHashHeader())
+	return authHeaders, nil
+}
+
+func (v *V2Signer) SignDirect(req *http.Request, authHeaders map[string]string, secret string) *signers.AuthenticationError {
+	authHeaders, err := v.handleExisting(req, authHeaders)
 	if err != nil {
-		return signers.Errorf(500, signers.ErrorTypeInternalError, "Failed to read request body: %s", err.Error())
+		return err
+	}
+	if req.Header.Get(v.timestampHeader()) == "" {
+		req.Header.Set(v.timestampHeader(), strconv.Itoa(int(signers.NowFrom(v.Clock).Unix())))
+	}
+	// Computed from the body when absent, streaming it through GetBody where possible. The body is hashed
+	// only once: a content hash already present is signed as it is.
+	bodyhash := req.Header.Get(v.ContentHashHeader())
+	if bodyhash == "" {
+		var serr *signers.AuthenticationError
+		bodyhash, serr = v.contentHash(req)
+		if serr != nil {
+			return serr
+		}
+		if bodyhash != "" {
+			req.Header.Set(v.ContentHashHeader(), bodyhash)
+		} else if v.Profile.requiresContentHash(req) {
+			// Sent for verifiers requiring it, but not signed: the specification omits the hash of empty bodies.
+			req.Header.Set(v.ContentHashHeader(), v.HashBytes(nil))
+		}
 	}
-	if len(body) > 0 && req.Header.Get("X-Authorization-Content-Sha256") == "" {
-		req.Header.Set("X-Authorization-Content-Sha256", v.HashBytes(body))
+	if err := v.signable(req, authHeaders); err != nil {
+		return err
 	}
-	sig, serr := v.Sign(req, authHeaders, secret)
+	sig, serr := v.mac(req, authHeaders, secret, bodyhash)
 	if serr != nil {
 		return serr
 	}
@@ -269,7 +606,7 @@ func (v *V2Signer) SignDirect(req *http.Request, authHeaders map[string]string,
 		return serr
 	}
 
-	req.Header.Set("Authorization", ah)
+	req.Header.Set(v.authorizationHeader(), ah)
 	return nil
 }
 
@@ -280,37 +617,55 @@ func (v *V2Signer) GenerateAuthorization(req *http.Request, authHeaders map[stri
 	if _, ok := authHeaders["nonce"]; !ok {
 		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Missing nonce for signature.")
 	}
-	if _, ok := authHeaders["realm"]; !ok {
+	if _, ok := authHeaders["realm"]; !ok && !v.OptionalRealm {
 		return "", signers.Errorf(500, signers.ErrorTypeInternalError, "Missing realm for signature.")
 	}
+	authHeaders = signers.CopyAuthHeaders(authHeaders)
+	if v.OptionalRealm && authHeaders["realm"] == "" {
+		delete(authHeaders, "realm")
+	}
 	if _, ok := authHeaders["version"]; !ok {
 		authHeaders["version"] = "2.0"
 	}
 	authHeaders["signature"] = signature
-	args := ""
-	sorted := []string{}
-	for k, _ := range authHeaders {
-		sorted = append(sorted, k)
-	}
-	sort.Strings(sorted)
-	for _, k := range sorted {
-		if args != "" {
-			args += ","
-		}
-		v := authHeaders[k]
-		if k != "signature" { // hack
-			v = EscapeProper(v)
-		}
-		args += fmt.Sprintf("%s=\"%s\"", k, v)
-	}
 
-	return fmt.Sprintf("acquia-http-hmac %s", args), nil
+	return formatAuthorization(authHeaders), nil
 }
 
 func (v *V2Signer) GetIdentificationRegex() *regexp.Regexp {
 	return v.IdRegex
 }
 
+// MatchAuthorization reports whether auth is a v2 Authorization header, as GetIdentificationRegex does,
+// but without running the regular expression, unless IdRegex was replaced.
+func (v *V2Signer) MatchAuthorization(auth string) bool {
+	if v.IdRegex != identificationRegex {
+		return v.IdRegex.MatchString(auth)
+	}
+	auth = strings.TrimLeft(auth, " \t\n\f\r")
+	const scheme = "acquia-http-hmac"
+	const version = `version="2.0"`
+	if len(auth) < len(scheme) || !strings.EqualFold(auth[:len(scheme)], scheme) || strings.IndexByte(auth, '\n') >= 0 {
+		return false
+	}
+	for i := len(scheme); i+len(version) <= len(auth); i++ {
+		if (auth[i] == 'v' || auth[i] == 'V') && strings.EqualFold(auth[i:i+len(version)], version) {
+			return true
+		}
+	}
+	return false
+}
+
+// CloneSigner returns a copy of the signer and its response signer.
+func (v *V2Signer) CloneSigner() signers.Signer {
+	c := *v
+	rs := *v.respSigner
+	rs.Headers = append([]string(nil), v.respSigner.Headers...)
+	rs.signer = &c
+	c.respSigner = &rs
+	return &c
+}
+
 func (v *V2Signer) GetResponseSigner() signers.ResponseSigner {
 	return v.respSigner
 }
@@ -1,9 +1,22 @@
 package v2
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/acquia/http-hmac-go/signers"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 var testVersion string = "v2"
@@ -24,6 +37,20 @@ func LogSkip(t *testing.T, args ...interface{}) {
 	t.Log("\033[33;1mSKIP\033[0m", fmt.Sprint(args...))
 }
 
+// Returns the hard-coded fixtures followed by the specification vectors, which are read from the
+// directory in $HTTP_HMAC_SPEC_FIXTURES or the bundled testdata.
+func allFixtures(t *testing.T) []*signers.TestFixture {
+	spec, err := signers.LoadSpecFixturesFromEnv("testdata/spec")
+	if err != nil {
+		t.Fatal("Failed to load specification fixtures: ", err.Error())
+	}
+	ret := append([]*signers.TestFixture{}, signers.Fixtures...)
+	for _, f := range spec {
+		ret = append(ret, f.ToTestFixture())
+	}
+	return ret
+}
+
 func TestSign(t *testing.T) {
 	evaluated := 0
 	skipped := 0
@@ -31,7 +58,7 @@ func TestSign(t *testing.T) {
 	passed := 0
 	failed := 0
 
-	for k, v := range signers.Fixtures {
+	for k, v := range allFixtures(t) {
 		LogTest(t, "fixture ", k, " - ", v.TestName)
 		if _, ok := v.Expected[testVersion]; !ok {
 			if ert, ok := v.ErrorType[testVersion]; !ok || ert == signers.ErrorTypeNoError {
@@ -213,3 +240,1499 @@ func TestSign(t *testing.T) {
 		t.Log("Conclusion: test PASSED.")
 	}
 }
+
+func TestParseAuthorization(t *testing.T) {
+	cases := []struct {
+		header string
+		valid  bool
+		realm  string
+	}{
+		{`acquia-http-hmac id="efdde334-fe7b-11e4-a322-1697f925ec7b",nonce="d1954337-5319-4821-8427-115542e08d10",realm="Pipet%20service",signature="MRlPr/Z1WQY2sMthcaEqETRMw4gPYXlPcTpaLWS2gcc=",version="2.0"`, true, "Pipet service"},
+		{`acquia-http-hmac realm="a,b", version="2.0" ,id="x",  nonce="y", signature="z"`, true, "a,b"},
+		{`acquia-http-hmac realm=Plexus,id=x,nonce=y,signature=z,version=2.0`, true, "Plexus"},
+		{`acquia-http-hmac signature="z",realm="a \"quoted\", realm",nonce="y",x-vendor="1",id="x"`, true, `a "quoted", realm`},
+		{`acquia-http-hmac realm="unterminated,id="x"`, false, ""},
+		{`acquia-http-hmac realm="a"b,id="x"`, false, ""},
+		{`acquia-http-hmac id`, false, ""},
+		{`acquia-http-hmac id="a",id="b"`, false, ""},
+		{`Acquia efdde334-fe7b-11e4-a322-1697f925ec7b:6DQcBYwaKdhRm/eNBKIN2jM8HF8=`, false, ""},
+		{``, false, ""},
+	}
+	for k, c := range cases {
+		LogTest(t, "case ", k, " - ", c.header)
+		ah, err := ParseAuthorization(c.header)
+		if !c.valid {
+			if err == nil {
+				LogFail(t, "Expected parse error, got ", *ah)
+				t.Fail()
+			} else {
+				LogPass(t, "Got expected error: ", err.Message)
+			}
+			continue
+		}
+		if err != nil {
+			LogFail(t, "Failed to parse header: ", err.Message)
+			t.Fail()
+			continue
+		}
+		if ah.Realm != c.realm || ah.ID == "" || ah.Signature == "" {
+			LogFail(t, "Unexpected parse result: ", *ah)
+			t.Fail()
+			continue
+		}
+		again, err := ParseAuthorization(ah.String())
+		if err != nil || again.String() != ah.String() {
+			LogFail(t, "Header does not survive a round trip: ", ah.String())
+			t.Fail()
+			continue
+		}
+		LogPass(t, "Parsed and round tripped.")
+	}
+}
+
+func TestAuthorizationBuilder(t *testing.T) {
+	ah := &AuthorizationHeader{
+		ID:        "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		Nonce:     "d1954337-5319-4821-8427-115542e08d10",
+		Realm:     "Pipet service",
+		Version:   "2.0",
+		Signature: "MRlPr/Z1WQY2sMthcaEqETRMw4gPYXlPcTpaLWS2gcc=",
+	}
+	expected := map[*AuthorizationBuilder]string{
+		&AuthorizationBuilder{}: `acquia-http-hmac id="efdde334-fe7b-11e4-a322-1697f925ec7b",nonce="d1954337-5319-4821-8427-115542e08d10",realm="Pipet%20service",signature="MRlPr/Z1WQY2sMthcaEqETRMw4gPYXlPcTpaLWS2gcc=",version="2.0"`,
+		NewAuthorizationBuilder("realm", "id", "nonce", "version"):           `acquia-http-hmac realm="Pipet%20service",id="efdde334-fe7b-11e4-a322-1697f925ec7b",nonce="d1954337-5319-4821-8427-115542e08d10",version="2.0",signature="MRlPr/Z1WQY2sMthcaEqETRMw4gPYXlPcTpaLWS2gcc="`,
+		&AuthorizationBuilder{Order: []string{"signature"}, Separator: ", "}: `acquia-http-hmac signature="MRlPr/Z1WQY2sMthcaEqETRMw4gPYXlPcTpaLWS2gcc=", id="efdde334-fe7b-11e4-a322-1697f925ec7b", nonce="d1954337-5319-4821-8427-115542e08d10", realm="Pipet%20service", version="2.0"`,
+	}
+	for b, e := range expected {
+		got := b.Build(ah)
+		if got != e {
+			LogFail(t, "Expected ", e, " but got ", got)
+			t.Fail()
+		}
+		if _, err := ParseAuthorization(got); err != nil {
+			LogFail(t, "Built header does not parse: ", err.Message)
+			t.Fail()
+		}
+	}
+}
+
+// Reads fail, to make sure the signer leaves the body alone when it can use GetBody instead.
+type unreadableBody struct{}
+
+func (unreadableBody) Read(p []byte) (int, error) {
+	return 0, errors.New("body read directly")
+}
+
+func (unreadableBody) Close() error {
+	return nil
+}
+
+func TestSignDirectContentHash(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, err := NewV2Signer(sha256.New)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	body := `{"method":"hi.bob","params":["5","4","8"]}`
+	req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Body = unreadableBody{}
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	if err := signer.SignDirect(req, authHeaders, "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+	if got := req.Header.Get("X-Authorization-Content-SHA256"); got != signer.HashBytes([]byte(body)) {
+		LogFail(t, "Unexpected content hash ", got)
+		t.Fail()
+	}
+
+	// Verify the way a server would, from a request without GetBody.
+	received, _ := http.NewRequest("POST", req.URL.String(), ioutil.NopCloser(strings.NewReader(body)))
+	received.ContentLength = int64(len(body))
+	received.Header = req.Header
+	if err := signer.Check(received, "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="); err != nil {
+		LogFail(t, "Signed request does not verify: ", err.Message)
+		t.Fail()
+	}
+}
+
+func TestSignString(t *testing.T) {
+	signer, err := NewV2Signer(sha256.New)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	body := `{"method":"hi.bob","params":["5","4","8"]}`
+	req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Authorization-Timestamp", "1432075982")
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+
+	bodyhash, herr := HashBody(strings.NewReader(body))
+	if herr != nil {
+		t.Fatal(herr)
+	}
+	if bodyhash != signer.HashBytes([]byte(body)) {
+		LogFail(t, "HashBody does not match HashBytes: ", bodyhash)
+		t.Fail()
+	}
+	expected, err := signer.Sign(req, authHeaders, secret)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	got, err := SignString(secret, string(signer.CreateSignable(req, authHeaders, bodyhash)))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if got != expected {
+		LogFail(t, "Expected signature ", expected, " but got ", got)
+		t.Fail()
+	}
+	if _, err := SignString("not base64!", "message"); err == nil || err.ErrorType != signers.ErrorTypeOutdatedKeypair {
+		LogFail(t, "Expected an invalid secret to be rejected.")
+		t.Fail()
+	}
+}
+
+func TestCanonicalizer(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	// A gateway rewrites the Host header, so it is left out of the signature.
+	ignoreHost := signers.CanonicalizerFunc(func(req *http.Request, authHeaders map[string]string, bodyhash string) []byte {
+		r := req.Clone(req.Context())
+		r.Host = ""
+		return SpecCanonicalizer{}.Canonicalize(r, authHeaders, bodyhash)
+	})
+	signer, err := NewV2Signer(sha256.New)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	signer.Canonicalizer = ignoreHost
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	req, _ := http.NewRequest("GET", "http://public.example.com/v1.0/task-status/133?limit=10", nil)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal("Failed to sign request: ", err.Message)
+	}
+
+	forwarded, _ := http.NewRequest("GET", "http://internal.example.com/v1.0/task-status/133?limit=10", nil)
+	forwarded.Header = req.Header
+	if err := signer.Check(forwarded, secret); err != nil {
+		LogFail(t, "Forwarded request does not verify with the custom canonicalizer: ", err.Message)
+		t.Fail()
+	}
+	signer.Canonicalizer = nil
+	if err := signer.Check(forwarded, secret); err == nil {
+		LogFail(t, "Expected forwarded request to fail with the specification canonicalizer.")
+		t.Fail()
+	}
+}
+
+func TestQueryNormalization(t *testing.T) {
+	expected := map[string]map[signers.QueryNormalization]string{
+		"b=2&a=1&a=0": {
+			signers.QueryNormalization{}:           "b=2&a=1&a=0",
+			signers.QueryNormalization{Sort: true}: "a=1&a=0&b=2",
+		},
+		"q=hello+world&path=%2fa%2fb": {
+			signers.QueryNormalization{}:           "q=hello+world&path=%2fa%2fb",
+			signers.ReferenceQueryNormalization:    "q=hello%20world&path=%2Fa%2Fb",
+			signers.QueryNormalization{Sort: true}: "path=%2fa%2fb&q=hello+world",
+		},
+	}
+	for raw, cases := range expected {
+		for q, e := range cases {
+			if got := q.Normalize(raw); got != e {
+				LogFail(t, "Expected ", e, " but got ", got, " for ", raw, " with ", q)
+				t.Fail()
+			}
+		}
+	}
+
+	// Two stacks encoding the same URL differently produce the same signature once normalized.
+	signer, err := NewV2Signer(sha256.New)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	signer.Canonicalizer = SpecCanonicalizer{Query: signers.ReferenceQueryNormalization}
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	var sigs []string
+	for _, u := range []string{"http://example.com/search?q=a+b&p=%2f", "http://example.com/search?q=a%20b&p=%2F"} {
+		req, _ := http.NewRequest("GET", u, nil)
+		req.Header.Set("X-Authorization-Timestamp", "1432075982")
+		sig, err := signer.Sign(req, authHeaders, "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI=")
+		if err != nil {
+			t.Fatal(err.Message)
+		}
+		sigs = append(sigs, sig)
+	}
+	if sigs[0] != sigs[1] {
+		LogFail(t, "Expected normalized queries to produce the same signature.")
+		t.Fail()
+	}
+}
+
+func TestPathNormalization(t *testing.T) {
+	all := signers.PathNormalization{CollapseSlashes: true, ResolveDotSegments: true, NormalizeEscapes: true}
+	expected := map[string]map[signers.PathNormalization]string{
+		"/v1.0//task-status/./133/": {
+			signers.PathNormalization{}:                      "/v1.0//task-status/./133",
+			signers.PathNormalization{CollapseSlashes: true}: "/v1.0/task-status/./133",
+			all: "/v1.0/task-status/133",
+		},
+		"/v1.0/tasks/../task-status/133": {
+			signers.PathNormalization{ResolveDotSegments: true}: "/v1.0/task-status/133",
+			all: "/v1.0/task-status/133",
+		},
+		"/files/a%2fb/%7euser": {
+			signers.PathNormalization{}: "/files/a/b/~user",
+			all:                         "/files/a%2Fb/~user",
+		},
+		"/../..": {
+			signers.PathNormalization{ResolveDotSegments: true}: "",
+		},
+	}
+	for raw, cases := range expected {
+		u, perr := url.Parse("http://example.com" + raw)
+		if perr != nil {
+			t.Fatal(perr)
+		}
+		for p, e := range cases {
+			if got := p.Normalize(u); got != e {
+				LogFail(t, "Expected ", e, " but got ", got, " for ", raw, " with ", p)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestHostNormalization(t *testing.T) {
+	all := signers.HostNormalization{Lowercase: true, CanonicalIP: true, StripDefaultPort: true}
+	expected := map[string]map[signers.HostNormalization]string{
+		"[::1]:3000": {
+			signers.HostNormalization{}: "[::1]:3000",
+			all:                         "[::1]:3000",
+		},
+		"[0:0:0:0:0:0:0:1]:3000": {
+			signers.HostNormalization{}:                  "[0:0:0:0:0:0:0:1]:3000",
+			signers.HostNormalization{CanonicalIP: true}: "[::1]:3000",
+		},
+		"[2001:DB8::A]:443": {
+			signers.HostNormalization{Lowercase: true}:        "[2001:db8::a]:443",
+			signers.HostNormalization{StripDefaultPort: true}: "[2001:DB8::A]",
+			all: "[2001:db8::a]",
+		},
+		"::1": {
+			signers.HostNormalization{CanonicalIP: true}: "[::1]",
+			signers.HostNormalization{Lowercase: true}:   "::1",
+		},
+		"192.000.002.001:8080": {
+			signers.HostNormalization{CanonicalIP: true}: "192.0.2.1:8080",
+			signers.HostNormalization{Lowercase: true}:   "192.000.002.001:8080",
+		},
+		"010.0.0.1": {
+			all: "10.0.0.1",
+		},
+		"192.0.2.256": {
+			all: "192.0.2.256",
+		},
+		"[fe80::0001%25en0]:8080": {
+			all: "[fe80::1%25en0]:8080",
+		},
+		"[::FFFF:192.0.2.1]": {
+			all: "[::ffff:192.0.2.1]",
+		},
+		"Example.com:80": {
+			all: "example.com",
+		},
+	}
+	for raw, cases := range expected {
+		for h, e := range cases {
+			if got := h.Normalize(raw); got != e {
+				LogFail(t, "Expected ", e, " but got ", got, " for ", raw, " with ", h)
+				t.Fail()
+			}
+		}
+	}
+
+	// A client and a server writing the same IPv6 host differently.
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	signer, _ := NewV2Signer(sha256.New)
+	req, _ := http.NewRequest("GET", "http://[::1]:3000/v1.0/task-status/133", nil)
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	received := httptest.NewRequest("GET", "/v1.0/task-status/133", nil)
+	received.Host = "[::1]:3000"
+	received.Header = req.Header
+	if err := signer.Check(received, secret); err != nil {
+		LogFail(t, "Failed to check a request to an IPv6 literal host: ", err.Message)
+		t.Fail()
+	}
+	received.Host = "[0:0::1]:3000"
+	if err := signer.Check(received, secret); err == nil {
+		LogFail(t, "Expected a differently written host to fail without normalization")
+		t.Fail()
+	}
+	signer.Canonicalizer = SpecCanonicalizer{Host: signers.HostNormalization{CanonicalIP: true}}
+	if err := signer.Check(received, secret); err != nil {
+		LogFail(t, "Failed to check a differently written IPv6 host with normalization: ", err.Message)
+		t.Fail()
+	}
+}
+
+func TestExistingSignature(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	signed := func(signer *V2Signer) *http.Request {
+		req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(`{"a":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		authHeaders := map[string]string{
+			"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+			"nonce": "d1954337-5319-4821-8427-115542e08d10",
+			"realm": "Pipet service",
+		}
+		if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+			t.Fatal("Failed to sign request: ", err.Message)
+		}
+		return req
+	}
+	other := map[string]string{
+		"id":    "615d6517-1cea-4aa3-b48e-96d83c16c4dd",
+		"nonce": "64d02132-40bf-4fce-85bf-3f1bb1bfe7dd",
+		"realm": "Other service",
+	}
+	signer, err := NewV2Signer(sha256.New)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+
+	req := signed(signer)
+	if err := signer.SignDirect(req, other, secret); err != nil {
+		t.Fatal("Failed to replace signature: ", err.Message)
+	}
+	if ah := ParseAuthHeaders(req); ah["id"] != other["id"] || strings.Count(req.Header.Get("Authorization"), "acquia-http-hmac") != 1 {
+		LogFail(t, "Expected signature to be replaced, got ", req.Header.Get("Authorization"))
+		t.Fail()
+	}
+
+	signer.OnExisting = signers.RefuseExistingSignature
+	req = signed(signer)
+	if err := signer.SignDirect(req, other, secret); err == nil || err.ErrorType != signers.ErrorTypeAlreadySigned {
+		LogFail(t, "Expected signing an already signed request to be refused.")
+		t.Fail()
+	}
+
+	signer.OnExisting = signers.ResignExistingSignature
+	req = signed(signer)
+	signers.OverrideClock(1432076000)
+	if err := signer.SignDirect(req, other, secret); err != nil {
+		t.Fatal("Failed to re-sign request: ", err.Message)
+	}
+	if ah := ParseAuthHeaders(req); ah["id"] != "efdde334-fe7b-11e4-a322-1697f925ec7b" || ah["nonce"] != other["nonce"] || req.Header.Get("X-Authorization-Timestamp") != "1432076000" {
+		LogFail(t, "Expected the existing parameters with the given nonce and a fresh timestamp, got ", req.Header.Get("Authorization"))
+		t.Fail()
+	}
+	if err := signer.Check(req, secret); err != nil {
+		LogFail(t, "Re-signed request does not verify: ", err.Message)
+		t.Fail()
+	}
+	req = signed(signer)
+	if err := signer.SignDirect(req, map[string]string{}, secret); err != nil {
+		t.Fatal("Failed to re-sign request: ", err.Message)
+	}
+	if ah := ParseAuthHeaders(req); ah["id"] != "efdde334-fe7b-11e4-a322-1697f925ec7b" || ah["nonce"] == "" || ah["nonce"] == "d1954337-5319-4821-8427-115542e08d10" {
+		LogFail(t, "Expected the re-signed request to get a fresh nonce, got ", req.Header.Get("Authorization"))
+		t.Fail()
+	}
+}
+
+func TestSecret(t *testing.T) {
+	encoded := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	b64, err := signers.Base64Secret(encoded)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	hexed, err := signers.HexSecret(fmt.Sprintf("%x", b64.Bytes()))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if hexed.Base64() != encoded || fmt.Sprint(hexed) != "[secret]" {
+		LogFail(t, "Decoders do not agree on the key material.")
+		t.Fail()
+	}
+	if _, err := signers.HexSecret("xyz"); err == nil || err.ErrorType != signers.ErrorTypeOutdatedKeypair {
+		LogFail(t, "Expected invalid hex secret to be rejected.")
+		t.Fail()
+	}
+
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, _ := NewV2Signer(sha256.New)
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	if err := signer.SignDirect(req, authHeaders, encoded); err != nil {
+		t.Fatal(err.Message)
+	}
+	sig, err := signer.SignSecret(req, authHeaders, signers.RawSecret(hexed.Bytes()))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if sig != ParseAuthHeaders(req)["signature"] {
+		LogFail(t, "SignSecret does not match Sign.")
+		t.Fail()
+	}
+	if err := signer.CheckSecret(req, hexed); err != nil {
+		LogFail(t, "CheckSecret failed: ", err.Message)
+		t.Fail()
+	}
+}
+
+// Computes MACs locally with keys only it knows, like a KMS would.
+type fakeBackend struct {
+	keys map[string]signers.Secret
+}
+
+func (b *fakeBackend) GenerateMAC(ctx context.Context, keyRef string, message []byte) ([]byte, error) {
+	key, ok := b.keys[keyRef]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+	h := hmac.New(sha256.New, key.Bytes())
+	h.Write(message)
+	return h.Sum(nil), nil
+}
+
+func (b *fakeBackend) VerifyMAC(ctx context.Context, keyRef string, message []byte, mac []byte) (bool, error) {
+	expected, err := b.GenerateMAC(ctx, keyRef, message)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal(expected, mac), nil
+}
+
+func TestBackend(t *testing.T) {
+	encoded := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	key, _ := signers.Base64Secret(encoded)
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+
+	local, _ := NewV2Signer(sha256.New)
+	remote, _ := NewV2Signer(sha256.New)
+	remote.Backend = &fakeBackend{keys: map[string]signers.Secret{"kms-key": key}}
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(`{"method":"hi.bob"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if err := remote.SignDirect(req, authHeaders, "kms-key"); err != nil {
+		t.Fatal(err.Message)
+	}
+	if err := local.Check(req, encoded); err != nil {
+		LogFail(t, "Signature computed by the backend does not verify locally: ", err.Message)
+		t.Fail()
+	}
+	if err := remote.Check(req, "kms-key"); err != nil {
+		LogFail(t, "Backend fails to verify its own signature: ", err.Message)
+		t.Fail()
+	}
+	req.Header.Set("X-Authorization-Timestamp", "1432075983")
+	if err := remote.Check(req, "kms-key"); err == nil || err.ErrorType != signers.ErrorTypeSignatureMismatch {
+		LogFail(t, "Expected tampered request to be rejected by the backend.")
+		t.Fail()
+	}
+	if err := remote.Check(req, "missing"); err == nil || err.HttpStatus != 500 {
+		LogFail(t, "Expected backend failure to be reported as an internal error.")
+		t.Fail()
+	}
+}
+
+func TestBackendResponse(t *testing.T) {
+	encoded := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	key, _ := signers.Base64Secret(encoded)
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+
+	remote, _ := NewV2Signer(sha256.New)
+	remote.Backend = &fakeBackend{keys: map[string]signers.Secret{"kms-key": key}}
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	if err := remote.SignDirect(req, authHeaders, "kms-key"); err != nil {
+		t.Fatal(err.Message)
+	}
+	rw := signers.NewDummySignableResponseWriter([]byte("ok"))
+	if err := remote.GetResponseSigner().SignResponseDirect(req, rw, "kms-key"); err != nil {
+		t.Fatal(err.Message)
+	}
+	resp := &http.Response{
+		StatusCode: 200,
+		Header:     rw.Header(),
+		Body:       ioutil.NopCloser(strings.NewReader("ok")),
+	}
+	if err := VerifyResponse(req, resp, encoded); err != nil {
+		LogFail(t, "Response signed by the backend does not verify locally: ", err.Message)
+		t.Fail()
+	}
+	if remote.respSigner.Streams() {
+		LogFail(t, "Expected responses signed by a backend not to be streamed.")
+		t.Fail()
+	}
+}
+
+func TestMACer(t *testing.T) {
+	encoded := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	key, _ := signers.Base64Secret(encoded)
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+
+	local, _ := NewV2Signer(sha256.New)
+	hexed, _ := NewV2Signer(sha256.New)
+	hexed.MACer = &signers.HMAC{Digest: sha256.New, Decoder: signers.DecodeHex}
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	if err := hexed.SignDirect(req, authHeaders, fmt.Sprintf("%x", key.Bytes())); err != nil {
+		t.Fatal(err.Message)
+	}
+	if err := local.Check(req, encoded); err != nil {
+		LogFail(t, "Signature computed by a custom MACer does not verify: ", err.Message)
+		t.Fail()
+	}
+	if err := hexed.Check(req, encoded); err == nil || err.ErrorType != signers.ErrorTypeOutdatedKeypair {
+		LogFail(t, "Expected the MACer to reject a secret it cannot decode.")
+		t.Fail()
+	}
+}
+
+func TestComputeAuthorization(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, _ := NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	body := `{"method":"hi.bob","params":["5","4","8"]}`
+	req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", ioutil.NopCloser(strings.NewReader(body)))
+	req.Header.Set("Content-Type", "application/json")
+	auth, extra, err := signers.ComputeAuthorization(signer, req, authHeaders, "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI=")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if req.Header.Get("Authorization") != "" || len(req.Header) != 1 || len(authHeaders) != 3 {
+		LogFail(t, "ComputeAuthorization modified the request headers or the auth headers.")
+		t.Fail()
+	}
+	if got, _ := ioutil.ReadAll(req.Body); string(got) != body {
+		LogFail(t, "Request body was not preserved: ", string(got))
+		t.Fail()
+	}
+	if extra.Get("X-Authorization-Timestamp") != "1432075982" || extra.Get("X-Authorization-Content-Sha256") == "" || extra.Get("Content-Type") != "" {
+		LogFail(t, "Unexpected extra headers: ", extra)
+		t.Fail()
+	}
+
+	req.Body = ioutil.NopCloser(strings.NewReader(body))
+	req.Header.Set("Authorization", auth)
+	for k, v := range extra {
+		req.Header[k] = v
+	}
+	if err := signer.Check(req, "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="); err != nil {
+		LogFail(t, "Computed authorization does not verify: ", err.Message)
+		t.Fail()
+	}
+}
+
+func TestComputeAuthorizationHeader(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, _ := NewV2Signer(sha256.New)
+	signer.AuthorizationHeader = "X-Acquia-Authorization"
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133", nil)
+	auth, extra, err := signers.ComputeAuthorization(signer, req, authHeaders, "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI=")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if !strings.HasPrefix(auth, "acquia-http-hmac ") || extra.Get("X-Acquia-Authorization") != "" {
+		LogFail(t, "Expected the signature of the custom header to be returned, got ", auth, " and ", extra)
+		t.Fail()
+	}
+	req.Header.Set("X-Acquia-Authorization", auth)
+	for k, v := range extra {
+		req.Header[k] = v
+	}
+	if err := signer.Check(req, "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="); err != nil {
+		LogFail(t, "Computed authorization does not verify: ", err.Message)
+		t.Fail()
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, _ := NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(strings.Repeat("a", 64)))
+	req.Header.Set("Content-Type", "text/plain")
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	signer.MaxBodyBytes = 64
+	if err := signer.Check(req, secret); err != nil {
+		LogFail(t, "Body at the limit was rejected: ", err.Message)
+		t.Fail()
+	}
+	signer.MaxBodyBytes = 63
+	if err := signer.Check(req, secret); err == nil || err.HttpStatus != 413 || err.ErrorType != signers.ErrorTypeBodyTooLarge {
+		LogFail(t, "Expected body over the limit to be rejected with 413.")
+		t.Fail()
+	}
+	req.GetBody = nil
+	if err := signer.Check(req, secret); err == nil || err.HttpStatus != 413 {
+		LogFail(t, "Expected unreplayable body over the limit to be rejected with 413.")
+		t.Fail()
+	}
+}
+
+func TestClock(t *testing.T) {
+	signer, _ := NewV2Signer(sha256.New)
+	signer.Clock = signers.NewTestClock(1432075982)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	if ts := req.Header.Get("X-Authorization-Timestamp"); ts != "1432075982" {
+		LogFail(t, "Timestamp not taken from the signer's clock: ", ts)
+		t.Fail()
+	}
+	if err := signer.Check(req, secret); err != nil {
+		LogFail(t, "Check does not use the signer's clock: ", err.Message)
+		t.Fail()
+	}
+	signer.Clock = signers.OffsetClock{Clock: signer.Clock, Offset: time.Hour}
+	if err := signer.Check(req, secret); err == nil || err.ErrorType != signers.ErrorTypeTimestampRangeError {
+		LogFail(t, "Expected the request to be outdated an hour later.")
+		t.Fail()
+	}
+}
+
+func TestSignableString(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, _ := NewV2Signer(sha256.New)
+	var seen []string
+	signer.OnSignable = func(req *http.Request, signable []byte) {
+		seen = append(seen, string(signable))
+	}
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	if err := signer.SignDirect(req, authHeaders, "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="); err != nil {
+		t.Fatal(err.Message)
+	}
+	signable, err := signer.SignableString(req)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	expected := "GET\nexample.acquiapipet.net\n/v1.0/task-status/133\nlimit=10\nid=efdde334-fe7b-11e4-a322-1697f925ec7b&nonce=d1954337-5319-4821-8427-115542e08d10&realm=Pipet%20service&version=2.0\n1432075982"
+	if signable != expected {
+		LogFail(t, "Unexpected signable string: ", signable)
+		t.Fail()
+	}
+	if len(seen) != 1 || seen[0] != expected {
+		LogFail(t, "OnSignable was not called with the signed message: ", seen)
+		t.Fail()
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, _ := NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":      "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce":   "d1954337-5319-4821-8427-115542e08d10",
+		"realm":   "Pipet service",
+		"headers": "X-Tenant",
+	}
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	if d := signer.Diagnose(req, secret); d.Err != nil || !d.SignatureMatch || !d.ContentHashMatch || !d.TimestampInRange {
+		LogFail(t, "Unexpected diagnosis of a valid request:\n", d)
+		t.Fail()
+	}
+
+	req.Header.Set("X-Tenant", "other")
+	signers.OverrideClock(1432075982 + 3600)
+	d := signer.Diagnose(req, secret)
+	if d.Err == nil || d.SignatureMatch || d.TimestampInRange || d.TimestampDelta != -time.Hour {
+		LogFail(t, "Unexpected diagnosis of an outdated, tampered request:\n", d)
+		t.Fail()
+	}
+	if d.SignedHeaders["X-Tenant"] != "other" || !strings.Contains(d.Signable, "x-tenant:other") {
+		LogFail(t, "Diagnosis does not show the signed header values:\n", d)
+		t.Fail()
+	}
+}
+
+func TestVerify(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, _ := NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":      "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce":   "d1954337-5319-4821-8427-115542e08d10",
+		"realm":   "Pipet service",
+		"headers": "X-Tenant;X-Trace",
+	}
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133", nil)
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("X-Trace", "1")
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	res, err := signers.Verify(signer, req, secret)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if res.KeyID != authHeaders["id"] || res.Realm != "Pipet service" || res.Version != 2 || res.Nonce != authHeaders["nonce"] ||
+		res.Timestamp.Unix() != 1432075982 || strings.Join(res.SignedHeaders, ";") != "X-Tenant;X-Trace" {
+		LogFail(t, "Unexpected verification result: ", res)
+		t.Fail()
+	}
+	if _, err := signers.Verify(signer, req, "c2VjcmV0"); err == nil {
+		LogFail(t, "Expected verification with the wrong secret to fail.")
+		t.Fail()
+	}
+}
+
+func TestPrecheck(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	signer, _ := NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(`{"a":1}`))
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	auth := req.Header.Get("Authorization")
+	// None of these may touch the body.
+	req.Body = unreadableBody{}
+	req.GetBody = nil
+	cases := map[string]func(){
+		"outdated timestamp": func() {
+			req.Header.Set("X-Authorization-Timestamp", "1432070000")
+		},
+		"unsupported version": func() {
+			req.Header.Set("Authorization", strings.Replace(auth, `version="2.0"`, `version="3.0"`, 1))
+		},
+		"truncated signature": func() {
+			req.Header.Set("Authorization", auth[:len(auth)-10]+`"`)
+		},
+		"signature not base64": func() {
+			req.Header.Set("Authorization", strings.Replace(auth, `signature="`, `signature="!`, 1))
+		},
+	}
+	for name, tamper := range cases {
+		req.Header.Set("Authorization", auth)
+		req.Header.Set("X-Authorization-Timestamp", "1432075982")
+		tamper()
+		if err := signer.Check(req, secret); err == nil || err.HttpStatus != 403 {
+			LogFail(t, "Expected request with ", name, " to be rejected before reading the body, got ", err)
+			t.Fail()
+		}
+	}
+}
+
+func TestAuthorizationHeader(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	signer, _ := NewV2Signer(sha256.New)
+	signer.AuthorizationHeader = "X-Acquia-Authorization"
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	if req.Header.Get("Authorization") != "Basic dXNlcjpwYXNz" || req.Header.Get("X-Acquia-Authorization") == "" {
+		LogFail(t, "Expected the signature in X-Acquia-Authorization only, got headers ", req.Header)
+		t.Fail()
+	}
+	if err := signer.Check(req, secret); err != nil {
+		LogFail(t, "Failed to check a signature in an alternate header: ", err.Message)
+		t.Fail()
+	}
+	if standard, _ := NewV2Signer(sha256.New); standard.Check(req, secret) == nil {
+		LogFail(t, "Expected a signer reading Authorization to reject the request")
+		t.Fail()
+	}
+
+	rw := signers.NewDummySignableResponseWriter([]byte("ok"))
+	if err := signer.GetResponseSigner().SignResponseDirect(req, rw, secret); err != nil {
+		LogFail(t, "Failed to sign the response to a request signed in an alternate header: ", err.Message)
+		t.Fail()
+	}
+}
+
+func TestTimestampHeader(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	signer, _ := NewV2Signer(sha256.New)
+	signer.Timestamps = &signers.TimestampValidator{Header: "X-Acquia-Timestamp"}
+	signer.Profile = Strict
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	if req.Header.Get("X-Acquia-Timestamp") != "1432075982" || req.Header.Get("X-Authorization-Timestamp") != "" {
+		LogFail(t, "Expected the timestamp in X-Acquia-Timestamp only, got headers ", req.Header)
+		t.Fail()
+	}
+	if err := signer.Check(req, secret); err != nil {
+		LogFail(t, "Failed to check a signature timestamped in an alternate header: ", err.Message)
+		t.Fail()
+	}
+	if _, err := signer.Verify(req, secret); err != nil {
+		LogFail(t, "Failed to verify a signature timestamped in an alternate header: ", err.Message)
+		t.Fail()
+	}
+	rw := signers.NewDummySignableResponseWriter([]byte("ok"))
+	if err := signer.GetResponseSigner().SignResponseDirect(req, rw, secret); err != nil {
+		LogFail(t, "Failed to sign the response to a request timestamped in an alternate header: ", err.Message)
+		t.Fail()
+	}
+	req.Header.Set("X-Acquia-Timestamp", "1432075983")
+	if err := signer.Check(req, secret); err == nil || err.ErrorType != signers.ErrorTypeSignatureMismatch {
+		LogFail(t, "Expected the alternate timestamp header to be signed.")
+		t.Fail()
+	}
+	if standard, _ := NewV2Signer(sha256.New); standard.Check(req, secret) == nil {
+		LogFail(t, "Expected a signer reading X-Authorization-Timestamp to reject the request")
+		t.Fail()
+	}
+}
+
+// Run with -race: one signer and one authorization header map are shared by concurrent requests.
+func TestConcurrentUse(t *testing.T) {
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	signer, _ := NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	errs := make(chan *signers.AuthenticationError, 16)
+	for i := 0; i < 16; i++ {
+		go func(i int) {
+			req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(fmt.Sprintf(`{"task":%d}`, i)))
+			req.Header.Set("Content-Type", "application/json")
+			if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+				errs <- err
+				return
+			}
+			errs <- signer.Check(req, secret)
+		}(i)
+	}
+	for i := 0; i < 16; i++ {
+		if err := <-errs; err != nil {
+			LogFail(t, "Failed to sign and check a request concurrently: ", err.Message)
+			t.Fail()
+		}
+	}
+	if len(authHeaders) != 3 {
+		LogFail(t, "Expected the authorization header map to be left untouched, got ", authHeaders)
+		t.Fail()
+	}
+}
+
+func TestMatchAuthorization(t *testing.T) {
+	signer, _ := NewV2Signer(sha256.New)
+	for _, auth := range []string{
+		`acquia-http-hmac id="efdde334-fe7b-11e4-a322-1697f925ec7b",nonce="d1954337-5319-4821-8427-115542e08d10",realm="Pipet%20service",signature="MRlPr/Z1WQY2sMthcaEqETRMw4gPYXlPcTpaLWS2gcc=",version="2.0"`,
+		`  ACQUIA-HTTP-HMAC VERSION="2.0",id="x"`,
+		`acquia-http-hmac id="x",version="1.0"`,
+		`acquia-http-hmac id="x",`,
+		"acquia-http-hmac id=\"x\"\n,version=\"2.0\"",
+		`Acquia efdde334-fe7b-11e4-a322-1697f925ec7b:6DQcBYwaKdhRm/eNBKIN2jM8HF8=`,
+		`version="2.0"`,
+		``,
+	} {
+		if got, want := signer.MatchAuthorization(auth), identificationRegex.MatchString(auth); got != want {
+			LogFail(t, "MatchAuthorization(", auth, ") = ", got, ", but the identification regex gives ", want)
+			t.Fail()
+		}
+	}
+}
+
+func TestParseAuthHeaders(t *testing.T) {
+	cases := map[string]map[string]string{
+		`acquia-http-hmac id="a",nonce="b", realm="Pipet%20service",signature="c+d=",version="2.0"`: {"id": "a", "nonce": "b", "realm": "Pipet service", "signature": "c+d=", "version": "2.0"},
+		`acquia-http-hmac realm="a,b" , id="x"`:                                                     {"realm": "a,b", "id": "x"},
+		`acquia-http-hmac realm=Plexus, id="x"`:                                                     {"realm": "Plexus", "id": "x"},
+		`acquia-http-hmac x-vendor="1",realm="say \"hi\", ok",id="x\\y"`:                            {"x-vendor": "1", "realm": `say "hi", ok`, "id": `x\y`},
+		`acquia-http-hmac realm="a"b,id="x"`:                                                        {},
+		`acquia-http-hmac realm="unterminated`:                                                      {},
+		`acquia-http-hmac id`:                                                                       {},
+		`acquia-http-hmac id="a",id="b"`:                                                            {},
+		`acquia-http-hmac id="a%zz"`:                                                                {},
+		`Bearer id="a"`:                                                                             {},
+		`acquia-http-hmac`:                                                                          {},
+	}
+	for auth, expected := range cases {
+		got := parseAuthorization(auth)
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			LogFail(t, "Parsing ", auth, " gave ", got, ", expected ", expected)
+			t.Fail()
+		}
+	}
+}
+
+var benchmarkAuthorization = `acquia-http-hmac headers="x-custom-tenant",id="efdde334-fe7b-11e4-a322-1697f925ec7b",nonce="d1954337-5319-4821-8427-115542e08d10",realm="Pipet%20service",signature="MRlPr/Z1WQY2sMthcaEqETRMw4gPYXlPcTpaLWS2gcc=",version="2.0"`
+
+func BenchmarkParseAuthHeaders(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		parseAuthorization(benchmarkAuthorization)
+	}
+}
+
+func BenchmarkMatchAuthorization(b *testing.B) {
+	signer, _ := NewV2Signer(sha256.New)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		signer.MatchAuthorization(benchmarkAuthorization)
+	}
+}
+
+func BenchmarkIdentificationRegex(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		identificationRegex.MatchString(benchmarkAuthorization)
+	}
+}
+
+func TestMissingSignedHeader(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	signer, _ := NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":      "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce":   "d1954337-5319-4821-8427-115542e08d10",
+		"realm":   "Pipet service",
+		"headers": "X-Custom-Signer1;X-Custom-Signer2",
+	}
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	req.Header.Set("X-Custom-Signer1", "custom-1")
+	if err := signer.SignDirect(req, authHeaders, secret); err == nil || err.ErrorType != signers.ErrorTypeMissingSignedHeader {
+		LogFail(t, "Expected signing to fail on a missing signed header, got ", err)
+		t.Fail()
+	}
+
+	lenient, _ := NewV2Signer(sha256.New)
+	lenient.AllowMissingSignedHeaders = true
+	if err := lenient.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	if err := lenient.Check(req, secret); err != nil {
+		LogFail(t, "Failed to check a signature with a missing signed header when allowed: ", err.Message)
+		t.Fail()
+	}
+	for name, check := range map[string]func() *signers.AuthenticationError{
+		"Check": func() *signers.AuthenticationError { return signer.Check(req, secret) },
+		"CheckDeferred": func() *signers.AuthenticationError {
+			_, err := signer.CheckDeferred(req, secret)
+			return err
+		},
+	} {
+		if err := check(); err == nil || err.HttpStatus != 403 || err.ErrorType != signers.ErrorTypeMissingSignedHeader {
+			LogFail(t, name, " accepted a request missing a signed header: ", err)
+			t.Fail()
+		}
+	}
+
+	req.Header.Set("X-Custom-Signer2", "")
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		LogFail(t, "Failed to sign a request with an empty signed header: ", err.Message)
+		t.Fail()
+	}
+	if err := signer.Check(req, secret); err != nil {
+		LogFail(t, "Failed to check a request with an empty signed header: ", err.Message)
+		t.Fail()
+	}
+}
+
+type failingReader struct {
+	err error
+}
+
+func (f failingReader) Read(p []byte) (int, error) {
+	return 0, f.err
+}
+
+func TestErrorCause(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	signer, _ := NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	cause := errors.New("connection reset")
+	req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", ioutil.NopCloser(failingReader{cause}))
+	err := signer.SignDirect(req, authHeaders, secret)
+	if err == nil || !errors.Is(err.Unwrap(), cause) {
+		LogFail(t, "Expected the read error as the cause, got ", err)
+		t.Fail()
+	} else if !errors.Is(err.ToError(), cause) {
+		LogFail(t, "Expected ToError to wrap the cause of ", err.Message)
+		t.Fail()
+	}
+
+	req, _ = http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	if err := signer.SignDirect(req, authHeaders, "not base64!"); err == nil || err.Cause == nil {
+		LogFail(t, "Expected the decoding error as the cause, got ", err)
+		t.Fail()
+	}
+	if err := signers.Errorf(403, signers.ErrorTypeSignatureMismatch, "Signature does not match expected signature."); err.Unwrap() != nil {
+		LogFail(t, "Expected no cause for ", err.Message)
+		t.Fail()
+	}
+}
+
+func TestOptionalRealm(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+	}
+	strict, _ := NewV2Signer(sha256.New)
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	if err := strict.SignDirect(req, authHeaders, secret); err == nil || err.ErrorType != signers.ErrorTypeInvalidAuthHeader {
+		LogFail(t, "Expected signing without a realm to fail by default, got ", err)
+		t.Fail()
+	}
+
+	signer, _ := NewV2Signer(sha256.New)
+	signer.OptionalRealm = true
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	if auth := req.Header.Get("Authorization"); strings.Contains(auth, "realm") {
+		LogFail(t, "Expected no realm in the authorization header, got ", auth)
+		t.Fail()
+	}
+	if err := signer.Check(req, secret); err != nil {
+		LogFail(t, "Failed to check a signature without a realm: ", err.Message)
+		t.Fail()
+	}
+	if err := strict.Check(req, secret); err == nil {
+		LogFail(t, "Expected a signature without a realm to be rejected by default")
+		t.Fail()
+	}
+
+	// A missing realm is signed as an empty one.
+	withEmpty := signers.CopyAuthHeaders(authHeaders)
+	withEmpty["realm"] = ""
+	a, _ := signer.Sign(req, authHeaders, secret)
+	b, _ := strict.Sign(req, withEmpty, secret)
+	if a == "" || a != b {
+		LogFail(t, "Expected a missing realm to be signed as an empty realm, got ", a, " and ", b)
+		t.Fail()
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	compatible, _ := NewV2Signer(sha256.New)
+	strict, _ := NewV2Signer(sha256.New)
+	strict.Profile = Strict
+
+	// A bodyless POST signed by a compatible client lacks the content hash.
+	req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", nil)
+	if err := compatible.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	if err := compatible.Check(req, secret); err != nil {
+		LogFail(t, "Failed to check a bodyless POST: ", err.Message)
+		t.Fail()
+	}
+	if err := strict.Check(req, secret); err == nil || err.ErrorType != signers.ErrorTypeMissingRequiredHeader {
+		LogFail(t, "Expected a bodyless POST without content hash to be rejected by the strict profile, got ", err)
+		t.Fail()
+	}
+	// Signed by a strict client, it carries the hash of the empty body and verifies with both profiles.
+	req, _ = http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", nil)
+	if err := strict.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	if got := req.Header.Get("X-Authorization-Content-Sha256"); got != strict.HashBytes(nil) {
+		LogFail(t, "Expected the hash of the empty body, got ", got)
+		t.Fail()
+	}
+	for _, signer := range []*V2Signer{compatible, strict} {
+		if err := signer.Check(req, secret); err != nil {
+			LogFail(t, "Failed to check a bodyless POST with content hash: ", err.Message)
+			t.Fail()
+		}
+	}
+	req.Header.Set("X-Authorization-Content-Sha256", "Zm9v")
+	if err := strict.Check(req, secret); err == nil {
+		LogFail(t, "Expected a wrong hash of the empty body to be rejected")
+		t.Fail()
+	}
+
+	// A body without Content-Type.
+	req, _ = http.NewRequest("PUT", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(`{"method":"hi.bob"}`))
+	if err := compatible.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	if err := compatible.Check(req, secret); err != nil {
+		LogFail(t, "Failed to check a body without Content-Type: ", err.Message)
+		t.Fail()
+	}
+	if err := strict.Check(req, secret); err == nil || err.ErrorType != signers.ErrorTypeMissingRequiredHeader {
+		LogFail(t, "Expected a body without Content-Type to be rejected by the strict profile, got ", err)
+		t.Fail()
+	}
+
+	// An unsigned X-Authorization-* header, and the same header signed.
+	req, _ = http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133", nil)
+	req.Header.Set("X-Authorization-Scope", "admin")
+	if err := compatible.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	if err := compatible.Check(req, secret); err != nil {
+		LogFail(t, "Failed to check a request with an unsigned header: ", err.Message)
+		t.Fail()
+	}
+	if err := strict.Check(req, secret); err == nil || err.ErrorType != signers.ErrorTypeInvalidRequiredHeader {
+		LogFail(t, "Expected an unsigned X-Authorization-* header to be rejected by the strict profile, got ", err)
+		t.Fail()
+	}
+	withHeaders := signers.CopyAuthHeaders(authHeaders)
+	withHeaders["headers"] = "X-Authorization-Scope"
+	if err := compatible.SignDirect(req, withHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	if err := strict.Check(req, secret); err != nil {
+		LogFail(t, "Failed to check a request with a signed X-Authorization-* header: ", err.Message)
+		t.Fail()
+	}
+}
+
+func TestContentHashDigest(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	body := `{"method":"hi.bob","params":["5","4","8"]}`
+	signer, _ := NewV2Signer(sha512.New)
+	if h := signer.ContentHashHeader(); h != "X-Authorization-Content-SHA512" {
+		LogFail(t, "Expected the SHA-512 content hash header, got ", h)
+		t.Fail()
+	}
+	req, _ := http.NewRequest("POST", "http://example.acquiapipet.net/v1.0/task", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	sum := sha512.Sum512([]byte(body))
+	if got := req.Header.Get("X-Authorization-Content-SHA512"); got != base64.StdEncoding.EncodeToString(sum[:]) {
+		LogFail(t, "Expected the SHA-512 digest of the body, got ", got)
+		t.Fail()
+	}
+	if got := req.Header.Get("X-Authorization-Content-SHA256"); got != "" {
+		LogFail(t, "Expected no SHA-256 content hash, got ", got)
+		t.Fail()
+	}
+	if err := signer.Check(req, secret); err != nil {
+		LogFail(t, "Failed to check a SHA-512 content hash: ", err.Message)
+		t.Fail()
+	}
+	deferred := req.Clone(req.Context())
+	deferred.Body = ioutil.NopCloser(strings.NewReader(body))
+	bv, err := signer.CheckDeferred(deferred, secret)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if err := bv.Verify(); err != nil {
+		LogFail(t, "Failed to verify a SHA-512 content hash while reading: ", err.Message)
+		t.Fail()
+	}
+
+	// A SHA-256 verifier does not ignore the SHA-512 hash, nor a SHA-512 verifier the SHA-256 one.
+	sha256Signer, _ := NewV2Signer(sha256.New)
+	if err := sha256Signer.Check(req, secret); err == nil || err.ErrorType != signers.ErrorTypeInvalidRequiredHeader {
+		LogFail(t, "Expected a SHA-512 content hash to be rejected by a SHA-256 verifier, got ", err)
+		t.Fail()
+	}
+	req.Header.Set("X-Authorization-Content-SHA256", "6paRNxUA7WawFxJpRp4cEixDjHq3jfIKX072k9slalo=")
+	if err := signer.Check(req, secret); err == nil || err.ErrorType != signers.ErrorTypeInvalidRequiredHeader {
+		LogFail(t, "Expected a SHA-256 content hash to be rejected by a SHA-512 verifier, got ", err)
+		t.Fail()
+	}
+}
+
+func TestVerifyResponse(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	signer, _ := NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	body := `{"id": 133, "status": "done"}`
+	rsig, err := signer.GetResponseSigner().SignResponse(req, signers.NewDummySignableResponseWriter([]byte(body)), secret)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	response := func(header, trailer http.Header, body string) *http.Response {
+		return &http.Response{
+			StatusCode: 200,
+			Header:     header,
+			Trailer:    trailer,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}
+	}
+	signed := http.Header{"X-Server-Authorization-Hmac-Sha256": {rsig}}
+
+	resp := response(signed, nil, body)
+	if err := VerifyResponse(req, resp, secret); err != nil {
+		LogFail(t, "Failed to verify a signed response: ", err.Message)
+		t.Fail()
+	}
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != body {
+		LogFail(t, "Expected the body to be readable after verification, got ", string(b))
+		t.Fail()
+	}
+	if err := VerifyResponse(nil, response(http.Header{}, signed, body), secret); err != nil {
+		LogFail(t, "Failed to verify a response signed in a trailer, for the request of the response: ", err.Message)
+		t.Fail()
+	}
+	if err := VerifyResponse(req, response(signed, nil, `{"id": 133, "status": "failed"}`), secret); err == nil || err.ErrorType != signers.ErrorTypeSignatureMismatch {
+		LogFail(t, "Expected a tampered response to be rejected, got ", err)
+		t.Fail()
+	}
+	if err := VerifyResponse(req, response(http.Header{}, nil, body), secret); err == nil || err.ErrorType != signers.ErrorTypeInvalidAuthHeader {
+		LogFail(t, "Expected an unsigned response to be rejected, got ", err)
+		t.Fail()
+	}
+}
+
+func TestExtendedResponseSignature(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	signer, _ := NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	extended := NewV2ResponseSigner(sha256.New)
+	extended.Extended = true
+	extended.Headers = []string{"Location", "Content-Type"}
+
+	body := `{"id": 134}`
+	rw := signers.NewDummySignableResponseWriter([]byte(body))
+	rw.Header().Set("Location", "/v1.0/task/134")
+	rw.WriteHeader(201)
+	if err := extended.SignResponseDirect(req, rw, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	if ct := rw.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		LogFail(t, "Expected the sniffed Content-Type to be set and signed, got ", ct)
+		t.Fail()
+	}
+	plain, _ := NewV2ResponseSigner(sha256.New).SignResponse(req, rw, secret)
+	if plain == rw.Header().Get("X-Server-Authorization-HMAC-SHA256") {
+		LogFail(t, "Expected the extended signature to differ from that of the body only")
+		t.Fail()
+	}
+	response := func(status int, location string) *http.Response {
+		header := http.Header{}
+		for k, v := range rw.Header() {
+			header[k] = v
+		}
+		header.Set("Location", location)
+		return &http.Response{
+			StatusCode: status,
+			Header:     header,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}
+	}
+	if err := extended.Check(req, response(201, "/v1.0/task/134"), secret); err != nil {
+		LogFail(t, "Failed to check an extended response signature: ", err.Message)
+		t.Fail()
+	}
+	if err := extended.Check(req, response(200, "/v1.0/task/134"), secret); err == nil {
+		LogFail(t, "Expected an altered status code to be rejected")
+		t.Fail()
+	}
+	if err := extended.Check(req, response(201, "/v1.0/task/1"), secret); err == nil {
+		LogFail(t, "Expected an altered signed header to be rejected")
+		t.Fail()
+	}
+	if err := VerifyResponse(req, response(201, "/v1.0/task/134"), secret); err == nil {
+		LogFail(t, "Expected an extended signature to be rejected by a verifier of the body only")
+		t.Fail()
+	}
+}
+
+func TestStreamingResponseSignature(t *testing.T) {
+	signers.OverrideClock(1432075982)
+	defer signers.RestoreClock()
+	secret := "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+	signer, _ := NewV2Signer(sha256.New)
+	authHeaders := map[string]string{
+		"id":    "efdde334-fe7b-11e4-a322-1697f925ec7b",
+		"nonce": "d1954337-5319-4821-8427-115542e08d10",
+		"realm": "Pipet service",
+	}
+	req, _ := http.NewRequest("GET", "http://example.acquiapipet.net/v1.0/task-status/133?limit=10", nil)
+	if err := signer.SignDirect(req, authHeaders, secret); err != nil {
+		t.Fatal(err.Message)
+	}
+	chunks := []string{`{"id": 133, `, `"status": `, `"done"}`}
+
+	for _, extended := range []bool{false, true} {
+		rs := NewV2ResponseSigner(sha256.New)
+		rs.Extended = extended
+		rs.Headers = []string{"Content-Type"}
+		rec := httptest.NewRecorder()
+		rw := signers.NewStreamingResponseWriter(rec, func(rw *signers.SignableResponseWriter) (hash.Hash, *signers.AuthenticationError) {
+			return rs.StartResponse(req, rw, secret)
+		})
+		rw.WriteHeader(202)
+		for _, c := range chunks {
+			rw.Write([]byte(c))
+			if rec.Body.String() == "" {
+				LogFail(t, "Expected the response to be written through")
+				t.Fail()
+			}
+		}
+		rw.Close()
+		if rw.Body.Len() != 0 || rec.Code != 202 {
+			LogFail(t, "Expected the body to be streamed with status 202, got ", rw.Body.Len(), " bytes buffered and status ", rec.Code)
+			t.Fail()
+		}
+		sig, err := rs.SignResponse(req, rw, secret)
+		if err != nil {
+			t.Fatal(err.Message)
+		}
+		resp := rec.Result()
+		resp.Header.Set("X-Server-Authorization-HMAC-SHA256", sig)
+		if err := rs.Check(req, resp, secret); err != nil {
+			LogFail(t, "Failed to check a streamed response signature, extended ", extended, ": ", err.Message)
+			t.Fail()
+		}
+	}
+}
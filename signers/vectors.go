@@ -0,0 +1,158 @@
+package signers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Vectors is the language-neutral JSON form of Fixtures and CompatFixtures, for other implementations of
+// the specification to run the same test vectors. The format is documented in testdata/vectors.md.
+type Vectors struct {
+	Signatures    []*SignatureVector     `json:"signatures"`
+	Compatibility []*CompatibilityVector `json:"compatibility"`
+}
+
+// VectorRequest is a request to sign or verify.
+type VectorRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// The Host header, if it differs from the host of the URL.
+	Host    string              `json:"host,omitempty"`
+	Headers map[string][]string `json:"headers"`
+	Body    string              `json:"body"`
+}
+
+// SignatureVector is a request signed with one version of the specification, and the expected outcome.
+type SignatureVector struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Digest  string `json:"digest"`
+	// The current time of the signer, in seconds since the epoch.
+	SystemTime int64             `json:"system_time"`
+	Secret     string            `json:"secret"`
+	AuthParams map[string]string `json:"auth_params"`
+	Request    *VectorRequest    `json:"request"`
+	// Empty where not verified by the vector.
+	Expectations struct {
+		Signature           string `json:"signature,omitempty"`
+		AuthorizationHeader string `json:"authorization_header,omitempty"`
+		// Error code of a request that must be rejected, as in the error responses of the middleware.
+		Error             string `json:"error,omitempty"`
+		ResponseBody      string `json:"response_body,omitempty"`
+		ResponseSignature string `json:"response_signature,omitempty"`
+	} `json:"expectations"`
+}
+
+// CompatibilityVector is a signed request whose version must be identified from its Authorization header.
+type CompatibilityVector struct {
+	Name       string         `json:"name"`
+	Digest     string         `json:"digest"`
+	SystemTime int64          `json:"system_time"`
+	Secret     string         `json:"secret"`
+	Request    *VectorRequest `json:"request"`
+	// The signature computed by the identified signer, or empty if no version must match.
+	ExpectedSignature string `json:"expected_signature"`
+}
+
+func vectorRequest(req *http.Request) (*VectorRequest, error) {
+	body, err := ReadBody(req)
+	if err != nil {
+		return nil, err
+	}
+	ret := &VectorRequest{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: map[string][]string{},
+		Body:    string(body),
+	}
+	if req.Host != req.URL.Host {
+		ret.Host = req.Host
+	}
+	for k, v := range req.Header {
+		ret.Headers[k] = append([]string{}, v...)
+	}
+	return ret, nil
+}
+
+// NewVectors converts fixtures into vectors, one for each version a fixture is expected to sign or reject.
+func NewVectors(fixtures []*TestFixture, compat []*CompatibilityTestFixture) (*Vectors, error) {
+	ret := &Vectors{
+		Signatures:    []*SignatureVector{},
+		Compatibility: []*CompatibilityVector{},
+	}
+	for _, f := range fixtures {
+		req, err := vectorRequest(f.Request)
+		if err != nil {
+			return nil, err
+		}
+		versions := map[string]bool{}
+		for k := range f.Expected {
+			versions[k] = true
+		}
+		for k, e := range f.ErrorType {
+			if e != ErrorTypeNoError {
+				versions[k] = true
+			}
+		}
+		sorted := []string{}
+		for k := range versions {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, version := range sorted {
+			v := &SignatureVector{
+				Name:       f.TestName,
+				Version:    version,
+				Digest:     DigestName(f.Digest),
+				SystemTime: f.SystemTime,
+				Secret:     f.SecretKey,
+				AuthParams: CopyAuthHeaders(f.AuthHeaders),
+				Request:    req,
+			}
+			v.Expectations.Signature = f.Expected[version]
+			v.Expectations.AuthorizationHeader = f.ExpectedHeader[version]
+			if e, ok := f.ErrorType[version]; ok && e != ErrorTypeNoError {
+				v.Expectations.Error = strings.Replace(GetErrorTypeText(e), " ", "_", -1)
+			}
+			if f.Response != nil && f.Response.Expected[version] != "" {
+				v.Expectations.ResponseBody = f.Response.Response.Body.String()
+				v.Expectations.ResponseSignature = f.Response.Expected[version]
+			}
+			ret.Signatures = append(ret.Signatures, v)
+		}
+	}
+	for _, c := range compat {
+		req, err := vectorRequest(c.Request)
+		if err != nil {
+			return nil, err
+		}
+		ret.Compatibility = append(ret.Compatibility, &CompatibilityVector{
+			Name:              c.TestName,
+			Digest:            DigestName(c.Digest),
+			SystemTime:        c.SystemTime,
+			Secret:            c.SecretKey,
+			Request:           req,
+			ExpectedSignature: c.Expected,
+		})
+	}
+	return ret, nil
+}
+
+// MarshalVectors returns the vectors of the fixtures as indented JSON.
+func MarshalVectors(fixtures []*TestFixture, compat []*CompatibilityTestFixture) ([]byte, error) {
+	v, err := NewVectors(fixtures, compat)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,167 @@
+// Package webhook signs payloads delivered to third parties and verifies inbound deliveries. Deliveries
+// carry the sender key ID, a timestamp, a unique delivery ID and an HMAC over those and the payload in
+// headers, so the receiver needs nothing but the shared secret to authenticate them. Secrets follow the
+// v2 conventions (base64 encoded) and may be kept in the same key Provider as request signing keys.
+package webhook
+
+import (
+	"crypto/hmac"
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/nonce"
+	"github.com/acquia/http-hmac-go/signers"
+	"github.com/acquia/http-hmac-go/signers/v2"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Payloads beyond this size are rejected by Verify.
+const MaxPayloadLength = 10 << 20
+
+// Signable returns the message signed for a delivery.
+func Signable(id string, timestamp string, delivery string, payload []byte) string {
+	var b strings.Builder
+	b.WriteString(id)
+	b.WriteString("\n")
+	b.WriteString(timestamp)
+	b.WriteString("\n")
+	b.WriteString(delivery)
+	b.WriteString("\n")
+	b.Write(payload)
+	return b.String()
+}
+
+// Signer signs outbound deliveries with a single key.
+type Signer struct {
+	ID     string
+	Secret string
+	// Generates delivery IDs. Defaults to nonce.UUIDv4.
+	Deliveries nonce.Source
+	// Source of delivery timestamps. Defaults to the package clock.
+	Clock signers.Clock
+}
+
+func NewSigner(id string, secret string) *Signer {
+	return &Signer{
+		ID:     id,
+		Secret: secret,
+	}
+}
+
+// Sign returns the headers authenticating a delivery of payload, with a fresh timestamp and delivery ID.
+func (s *Signer) Sign(payload []byte) (http.Header, *signers.AuthenticationError) {
+	deliveries := s.Deliveries
+	if deliveries == nil {
+		deliveries = nonce.UUIDv4
+	}
+	delivery, err := deliveries.Nonce()
+	if err != nil {
+		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not generate delivery ID: %w", err)
+	}
+	timestamp := strconv.FormatInt(signers.NowFrom(s.Clock).Unix(), 10)
+	sig, serr := v2.SignString(s.Secret, Signable(s.ID, timestamp, delivery, payload))
+	if serr != nil {
+		return nil, serr
+	}
+	h := http.Header{}
+	h.Set(HeaderID, s.ID)
+	h.Set(HeaderTimestamp, timestamp)
+	h.Set(HeaderDelivery, delivery)
+	h.Set(HeaderSignature, sig)
+	return h, nil
+}
+
+// NewRequest creates a POST request delivering payload to url, with the signature headers set.
+func (s *Signer) NewRequest(url string, contentType string, payload []byte) (*http.Request, *signers.AuthenticationError) {
+	req, err := http.NewRequest("POST", url, strings.NewReader(string(payload)))
+	if err != nil {
+		return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not create request: %w", err)
+	}
+	h, serr := s.Sign(payload)
+	if serr != nil {
+		return nil, serr
+	}
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
+}
+
+// Verifier authenticates inbound deliveries.
+type Verifier struct {
+	Keys keys.Provider
+	// Realm passed to the key provider.
+	Realm string
+	// Records delivery IDs to reject replayed deliveries. Replay protection is disabled if nil.
+	Nonces nonce.Store
+	// Validates the delivery timestamp. Defaults to a 15 minute tolerance on Clock.
+	Timestamps *signers.TimestampValidator
+	// Source of the current time. Defaults to the package clock.
+	Clock signers.Clock
+}
+
+func NewVerifier(provider keys.Provider) *Verifier {
+	return &Verifier{
+		Keys:   provider,
+		Nonces: nonce.NewMemoryStore(100000),
+	}
+}
+
+func (v *Verifier) timestamps() *signers.TimestampValidator {
+	if v.Timestamps == nil {
+		return &signers.TimestampValidator{
+			Header: HeaderTimestamp,
+			Clock:  v.Clock,
+		}
+	}
+	return v.Timestamps
+}
+
+// Verify authenticates a delivery and returns its payload. The request body is consumed.
+func (v *Verifier) Verify(req *http.Request) ([]byte, *signers.AuthenticationError) {
+	for _, name := range []string{HeaderID, HeaderTimestamp, HeaderDelivery, HeaderSignature} {
+		if req.Header.Get(name) == "" {
+			return nil, signers.Errorf(403, signers.ErrorTypeMissingRequiredHeader, "Missing required header %s.", name)
+		}
+	}
+	id := req.Header.Get(HeaderID)
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(nil, req.Body, MaxPayloadLength))
+	if err != nil {
+		return nil, signers.Errorf(400, signers.ErrorTypeInternalError, "Failed to read webhook payload: %w", err)
+	}
+	secret, serr := v.Keys.GetSecret(v.Realm, id)
+	if serr != nil {
+		return nil, serr
+	}
+	timestamp := req.Header.Get(HeaderTimestamp)
+	if _, serr := v.timestamps().Validate(timestamp); serr != nil {
+		return nil, serr
+	}
+	delivery := req.Header.Get(HeaderDelivery)
+	expected, serr := v2.SignString(secret, Signable(id, timestamp, delivery, payload))
+	if serr != nil {
+		return nil, serr
+	}
+	if !hmac.Equal([]byte(expected), []byte(req.Header.Get(HeaderSignature))) {
+		return nil, signers.Errorf(403, signers.ErrorTypeSignatureMismatch, "Webhook signature does not match expected signature.")
+	}
+	if v.Nonces != nil {
+		fresh, err := v.Nonces.Add(id+":"+delivery, v.timestamps().NonceTTL())
+		if err != nil {
+			return nil, signers.Errorf(500, signers.ErrorTypeInternalError, "Could not record delivery ID: %w", err)
+		}
+		if !fresh {
+			return nil, signers.Errorf(403, signers.ErrorTypeReplayedRequest, "Delivery %s has already been received.", delivery)
+		}
+	}
+	return payload, nil
+}
@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"github.com/acquia/http-hmac-go/keys"
+	"github.com/acquia/http-hmac-go/signers"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const (
+	testID     = "efdde334-fe7b-11e4-a322-1697f925ec7b"
+	testSecret = "W5PeGMxSItNerkNFqQMfYiJvH14WzVJMy54CPoTAYoI="
+)
+
+func delivery(t *testing.T, payload string) *http.Request {
+	req, err := NewSigner(testID, testSecret).NewRequest("http://example.com/hooks", "application/json", []byte(payload))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	return req
+}
+
+// Simulates the receiving end, which gets a fresh copy of the request.
+func received(req *http.Request, payload string) *http.Request {
+	r, _ := http.NewRequest(req.Method, req.URL.String(), strings.NewReader(payload))
+	r.Header = req.Header.Clone()
+	return r
+}
+
+func TestWebhook(t *testing.T) {
+	payload := `{"event":"task.done","id":133}`
+	req := delivery(t, payload)
+	v := NewVerifier(keys.Static{testID: testSecret})
+
+	got, err := v.Verify(received(req, payload))
+	if err != nil {
+		t.Fatal("Failed to verify delivery: ", err.Message)
+	}
+	if string(got) != payload {
+		t.Errorf("Expected payload %q, got %q.", payload, got)
+	}
+
+	if _, err := v.Verify(received(req, payload)); err == nil || err.ErrorType != signers.ErrorTypeReplayedRequest {
+		t.Error("Expected replayed delivery to be rejected.")
+	}
+
+	req = delivery(t, payload)
+	if _, err := v.Verify(received(req, `{"event":"task.done","id":134}`)); err == nil || err.ErrorType != signers.ErrorTypeSignatureMismatch {
+		t.Error("Expected tampered delivery to be rejected.")
+	}
+
+	req = delivery(t, payload)
+	req.Header.Del(HeaderDelivery)
+	if _, err := v.Verify(received(req, payload)); err == nil || err.ErrorType != signers.ErrorTypeMissingRequiredHeader {
+		t.Error("Expected delivery without ID to be rejected.")
+	}
+
+	signers.OverrideClock(1432075982)
+	req = delivery(t, payload)
+	signers.RestoreClock()
+	if _, err := v.Verify(received(req, payload)); err == nil || err.ErrorType != signers.ErrorTypeTimestampRangeError {
+		t.Error("Expected stale delivery to be rejected.")
+	}
+
+	req = delivery(t, payload)
+	if _, err := NewVerifier(keys.Static{}).Verify(received(req, payload)); err == nil || err.ErrorType != signers.ErrorTypeUnknownKey {
+		t.Error("Expected delivery with unknown key to be rejected.")
+	}
+}